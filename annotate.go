@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// annotation is the comment -annotate puts above txt, ansi-file and html
+// exports, recording what the art was made from so an archived file can be
+// made again.
+type annotation struct {
+	source  string
+	charset string
+}
+
+// header returns the comment for art in the syntax of format: an HTML
+// comment for html and a line starting with # for the text formats.
+func (a *annotation) header(art *imgascii.Art, format string) string {
+	line := fmt.Sprintf("go-img-ascii %s: %s, %dx%d, charset %q", toolVersion(), a.source, art.Width, art.Height, a.charset)
+	if format == "html" {
+		// A comment must not contain --
+		return "<!-- " + strings.ReplaceAll(line, "--", "- -") + " -->\n"
+	}
+	return "# " + line + "\n"
+}
+
+// toolVersion returns the module version of the build. A development build
+// without one is named by the commit it was built from, when recorded.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	if version != "(devel)" {
+		return version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			version += " " + s.Value[:12]
+		}
+	}
+	return version
+}
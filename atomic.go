@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written under a temporary name in the destination directory
+// and only renamed into place by Commit, so readers never see a partially
+// written output even if the process is interrupted. The temporary file is
+// removed should the tool exit on an interrupt signal first.
+type atomicFile struct {
+	*os.File
+	path    string
+	done    bool
+	discard func()
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	f := &atomicFile{File: tmp, path: path}
+	f.discard = onInterrupt(func() { os.Remove(tmp.Name()) })
+	return f, nil
+}
+
+// Commit flushes the file to disk and moves it over the destination path.
+func (f *atomicFile) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	defer f.discard()
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	// CreateTemp uses 0600, so give the output the permissions of the file
+	// it replaces, or those a new file would get under the umask
+	mode := 0o666 &^ umask()
+	if info, err := os.Stat(f.path); err == nil && info.Mode().IsRegular() {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary file. It does nothing after Commit.
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+	f.discard()
+}
+
+// exportFile writes an output file through write, buffered and atomically.
+// Failures are reported on stderr and exit with exitWrite, using failure
+// when write itself fails.
+func exportFile(outputPath, failure string, write func(w io.Writer) error) {
+	file, err := createAtomic(outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", tr("Error: File could not be created"), err)
+		os.Exit(exitWrite)
+	}
+
+	w := bufio.NewWriter(file)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		file.Abort()
+		fmt.Fprintf(os.Stderr, "%s: %v\n", tr(failure), err)
+		os.Exit(exitWrite)
+	}
+
+	if err := file.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", tr("Error: File could not be saved"), err)
+		os.Exit(exitWrite)
+	}
+}
+
+// writeAtomic writes an output file through write, buffered and atomically,
+// like exportFile, but returns failures so the caller can go on with other
+// files.
+func writeAtomic(outputPath string, write func(w io.Writer) error) error {
+	file, err := createAtomic(outputPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/font"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// The values -auto-tune tries for each setting. The charset is tried
+// without up to maxCharsetOffset of its lightest characters, so sparse
+// images can start their ramp on a denser glyph.
+var (
+	tuneContrasts = []float64{0.6, 0.8, 1, 1.25, 1.5, 2}
+	tuneGammas    = []float64{0.5, 0.7, 0.85, 1, 1.2, 1.5, 2}
+)
+
+const maxCharsetOffset = 3
+
+// glyphs is how art is drawn to be scored: with face, and dark on a light
+// background when light is set, as -bg light expects.
+type glyphs struct {
+	face  font.Face
+	light bool
+}
+
+// scorer measures how well art shows the image it was converted from. The
+// art is drawn and compared with the part of the image it shows, both
+// sampled at two by four gray levels per cell, by SSIM.
+type scorer struct {
+	glyphs
+	want []float64
+	w, h int
+}
+
+func newScorer(src image.Image, region image.Rectangle, art *imgascii.Art, opts imgascii.Options, g glyphs) *scorer {
+	s := &scorer{glyphs: g, w: art.Width * 2, h: art.Height * 4}
+	// The source is sampled upright and turned as the art is
+	w, h := s.w, s.h
+	if opts.Orient == 90 || opts.Orient == 270 {
+		w, h = h, w
+	}
+	s.want = turnGray(sampleGray(src, region, w, h), w, h, opts.Orient)
+	return s
+}
+
+// score returns the SSIM of art and the image, from -1 to 1 for identical.
+func (s *scorer) score(art *imgascii.Art) float64 {
+	fg, bg := color.Color(color.White), color.Color(color.Black)
+	if s.light {
+		fg, bg = bg, fg
+	}
+	drawn := art.Image(s.face, fg, bg)
+	return ssim(sampleGray(drawn, drawn.Bounds(), s.w, s.h), s.want, s.w, s.h)
+}
+
+// autoTune searches the contrast, the gamma and the start of the charset
+// for the art scoring highest, changing one setting at a time from opts
+// until no change scores higher. It returns the best options and score.
+func autoTune(c *imgascii.Converter, src image.Image, opts imgascii.Options, g glyphs) (imgascii.Options, float64, error) {
+	art, err := c.ConvertArt(opts)
+	if err != nil {
+		return opts, 0, err
+	}
+	s := newScorer(src, c.SourceRect(), art, opts, g)
+	best, bestScore := opts, s.score(art)
+
+	tried := map[string]bool{fmt.Sprint(opts.Contrast, opts.Gamma, opts.Charset): true}
+	improved := false
+	try := func(o imgascii.Options) error {
+		key := fmt.Sprint(o.Contrast, o.Gamma, o.Charset)
+		if tried[key] {
+			return nil
+		}
+		tried[key] = true
+		art, err := c.ConvertArt(o)
+		if err != nil {
+			return err
+		}
+		if score := s.score(art); score > bestScore {
+			best, bestScore, improved = o, score, true
+		}
+		return nil
+	}
+
+	ramp := []rune(opts.Charset)
+	for round := 0; round < 4; round++ {
+		improved = false
+		for _, v := range tuneContrasts {
+			o := best
+			o.Contrast = v
+			if err := try(o); err != nil {
+				return opts, 0, err
+			}
+		}
+		for _, v := range tuneGammas {
+			o := best
+			o.Gamma = v
+			if err := try(o); err != nil {
+				return opts, 0, err
+			}
+		}
+		for k := 0; k <= maxCharsetOffset && len(ramp)-k >= 2; k++ {
+			o := best
+			o.Charset = string(ramp[k:])
+			if err := try(o); err != nil {
+				return opts, 0, err
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return best, bestScore, nil
+}
+
+// scoreArt returns the SSIM of art, converted by c with opts, and src.
+func scoreArt(c *imgascii.Converter, src image.Image, art *imgascii.Art, opts imgascii.Options, g glyphs) float64 {
+	return newScorer(src, c.SourceRect(), art, opts, g).score(art)
+}
+
+// sampleGray returns the mean luminance of each of w by h equal parts of
+// rect in img, row by row. Parts smaller than a pixel take the pixel they
+// fall on.
+func sampleGray(img image.Image, rect image.Rectangle, w, h int) []float64 {
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		y0 := rect.Min.Y + y*rect.Dy()/h
+		y1 := max(y0+1, rect.Min.Y+(y+1)*rect.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := rect.Min.X + x*rect.Dx()/w
+			x1 := max(x0+1, rect.Min.X+(x+1)*rect.Dx()/w)
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				}
+			}
+			gray[y*w+x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return gray
+}
+
+// turnGray turns a w by h grid clockwise by degrees, as Options.Orient
+// turns the art.
+func turnGray(gray []float64, w, h, degrees int) []float64 {
+	turned := make([]float64, len(gray))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := gray[y*w+x]
+			switch degrees {
+			case 90:
+				turned[x*h+h-1-y] = v
+			case 180:
+				turned[(h-1-y)*w+w-1-x] = v
+			case 270:
+				turned[(w-1-x)*h+y] = v
+			default:
+				turned[y*w+x] = v
+			}
+		}
+	}
+	return turned
+}
+
+// ssim returns the mean structural similarity of two w by h grids of gray
+// levels over windows of 8x8, half a window apart, as Wang et al. define it.
+func ssim(a, b []float64, w, h int) float64 {
+	const c1, c2 = (0.01 * 255) * (0.01 * 255), (0.03 * 255) * (0.03 * 255)
+	size := min(8, w, h)
+	step := max(1, size/2)
+	n := float64(size * size)
+	var total float64
+	windows := 0
+	for y := 0; y+size <= h; y += step {
+		for x := 0; x+size <= w; x += step {
+			var ma, mb float64
+			for wy := y; wy < y+size; wy++ {
+				for wx := x; wx < x+size; wx++ {
+					ma += a[wy*w+wx]
+					mb += b[wy*w+wx]
+				}
+			}
+			ma, mb = ma/n, mb/n
+			var va, vb, cov float64
+			for wy := y; wy < y+size; wy++ {
+				for wx := x; wx < x+size; wx++ {
+					da, db := a[wy*w+wx]-ma, b[wy*w+wx]-mb
+					va += da * da
+					vb += db * db
+					cov += da * db
+				}
+			}
+			va, vb, cov = va/n, vb/n, cov/n
+			total += (2*ma*mb + c1) * (2*cov + c2) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// batchEntry is one conversion of a batch. Zero fields fall back to the
+// flags of the batch command.
+type batchEntry struct {
+	Input  string `json:"input"`
+	Width  int    `json:"w"`
+	Height int    `json:"h"`
+	Crop   string `json:"crop"`
+	Out    string `json:"out"`
+}
+
+// readBatchList reads the entries of a list file, either a JSON array of
+// entries or a CSV file whose header row names the columns.
+func readBatchList(path string) ([]batchEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []batchEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".csv":
+		entries, err = readBatchCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: list files are .csv or .json", path)
+	}
+
+	for i, entry := range entries {
+		if entry.Input == "" {
+			return nil, fmt.Errorf("%s: entry %d has no input", path, i+1)
+		}
+	}
+	return entries, nil
+}
+
+// readBatchCSV reads entries from CSV with the columns input, w, h, crop and
+// out in any order. Only input is required.
+func readBatchCSV(r io.Reader) ([]batchEntry, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "input", "w", "h", "crop", "out":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	if _, ok := columns["input"]; !ok {
+		return nil, fmt.Errorf("no input column")
+	}
+
+	entries := make([]batchEntry, 0, len(records)-1)
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) (int, error) {
+			if field(name) == "" {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(field(name))
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid %s %q", line+2, name, field(name))
+			}
+			return n, nil
+		}
+
+		entry := batchEntry{Input: field("input"), Crop: field("crop"), Out: field("out")}
+		if entry.Width, err = number("w"); err != nil {
+			return nil, err
+		}
+		if entry.Height, err = number("h"); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// runBatch converts every image named on the command line, or listed in a
+// list file with its own overrides, to a file in the output directory.
+func runBatch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	format := fs.String("o", "txt", "Output format: txt or ansi-file or png or svg or pdf or html or json or md, or a renderer registered with imgascii")
+	dir := fs.String("dir", ".", "Directory to write the outputs to")
+	list := fs.String("list", "", "CSV or JSON file listing the inputs, each with its own w, h, crop and out")
+	width := fs.Int("w", 64, "Width to scale the images to")
+	height := fs.Int("h", 0, "Height to scale the images to (default keeps each image's aspect)")
+	var relative relativeSize
+	fs.Var(&relative.scale, "scale", "Size each output to a percentage of its image, as 25%, instead of -w and -h")
+	fs.IntVar(&relative.maxWidth, "max-width", 0, "Largest width, the height following each image's aspect, instead of -w and -h")
+	fs.IntVar(&relative.maxHeight, "max-height", 0, "Largest height, the width following each image's aspect, instead of -w and -h")
+	themeName := fs.String("theme", "light", "Colors for png, svg, pdf and html output: light or dark or solarized or matrix")
+	progress := fs.Bool("progress", false, "Show a progress bar below the per-file status on stderr")
+	jobs := fs.Int("jobs", 1, "Images to convert at once, 0 for one per core")
+	dryRun := fs.Bool("dry-run", false, "Print every input with the path and size of its output, reading only the image headers, without converting or writing anything")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii batch [options] image|directory...")
+		fmt.Fprintln(os.Stderr, "       go-img-ascii batch [options] -list file")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+
+	var entries []batchEntry
+	var listed map[string]bool
+	if *list != "" {
+		if fs.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, tr("batch: give either images or -list, not both"))
+			return exitUsage
+		}
+		var err error
+		if entries, err = readBatchList(*list); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	} else {
+		inputs, fromDirs, err := montageInputs(fs.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		for _, input := range inputs {
+			entries = append(entries, batchEntry{Input: input})
+		}
+		listed = fromDirs
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	if *width < 1 || *height < 0 {
+		fmt.Fprintln(os.Stderr, tr("batch: width must be positive and height must not be negative"))
+		return exitUsage
+	}
+	if *jobs < 0 {
+		fmt.Fprintln(os.Stderr, tr("batch: -jobs must not be negative"))
+		return exitUsage
+	}
+	absolute, themed := false, false
+	fs.Visit(func(f *flag.Flag) {
+		absolute = absolute || f.Name == "w" || f.Name == "h"
+		themed = themed || f.Name == "theme"
+	})
+	if absolute && relative.given() {
+		fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height cannot be combined with -w or -h"))
+		return exitUsage
+	}
+	if relative.maxWidth < 0 || relative.maxHeight < 0 {
+		fmt.Fprintln(os.Stderr, tr("-max-width and -max-height must not be negative"))
+		return exitUsage
+	}
+	th, ok := themes[*themeName]
+	if !ok {
+		fmt.Fprintln(os.Stderr, tr("Invalid theme option. Quitting."))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !themed {
+		th = tintedTheme(th, opts.Tint)
+	}
+
+	// Every format that writes one art to a file works, stdout aside
+	settings := outputSettings{th: th, links: htmlLinks{mode: "none"}, goSrc: goSource{pkg: "main", name: "Art"}, txtSpaces: "keep"}
+	renderers := map[string]imgascii.Renderer{}
+	rendererFor := func(format string) bool {
+		if format == "stdout" {
+			return false
+		}
+		if _, ok := renderers[format]; !ok {
+			r, ok := settings.renderer(format)
+			if !ok {
+				return false
+			}
+			renderers[format] = r
+		}
+		return true
+	}
+	if !rendererFor(*format) {
+		fmt.Fprintln(os.Stderr, tr("Invalid output option. Quitting."))
+		return exitUsage
+	}
+
+	// Everything an entry asks for is checked before anything is written.
+	// Outputs are named after their inputs without the extension unless the
+	// entry names one, so photo.jpg and photo.png would overwrite each other
+	paths := make([]string, len(entries))
+	formats := make([]string, len(entries))
+	crops := make([]image.Rectangle, len(entries))
+	outputs := map[string]string{}
+	for i, entry := range entries {
+		if entry.Width < 0 || entry.Height < 0 {
+			fmt.Fprintf(os.Stderr, tr("batch: %s: width and height must not be negative\n"), entry.Input)
+			return exitUsage
+		}
+		if entry.Crop != "" {
+			if crops[i], err = parseCrop(entry.Crop); err != nil {
+				fmt.Fprintf(os.Stderr, "batch: %s: %v\n", entry.Input, err)
+				return exitUsage
+			}
+		}
+
+		formats[i] = *format
+		if entry.Out != "" {
+			paths[i] = entry.Out
+			if !filepath.IsAbs(paths[i]) {
+				paths[i] = filepath.Join(*dir, paths[i])
+			}
+			if f, ok := outputExtensions[strings.ToLower(filepath.Ext(entry.Out))]; ok {
+				formats[i] = f
+			}
+			if !rendererFor(formats[i]) {
+				fmt.Fprintf(os.Stderr, tr("batch: %s: %s files are not supported\n"), entry.Input, formats[i])
+				return exitUsage
+			}
+		} else {
+			name := strings.TrimSuffix(filepath.Base(entry.Input), filepath.Ext(entry.Input))
+			paths[i] = filepath.Join(*dir, name+"."+outputExtension(*format))
+		}
+
+		if other, dup := outputs[paths[i]]; dup {
+			fmt.Fprintf(os.Stderr, tr("batch: %s and %s would both be written to %s\n"), other, entry.Input, paths[i])
+			return exitUsage
+		}
+		outputs[paths[i]] = entry.Input
+	}
+	if *dryRun {
+		return planBatch(os.Stdout, entries, paths, crops, listed, optionFlags.decodeOptions(), opts.Orient, *width, *height, relative)
+	}
+
+	// The entries of an input are converted together by one worker, so the
+	// image is decoded once and its entries reuse whatever stages they share
+	var groups [][]int
+	group := map[string]int{}
+	for i, entry := range entries {
+		g, ok := group[entry.Input]
+		if !ok {
+			g = len(groups)
+			group[entry.Input] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	// An interrupt lets the conversions under way stop and keeps the rest
+	// from starting. Their temporary files are removed, so no output is
+	// left half written.
+	ctx, done := watchInterrupts()
+	defer done()
+
+	report := &batchReport{bar: newProgressBar(*progress, os.Stderr, "batch"), total: len(entries)}
+	convertGroup := func(indices []int) {
+		input := entries[indices[0]].Input
+		img, err := imgascii.DecodeFileWith(input, optionFlags.decodeOptions())
+		if err != nil {
+			// Directories hold more than images
+			for range indices {
+				if listed[input] && errors.Is(err, image.ErrFormat) {
+					report.skip(input, tr("not an image"))
+				} else {
+					report.fail(input, err)
+				}
+			}
+			return
+		}
+		converter := imgascii.NewConverter(img)
+		for _, i := range indices {
+			if ctx.Err() != nil {
+				return
+			}
+			art, err := convertEntry(ctx, converter, img, entries[i], crops[i], opts, optionFlags, *width, *height, relative)
+			if err == nil {
+				err = writeAtomic(paths[i], func(w io.Writer) error {
+					return renderers[formats[i]].Render(art, w)
+				})
+			}
+			if err != nil && ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				report.fail(input, err)
+				continue
+			}
+			report.written(fmt.Sprintf("%s -> %s %dx%d", input, paths[i], art.Width, art.Height))
+		}
+	}
+
+	workers := *jobs
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(workers, len(groups)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indices := range work {
+				convertGroup(indices)
+			}
+		}()
+	}
+feed:
+	for _, indices := range groups {
+		select {
+		case work <- indices:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	report.summary(os.Stderr)
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, tr("batch: interrupted, %d of %d not converted\n"), report.total-report.done, report.total)
+		return exitInterrupted
+	}
+	if len(report.failed) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// batchReport tracks the outcome of every entry of a batch, printing a
+// status line for each as it finishes and keeping the reasons entries were
+// skipped or failed for the summary. Workers share it.
+type batchReport struct {
+	mu              sync.Mutex
+	bar             *progressBar
+	done, total     int
+	converted       int
+	skipped, failed []string
+}
+
+func (r *batchReport) status(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bar.clear()
+	fmt.Fprintln(os.Stderr, line)
+	r.done++
+	if r.done < r.total {
+		r.bar.update(r.done, r.total)
+	}
+}
+
+func (r *batchReport) written(line string) {
+	r.mu.Lock()
+	r.converted++
+	r.mu.Unlock()
+	r.status(line)
+}
+
+func (r *batchReport) skip(input, reason string) {
+	line := fmt.Sprintf(tr("%s: skipped: %s"), input, reason)
+	r.mu.Lock()
+	r.skipped = append(r.skipped, line)
+	r.mu.Unlock()
+	r.status(line)
+}
+
+func (r *batchReport) fail(input string, err error) {
+	line := fmt.Sprintf(tr("%s: failed: %v"), input, err)
+	r.mu.Lock()
+	r.failed = append(r.failed, line)
+	r.mu.Unlock()
+	r.status(line)
+}
+
+// summary prints the counts, then the entries skipped and failed again
+// with their reasons, which are easily lost among thousands of lines.
+func (r *batchReport) summary(w io.Writer) {
+	fmt.Fprintf(w, tr("batch: %d converted, %d skipped, %d failed\n"), r.converted, len(r.skipped), len(r.failed))
+	for _, line := range r.skipped {
+		fmt.Fprintln(w, "  "+line)
+	}
+	for _, line := range r.failed {
+		fmt.Fprintln(w, "  "+line)
+	}
+}
+
+// convertEntry converts one entry with the batch options and the entry's own
+// size and crop. Relative sizes apply to entries without a size of their own.
+func convertEntry(ctx context.Context, converter *imgascii.Converter, img image.Image, entry batchEntry, crop image.Rectangle,
+	opts imgascii.Options, optionFlags *optionFlags, width, height int, relative relativeSize) (*imgascii.Art, error) {
+	if err := optionFlags.applyFocus(&opts, img); err != nil {
+		return nil, err
+	}
+
+	size, err := entrySize(img.Bounds(), entry, crop, opts.Orient, width, height, relative)
+	if err != nil {
+		return nil, err
+	}
+	if !crop.Empty() {
+		opts.Crop = crop
+	}
+	opts.Width, opts.Height = size.X, size.Y
+	return converter.ConvertArtContext(ctx, opts)
+}
+
+// entrySize returns the size of the art of entry for an image of the given
+// bounds, turned by orientation: the entry's own size, or the relative size
+// or the width and height of the batch, with the height following the
+// aspect of the part converted when none is given.
+func entrySize(bounds image.Rectangle, entry batchEntry, crop image.Rectangle, orientation, width, height int, relative relativeSize) (image.Point, error) {
+	region := bounds
+	if !crop.Empty() {
+		region = crop.Intersect(region)
+		if region.Empty() {
+			return image.Point{}, fmt.Errorf("crop %s is outside the image", entry.Crop)
+		}
+	}
+
+	// Characters are about twice as tall as they are wide
+	region = imgascii.TurnedBounds(region, orientation)
+	size := image.Pt(width, height)
+	if relative.given() && entry.Width == 0 && entry.Height == 0 {
+		size = relative.size(region)
+	}
+	if entry.Width > 0 {
+		size.X = entry.Width
+	}
+	if entry.Height > 0 {
+		size.Y = entry.Height
+	}
+	if size.Y == 0 {
+		size.Y = max(1, size.X*region.Dy()/region.Dx()/2)
+	}
+	return size, nil
+}
+
+// planBatch prints what a dry run of a batch would write to w, each input
+// with its output path and size on a line, reading no more of every image
+// than its header, and the inputs that would be skipped or fail to stderr.
+// It returns the exit code the batch would end with.
+func planBatch(w io.Writer, entries []batchEntry, paths []string, crops []image.Rectangle, listed map[string]bool,
+	decode imgascii.DecodeOptions, orientation, width, height int, relative relativeSize) int {
+	planned, skipped, failed := 0, 0, 0
+	bounds := map[string]image.Rectangle{}
+	errs := map[string]error{}
+	for i, entry := range entries {
+		input := entry.Input
+		if _, ok := bounds[input]; !ok {
+			bounds[input], errs[input] = imgascii.DecodeFileBounds(input, decode)
+		}
+		err := errs[input]
+		if listed[input] && errors.Is(err, image.ErrFormat) {
+			fmt.Fprintf(os.Stderr, tr("%s: skipped: %s")+"\n", input, tr("not an image"))
+			skipped++
+			continue
+		}
+		var size image.Point
+		if err == nil {
+			size, err = entrySize(bounds[input], entry, crops[i], orientation, width, height, relative)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("%s: failed: %v")+"\n", input, err)
+			failed++
+			continue
+		}
+
+		line := fmt.Sprintf("%s -> %s %dx%d", input, paths[i], size.X, size.Y)
+		if _, err := os.Stat(paths[i]); err == nil {
+			line += tr(", replacing the existing file")
+		}
+		fmt.Fprintln(w, line)
+		planned++
+	}
+
+	fmt.Fprintf(os.Stderr, tr("batch: dry run: %d would be converted, %d skipped, %d failed\n"), planned, skipped, failed)
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
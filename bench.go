@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"text/tabwriter"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// benchStages names the timed stages of a run in order: decoding, the six
+// stages a Converter reports progress for, and rendering.
+var benchStages = []string{"decode", "scale", "gray", "color", "tone", "map", "finish", "render"}
+
+// benchStage adds up the time and allocations of one stage over all runs.
+type benchStage struct {
+	elapsed       time.Duration
+	bytes, allocs uint64
+}
+
+// runBench converts an image -n times and prints the average time and
+// allocations of every stage, to compare filters, mappers and sizes.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Path to the image file")
+	runs := fs.Int("n", 20, "Runs to average over")
+	width := fs.Int("w", 64, "Width to convert to")
+	height := fs.Int("h", 0, "Height to convert to (default keeps the aspect of the image)")
+	format := fs.String("o", "ansi", "Renderer to time: text or ansi or html or png, or another registered with imgascii")
+	cpuProfile := fs.String("cpuprofile", "", "Write a CPU profile of the runs to this file")
+	memProfile := fs.String("memprofile", "", "Write a heap profile to this file after the runs")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii bench -i image [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	if *runs < 1 || *width < 1 || *height < 0 {
+		fmt.Fprintln(os.Stderr, tr("bench: -n and -w must be positive and -h must not be negative"))
+		return exitUsage
+	}
+	renderer, ok := imgascii.LookupRenderer(*format)
+	if !ok {
+		fmt.Fprintln(os.Stderr, tr("Invalid output option. Quitting."))
+		return exitUsage
+	}
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// The file is read once, so the runs time decoding rather than the disk
+	data, err := os.ReadFile(*imagePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	img, err := imgascii.DecodeWith(bytes.NewReader(data), optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	if err := optionFlags.applyFocus(&opts, img); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	opts.Width, opts.Height = *width, *height
+	if opts.Height == 0 {
+		bounds := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+		opts.Height = max(1, *width*bounds.Dy()/bounds.Dx()/2)
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+	}
+
+	stages := make([]benchStage, len(benchStages))
+	var mem runtime.MemStats
+	var last time.Time
+	// mark adds the time and allocations since the last mark to stage.
+	// Reading the memory statistics stops the world, so the clock restarts
+	// after it.
+	mark := func(stage int) {
+		stages[stage].elapsed += time.Since(last)
+		allocated, mallocs := mem.TotalAlloc, mem.Mallocs
+		runtime.ReadMemStats(&mem)
+		stages[stage].bytes += mem.TotalAlloc - allocated
+		stages[stage].allocs += mem.Mallocs - mallocs
+		last = time.Now()
+	}
+	for i := 0; i < *runs; i++ {
+		runtime.ReadMemStats(&mem)
+		last = time.Now()
+		img, err := imgascii.DecodeWith(bytes.NewReader(data), optionFlags.decodeOptions())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitDecode
+		}
+		mark(0)
+
+		// A new converter every run, as a reused one skips every stage
+		converter := imgascii.NewConverter(img)
+		converter.OnProgress(func(done, total int) {
+			mark(done)
+		})
+		art, err := converter.ConvertArt(opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		if err := renderer.Render(art, io.Discard); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		mark(len(benchStages) - 1)
+	}
+
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if *memProfile != "" {
+		f, err := os.Create(*memProfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+		defer f.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+	}
+
+	n := uint64(*runs)
+	var total benchStage
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "stage\ttime/run\tB/run\tallocs/run\t")
+	for i, name := range benchStages {
+		s := stages[i]
+		total.elapsed += s.elapsed
+		total.bytes += s.bytes
+		total.allocs += s.allocs
+		fmt.Fprintf(tw, "%s\t%v\t%d\t%d\t\n", name, s.elapsed/time.Duration(n), s.bytes/n, s.allocs/n)
+	}
+	fmt.Fprintf(tw, "total\t%v\t%d\t%d\t\n", total.elapsed/time.Duration(n), total.bytes/n, total.allocs/n)
+	tw.Flush()
+	return exitOK
+}
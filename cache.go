@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// resultCache keeps finished conversions on disk, so converting the same
+// image with the same options again, as build pipelines do on every run,
+// writes the earlier output instead of decoding and converting. Entries are
+// named by the SHA-256 of the input bytes and the options, and once they
+// take more than max bytes the least recently used are removed. A nil cache
+// keeps nothing.
+type resultCache struct {
+	dir string
+	max int64
+}
+
+// cacheOptions is everything besides the input that shapes the output of
+// convert. The options are taken once the config file, presets and terminal
+// queries are resolved, so the same conversion is found however it was
+// asked for.
+type cacheOptions struct {
+	Build   string
+	Decode  imgascii.DecodeOptions
+	Options imgascii.Options
+
+	// Script is the SHA-256 of -map-script, as the options only name the
+	// effect it registers, and Mask that of -mask, which the options hold
+	// decoded and leave out of their JSON
+	Script string
+	Mask   string
+
+	Sizes               []image.Point
+	Scale               float64
+	MaxWidth, MaxHeight int
+	Fit                 bool
+	MaxBytes            int
+	AutoTune            bool
+
+	// Terminal is the terminal size, only set for -fit and -center which
+	// depend on it
+	Terminal image.Point
+
+	Pad    int
+	Fill   rune
+	Border bool
+	Title  string
+	Center bool
+	Page   image.Point
+
+	Output    string
+	Theme     string
+	Themed    bool
+	Font      string
+	FontSize  float64
+	Links     string
+	LinkBase  string
+	GoPackage string
+	GoName    string
+	MdTitle   string
+	TxtSpaces string
+	EOL       string
+	Encoding  string
+
+	// Annotation is the source named by -annotate, which the file name of
+	// the input sets
+	Annotation string
+}
+
+// cachedOutput is one output of a cached conversion: what was written to
+// stdout, or a file named with Suffix as outputFile appends it.
+type cachedOutput struct {
+	Suffix string
+	Data   []byte
+}
+
+// buildID names the build of the tool, so entries written by another
+// version, which may convert differently, are never used. Builds without
+// a VCS revision all share the version "(devel)", and builds of changed
+// sources share their revision, so the SHA-256 of the executable tells
+// those apart.
+var buildID = sync.OnceValue(func() string {
+	var id string
+	revision, modified := false, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		id = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				id += " " + s.Value
+			}
+			revision = revision || s.Key == "vcs.revision"
+			modified = modified || s.Key == "vcs.modified" && s.Value == "true"
+		}
+	}
+	if !revision || modified {
+		if exe, err := os.Executable(); err == nil {
+			id += " " + fileSum(exe)
+		}
+	}
+	return id
+})
+
+// fileSum returns the SHA-256 of the file at path, or nothing when there is
+// no path or it cannot be read.
+func fileSum(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// name returns the entry name of input converted with opts.
+func (c *resultCache) name(input []byte, opts cacheOptions) string {
+	h := sha256.New()
+	h.Write(input)
+	json.NewEncoder(h).Encode(opts)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the outputs kept under name, marking the entry as just used.
+// Entries that cannot be read count as missing.
+func (c *resultCache) get(name string) ([]cachedOutput, bool) {
+	if c == nil {
+		return nil, false
+	}
+	path := filepath.Join(c.dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var outputs []cachedOutput
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&outputs); err != nil || len(outputs) == 0 {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return outputs, true
+}
+
+// add keeps outputs under name and removes the least recently used entries
+// beyond the size limit. Failing to is only a warning, as the conversion
+// itself went through.
+func (c *resultCache) add(name string, outputs []cachedOutput) {
+	if c == nil {
+		return
+	}
+	err := os.MkdirAll(c.dir, 0o755)
+	if err == nil {
+		err = writeAtomic(filepath.Join(c.dir, name), func(w io.Writer) error {
+			return gob.NewEncoder(w).Encode(outputs)
+		})
+	}
+	if err == nil {
+		err = c.prune()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("cache: %v\n"), err)
+	}
+}
+
+// prune removes entries, least recently used first, until they take at
+// most c.max bytes.
+func (c *resultCache) prune() error {
+	if c.max <= 0 {
+		return nil
+	}
+	entries, err := cacheEntries(c.dir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size()
+	}
+	for _, e := range entries {
+		if total <= c.max {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= e.Size()
+	}
+	return nil
+}
+
+// cacheEntries lists the entries in dir, least recently used first. Other
+// files are left out, so a cache directory shared with anything else only
+// ever loses entries. A missing directory has none.
+func cacheEntries(dir string) ([]fs.FileInfo, error) {
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []fs.FileInfo
+	for _, e := range list {
+		if !e.Type().IsRegular() || !isEntryName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+	return entries, nil
+}
+
+// isEntryName reports whether name is a hex SHA-256, as entries are named.
+func isEntryName(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// writeCached writes the outputs of a cache hit where convert writes those
+// of a conversion.
+func writeCached(outputs []cachedOutput, output, outPath string) int {
+	if output == "stdout" {
+		if _, err := os.Stdout.Write(outputs[0].Data); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+		return exitOK
+	}
+	for _, o := range outputs {
+		exportFile(outputFile(outPath, outputExtension(output), o.Suffix), "Error: Output could not be written", func(w io.Writer) error {
+			_, err := w.Write(o.Data)
+			return err
+		})
+	}
+	return exitOK
+}
+
+// runCache is the cache command, which clears a -cache-dir of convert.
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	dir := fs.String("cache-dir", "", "Cache directory to clear, as given to convert")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii cache clear -cache-dir dir")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "clear" {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return exitUsage
+	}
+	if *dir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	entries, err := cacheEntries(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	var freed int64
+	for _, e := range entries {
+		if err := os.Remove(filepath.Join(*dir, e.Name())); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		freed += e.Size()
+	}
+	fmt.Printf(tr("cache: removed %d entries, %d bytes\n"), len(entries), freed)
+	return exitOK
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// calibratedCharset returns charset calibrated with face, which was loaded
+// from fontPath at size or is the built-in font when fontPath is empty.
+// Measuring every glyph of a long charset in an outline font takes a moment,
+// so results are kept in the user cache directory, keyed by the font file
+// contents, the size and the charset. The cache is only a shortcut, so any
+// failure to read or write it is ignored.
+func calibratedCharset(charset string, face font.Face, fontPath string, size float64) string {
+	h := sha256.New()
+	if fontPath != "" {
+		if data, err := os.ReadFile(fontPath); err == nil {
+			h.Write(data)
+		}
+		fmt.Fprintf(h, "\x00%g", size)
+	}
+	fmt.Fprintf(h, "\x00%s", charset)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	path := rampCachePath()
+	cache := map[string]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	if ramp, ok := cache[key]; ok {
+		return ramp
+	}
+
+	ramp := imgascii.CalibrateCharset(charset, face)
+	if path != "" {
+		cache[key] = ramp
+		saveRampCache(path, cache)
+	}
+	return ramp
+}
+
+func saveRampCache(path string, cache map[string]string) {
+	data, err := json.Marshal(cache)
+	if err != nil || os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	file, err := createAtomic(path)
+	if err != nil {
+		return
+	}
+	defer file.Abort()
+	if _, err := file.Write(data); err == nil {
+		file.Commit()
+	}
+}
+
+// rampCachePath returns where calibrated ramps are cached, or "" when the
+// system has no cache directory.
+func rampCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-img-ascii", "ramps.json")
+}
+
+// warnMissingGlyphs warns when face, which png, gif and pdf exports draw
+// with, lacks glyphs for characters opts may draw, as those come out as
+// boxes or blanks. Fonts have the braille block whole or not at all, so the
+// full cell stands for it.
+func warnMissingGlyphs(opts imgascii.Options, face font.Face, w io.Writer) {
+	var drawn strings.Builder
+	switch {
+	case opts.Mode != "ascii":
+	case opts.Detail == "braille":
+		drawn.WriteString(opts.Charset + "⣿")
+	case opts.Detail == "quadrant":
+		drawn.WriteString(opts.Charset + "▘▝▖▗▚▞▛▜▙▟▌▐▀▄█")
+	case opts.Mapper == "halfblock":
+		drawn.WriteString("▀▄█")
+	case opts.Mapper == "braille":
+		drawn.WriteString("⣿")
+	default:
+		drawn.WriteString(opts.Charset)
+	}
+	switch opts.Mode {
+	case "shade":
+		drawn.WriteString("░▒▓")
+	case "mosaic":
+		for _, g := range opts.Glyphs {
+			drawn.WriteRune(g.Rune)
+		}
+	}
+	for _, ov := range opts.Overlays {
+		drawn.WriteString(ov.Text)
+	}
+	if missing := imgascii.MissingGlyphs(drawn.String(), face); len(missing) > 0 {
+		fmt.Fprintf(w, tr("Warning: the font has no glyphs for %q, which are drawn as blanks or boxes.\n"), string(missing))
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// cameraIndex reports whether path names a camera such as camera:0 rather
+// than a file, and which one.
+func cameraIndex(path string) (int, bool) {
+	index, ok := strings.CutPrefix(path, "camera:")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/blackjack/webcam"
+)
+
+// V4L2 pixel formats, the fourcc codes in little endian order
+const (
+	pixelFormatMJPEG = webcam.PixelFormat('M' | 'J'<<8 | 'P'<<16 | 'G'<<24)
+	pixelFormatYUYV  = webcam.PixelFormat('Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24)
+)
+
+// cameraSupported reports whether this build reads camera:N inputs.
+const cameraSupported = true
+
+// v4l2Camera captures from a Video4Linux device, asking for Motion JPEG and
+// falling back to raw YUYV, which nearly every webcam offers.
+type v4l2Camera struct {
+	cam           *webcam.Webcam
+	format        webcam.PixelFormat
+	width, height int
+}
+
+func openCamera(index int) (frameSource, error) {
+	cam, err := webcam.Open(fmt.Sprintf("/dev/video%d", index))
+	if err != nil {
+		return nil, err
+	}
+
+	supported := cam.GetSupportedFormats()
+	format := pixelFormatMJPEG
+	if _, ok := supported[format]; !ok {
+		format = pixelFormatYUYV
+		if _, ok := supported[format]; !ok {
+			cam.Close()
+			return nil, errors.New("camera offers neither MJPEG nor YUYV frames")
+		}
+	}
+
+	// Terminal art needs few pixels, so VGA keeps capture and decoding
+	// cheap. The driver answers with the nearest size it supports
+	format, w, h, err := cam.SetImageFormat(format, 640, 480)
+	if err != nil {
+		cam.Close()
+		return nil, err
+	}
+	if err := cam.StartStreaming(); err != nil {
+		cam.Close()
+		return nil, err
+	}
+
+	return &v4l2Camera{cam: cam, format: format, width: int(w), height: int(h)}, nil
+}
+
+func (c *v4l2Camera) Frame() (image.Image, error) {
+	for {
+		err := c.cam.WaitForFrame(1000)
+		var timeout *webcam.Timeout
+		if errors.As(err, &timeout) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, index, err := c.cam.GetFrame()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			c.cam.ReleaseFrame(index)
+			continue
+		}
+
+		// The buffer goes back to the driver once decoded, so it must not
+		// be referenced afterwards
+		img, err := c.decode(data)
+		c.cam.ReleaseFrame(index)
+		return img, err
+	}
+}
+
+func (c *v4l2Camera) decode(data []byte) (image.Image, error) {
+	if c.format == pixelFormatMJPEG {
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+
+	// YUYV packs two pixels into Y0 U Y1 V, which is 4:2:2 YCbCr
+	img := image.NewYCbCr(image.Rect(0, 0, c.width, c.height), image.YCbCrSubsampleRatio422)
+	if len(data) < c.width*c.height*2 {
+		return nil, errors.New("short camera frame")
+	}
+	for y := 0; y < c.height; y++ {
+		for x := 0; x < c.width; x += 2 {
+			p := data[(y*c.width+x)*2:]
+			img.Y[y*img.YStride+x] = p[0]
+			img.Y[y*img.YStride+x+1] = p[2]
+			img.Cb[y*img.CStride+x/2] = p[1]
+			img.Cr[y*img.CStride+x/2] = p[3]
+		}
+	}
+	return img, nil
+}
+
+func (c *v4l2Camera) Close() error {
+	c.cam.StopStreaming()
+	return c.cam.Close()
+}
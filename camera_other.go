@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// cameraSupported reports whether this build reads camera:N inputs.
+const cameraSupported = false
+
+func openCamera(index int) (frameSource, error) {
+	return nil, errors.New("camera input is only supported on Linux")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// exportToCast saves the frames as an asciinema v2 recording.
+func exportToCast(arts []*imgascii.Art, delays []time.Duration, outputPath string) {
+	exportFile(outputPath, "Error: Cast could not be written", func(w io.Writer) error {
+		return writeCast(w, arts, delays)
+	})
+}
+
+// writeCast writes the frames as an asciinema v2 recording, one output event
+// per frame at its original timing.
+func writeCast(w io.Writer, arts []*imgascii.Art, delays []time.Duration) error {
+	width, height := 0, 0
+	for _, art := range arts {
+		width, height = max(width, art.Width*art.Columns()), max(height, art.Height)
+	}
+
+	// The timestamp is optional, and left out of deterministic output
+	timestamp := time.Now().Unix()
+	if deterministic {
+		timestamp = 0
+	}
+	b := bufio.NewWriter(w)
+	header, _ := json.Marshal(struct {
+		Version   int               `json:"version"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Timestamp int64             `json:"timestamp,omitempty"`
+		Env       map[string]string `json:"env"`
+	}{2, width, height, timestamp, map[string]string{"TERM": "xterm-256color"}})
+	b.Write(header)
+	b.WriteByte('\n')
+
+	var at time.Duration
+	for i, art := range arts {
+		// Each frame redraws from the top left, the first also clears
+		data := "\x1b[H" + strings.ReplaceAll(art.ANSI(), "\n", "\r\n")
+		if i == 0 {
+			data = "\x1b[2J" + data
+		}
+		event, _ := json.Marshal([]any{at.Seconds(), "o", data})
+		b.Write(event)
+		b.WriteByte('\n')
+		at += delays[i]
+	}
+
+	return b.Flush()
+}
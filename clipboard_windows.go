@@ -0,0 +1,65 @@
+//go:build windows
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32           = windows.NewLazySystemDLL("user32.dll")
+	kernel32         = windows.NewLazySystemDLL("kernel32.dll")
+	openClipboard    = user32.NewProc("OpenClipboard")
+	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
+	setClipboardData = user32.NewProc("SetClipboardData")
+	globalAlloc      = kernel32.NewProc("GlobalAlloc")
+	globalFree       = kernel32.NewProc("GlobalFree")
+	globalLock       = kernel32.NewProc("GlobalLock")
+	globalUnlock     = kernel32.NewProc("GlobalUnlock")
+	moveMemory       = kernel32.NewProc("RtlMoveMemory")
+)
+
+// Clipboard format and allocation flag from the Windows headers.
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+// copyToClipboard puts text on the Windows clipboard as UTF-16, which keeps
+// characters outside the console code page intact where clip.exe would not.
+func copyToClipboard(text string) error {
+	data, err := windows.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+
+	if ok, _, err := openClipboard.Call(0); ok == 0 {
+		return err
+	}
+	defer closeClipboard.Call()
+	if ok, _, err := emptyClipboard.Call(); ok == 0 {
+		return err
+	}
+
+	// The clipboard takes over memory it accepts, but not memory it refuses
+	size := uintptr(len(data)) * unsafe.Sizeof(data[0])
+	mem, _, err := globalAlloc.Call(gmemMoveable, size)
+	if mem == 0 {
+		return err
+	}
+	ptr, _, err := globalLock.Call(mem)
+	if ptr == 0 {
+		globalFree.Call(mem)
+		return err
+	}
+	moveMemory.Call(ptr, uintptr(unsafe.Pointer(&data[0])), size)
+	globalUnlock.Call(mem)
+	if ok, _, err := setClipboardData.Call(cfUnicodeText, mem); ok == 0 {
+		globalFree.Call(mem)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runCompare converts two images at the same size and prints them side by
+// side, or as the second one with every cell that differs from the first
+// highlighted.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	first := fs.String("i", "", "Path to the first image file")
+	second := fs.String("i2", "", "Path to the second image file")
+	width := fs.Int("w", 40, "Width of each image")
+	height := fs.Int("h", 0, "Height of each image (default keeps the aspect of the first)")
+	view := fs.String("view", "side", "How to show the images: side or diff")
+	gap := fs.Int("gap", 2, "Columns between the images side by side")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii compare -i image -i2 image [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *first == "" || *second == "" {
+		fmt.Fprintln(os.Stderr, tr("compare: give both -i and -i2"))
+		return exitUsage
+	}
+	if *view != "side" && *view != "diff" {
+		fmt.Fprintf(os.Stderr, tr("compare: invalid view %q\n"), *view)
+		return exitUsage
+	}
+	if *width < 1 || *height < 0 || *gap < 0 {
+		fmt.Fprintln(os.Stderr, tr("compare: width must be positive and height and gap must not be negative"))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	var imgs [2]image.Image
+	for i, path := range []string{*first, *second} {
+		if imgs[i], err = imgascii.DecodeFileWith(path, optionFlags.decodeOptions()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitDecode
+		}
+	}
+
+	// Both images share one size so their cells line up, even when their
+	// aspects differ
+	opts.Width, opts.Height = *width, *height
+	if opts.Height == 0 {
+		bounds := imgascii.TurnedBounds(imgs[0].Bounds(), opts.Orient)
+		opts.Height = max(1, *width*bounds.Dy()/bounds.Dx()/2)
+	}
+	var arts [2]*imgascii.Art
+	for i, img := range imgs {
+		o := opts
+		if err := optionFlags.applyFocus(&o, img); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		if arts[i], err = imgascii.ConvertArt(img, o); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+
+	art := sideBySide(arts[0], arts[1], *gap)
+	if *view == "diff" {
+		var changed int
+		art, changed = diffArt(arts[0], arts[1])
+		fmt.Fprintf(os.Stderr, tr("compare: %d of %d cells differ\n"), changed, len(art.Cells))
+	}
+	if _, err := io.WriteString(os.Stdout, art.ANSI()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitWrite
+	}
+	return exitOK
+}
+
+// sideBySide places a and b next to each other, gap blank cells apart.
+func sideBySide(a, b *imgascii.Art, gap int) *imgascii.Art {
+	art := &imgascii.Art{Width: a.Width + gap + b.Width, Height: max(a.Height, b.Height)}
+	art.Cells = make([]imgascii.Cell, art.Width*art.Height)
+	for i := range art.Cells {
+		art.Cells[i] = imgascii.Cell{Rune: ' ', Index: -1}
+	}
+	for y := 0; y < art.Height; y++ {
+		row := art.Cells[y*art.Width : (y+1)*art.Width]
+		if y < a.Height {
+			copy(row, a.Cells[y*a.Width:(y+1)*a.Width])
+		}
+		if y < b.Height {
+			copy(row[a.Width+gap:], b.Cells[y*b.Width:(y+1)*b.Width])
+		}
+	}
+	return art
+}
+
+// diffArt returns b with the cells whose character or color differs from a
+// on a red background and the rest without color, and how many cells
+// differ. The arts have the same size.
+func diffArt(a, b *imgascii.Art) (*imgascii.Art, int) {
+	art := &imgascii.Art{Width: b.Width, Height: b.Height, Cells: make([]imgascii.Cell, len(b.Cells))}
+	changed := 0
+	for i, cell := range b.Cells {
+		art.Cells[i] = imgascii.Cell{Rune: cell.Rune, Index: -1}
+		if cell.Rune != a.Cells[i].Rune || cell.Color != a.Cells[i].Color || cell.Fill != a.Cells[i].Fill {
+			art.Cells[i].Color, art.Cells[i].Index, art.Cells[i].Attr = imgascii.ANSIPalette[1], 1, imgascii.Background
+			changed++
+		}
+	}
+	return art, changed
+}
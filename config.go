@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultConfigPath is where the config file is looked for when -config is
+// not given, ~/.config/go-img-ascii/config.toml on Linux.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-img-ascii", "config.toml")
+}
+
+// envPrefix starts the names of the environment variables that set flags.
+const envPrefix = "GO_IMG_ASCII_"
+
+// envNames spells out the one-letter flags in their environment variables.
+var envNames = map[string]string{"i": "INPUT", "o": "OUTPUT", "w": "WIDTH", "h": "HEIGHT"}
+
+// envName returns the environment variable setting the flag called name:
+// the name in capitals, dashes turned to underscores, after envPrefix, so
+// -font-size is GO_IMG_ASCII_FONT_SIZE and -w GO_IMG_ASCII_WIDTH.
+func envName(name string) string {
+	if long, ok := envNames[name]; ok {
+		return envPrefix + long
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag in flags not set on the command line from its
+// environment variable, when that is set, with the flag's syntax. Applied
+// before the config file, the environment takes precedence over it and
+// gives way to the command line. Variables for flags the command doesn't
+// have are ignored, as one environment often serves several commands.
+func applyEnv(flags *flag.FlagSet) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if e := flags.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// parseFlags parses args into fs and then sets the flags they leave out
+// from the environment, as applyEnv does. An error in the environment is
+// printed like errors in args are.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := applyEnv(fs); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	return nil
+}
+
+// applyConfig reads the TOML file at path and sets every flag in flags named by
+// one of its keys, except those set on the command line, which take
+// precedence. A missing file is only an error when required is set, as it
+// is for a path given with -config.
+//
+// Values use their flag's syntax, written as TOML strings, numbers or
+// booleans. Lists of numbers are joined with commas, as -w and -h take
+// them, and other lists set a repeatable flag such as -text once per entry.
+func applyConfig(flags *flag.FlagSet, path string, required bool) error {
+	var values map[string]any
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("config: %w", err)
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if key == "config" || flags.Lookup(key) == nil {
+			return fmt.Errorf(tr("config: %s: unknown setting %q"), path, key)
+		}
+		if set[key] {
+			continue
+		}
+		for _, value := range configValues(values[key]) {
+			if err := flags.Set(key, value); err != nil {
+				return fmt.Errorf("config: %s: %s: %w", path, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValues turns a TOML value into the flag values it stands for.
+func configValues(value any) []string {
+	list, ok := value.([]any)
+	if !ok {
+		return []string{fmt.Sprint(value)}
+	}
+
+	numbers := true
+	parts := make([]string, len(list))
+	for i, v := range list {
+		switch v.(type) {
+		case int64, float64:
+		default:
+			numbers = false
+		}
+		parts[i] = fmt.Sprint(v)
+	}
+	if numbers {
+		return []string{strings.Join(parts, ",")}
+	}
+	return parts
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// contactSheet converts cols by rows frames spread evenly over an animation,
+// from its first frame on, and lays them out like a montage, each below the
+// time it is shown at. Without rows every frame is taken. Clips with fewer
+// frames than tiles leave the rest of the sheet blank.
+func contactSheet(frames []imgascii.Frame, grid gridValue, size image.Point, opts imgascii.Options, separators bool, bar *progressBar) (*imgascii.Art, error) {
+	starts := make([]time.Duration, len(frames))
+	for i := 1; i < len(frames); i++ {
+		starts[i] = starts[i-1] + frames[i-1].Delay
+	}
+
+	cols, rows := grid.cols, grid.rows
+	if rows == 0 {
+		rows = (len(frames) + cols - 1) / cols
+	}
+	n := min(cols*rows, len(frames))
+	sampled := make([]imgascii.Frame, n)
+	names := make([]string, n)
+	for i := range sampled {
+		index := i * len(frames) / n
+		sampled[i] = frames[index]
+		names[i] = clipTime(starts[index])
+	}
+
+	fitted := fitTile(imgascii.TurnedBounds(frames[0].Image.Bounds(), opts.Orient), size)
+	opts.Width, opts.Height = fitted.X, fitted.Y
+	tiles, err := imgascii.ConvertFramesProgress(sampled, opts, bar.update)
+	bar.clear()
+	if err != nil {
+		return nil, err
+	}
+	return layoutSheet(tiles, names, cols, rows, size, true, separators), nil
+}
+
+// clipTime formats a time into a clip as minutes, seconds and hundredths,
+// as 1:02.50.
+func clipTime(d time.Duration) string {
+	d = d.Round(10 * time.Millisecond)
+	return fmt.Sprintf("%d:%05.2f", int(d/time.Minute), (d % time.Minute).Seconds())
+}
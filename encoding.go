@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// textEncoding is how -o txt and -o ansi-file write art: eol is lf or crlf
+// and charset utf8, cp437 or ascii. The zero value writes UTF-8 with lf.
+type textEncoding struct {
+	eol     string
+	charset string
+}
+
+// plain reports whether e writes text as it is.
+func (e textEncoding) plain() bool {
+	return e.eol != "crlf" && (e.charset == "" || e.charset == "utf8")
+}
+
+// encode returns text in e. Characters cp437 or ascii lack are swapped for
+// the closest they have, as transliterate picks it, so ramps of shades,
+// blocks or braille keep their tones on DOS and other retro systems.
+func (e textEncoding) encode(text string) []byte {
+	if e.eol == "crlf" {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	switch e.charset {
+	case "cp437":
+		buf := make([]byte, 0, len(text))
+		for _, r := range text {
+			for _, t := range transliterate(r, cp437Ramp, func(r rune) bool {
+				_, ok := charmap.CodePage437.EncodeRune(r)
+				return ok
+			}) {
+				b, _ := charmap.CodePage437.EncodeRune(t)
+				buf = append(buf, b)
+			}
+		}
+		return buf
+	case "ascii":
+		buf := make([]byte, 0, len(text))
+		for _, r := range text {
+			for _, t := range transliterate(r, imgascii.Charsets["standard"], func(r rune) bool { return r < utf8.RuneSelf }) {
+				buf = append(buf, byte(t))
+			}
+		}
+		return buf
+	}
+	return []byte(text)
+}
+
+// cp437Ramp is the ramp of shades code page 437 has, from empty to full.
+const cp437Ramp = " ░▒▓█"
+
+// blockEighths is how many eighths of its cell each character of the Block
+// Elements, U+2580 to U+259F, covers.
+var blockEighths = [32]int{4, 1, 2, 3, 4, 5, 6, 7, 8, 7, 6, 5, 4, 3, 2, 1, 4, 2, 4, 6, 1, 1, 2, 2, 2, 6, 4, 6, 6, 2, 4, 6}
+
+// lineFallbacks are the ASCII stand-ins for the line and punctuation
+// characters -border and overlays draw.
+var lineFallbacks = map[rune]rune{
+	'─': '-', '━': '-', '═': '=', '│': '|', '┃': '|', '║': '|',
+	'…': '.', '‘': '\'', '’': '\'', '“': '"', '”': '"', '–': '-', '—': '-', '•': '*', '·': '.',
+}
+
+// transliterate returns r, when fits says the encoding has it, or what
+// stands in for it: the character of ramp covering as much of the cell for
+// blocks and braille, a line drawn in ASCII, the letter without its accents
+// or fullwidth form, or ? for anything else. A double width character is
+// followed by a space, so the columns stay aligned.
+func transliterate(r rune, ramp string, fits func(rune) bool) []rune {
+	if fits(r) {
+		return []rune{r}
+	}
+	t := '?'
+	shades := []rune(ramp)
+	shade := func(coverage float64) rune {
+		return shades[min(len(shades)-1, int(coverage*float64(len(shades)-1)+0.5))]
+	}
+	switch {
+	case r >= 0x2580 && r <= 0x259f:
+		t = shade(float64(blockEighths[r-0x2580]) / 8)
+	case r >= 0x2800 && r <= 0x28ff:
+		dots := 0
+		for bits := r - 0x2800; bits != 0; bits &= bits - 1 {
+			dots++
+		}
+		t = shade(float64(dots) / 8)
+	case lineFallbacks[r] != 0:
+		t = lineFallbacks[r]
+	case r >= 0x2500 && r <= 0x257f:
+		t = '+'
+	default:
+		// Accented letters lose their marks, and fullwidth forms and
+		// ligatures the first letter they stand for
+		for _, d := range norm.NFKD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) && fits(d) {
+				t = d
+				break
+			}
+		}
+	}
+	if !fits(t) {
+		t = '?'
+	}
+	if imgascii.RuneWidth(r) == 2 {
+		return []rune{t, ' '}
+	}
+	return []rune{t}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// maxFeedFrame is the largest encoded frame a feed may send, so a corrupt
+// length prefix fails rather than allocating gigabytes.
+const maxFeedFrame = 64 << 20
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// feedSource reads a stream of encoded images from a unix socket or a
+// named pipe, as another process produces them. Each frame is a JPEG or a
+// PNG as it is, which covers MJPEG, or a big endian 4-byte length followed
+// by an image in any format imgascii decodes. Anything else between JPEG
+// frames, such as the part headers of multipart MJPEG, is skipped.
+type feedSource struct {
+	r        *bufio.Reader
+	c        io.Closer
+	listener net.Listener
+	decode   imgascii.DecodeOptions
+}
+
+// openFeed opens a feed input: unix:path connects to the socket at path,
+// or listens there for one producer to connect when nothing does yet, and
+// a path naming a FIFO reads it. It reports false when path is neither.
+func openFeed(path string, decode imgascii.DecodeOptions) (*feedSource, bool, error) {
+	src := &feedSource{decode: decode}
+	if name, ok := strings.CutPrefix(path, "unix:"); ok {
+		if info, err := os.Stat(name); err == nil && info.Mode()&os.ModeSocket != 0 {
+			conn, err := net.Dial("unix", name)
+			if err != nil {
+				return nil, true, err
+			}
+			src.r, src.c = bufio.NewReader(conn), conn
+			return src, true, nil
+		}
+		listener, err := net.Listen("unix", name)
+		if err != nil {
+			return nil, true, err
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			listener.Close()
+			return nil, true, err
+		}
+		src.r, src.c, src.listener = bufio.NewReader(conn), conn, listener
+		return src, true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, false, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, true, err
+	}
+	src.r, src.c = bufio.NewReader(f), f
+	return src, true, nil
+}
+
+func (s *feedSource) Frame() (image.Image, error) {
+	data, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	return imgascii.DecodeWith(bytes.NewReader(data), s.decode)
+}
+
+func (s *feedSource) Close() error {
+	err := s.c.Close()
+	if s.listener != nil {
+		// Closing a unix listener removes its socket file
+		s.listener.Close()
+	}
+	return err
+}
+
+// next returns the encoded bytes of the following frame.
+func (s *feedSource) next() ([]byte, error) {
+	for {
+		start, err := s.r.Peek(8)
+		if len(start) < 4 {
+			if err == io.EOF && len(start) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch {
+		case start[0] == 0xff && start[1] == 0xd8:
+			return readJPEG(s.r)
+		case bytes.Equal(start, pngSignature):
+			return readPNG(s.r)
+		case start[0] < maxFeedFrame>>24:
+			size := binary.BigEndian.Uint32(start)
+			if size == 0 || size > maxFeedFrame {
+				return nil, fmt.Errorf("feed: invalid frame length %d", size)
+			}
+			s.r.Discard(4)
+			data := make([]byte, size)
+			if _, err := io.ReadFull(s.r, data); err != nil {
+				return nil, unexpected(err)
+			}
+			return data, nil
+		default:
+			// Skip up to the next JPEG
+			if _, err := s.r.ReadBytes(0xff); err != nil {
+				return nil, err
+			}
+			s.r.UnreadByte()
+			if b, _ := s.r.Peek(2); len(b) == 2 && b[1] == 0xd8 {
+				continue
+			}
+			s.r.Discard(1)
+		}
+	}
+}
+
+// readJPEG reads one JPEG from r up to and including its end of image
+// marker. It follows the segment lengths, so markers within segments, such
+// as those of an EXIF thumbnail, don't end it early.
+func readJPEG(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	copyN := func(n int) error {
+		if buf.Len()+n > maxFeedFrame {
+			return errors.New("feed: frame too large")
+		}
+		_, err := io.CopyN(&buf, r, int64(n))
+		return unexpected(err)
+	}
+	if err := copyN(2); err != nil {
+		return nil, err
+	}
+	// The scan of entropy coded data ends on the 0xff of the next marker
+	scanned := false
+	for {
+		if !scanned {
+			if b, err := r.ReadByte(); err != nil || b != 0xff {
+				return nil, errors.New("feed: invalid JPEG marker")
+			}
+		}
+		scanned = false
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xff {
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		buf.Write([]byte{0xff, marker})
+		switch {
+		case marker == 0xd9:
+			return buf.Bytes(), nil
+		case marker >= 0xd0 && marker <= 0xd7 || marker == 0x01:
+			continue
+		}
+
+		length, err := r.Peek(2)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if err := copyN(int(binary.BigEndian.Uint16(length))); err != nil {
+			return nil, err
+		}
+		if marker != 0xda {
+			continue
+		}
+
+		// Within the scan 0xff is followed by a stuffed 0 or a restart
+		// marker, anything else is the next marker
+		for !scanned {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			if b != 0xff {
+				buf.WriteByte(b)
+				continue
+			}
+			next, err := r.Peek(1)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			if next[0] == 0 || next[0] >= 0xd0 && next[0] <= 0xd7 {
+				buf.WriteByte(0xff)
+				buf.WriteByte(next[0])
+				r.Discard(1)
+				continue
+			}
+			if buf.Len() > maxFeedFrame {
+				return nil, errors.New("feed: frame too large")
+			}
+			scanned = true
+		}
+	}
+}
+
+// readPNG reads one PNG from r, chunk by chunk up to and including IEND.
+func readPNG(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(len(pngSignature))); err != nil {
+		return nil, unexpected(err)
+	}
+	for {
+		header, err := r.Peek(8)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		last := string(header[4:]) == "IEND"
+		if int64(buf.Len())+size > maxFeedFrame {
+			return nil, errors.New("feed: frame too large")
+		}
+		// Length, type, data and CRC
+		if _, err := io.CopyN(&buf, r, 8+size+4); err != nil {
+			return nil, unexpected(err)
+		}
+		if last {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// unexpected turns the end of the stream in the middle of a frame into
+// io.ErrUnexpectedEOF, as only the end between frames ends a feed.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runFilter implements the filter mode used by editors and scripts. The
+// contract is strict: the image is read from stdin, stdout receives exactly
+// the art and nothing else, every diagnostic goes to stderr, and any failure
+// exits non-zero without writing to stdout. The return value is the exit code.
+func runFilter(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("filter", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	width := fs.Int("w", 64, "Exact number of columns to produce")
+	height := fs.Int("h", 0, "Number of rows to produce (default keeps the image aspect)")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-img-ascii filter [options] < image")
+		fs.PrintDefaults()
+	}
+
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, tr("filter: unexpected argument %q\n"), fs.Arg(0))
+		return exitUsage
+	}
+	if *width < 1 || *height < 0 {
+		fmt.Fprintln(stderr, tr("filter: width must be positive and height must not be negative"))
+		return exitUsage
+	}
+	// Both cut columns, which would break the width promised above
+	if *optionFlags.trim || *optionFlags.compact {
+		fmt.Fprintln(stderr, tr("filter: -trim and -compact change the width and can't be used"))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintf(stderr, "filter: %v\n", err)
+		return exitUsage
+	}
+
+	img, err := imgascii.DecodeWith(stdin, optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintf(stderr, "filter: %v\n", err)
+		return exitDecode
+	}
+	if err := optionFlags.applyFocus(&opts, img); err != nil {
+		fmt.Fprintf(stderr, "filter: %v\n", err)
+		return exitUsage
+	}
+
+	// Characters are about twice as tall as they are wide
+	opts.Width, opts.Height = *width, *height
+	if opts.Height == 0 {
+		bounds := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+		opts.Height = max(1, *width*bounds.Dy()/bounds.Dx()/2)
+	}
+
+	// Convert fully before writing so a failure never leaves partial art
+	ascii, err := imgascii.Convert(img, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "filter: %v\n", err)
+		return exitFailure
+	}
+	if _, err := io.WriteString(stdout, ascii); err != nil {
+		fmt.Fprintf(stderr, "filter: %v\n", err)
+		return exitWrite
+	}
+
+	return exitOK
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// gradientPNG returns a PNG of a horizontal gradient, dark on the left.
+func gradientPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x * 255 / (w - 1))})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunFilter(t *testing.T) {
+	img := gradientPNG(t, 40, 20)
+	tests := []struct {
+		name  string
+		args  []string
+		stdin []byte
+		code  int
+		cols  int
+		rows  int
+	}{
+		{"width", []string{"-w", "10"}, img, exitOK, 10, 2},
+		{"width and height", []string{"-w", "12", "-h", "4"}, img, exitOK, 12, 4},
+		{"charset", []string{"-w", "10", "-charset", "blocks"}, img, exitOK, 10, 2},
+		{"trim", []string{"-w", "10", "-trim"}, img, exitUsage, 0, 0},
+		{"compact", []string{"-w", "10", "-compact"}, img, exitUsage, 0, 0},
+		{"zero width", []string{"-w", "0"}, img, exitUsage, 0, 0},
+		{"argument", []string{"photo.jpg"}, img, exitUsage, 0, 0},
+		{"unknown flag", []string{"-nope"}, img, exitUsage, 0, 0},
+		{"not an image", []string{"-w", "10"}, []byte("not an image"), exitDecode, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runFilter(tt.args, bytes.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("exit code %d, want %d; stderr: %s", code, tt.code, stderr.String())
+			}
+			if code != exitOK {
+				if stdout.Len() > 0 {
+					t.Errorf("failure wrote to stdout: %q", stdout.String())
+				}
+				if stderr.Len() == 0 {
+					t.Error("failure wrote nothing to stderr")
+				}
+				return
+			}
+			if stderr.Len() > 0 {
+				t.Errorf("success wrote to stderr: %q", stderr.String())
+			}
+			lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+			if len(lines) != tt.rows {
+				t.Fatalf("%d rows, want %d: %q", len(lines), tt.rows, stdout.String())
+			}
+			for i, line := range lines {
+				if got := utf8.RuneCountInString(line); got != tt.cols {
+					t.Errorf("row %d has %d columns, want %d: %q", i, got, tt.cols, line)
+				}
+			}
+		})
+	}
+}
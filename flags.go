@@ -0,0 +1,537 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// optionFlags holds the conversion flags shared by every mode of the tool.
+type optionFlags struct {
+	brightness   *float64
+	contrast     *float64
+	gamma        *float64
+	denoise      *int
+	denoiseWith  *string
+	sharpen      *float64
+	autoContrast *bool
+	clipLow      *float64
+	clipHigh     *float64
+	invert       *bool
+	attrs        *bool
+	background   *string
+	focus        *string
+	smartCrop    *bool
+	cropFace     *bool
+	resize       *string
+	alpha        *string
+	mask         *string
+	maskFill     *string
+	luma         *string
+	tonemap      *string
+	color        *string
+	quantize     *string
+	tint         *string
+	palette      *string
+	noExifRotate *bool
+	ignoreICC    *bool
+	rotate       *int
+	flip         *string
+	crop         rectValue
+	orient       *string
+	overlays     overlayList
+	caption      *string
+	watermark    *string
+	match        *string
+	mode         *string
+	glyphs       *string
+	mapper       *string
+	detailMap    *string
+	detailLevel  *float64
+	charset      *string
+	threshold    *string
+	dither       *bool
+	levels       *int
+	levelBounds  *string
+	samples      *int
+	linear       *bool
+	hysteresis   *float64
+	compact      *bool
+	trim         *bool
+	effects      *string
+	mapScript    *string
+}
+
+func addOptionFlags(fs *flag.FlagSet) *optionFlags {
+	f := &optionFlags{
+		brightness:   localFloat(fs, "brightness", 0, "Brightness offset from -1 to 1"),
+		contrast:     localFloat(fs, "contrast", 1, "Contrast multiplier"),
+		gamma:        localFloat(fs, "gamma", 1, "Gamma correction"),
+		denoise:      fs.Int("denoise", 0, "Smooth noise within this many cells before the tone adjustments"),
+		denoiseWith:  fs.String("denoise-filter", "median", "Filter for -denoise: median or gaussian"),
+		sharpen:      localFloat(fs, "sharpen", 0, "Unsharp mask amount to recover edges lost to downscaling, 1 is strong"),
+		autoContrast: fs.Bool("auto-contrast", false, "Stretch the grayscale histogram to use the full ramp"),
+		clipLow:      localFloat(fs, "clip-low", 1, "Percent of darkest pixels to clip with -auto-contrast"),
+		clipHigh:     localFloat(fs, "clip-high", 1, "Percent of brightest pixels to clip with -auto-contrast"),
+		charset:      fs.String("charset", "standard", "Character ramp from empty to dense: standard or blocks or detailed or the characters themselves"),
+		threshold:    fs.String("threshold", "", "Render in two tones, cells from this gray level up dense: 1 to 255 or auto"),
+		dither:       fs.Bool("dither", false, "Diffuse rounding error between cells to avoid banding"),
+		levels:       fs.Int("levels", 0, "Tone steps to quantize to, repeating or skipping charset characters to fit (default one per character)"),
+		levelBounds:  fs.String("level-bounds", "", "Gray levels from 1 to 255 at which each tone step after the first starts, as 64,128,192, instead of even steps"),
+		samples:      fs.Int("samples", 1, "Average an NxN grid of samples per cell for steadier animations"),
+		linear:       fs.Bool("linear", false, "Average -samples and the pixels of block mappers in linear light, keeping fine light detail from darkening"),
+		hysteresis:   localFloat(fs, "hysteresis", 0, "Tone levels a cell's tone must move before an animation frame changes its glyph"),
+		compact:      fs.Bool("compact", false, "Shorten colored output by skipping color changes on spaces and trailing spaces"),
+		trim:         fs.Bool("trim", false, "Cut the blank rows and columns around the subject"),
+		effects:      fs.String("effects", "", "Text effects to apply in order, comma separated: shadow or outline or scanlines"),
+		mapScript:    fs.String("map-script", "", "Lua script whose cell function returns the character and color of every cell"),
+		invert:       fs.Bool("invert", false, "Reverse the character ramp"),
+		attrs:        fs.Bool("attrs", false, "Add dim, bold and reverse video characters to the ramp as extra tones for terminals with few colors"),
+		background:   fs.String("bg", "dark", "Terminal background: dark or light or auto"),
+		focus:        fs.String("focus", "", "Crop to the output aspect around a point: x,y as fractions or auto"),
+		smartCrop:    fs.Bool("smart-crop", false, "Crop to the output aspect around the most detailed part of the image"),
+		cropFace:     fs.Bool("crop-face", false, "Crop to the output aspect around the most certain face, needs the faces build tag"),
+		resize:       fs.String("resize", "stretch", "Fit a source of another aspect: stretch or seam to carve away its least detailed columns or rows"),
+		alpha:        fs.String("alpha", "black", "Background for transparent pixels: black or white or checker or skip"),
+		mask:         fs.String("mask", "", "Image whose light parts are converted and dark parts left blank, stretched over the input"),
+		maskFill:     fs.String("mask-fill", " ", "Character filling the parts -mask leaves blank"),
+		luma:         fs.String("luma", "rec601", "Luminance formula: rec601 or rec709 or average or lightness"),
+		tonemap:      fs.String("tonemap", "none", "HDR tone mapping: none or reinhard or hable or aces"),
+		mode:         fs.String("mode", "ascii", "Cell rendering: ascii or blocks or mosaic or shade or wallpaper, or auto for blocks where the terminal shows them"),
+		glyphs:       fs.String("glyphs", "squares", "Glyphs for mosaic mode: squares or circles or a file of glyph #rrggbb lines"),
+		mapper:       fs.String("mapper", "luminance", "Character selection for ascii mode: luminance or halfblock or braille or structural"),
+		detailMap:    fs.String("detail-map", "none", "Draw busy cells with finer glyphs and the rest from the charset: none or braille or quadrant"),
+		detailLevel:  localFloat(fs, "detail-threshold", 32, "Standard deviation in gray levels, from 0 to 128, at which -detail-map draws a cell with finer glyphs"),
+		color:        fs.String("color", "none", "ANSI color output: none or 16 or 256 or truecolor, or auto or always or never to pick the depth the terminal supports"),
+		match:        fs.String("match", "", "Match the tonal histogram of this reference image"),
+		noExifRotate: fs.Bool("no-exif-rotate", false, "Ignore the EXIF orientation of photos"),
+		ignoreICC:    fs.Bool("ignore-icc", false, "Read the pixels as sRGB even when the image carries an ICC profile for another color space"),
+		rotate:       fs.Int("rotate", 0, "Turn the image clockwise before converting: 90 or 180 or 270"),
+		flip:         fs.String("flip", "", "Mirror the image after -rotate: h or v"),
+		quantize:     fs.String("quantize", "nearest", "Palette matching for 16 and 256 colors: nearest or ciede2000 or dither"),
+		tint:         fs.String("tint", "", "Color cells by brightness along a gradient: matrix or amber or sepia or #rrggbb,#rrggbb"),
+		palette:      fs.String("palette", "", "Limit colors to a fixed palette: gameboy or pico8 or c64, #rrggbb,#rrggbb,..., a .gpl or hex list file, or median-cut:N for N colors of the image"),
+	}
+	fs.Var(&f.overlays, "text", "Stamp text over the art as x,y[,#rrggbb]:text, x may be c to center, may be repeated")
+	f.caption = fs.String("caption", "", "Stamp a caption centered in the bottom line of the art")
+	f.watermark = fs.String("watermark", "", "Stamp text in the bottom right corner of the art")
+	fs.Var(&f.crop, "crop", "Convert only this part of the turned image: x,y,w,h in pixels")
+	f.orient = fs.String("orient", "horizontal", "Turn the art for vertical banners and displays on their side: horizontal or vertical, or 90 or 180 or 270 degrees clockwise")
+	return f
+}
+
+// rectValue is a flag value holding a rectangle written as x,y,w,h.
+type rectValue image.Rectangle
+
+func (r *rectValue) String() string {
+	if image.Rectangle(*r).Empty() {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X-r.Min.X, r.Max.Y-r.Min.Y)
+}
+
+func (r *rectValue) Set(value string) error {
+	rect, err := parseCrop(value)
+	if err != nil {
+		return err
+	}
+	*r = rectValue(rect)
+	return nil
+}
+
+// parseCrop parses an x,y,w,h crop region in pixels.
+func parseCrop(crop string) (image.Rectangle, error) {
+	var x, y, w, h int
+	if _, err := fmt.Sscanf(crop, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil || w < 1 || h < 1 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop %q: expected x,y,w,h", crop)
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// floatValue is a float flag that also accepts a decimal comma, so numbers
+// can be typed the way locales such as de or fr write them.
+type floatValue float64
+
+func localFloat(fs *flag.FlagSet, name string, value float64, usage string) *float64 {
+	p := new(float64)
+	*p = value
+	fs.Var((*floatValue)(p), name, usage)
+	return p
+}
+
+func (f *floatValue) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
+}
+
+func (f *floatValue) Set(value string) error {
+	// A single float never holds a list, so a comma can only be a decimal
+	// separator
+	v, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return errors.New(tr("invalid number"))
+	}
+	*f = floatValue(v)
+	return nil
+}
+
+// overlayList is a repeatable flag collecting text overlays.
+type overlayList []imgascii.Overlay
+
+func (l *overlayList) String() string {
+	return fmt.Sprintf("%d overlays", len(*l))
+}
+
+func (l *overlayList) Set(value string) error {
+	o, err := imgascii.ParseOverlay(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, o)
+	return nil
+}
+
+// options builds validated library options from the parsed flags. Width and
+// height are left at their defaults for the caller to fill in.
+func (f *optionFlags) options() (imgascii.Options, error) {
+	opts := imgascii.DefaultOptions()
+	opts.Alpha = *f.alpha
+	opts.Luma = *f.luma
+	opts.ToneMap = *f.tonemap
+	opts.AutoContrast = *f.autoContrast
+	opts.ClipLow = *f.clipLow
+	opts.ClipHigh = *f.clipHigh
+	opts.Brightness = *f.brightness
+	opts.Contrast = *f.contrast
+	opts.Gamma = *f.gamma
+	opts.Denoise = *f.denoise
+	opts.DenoiseFilter = *f.denoiseWith
+	opts.Sharpen = *f.sharpen
+	opts.Invert = *f.invert
+	opts.Attrs = *f.attrs
+	opts.Dither = *f.dither
+	opts.Levels = *f.levels
+	if *f.levelBounds != "" {
+		bounds, err := imgascii.ParseLevelBounds(*f.levelBounds)
+		if err != nil {
+			return opts, err
+		}
+		opts.LevelBounds = bounds
+	}
+	opts.Samples = *f.samples
+	opts.Linear = *f.linear
+	switch *f.orient {
+	case "horizontal":
+	case "vertical":
+		opts.Orient = 90
+	default:
+		degrees, err := strconv.Atoi(*f.orient)
+		if err != nil || degrees != 90 && degrees != 180 && degrees != 270 {
+			return opts, fmt.Errorf(tr("invalid orientation %q: expected horizontal, vertical, 90, 180 or 270"), *f.orient)
+		}
+		opts.Orient = degrees
+	}
+	opts.Hysteresis = *f.hysteresis
+	opts.Compact = *f.compact
+	opts.Trim = *f.trim
+	opts.SmartCrop = *f.smartCrop
+	if *f.resize != "stretch" {
+		opts.Resize = *f.resize
+	}
+	if *f.effects != "" {
+		opts.Effects = strings.Split(*f.effects, ",")
+	}
+	// The script maps the cells, so it runs before the effects restyle them
+	if *f.mapScript != "" {
+		name, err := loadMapScript(*f.mapScript)
+		if err != nil {
+			return opts, err
+		}
+		opts.Effects = append([]string{name}, opts.Effects...)
+	}
+	opts.Charset = *f.charset
+	if named, ok := imgascii.Charsets[*f.charset]; ok {
+		opts.Charset = named
+	}
+	switch *f.threshold {
+	case "":
+	case "auto":
+		opts.Threshold = imgascii.ThresholdAuto
+	default:
+		level, err := strconv.Atoi(*f.threshold)
+		if err != nil || level < 1 || level > 255 {
+			return opts, fmt.Errorf(tr("invalid threshold %q: expected 1 to 255 or auto"), *f.threshold)
+		}
+		opts.Threshold = level
+	}
+	// Two tones only need two characters, and the ends of the standard ramp
+	// are further apart than they look
+	if opts.Threshold != 0 && *f.charset == "standard" {
+		opts.Charset = " #"
+	}
+	opts.Color = colorDepth(*f.color)
+	opts.Mode = *f.mode
+	if opts.Mode == "auto" {
+		opts.Mode = autoMode()
+		// Blocks in the colors the terminal has rather than truecolor
+		if opts.Mode == "blocks" && opts.Color == "none" {
+			opts.Color = terminalCaps().color
+		}
+	}
+	opts.Mapper = *f.mapper
+	if *f.detailMap != "none" {
+		opts.Detail = *f.detailMap
+	}
+	opts.DetailThreshold = *f.detailLevel
+	if opts.Mode == "wallpaper" || opts.Mode == "blocks" {
+		// Blocks are nothing but color, so pick the richest by default
+		opts.Mode = "blocks"
+		if opts.Color == "none" {
+			opts.Color = "truecolor"
+		}
+	}
+	opts.Quantize = *f.quantize
+	if *f.tint != "" {
+		tint, err := imgascii.ParseTint(*f.tint)
+		if err != nil {
+			return opts, err
+		}
+		opts.Tint = &tint
+		if opts.Color == "none" {
+			opts.Color = "truecolor"
+		}
+	}
+	// Shades blend pairs of palette colors, which truecolor has no need of
+	if opts.Mode == "shade" && opts.Color == "none" {
+		opts.Color = "256"
+	}
+	if *f.palette != "" {
+		palette, size, err := loadPalette(*f.palette)
+		if err != nil {
+			return opts, err
+		}
+		opts.Palette, opts.PaletteSize = palette, size
+		if opts.Color == "none" {
+			opts.Color = "truecolor"
+		}
+	}
+	if opts.Mode == "mosaic" {
+		glyphs, err := loadGlyphs(*f.glyphs)
+		if err != nil {
+			return opts, err
+		}
+		opts.Glyphs = glyphs
+	}
+	opts.Overlays = f.overlays
+	if *f.caption != "" {
+		opts.Overlays = append(opts.Overlays, imgascii.Overlay{Text: *f.caption, Y: -1, Center: true})
+	}
+	if *f.watermark != "" {
+		opts.Overlays = append(opts.Overlays, imgascii.Overlay{Text: *f.watermark, X: -1, Y: -1})
+	}
+	if err := opts.Validate(); err != nil {
+		return opts, err
+	}
+	if *f.cropFace && (opts.SmartCrop || *f.focus != "") {
+		return opts, errors.New(tr("-crop-face cannot be combined with -focus or -smart-crop"))
+	}
+	if err := f.decodeOptions().Validate(); err != nil {
+		return opts, err
+	}
+
+	// The mask is decoded as the input is, so one of the same size still
+	// lines up once it is turned, flipped or cropped
+	if *f.mask != "" {
+		fill := []rune(*f.maskFill)
+		if len(fill) != 1 {
+			return opts, errors.New(tr("-mask-fill must be a single character"))
+		}
+		mask, err := imgascii.DecodeFileWith(*f.mask, f.decodeOptions())
+		if err != nil {
+			return opts, fmt.Errorf("mask image: %w", err)
+		}
+		opts.Mask = mask
+		if fill[0] != ' ' {
+			opts.MaskFill = fill[0]
+		}
+		if err := opts.Validate(); err != nil {
+			return opts, err
+		}
+	}
+
+	// The reference is compared as a whole, so only EXIF rotation and the
+	// color profile apply
+	if *f.match != "" {
+		ref, err := imgascii.DecodeFileWith(*f.match, imgascii.DecodeOptions{NoExifRotate: *f.noExifRotate, IgnoreICC: *f.ignoreICC})
+		if err != nil {
+			return opts, fmt.Errorf("reference image: %w", err)
+		}
+		opts.Reference = imgascii.HistogramOf(ref, opts.Luma)
+	}
+
+	// Dense glyphs read as bright on a dark background, so a light background
+	// needs the ramp reversed to avoid a negative
+	switch *f.background {
+	case "dark":
+	case "light":
+		opts.Invert = !opts.Invert
+	case "auto":
+		if light, ok := queryLightBackground(); ok && light {
+			opts.Invert = !opts.Invert
+		}
+	default:
+		return opts, errors.New(tr("invalid background option"))
+	}
+
+	return opts, nil
+}
+
+// colorDepth resolves the auto, always and never color settings to a palette.
+// Auto colors only a terminal stdout, and never when NO_COLOR is set, so
+// piped output stays plain. Always colors regardless. Both use the depth
+// terminalCaps finds, or 16 colors when the output is deterministic.
+// Explicit depths are returned as they are.
+func colorDepth(value string) string {
+	switch value {
+	case "never":
+		return "none"
+	case "auto":
+		if deterministic || os.Getenv("NO_COLOR") != "" || !term.IsTerminal(int(os.Stdout.Fd())) || os.Getenv("TERM") == "dumb" {
+			return "none"
+		}
+	case "always":
+	default:
+		return value
+	}
+
+	return terminalCaps().color
+}
+
+// autoMode picks the cell rendering for -mode auto: colored blocks on a
+// terminal showing Unicode in 256 colors or more, and plain characters
+// anywhere else.
+func autoMode() string {
+	c := terminalCaps()
+	if c.tty && c.unicode && c.color != "16" {
+		return "blocks"
+	}
+	return "ascii"
+}
+
+// cropToFace crops to the most certain face in img with room for the head
+// and shoulders around it, half a face on every side, and centres the
+// output on the face. Without a face it falls back to the most detailed
+// region, as -smart-crop does.
+func cropToFace(opts *imgascii.Options, img image.Image) error {
+	faces, err := imgascii.DetectFaces(img)
+	if err != nil {
+		return err
+	}
+	if len(faces) == 0 {
+		opts.SmartCrop = true
+		return nil
+	}
+
+	face := faces[0]
+	margin := image.Pt(face.Dx()/2, face.Dy()/2)
+	opts.Crop = image.Rectangle{face.Min.Sub(margin), face.Max.Add(margin)}.Intersect(img.Bounds())
+	center := image.Pt((face.Min.X+face.Max.X)/2, (face.Min.Y+face.Max.Y)/2)
+	opts.Focus = &center
+	return nil
+}
+
+// loadGlyphs returns the built-in glyph set called name, or reads one from
+// the file at that path.
+func loadGlyphs(name string) ([]imgascii.Glyph, error) {
+	if glyphs, ok := imgascii.GlyphSets[name]; ok {
+		return glyphs, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("glyphs: %w", err)
+	}
+	defer file.Close()
+	glyphs, err := imgascii.ParseGlyphs(file)
+	if err != nil {
+		return nil, fmt.Errorf("glyphs: %s: %w", name, err)
+	}
+	return glyphs, nil
+}
+
+// loadPalette resolves -palette to a built-in palette, a list of colors, a
+// palette file, or the number of colors to cut from the image.
+func loadPalette(name string) ([]color.RGBA, int, error) {
+	if palette, ok := imgascii.Palettes[name]; ok {
+		return palette, 0, nil
+	}
+	if count, ok := strings.CutPrefix(name, "median-cut:"); ok {
+		size, err := strconv.Atoi(count)
+		if err != nil || size < 1 {
+			return nil, 0, fmt.Errorf("palette: invalid number of colors %q", count)
+		}
+		return nil, size, nil
+	}
+	if !paletteFile(name) {
+		palette, err := imgascii.ParsePalette(strings.NewReader(name))
+		if err != nil {
+			return nil, 0, fmt.Errorf("palette: %w", err)
+		}
+		return palette, 0, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("palette: %w", err)
+	}
+	defer file.Close()
+	palette, err := imgascii.ParsePalette(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("palette: %s: %w", name, err)
+	}
+	return palette, 0, nil
+}
+
+// paletteFile reports whether -palette names a palette file rather than a
+// built-in palette, a list of colors or median-cut.
+func paletteFile(name string) bool {
+	if _, ok := imgascii.Palettes[name]; ok || name == "" {
+		return false
+	}
+	return !strings.HasPrefix(name, "median-cut:") && !strings.HasPrefix(name, "#") && !strings.Contains(name, ",")
+}
+
+// decodeOptions returns the options for decoding the input image.
+func (f *optionFlags) decodeOptions() imgascii.DecodeOptions {
+	return imgascii.DecodeOptions{
+		NoExifRotate: *f.noExifRotate,
+		IgnoreICC:    *f.ignoreICC,
+		Rotate:       *f.rotate,
+		Flip:         *f.flip,
+		Crop:         image.Rectangle(f.crop),
+	}
+}
+
+// applyFocus resolves the -focus and -crop-face flags against the decoded
+// image.
+func (f *optionFlags) applyFocus(opts *imgascii.Options, img image.Image) error {
+	if *f.cropFace {
+		return cropToFace(opts, img)
+	}
+	if *f.focus == "" {
+		return nil
+	}
+
+	point, err := imgascii.ParseFocus(*f.focus, img)
+	if err != nil {
+		return err
+	}
+	opts.Focus = &point
+	return nil
+}
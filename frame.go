@@ -0,0 +1,87 @@
+package main
+
+import "github.com/m-spangenberg/go-img-ascii/imgascii"
+
+// frame surrounds art with a margin, a box drawn in line characters with an
+// optional title in its top edge, and, to centre it in the terminal, blank
+// cells on the left.
+type frame struct {
+	pad    int
+	fill   rune
+	border bool
+	title  string
+	center bool
+}
+
+// apply returns art framed as f describes, or art itself when f adds
+// nothing. Cells are about twice as tall as they are wide, so the margin
+// has half as many lines above and below as columns at the sides.
+func (f frame) apply(art *imgascii.Art) *imgascii.Art {
+	if f.pad == 0 && !f.border && !f.center {
+		return art
+	}
+
+	side, lines := f.pad, (f.pad+1)/2
+	edge := 0
+	if f.border {
+		edge = 1
+	}
+	left := 0
+	if f.center {
+		cols, _ := terminalSize()
+		width := (art.Width + 2*side + 2*edge) * art.Columns()
+		left = max(0, cols-width) / 2 / art.Columns()
+	}
+
+	framed := &imgascii.Art{Width: left + art.Width + 2*(side+edge), Height: art.Height + 2*(lines+edge)}
+	framed.Cells = make([]imgascii.Cell, framed.Width*framed.Height)
+	set := func(x, y int, r rune) {
+		framed.Cells[y*framed.Width+x] = imgascii.Cell{Rune: r, Index: -1}
+	}
+	for y := 0; y < framed.Height; y++ {
+		for x := 0; x < framed.Width; x++ {
+			r := f.fill
+			if x < left {
+				r = ' '
+			}
+			set(x, y, r)
+		}
+	}
+
+	if f.border {
+		right, bottom := framed.Width-1, framed.Height-1
+		for x := left + 1; x < right; x++ {
+			set(x, 0, '─')
+			set(x, bottom, '─')
+		}
+		for y := 1; y < bottom; y++ {
+			set(left, y, '│')
+			set(right, y, '│')
+		}
+		set(left, 0, '┌')
+		set(right, 0, '┐')
+		set(left, bottom, '└')
+		set(right, bottom, '┘')
+
+		// The title sits in the top edge after a short stretch of line,
+		// shortened to fit between the corners
+		if f.title != "" {
+			title := []rune(" " + f.title + " ")
+			if room := right - left - 2; len(title) > room {
+				title = title[:max(0, room-1)]
+				if room > 0 {
+					title = append(title, '…')
+				}
+			}
+			for i, r := range title {
+				set(left+2+i, 0, r)
+			}
+		}
+	}
+
+	top, start := lines+edge, left+side+edge
+	for y := 0; y < art.Height; y++ {
+		copy(framed.Cells[(top+y)*framed.Width+start:], art.Cells[y*art.Width:(y+1)*art.Width])
+	}
+	return framed
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runGen writes a synthetic test image for checking terminal colors and
+// aspect, or as input with known properties for comparing settings.
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	pattern := fs.String("pattern", "gradient", "Test pattern: "+strings.Join(imgascii.TestPatterns, " or "))
+	width := fs.Int("w", 640, "Width in pixels")
+	height := fs.Int("h", 480, "Height in pixels")
+	output := fs.String("o", "", "Output PNG file (default the pattern name)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii gen [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+
+	img, err := imgascii.Generate(*pattern, *width, *height)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	path := *output
+	if path == "" {
+		path = *pattern + ".png"
+	}
+	file, err := createAtomic(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, tr("Error: File could not be created"))
+		return exitWrite
+	}
+	defer file.Abort()
+	if err := png.Encode(file, img); err != nil {
+		fmt.Fprintln(os.Stderr, tr("Error: Image could not be encoded"))
+		return exitWrite
+	}
+	if err := file.Commit(); err != nil {
+		fmt.Fprintln(os.Stderr, tr("Error: File could not be saved"))
+		return exitWrite
+	}
+
+	return exitOK
+}
@@ -1,5 +1,32 @@
 module github.com/m-spangenberg/go-img-ascii
 
-go 1.21.11
+go 1.22
 
-require golang.org/x/image v0.18.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/blackjack/webcam v0.6.1
+	github.com/esimov/pigo v1.4.6
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gen2brain/avif v0.3.2
+	github.com/gen2brain/heic v0.3.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/kbinani/screenshot v0.0.0-20250624051815-089614a94018
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/image v0.18.0
+	golang.org/x/sys v0.24.0
+	golang.org/x/term v0.21.0
+	golang.org/x/text v0.16.0
+	google.golang.org/grpc v1.66.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/ebitengine/purego v0.7.1 // indirect
+	github.com/gen2brain/shm v0.1.0 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/jezek/xgb v1.1.1 // indirect
+	github.com/lxn/win v0.0.0-20210218163916-a377121e959e // indirect
+	github.com/tetratelabs/wazero v1.7.3 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
+)
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// goSource names the package and constant of a Go source export.
+type goSource struct {
+	pkg  string
+	name string
+}
+
+// validate reports whether the package and constant names are identifiers.
+func (g goSource) validate() error {
+	if !token.IsIdentifier(g.pkg) || !token.IsIdentifier(g.name) {
+		return fmt.Errorf(tr("-go-package %q and -go-name %q must be Go identifiers"), g.pkg, g.name)
+	}
+	return nil
+}
+
+// writeGo writes a Go source file declaring the art as a string constant,
+// one quoted line at a time so it needs no escaping by hand. Colored art
+// also gets a function returning it with its escape sequences.
+func writeGo(w io.Writer, art *imgascii.Art, g goSource) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "// Code generated by go-img-ascii. DO NOT EDIT.\n\npackage %s\n\n", g.pkg)
+	fmt.Fprintf(b, "// %s is %dx%d character art.\n", g.name, art.Width, art.Height)
+	fmt.Fprintf(b, "const %s = %s\n", g.name, quoteLines(art.String()))
+
+	if ansi := art.ANSI(); ansi != art.String() {
+		fmt.Fprintf(b, "\n// %sANSI returns %s with the ANSI escape sequences for its colors.\n", g.name, g.name)
+		fmt.Fprintf(b, "func %sANSI() string {\n\treturn %s\n}\n", g.name, strings.ReplaceAll(quoteLines(ansi), "\n\t", "\n\t\t"))
+	}
+	return b.Flush()
+}
+
+// quoteLines returns text as a concatenation of quoted Go strings, one per
+// line, each on a line of its own.
+func quoteLines(text string) string {
+	var b strings.Builder
+	b.WriteString(`""`)
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line != "" {
+			b.WriteString(" +\n\t" + strconv.Quote(line))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// htmlLinks describes how cells of an HTML export link back to the source.
+type htmlLinks struct {
+	mode   string // none, fragment or query
+	base   string
+	region image.Rectangle
+	orient int // degrees the art is turned from region
+}
+
+// href returns the link for the cell at column x, row y of a grid with the
+// given size. Fragments use the W3C media fragment xywh syntax.
+func (l htmlLinks) href(x, y, columns, rows int) string {
+	// Turned art is linked by the cell's place in the upright grid
+	switch l.orient {
+	case 90:
+		x, y, columns, rows = y, columns-1-x, rows, columns
+	case 180:
+		x, y = columns-1-x, rows-1-y
+	case 270:
+		x, y, columns, rows = rows-1-y, x, rows, columns
+	}
+	x0 := l.region.Min.X + x*l.region.Dx()/columns
+	y0 := l.region.Min.Y + y*l.region.Dy()/rows
+	x1 := l.region.Min.X + (x+1)*l.region.Dx()/columns
+	y1 := l.region.Min.Y + (y+1)*l.region.Dy()/rows
+	if l.mode == "query" {
+		return fmt.Sprintf("%s?x=%d&y=%d&w=%d&h=%d", l.base, x0, y0, x1-x0, y1-y0)
+	}
+	return fmt.Sprintf("%s#xywh=%d,%d,%d,%d", l.base, x0, y0, x1-x0, y1-y0)
+}
+
+// writeHTML writes the art as a standalone page, turning its colors into
+// spans and, depending on links, every cell into a link to the source.
+func writeHTML(w io.Writer, art *imgascii.Art, th theme, links htmlLinks) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>go-img-ascii</title>\n")
+	fmt.Fprintf(b, "<style>body{--bg:%s;--fg:%s;background:var(--bg);color:var(--fg)}pre{line-height:1}a{color:inherit;text-decoration:none}%s</style>\n",
+		cssColor(th.background), cssColor(th.foreground), imgascii.AttrCSS)
+	b.WriteString("</head>\n<body>\n<pre>")
+
+	if links.mode == "none" {
+		b.WriteString(art.HTML())
+	} else {
+		// Every cell is its own link, so each carries its own color
+		columns := art.Columns()
+		for y := 0; y < art.Height; y++ {
+			for x := 0; x < art.Width; x++ {
+				cell := art.At(x, y)
+				r := imgascii.SafeRune(cell.Rune)
+				style := ""
+				if class := cell.Class(); class != "" {
+					style = fmt.Sprintf(" class=\"%s\"", class)
+				}
+				if s := cell.Style(); s != "" {
+					style += fmt.Sprintf(" style=\"%s\"", s)
+				}
+				fmt.Fprintf(b, "<a href=\"%s\"%s>%s%s</a>", html.EscapeString(links.href(x, y, art.Width, art.Height)), style,
+					html.EscapeString(string(r)), strings.Repeat(" ", max(0, columns-imgascii.RuneWidth(r))))
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("</pre>\n</body>\n</html>\n")
+
+	return b.Flush()
+}
+
+func cssColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,51 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// flattenAlpha composites img onto the background chosen by mode so the
+// gray conversion never sees partially transparent pixels. The skip mode
+// flattens onto black, the cells are blanked later from the alpha mask.
+func flattenAlpha(img image.Image, mode string) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewRGBA64(bounds)
+
+	switch mode {
+	case "white":
+		draw.Draw(flat, bounds, image.White, image.Point{}, draw.Src)
+	case "checker":
+		// Two cells wide by one tall keeps the squares square on screen
+		light := color.RGBA64{0xcccc, 0xcccc, 0xcccc, 0xffff}
+		dark := color.RGBA64{0x6666, 0x6666, 0x6666, 0xffff}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if (x/4+y/2)%2 == 0 {
+					flat.SetRGBA64(x, y, light)
+				} else {
+					flat.SetRGBA64(x, y, dark)
+				}
+			}
+		}
+	default:
+		draw.Draw(flat, bounds, image.Black, image.Point{}, draw.Src)
+	}
+
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return flat
+}
+
+// alphaMask returns the alpha channel of img.
+func alphaMask(img image.Image) *image.Alpha {
+	bounds := img.Bounds()
+	mask := image.NewAlpha(bounds)
+	draw.Draw(mask, bounds, img, bounds.Min, draw.Src)
+	return mask
+}
+
+// transparent reports whether the cell at x, y is mostly see-through.
+func transparent(mask *image.Alpha, x, y int) bool {
+	return mask != nil && mask.AlphaAt(x, y).A < 0x80
+}
@@ -0,0 +1,175 @@
+package imgascii
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+var errAPNG = errors.New("failed to decode image: invalid APNG")
+
+// pngChunk is a chunk of a PNG file: its type and data.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// apngFrame is a frame of an APNG as its fcTL chunk describes it, with
+// the image data that follows.
+type apngFrame struct {
+	rect    image.Rectangle
+	delay   time.Duration
+	dispose int
+	blend   bool
+	data    [][]byte
+}
+
+// apngFrames are the frames of an animated PNG. Each is decoded as a PNG of
+// its own, made of the header and palette of the file with the size and
+// image data of the frame, so image/png does the decompressing and
+// unfiltering.
+type apngFrames struct {
+	header []pngChunk
+	frames []apngFrame
+	canvas *frameCanvas
+	next   int
+}
+
+// newAPNGFrames reads the chunks of the PNG in data. It returns nil
+// without an error when the PNG has no acTL chunk before its image data,
+// which makes it a still image.
+func newAPNGFrames(data []byte, opts DecodeOptions) (*apngFrames, error) {
+	var chunks []pngChunk
+	for rest := data[len(pngSignature):]; len(rest) >= 12; {
+		n := binary.BigEndian.Uint32(rest)
+		if uint64(n)+12 > uint64(len(rest)) {
+			break
+		}
+		chunks = append(chunks, pngChunk{string(rest[4:8]), rest[8 : 8+n]})
+		rest = rest[12+n:]
+	}
+
+	s := &apngFrames{}
+	animated := false
+	var frame *apngFrame
+	for _, c := range chunks {
+		switch c.kind {
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if len(c.data) != 26 {
+				return nil, errAPNG
+			}
+			if frame != nil {
+				s.frames = append(s.frames, *frame)
+			}
+			frame = parseFcTL(c.data)
+		case "IDAT":
+			if !animated {
+				return nil, nil
+			}
+			// Image data before the first fcTL is a still image shown
+			// where animations aren't supported, not a frame
+			if frame != nil {
+				frame.data = append(frame.data, c.data)
+			}
+		case "fdAT":
+			if frame == nil || len(c.data) < 4 {
+				return nil, errAPNG
+			}
+			frame.data = append(frame.data, c.data[4:])
+		case "IHDR", "PLTE", "tRNS":
+			if frame == nil {
+				s.header = append(s.header, c)
+			}
+		}
+	}
+	if !animated {
+		return nil, nil
+	}
+	if frame != nil {
+		s.frames = append(s.frames, *frame)
+	}
+	if len(s.header) == 0 || s.header[0].kind != "IHDR" || len(s.header[0].data) != 13 || len(s.frames) == 0 {
+		return nil, errAPNG
+	}
+
+	ihdr := s.header[0].data
+	bounds := image.Rect(0, 0, int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:])))
+	for _, f := range s.frames {
+		if !f.rect.In(bounds) || len(f.data) == 0 {
+			return nil, errAPNG
+		}
+	}
+	// The first frame has nothing to go back to
+	if s.frames[0].dispose == disposePrevious {
+		s.frames[0].dispose = disposeBackground
+	}
+	s.canvas = newFrameCanvas(bounds, opts)
+	return s, nil
+}
+
+// parseFcTL reads an fcTL chunk: the sequence number, the size and offset
+// of the frame, its delay as a fraction of a second and how it is
+// disposed of and blended.
+func parseFcTL(data []byte) *apngFrame {
+	w, h := binary.BigEndian.Uint32(data[4:]), binary.BigEndian.Uint32(data[8:])
+	x, y := binary.BigEndian.Uint32(data[12:]), binary.BigEndian.Uint32(data[16:])
+	num, den := binary.BigEndian.Uint16(data[20:]), binary.BigEndian.Uint16(data[22:])
+	if den == 0 {
+		den = 100
+	}
+	return &apngFrame{
+		rect:    image.Rect(int(x), int(y), int(x+w), int(y+h)),
+		delay:   time.Duration(num) * time.Second / time.Duration(den),
+		dispose: int(data[24]),
+		blend:   data[25] == 1,
+	}
+}
+
+func (s *apngFrames) Next() (Frame, error) {
+	if s.next >= len(s.frames) {
+		return Frame{}, io.EOF
+	}
+	f := s.frames[s.next]
+	s.next++
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, c := range s.header {
+		if c.kind == "IHDR" {
+			ihdr := bytes.Clone(c.data)
+			binary.BigEndian.PutUint32(ihdr, uint32(f.rect.Dx()))
+			binary.BigEndian.PutUint32(ihdr[4:], uint32(f.rect.Dy()))
+			c.data = ihdr
+		}
+		writePNGChunk(&buf, c)
+	}
+	for _, data := range f.data {
+		writePNGChunk(&buf, pngChunk{"IDAT", data})
+	}
+	writePNGChunk(&buf, pngChunk{"IEND", nil})
+
+	patch, err := png.Decode(&buf)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode image: frame %d: %w", s.next, err)
+	}
+	return s.canvas.draw(patch, f.rect, f.blend, f.dispose, f.delay)
+}
+
+// writePNGChunk writes c to buf with its length and checksum.
+func writePNGChunk(buf *bytes.Buffer, c pngChunk) {
+	binary.Write(buf, binary.BigEndian, uint32(len(c.data)))
+	crc := crc32.NewIEEE()
+	io.WriteString(crc, c.kind)
+	crc.Write(c.data)
+	buf.WriteString(c.kind)
+	buf.Write(c.data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,439 @@
+package imgascii
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Attr holds the attributes of a cell.
+type Attr uint8
+
+const (
+	// Background paints the cell color behind the glyph instead of using
+	// it for the glyph, as blocks mode does.
+	Background Attr = 1 << iota
+
+	// Transparent marks cells the skip alpha mode left empty.
+	Transparent
+
+	// Bold, Dim and Reverse are the terminal attributes of the glyph:
+	// brighter, fainter, or with its colors swapped so it is cut out of a
+	// cell filled with its color. Options.Attrs uses them as tones.
+	Bold
+	Dim
+	Reverse
+)
+
+// Cell is one character of the art.
+type Cell struct {
+	Rune rune
+
+	// Color is the cell color. A zero alpha keeps the default color.
+	Color color.RGBA
+
+	// Index is the ANSIPalette entry Color was matched to for 16 and 256
+	// color output, or -1 when Color is sent as true color.
+	Index int
+
+	Attr Attr
+
+	// Fill is a background color behind a glyph drawn in Color, as shade
+	// mode gives cells, and FillIndex its ANSIPalette entry or -1. A zero
+	// alpha keeps the default background.
+	Fill      color.RGBA
+	FillIndex int
+
+	// Gray is the tone the ramp character was picked for, after every
+	// tone adjustment.
+	Gray uint8
+
+	// Pixel is the color sampled for the cell, with any transparency
+	// flattened onto the alpha background.
+	Pixel color.RGBA
+}
+
+// Art is converted output as a grid of cells, which each output format
+// renders in its own way.
+type Art struct {
+	Width, Height int
+
+	// Cells holds the grid row by row.
+	Cells []Cell
+
+	// compact shortens ANSI output as Options.Compact asks
+	compact bool
+}
+
+// At returns the cell in column x of row y.
+func (a *Art) At(x, y int) Cell {
+	return a.Cells[y*a.Width+x]
+}
+
+// String returns the characters of the art without any color, one line per
+// row, each ending in a newline.
+func (a *Art) String() string {
+	columns := a.Columns()
+	var b strings.Builder
+	b.Grow(a.Width*a.Height + a.Height)
+	for y := 0; y < a.Height; y++ {
+		for _, cell := range a.Cells[y*a.Width : (y+1)*a.Width] {
+			r := SafeRune(cell.Rune)
+			b.WriteRune(r)
+			for range padding(r, columns) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ANSI returns the art as terminal text, with escape sequences for the cell
+// colors. This is what Convert returns.
+func (a *Art) ANSI() string {
+	// Compact output leaves the color alone for spaces, whose foreground
+	// never shows, and drops trailing spaces. Background colors show on
+	// spaces too, so those cells are left as they are
+	keep := func(cell Cell) bool {
+		return !cell.blank()
+	}
+	columns := a.Columns()
+
+	buf := make([]byte, 0, a.Width*a.Height+a.Height)
+	for y := 0; y < a.Height; y++ {
+		row := a.Cells[y*a.Width : (y+1)*a.Width]
+		if a.compact {
+			for len(row) > 0 && !keep(row[len(row)-1]) {
+				row = row[:len(row)-1]
+			}
+		}
+
+		// Escapes are only emitted when the color changes
+		current, from := "", Cell{}
+		for _, cell := range row {
+			code := cell.escape()
+			if a.compact && !keep(cell) {
+				code = current
+			}
+			if code != current {
+				buf = appendEscape(buf, code, from.resets(cell))
+				current, from = code, cell
+			}
+			r := SafeRune(cell.Rune)
+			buf = utf8.AppendRune(buf, r)
+			for range padding(r, columns) {
+				buf = append(buf, ' ')
+			}
+		}
+		if current != "" {
+			buf = append(buf, "\x1b[0m"...)
+		}
+		buf = append(buf, '\n')
+	}
+
+	return string(buf)
+}
+
+// deltaGap is the longest run of unchanged cells Delta rewrites rather than
+// jumping over, as moving the cursor takes about as many bytes.
+const deltaGap = 6
+
+// Delta returns what turns prev into a on a terminal where prev was drawn
+// by ANSI from the top left corner: the cursor moves to each run of changed
+// cells and only those are written. Without prev it moves the cursor home
+// and draws all of a, and when prev differs in size, as trimmed art may, it
+// clears what prev left below the cursor first. The cursor is left after
+// the last cell written.
+func (a *Art) Delta(prev *Art) string {
+	columns := a.Columns()
+	if prev == nil {
+		return "\x1b[H" + a.ANSI()
+	}
+	if prev.Width != a.Width || prev.Height != a.Height || prev.Columns() != columns {
+		return "\x1b[H\x1b[J" + a.ANSI()
+	}
+
+	// Blank cells look the same whatever their color
+	same := func(i int) bool {
+		c, p := a.Cells[i], prev.Cells[i]
+		if c.blank() && p.blank() {
+			return true
+		}
+		return c.Rune == p.Rune && c.escape() == p.escape()
+	}
+
+	var buf []byte
+	for y := 0; y < a.Height; y++ {
+		row := a.Cells[y*a.Width : (y+1)*a.Width]
+		for x := 0; x < a.Width; x++ {
+			if same(y*a.Width + x) {
+				continue
+			}
+			last := x
+			for end := x + 1; end < a.Width && end-last <= deltaGap; end++ {
+				if !same(y*a.Width + end) {
+					last = end
+				}
+			}
+
+			buf = fmt.Appendf(buf, "\x1b[%d;%dH", y+1, x*columns+1)
+			current, from := "", Cell{}
+			for _, cell := range row[x : last+1] {
+				if code := cell.escape(); code != current {
+					buf = appendEscape(buf, code, from.resets(cell))
+					current, from = code, cell
+				}
+				r := SafeRune(cell.Rune)
+				buf = utf8.AppendRune(buf, r)
+				for range padding(r, columns) {
+					buf = append(buf, ' ')
+				}
+			}
+			if current != "" {
+				buf = append(buf, "\x1b[0m"...)
+			}
+			x = last
+		}
+	}
+	return string(buf)
+}
+
+// appendEscape appends code, the escape of the next cell, which resets the
+// colors first when it is "" or reset is set, as when the cell before set a
+// background or an attribute the next one does not.
+func appendEscape(buf []byte, code string, reset bool) []byte {
+	if code == "" || reset {
+		buf = append(buf, "\x1b[0m"...)
+	}
+	return append(buf, code...)
+}
+
+// backed reports whether the escape of the cell sets a background color.
+func (c Cell) backed() bool {
+	return c.Fill.A != 0 || c.Color.A != 0 && c.Attr&Background != 0
+}
+
+// resets reports whether the colors and attributes the escape of c set
+// have to be reset before the escape of next, which only adds to them:
+// when c sets a background or an attribute next does not.
+func (c Cell) resets(next Cell) bool {
+	return c.backed() && !next.backed() || c.Attr&^next.Attr&(Bold|Dim|Reverse) != 0
+}
+
+// attrCodes are the SGR parameters of the attributes.
+var attrCodes = []struct {
+	attr Attr
+	code string
+}{{Bold, "1"}, {Dim, "2"}, {Reverse, "7"}}
+
+// escape returns the escape sequence that sets the cell colors and
+// attributes, or "" for the default ones.
+func (c Cell) escape() string {
+	code := ""
+	for _, a := range attrCodes {
+		if c.Attr&a.attr != 0 {
+			code += "\x1b[" + a.code + "m"
+		}
+	}
+	if c.Color.A != 0 {
+		if c.Attr&Background != 0 {
+			code += colorEscape(48, 40, 100, c.Color, c.Index)
+		} else {
+			code += colorEscape(38, 30, 90, c.Color, c.Index)
+		}
+	}
+	if c.Fill.A != 0 {
+		code += colorEscape(48, 40, 100, c.Fill, c.FillIndex)
+	}
+	return code
+}
+
+// colorEscape returns the escape sequence setting c, matched to palette
+// entry index or -1, on the given layer, 38 for the foreground or 48 for
+// the background, whose basic and bright colors start at base and bright.
+func colorEscape(layer, base, bright int, c color.RGBA, index int) string {
+	switch {
+	case index < 0:
+		return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", layer, c.R, c.G, c.B)
+	case index < 8:
+		return fmt.Sprintf("\x1b[%dm", base+index)
+	case index < 16:
+		return fmt.Sprintf("\x1b[%dm", bright+index-8)
+	}
+	return fmt.Sprintf("\x1b[%d;5;%dm", layer, index)
+}
+
+// HTML returns the art as HTML text for a pre element, with runs of the same
+// color wrapped in styled spans, and of the same attributes in spans of the
+// classes AttrCSS styles.
+func (a *Art) HTML() string {
+	columns := a.Columns()
+	var b strings.Builder
+	for y := 0; y < a.Height; y++ {
+		current := ""
+		for _, cell := range a.Cells[y*a.Width : (y+1)*a.Width] {
+			if span := cell.span(); span != current {
+				if current != "" {
+					b.WriteString("</span>")
+				}
+				if span != "" {
+					fmt.Fprintf(&b, "<span%s>", span)
+				}
+				current = span
+			}
+			r := SafeRune(cell.Rune)
+			b.WriteString(html.EscapeString(string(r)))
+			for range padding(r, columns) {
+				b.WriteByte(' ')
+			}
+		}
+		if current != "" {
+			b.WriteString("</span>")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// AttrCSS styles the classes HTML gives cells with attributes. Reverse
+// video swaps the foreground, which Style sets as the custom property
+// --fg for those cells, and the background, which pages set as --bg.
+const AttrCSS = ".bold{font-weight:bold}.dim{opacity:0.5}.reverse{color:var(--bg,#000);background:var(--fg,#fff)}"
+
+// span returns the attributes of the HTML span of the cell, or "" for a
+// cell without colors or attributes of its own.
+func (c Cell) span() string {
+	span := ""
+	if class := c.Class(); class != "" {
+		span = fmt.Sprintf(" class=\"%s\"", class)
+	}
+	if style := c.Style(); style != "" {
+		span += fmt.Sprintf(" style=\"%s\"", style)
+	}
+	return span
+}
+
+// Class returns the HTML classes of the cell attributes, bold, dim and
+// reverse, as AttrCSS styles them, or "" for none.
+func (c Cell) Class() string {
+	var classes []string
+	for _, a := range []struct {
+		attr Attr
+		name string
+	}{{Bold, "bold"}, {Dim, "dim"}, {Reverse, "reverse"}} {
+		if c.Attr&a.attr != 0 {
+			classes = append(classes, a.name)
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+// Style returns the CSS declarations for the cell colors, or "" for the
+// default colors.
+func (c Cell) Style() string {
+	var styles []string
+	if c.Color.A != 0 {
+		property := "color"
+		switch {
+		case c.Attr&Background != 0:
+			property = "background"
+		case c.Attr&Reverse != 0:
+			property = "--fg"
+		}
+		styles = append(styles, fmt.Sprintf("%s:#%02x%02x%02x", property, c.Color.R, c.Color.G, c.Color.B))
+	}
+	if c.Fill.A != 0 {
+		styles = append(styles, fmt.Sprintf("background:#%02x%02x%02x", c.Fill.R, c.Fill.G, c.Fill.B))
+	}
+	return strings.Join(styles, ";")
+}
+
+// Image draws the art with face, one cell per glyph advance and line height,
+// or two advances for double width art, in foreground on background where
+// cells have no color of their own. A nil face selects the built-in 7x13
+// bitmap font.
+func (a *Art) Image(face font.Face, foreground, background color.Color) *image.RGBA {
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+
+	// Cell size comes from the font so any monospaced face lines up
+	metrics := face.Metrics()
+	advance, ok := face.GlyphAdvance('M')
+	if !ok {
+		advance = font.MeasureString(face, "M")
+	}
+	cellWidth := advance.Ceil() * a.Columns()
+	lineHeight := metrics.Height.Ceil()
+
+	img := image.NewRGBA(image.Rect(0, 0, a.Width*cellWidth, a.Height*lineHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img, Face: face}
+	for y := 0; y < a.Height; y++ {
+		baseline := y*lineHeight + metrics.Ascent.Ceil()
+		for x, cell := range a.Cells[y*a.Width : (y+1)*a.Width] {
+			fg := foreground
+			if cell.Fill.A != 0 {
+				rect := image.Rect(x*cellWidth, y*lineHeight, (x+1)*cellWidth, (y+1)*lineHeight)
+				draw.Draw(img, rect, image.NewUniform(cell.Fill), image.Point{}, draw.Src)
+			}
+			if cell.Color.A != 0 {
+				if cell.Attr&Background != 0 {
+					rect := image.Rect(x*cellWidth, y*lineHeight, (x+1)*cellWidth, (y+1)*lineHeight)
+					draw.Draw(img, rect, image.NewUniform(cell.Color), image.Point{}, draw.Src)
+				} else {
+					fg = cell.Color
+				}
+			}
+			// Dim glyphs are drawn halfway to the background, reversed ones
+			// in the background on a cell of their color, and bold ones
+			// twice, a pixel apart
+			if cell.Attr&Dim != 0 {
+				fg = halfway(fg, background)
+			}
+			if cell.Attr&Reverse != 0 {
+				rect := image.Rect(x*cellWidth, y*lineHeight, (x+1)*cellWidth, (y+1)*lineHeight)
+				draw.Draw(img, rect, image.NewUniform(fg), image.Point{}, draw.Src)
+				fg = background
+			}
+			if cell.Rune == ' ' || cell.Rune == '\u3000' {
+				continue
+			}
+			d.Src = image.NewUniform(fg)
+			d.Dot = fixed.P(x*cellWidth, baseline)
+			d.DrawString(string(cell.Rune))
+			if cell.Attr&Bold != 0 {
+				d.Dot = fixed.P(x*cellWidth+1, baseline)
+				d.DrawString(string(cell.Rune))
+			}
+		}
+	}
+
+	return img
+}
+
+// halfway returns the color between a and b.
+func halfway(a, b color.Color) color.RGBA {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	return color.RGBA{uint8((ar + br) >> 9), uint8((ag + bg) >> 9), uint8((ab + bb) >> 9), 0xff}
+}
+
+// WriteTo writes the ANSI text of the art to w in a single call. Terminals
+// draw one large write far faster than many small ones, and without tearing
+// mid-frame.
+func (a *Art) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, a.ANSI())
+	return int64(n), err
+}
@@ -0,0 +1,121 @@
+package imgascii
+
+import (
+	"image"
+	"math"
+	"slices"
+	"sort"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// GlyphCoverage returns how much of its cell each character of charset
+// covers with ink when drawn with face, from 0 for none to 1 for all of it.
+// A nil face measures the built-in 7x13 bitmap font that Art.Image uses.
+func GlyphCoverage(charset string, face font.Face) []float64 {
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+
+	// Glyphs are measured in the same cell Art.Image draws them in
+	metrics := face.Metrics()
+	advance, ok := face.GlyphAdvance('M')
+	if !ok {
+		advance = font.MeasureString(face, "M")
+	}
+	cell := image.NewAlpha(image.Rect(0, 0, max(1, advance.Ceil()), max(1, metrics.Height.Ceil())))
+	area := float64(cell.Bounds().Dx() * cell.Bounds().Dy())
+	d := &font.Drawer{Dst: cell, Src: image.Opaque, Face: face}
+
+	runes := []rune(charset)
+	coverage := make([]float64, len(runes))
+	for i, r := range runes {
+		clear(cell.Pix)
+		d.Dot = fixed.P(0, metrics.Ascent.Ceil())
+		d.DrawString(string(r))
+		ink := 0
+		for _, a := range cell.Pix {
+			ink += int(a)
+		}
+		coverage[i] = float64(ink) / 255 / area
+	}
+	return coverage
+}
+
+// CalibrateCharset returns a ramp of the same length as charset whose ink
+// coverage, as drawn with face, rises as evenly as the characters allow.
+// The characters are sorted by measured coverage and every step of the ramp
+// takes the one closest to its share of the range, so a character may
+// repeat where the set has a gap and go unused where several are alike.
+// The lightest and densest characters always end the ramp. A nil face
+// measures the built-in 7x13 bitmap font.
+func CalibrateCharset(charset string, face font.Face) string {
+	runes := []rune(charset)
+	if len(runes) < 2 {
+		return charset
+	}
+	coverage := GlyphCoverage(charset, face)
+	order := make([]int, len(runes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return coverage[order[a]] < coverage[order[b]] })
+
+	lightest, densest := coverage[order[0]], coverage[order[len(order)-1]]
+	if densest == lightest {
+		return charset
+	}
+
+	ramp := make([]rune, len(runes))
+	for i := range ramp {
+		target := lightest + (densest-lightest)*float64(i)/float64(len(ramp)-1)
+		best := order[0]
+		for _, j := range order {
+			if math.Abs(coverage[j]-target) < math.Abs(coverage[best]-target) {
+				best = j
+			}
+		}
+		ramp[i] = runes[best]
+	}
+	return string(ramp)
+}
+
+// MissingGlyphs returns the characters of charset that face has no glyph
+// for, which Art.Image draws as the box or blank of a missing glyph rather
+// than the character. Spaces are never missing. A nil face checks the
+// built-in 7x13 bitmap font.
+func MissingGlyphs(charset string, face font.Face) []rune {
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+
+	// Most fonts say they have every glyph and draw the same placeholder
+	// for the ones they lack, as they do for U+FFFF, which no font has
+	metrics := face.Metrics()
+	cell := image.NewAlpha(image.Rect(0, 0, max(1, font.MeasureString(face, "MM").Ceil()), max(1, metrics.Height.Ceil())))
+	d := &font.Drawer{Dst: cell, Src: image.Opaque, Face: face}
+	draw := func(r rune) []byte {
+		clear(cell.Pix)
+		d.Dot = fixed.P(0, metrics.Ascent.Ceil())
+		d.DrawString(string(r))
+		return slices.Clone(cell.Pix)
+	}
+	placeholder := draw('\uffff')
+	if !slices.ContainsFunc(placeholder, func(a uint8) bool { return a != 0 }) {
+		placeholder = nil
+	}
+
+	var missing []rune
+	for _, r := range charset {
+		if unicode.IsSpace(r) || slices.Contains(missing, r) {
+			continue
+		}
+		if _, ok := face.GlyphAdvance(r); !ok || (placeholder != nil && slices.Equal(draw(r), placeholder)) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,258 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ansi16 holds the xterm defaults for the 16 basic ANSI colors.
+var ansi16 = []color.RGBA{
+	{0, 0, 0, 255}, {205, 0, 0, 255}, {0, 205, 0, 255}, {205, 205, 0, 255},
+	{0, 0, 238, 255}, {205, 0, 205, 255}, {0, 205, 205, 255}, {229, 229, 229, 255},
+	{127, 127, 127, 255}, {255, 0, 0, 255}, {0, 255, 0, 255}, {255, 255, 0, 255},
+	{92, 92, 255, 255}, {255, 0, 255, 255}, {0, 255, 255, 255}, {255, 255, 255, 255},
+}
+
+// xterm256 holds the 6x6x6 color cube and gray ramp of the 256-color
+// palette. The first 16 entries are left out because terminals theme them.
+var xterm256 = func() []color.RGBA {
+	levels := []uint8{0, 95, 135, 175, 215, 255}
+	var p []color.RGBA
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				p = append(p, color.RGBA{levels[r], levels[g], levels[b], 255})
+			}
+		}
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + 10*i)
+		p = append(p, color.RGBA{v, v, v, 255})
+	}
+	return p
+}()
+
+// ANSIPalette is the full 256-color terminal palette, indexed by the
+// numbers used in 38;5;N escape sequences.
+var ANSIPalette = append(append([]color.RGBA{}, ansi16...), xterm256...)
+
+// cellColors picks a color for every cell of img, as a grid of cells whose
+// runes are left for the ramp, from custom when it is not nil. The colors
+// are backgrounds when background is set. It returns nil when mode is none.
+func cellColors(img image.Image, mode, quantize string, custom []color.RGBA, background bool) []Cell {
+	if mode == "none" {
+		return nil
+	}
+
+	var attr Attr
+	if background {
+		attr = Background
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	pixels := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*w+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+
+	cells := make([]Cell, w*h)
+	palette, indexes := cellPalette(mode, custom)
+	if palette == nil {
+		for i, p := range pixels {
+			cells[i] = Cell{Color: color.RGBA{uint8(p[0]), uint8(p[1]), uint8(p[2]), 0xff}, Index: -1, Attr: attr}
+		}
+		return cells
+	}
+
+	for i, idx := range quantizeColors(pixels, w, palette, quantize) {
+		cells[i] = Cell{Color: palette[idx], Index: indexes[idx], Attr: attr}
+	}
+
+	return cells
+}
+
+// Paint colors every cell of the art with the pixel at its place in img,
+// which must be as large as the art, as Convert colors cells in the color
+// and quantize options given. The characters are left as they are, and a
+// color of none takes the colors away.
+func (a *Art) Paint(img image.Image, colorOption, quantize string) error {
+	if b := img.Bounds(); b.Dx() != a.Width || b.Dy() != a.Height {
+		return fmt.Errorf("paint: %dx%d colors for %dx%d art", b.Dx(), b.Dy(), a.Width, a.Height)
+	}
+	switch colorOption {
+	case "none", "16", "256", "truecolor":
+	default:
+		return fmt.Errorf("invalid color option %q", colorOption)
+	}
+	switch quantize {
+	case "nearest", "ciede2000", "dither":
+	default:
+		return fmt.Errorf("invalid quantize option %q", quantize)
+	}
+
+	cells := cellColors(img, colorOption, quantize, nil, false)
+	for i := range a.Cells {
+		if cells == nil {
+			a.Cells[i].Color, a.Cells[i].Index = color.RGBA{}, 0
+			continue
+		}
+		a.Cells[i].Color, a.Cells[i].Index = cells[i].Color, cells[i].Index
+	}
+	return nil
+}
+
+// quantizeColors maps each pixel of a w pixel wide image to a palette index.
+// The nearest strategy compares plain RGB distance, ciede2000 compares
+// perceptual distance in Lab space, and dither diffuses the RGB error of
+// each choice onto its neighbours with Floyd-Steinberg weights.
+func quantizeColors(pixels [][3]float64, w int, palette []color.RGBA, strategy string) []int {
+	indexes := make([]int, len(pixels))
+	switch strategy {
+	case "ciede2000":
+		labs := make([][3]float64, len(palette))
+		for i, c := range palette {
+			labs[i] = rgbToLab(float64(c.R), float64(c.G), float64(c.B))
+		}
+		for i, p := range pixels {
+			lab := rgbToLab(p[0], p[1], p[2])
+			best, bestDist := 0, math.Inf(1)
+			for j, pl := range labs {
+				if d := ciede2000(lab, pl); d < bestDist {
+					best, bestDist = j, d
+				}
+			}
+			indexes[i] = best
+		}
+	case "dither":
+		work := make([][3]float64, len(pixels))
+		copy(work, pixels)
+		h := len(pixels) / w
+		spread := func(x, y int, e [3]float64, weight float64) {
+			if x < 0 || x >= w || y >= h {
+				return
+			}
+			for k := range e {
+				work[y*w+x][k] += e[k] * weight
+			}
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				p := work[y*w+x]
+				idx := nearestRGB(p, palette)
+				indexes[y*w+x] = idx
+				c := palette[idx]
+				e := [3]float64{p[0] - float64(c.R), p[1] - float64(c.G), p[2] - float64(c.B)}
+				spread(x+1, y, e, 7.0/16)
+				spread(x-1, y+1, e, 3.0/16)
+				spread(x, y+1, e, 5.0/16)
+				spread(x+1, y+1, e, 1.0/16)
+			}
+		}
+	default:
+		for i, p := range pixels {
+			indexes[i] = nearestRGB(p, palette)
+		}
+	}
+
+	return indexes
+}
+
+func nearestRGB(p [3]float64, palette []color.RGBA) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range palette {
+		dr, dg, db := p[0]-float64(c.R), p[1]-float64(c.G), p[2]-float64(c.B)
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// rgbToLab converts 8-bit sRGB components to CIE L*a*b* with a D65 white.
+func rgbToLab(r, g, b float64) [3]float64 {
+	rl, gl, bl := srgbToLinear(r/255), srgbToLinear(g/255), srgbToLinear(b/255)
+	x := (0.4124*rl + 0.3576*gl + 0.1805*bl) / 0.95047
+	y := 0.2126*rl + 0.7152*gl + 0.0722*bl
+	z := (0.0193*rl + 0.1192*gl + 0.9505*bl) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// ciede2000 returns the CIEDE2000 color difference between two Lab colors.
+func ciede2000(lab1, lab2 [3]float64) float64 {
+	const deg = math.Pi / 180
+	l1, a1, b1 := lab1[0], lab1[1], lab1[2]
+	l2, a2, b2 := lab2[0], lab2[1], lab2[2]
+
+	c1 := math.Hypot(a1, b1)
+	c2 := math.Hypot(a2, b2)
+	cBar7 := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+math.Pow(25, 7))))
+	a1p, a2p := a1*(1+g), a2*(1+g)
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a)
+		if h < 0 {
+			h += 2 * math.Pi
+		}
+		return h
+	}
+	h1p, h2p := hue(b1, a1p), hue(b2, a2p)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+	dhp := 0.0
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > math.Pi {
+			dhp -= 2 * math.Pi
+		} else if dhp < -math.Pi {
+			dhp += 2 * math.Pi
+		}
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(dhp/2)
+
+	lBarp := (l1 + l2) / 2
+	cBarp := (c1p + c2p) / 2
+	hBarp := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) > math.Pi {
+			if hBarp < 2*math.Pi {
+				hBarp += 2 * math.Pi
+			} else {
+				hBarp -= 2 * math.Pi
+			}
+		}
+		hBarp /= 2
+	}
+
+	t := 1 - 0.17*math.Cos(hBarp-30*deg) + 0.24*math.Cos(2*hBarp) +
+		0.32*math.Cos(3*hBarp+6*deg) - 0.20*math.Cos(4*hBarp-63*deg)
+	dTheta := 30 * deg * math.Exp(-math.Pow((hBarp/deg-275)/25, 2))
+	cBarp7 := math.Pow(cBarp, 7)
+	rc := 2 * math.Sqrt(cBarp7/(cBarp7+math.Pow(25, 7)))
+	sl := 1 + 0.015*math.Pow(lBarp-50, 2)/math.Sqrt(20+math.Pow(lBarp-50, 2))
+	sc := 1 + 0.045*cBarp
+	sh := 1 + 0.015*cBarp*t
+	rt := -math.Sin(2*dTheta) * rc
+
+	return math.Sqrt(math.Pow(dLp/sl, 2) + math.Pow(dCp/sc, 2) + math.Pow(dHp/sh, 2) +
+		rt*(dCp/sc)*(dHp/sh))
+}
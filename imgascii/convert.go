@@ -0,0 +1,966 @@
+// Package imgascii converts images into ASCII art.
+//
+// A Converter holds on to a decoded image and the intermediate results of the
+// last conversion, so converting the same image again with slightly different
+// Options only re-runs the stages that those options affect.
+package imgascii
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"slices"
+	"unicode/utf8"
+)
+
+// Options controls every stage of the conversion pipeline.
+type Options struct {
+	// Width and Height are the size of the output in characters.
+	Width  int
+	Height int
+
+	// Crop limits the conversion to part of the source image. The zero
+	// rectangle uses the whole image.
+	Crop image.Rectangle
+
+	// Orient turns the art clockwise by 90, 180 or 270 degrees, for
+	// vertical banners and displays mounted on their side. Width and Height
+	// are the size of the turned grid, and cells keep their aspect as seen
+	// once it is turned back upright. Crop and Focus refer to the upright
+	// source.
+	Orient int
+
+	// Samples averages a Samples by Samples grid of points in every cell
+	// instead of picking one source pixel, which keeps detail from
+	// shimmering across animation frames. 0 and 1 take a single sample.
+	Samples int
+
+	// Scaler names the registered Scaler that shrinks the source to the
+	// output size. The built-in nearest picks the pixel under each cell.
+	Scaler string
+
+	// Linear averages pixels in linear light rather than as the gamma
+	// encoded sRGB values they are stored as, which darkens fine detail
+	// such as thin light lines on a dark ground. It applies to the Samples
+	// of the built-in scaler, to other scalers that average, and to the
+	// pixels the cells of block mappers cover.
+	Linear bool
+
+	// Focus, when set, crops the source to the output aspect ratio around
+	// this point instead of stretching it.
+	Focus *image.Point
+
+	// SmartCrop crops the source to the output aspect ratio around its most
+	// detailed region, as found by SalientRect, instead of stretching it.
+	// With Focus it prefers regions near that point, as SalientRectNear
+	// does.
+	SmartCrop bool
+
+	// Resize, when set to seam, brings a source whose aspect ratio is far
+	// from the output's closer to it by seam carving rather than stretching
+	// it: the paths of pixels across it with the least detail, mostly
+	// background, are removed one at a time, up to half of its columns or
+	// rows, keeping the subject whole. Whatever carving leaves of the
+	// difference is stretched. The default, empty, stretches it all.
+	Resize string
+
+	// Luma selects how color is reduced to gray: rec601, rec709, average or
+	// lightness (CIE L*).
+	Luma string
+
+	// Alpha picks what transparent pixels are composited onto: black,
+	// white or checker. The skip mode renders transparent cells as spaces.
+	Alpha string
+
+	// Mask, when set, picks the parts of the source that are converted:
+	// cells where it is light are converted as usual, and cells where it is
+	// dark or transparent are left as spaces, or MaskFill when it is set,
+	// for cut-out shapes. It is stretched over the whole source image and
+	// cropped and scaled along with it, so one of the same size lines up
+	// pixel for pixel.
+	Mask     image.Image `json:"-"`
+	MaskFill rune
+
+	// ToneMap selects the HDR tone mapping operator: none, reinhard, hable
+	// or aces.
+	ToneMap string
+
+	// Denoise, when above 0, smooths noise within this many cells with
+	// DenoiseFilter, median or gaussian, before any other tone stage.
+	// Sharpen then applies an unsharp mask of that amount, recovering edges
+	// that shrinking the image to a few cells blurred. 0 leaves it as is.
+	Denoise       int
+	DenoiseFilter string
+	Sharpen       float64
+
+	// Reference, when set, matches the tonal histogram of the output to
+	// another image so a batch renders with a consistent look.
+	Reference *Histogram
+
+	// AutoContrast stretches the histogram, clipping ClipLow and ClipHigh
+	// percent of the darkest and brightest pixels.
+	AutoContrast bool
+	ClipLow      float64
+	ClipHigh     float64
+
+	// Brightness is an offset from -1 to 1, Contrast a multiplier around
+	// middle gray and Gamma a power curve applied last.
+	Brightness float64
+	Contrast   float64
+	Gamma      float64
+
+	// Threshold, from 1 to 255, renders the image in two tones instead of
+	// the whole ramp: cells at least this bright after the tone adjustments
+	// get the last character of Charset and the rest the first. ThresholdAuto
+	// picks the level for each image with Otsu's method, and 0 keeps the
+	// ramp.
+	Threshold int
+
+	// Charset is the character ramp from empty to dense. See Charsets for
+	// the built-in ramps.
+	Charset string
+
+	// Dither diffuses rounding error between neighbouring cells so smooth
+	// gradients don't band into stripes of one character.
+	Dither bool
+
+	// Levels is how many steps tones are quantized to before picking a
+	// character, spread evenly over Charset so characters repeat when there
+	// are more levels than characters and are skipped when there are fewer.
+	// 0 gives every character one level. LevelBounds instead sets the gray
+	// level each step after the first starts at, rising from 1 to 255, for
+	// uneven steps.
+	Levels      int
+	LevelBounds []uint8
+
+	// Hysteresis, in levels, is how far past its glyph's range a cell's
+	// tone has to move before ConvertFrames changes the glyph from the
+	// previous frame. It keeps static backgrounds from flickering between
+	// neighbouring characters.
+	Hysteresis float64
+
+	// Invert reverses the character ramp.
+	Invert bool
+
+	// Attrs adds the Bold, Dim and Reverse attributes to the ramp as tones
+	// of their own: every character but the first comes dim, plain and
+	// bold, and above the densest the lighter half of the ramp follows in
+	// reverse video up to a full cell. It triples the tones of a ramp on
+	// terminals with few colors or none, and needs the luminance Mapper
+	// and the ascii Mode.
+	Attrs bool
+
+	// Mapper names the registered Mapper that picks the character of each
+	// cell from the pixels it covers. The built-in luminance, the default,
+	// picks from the ramp by tone. halfblock, braille and structural look
+	// at several pixels per cell, drawing them as half blocks, as braille
+	// dots or as the ramp character of the closest shape, and need the
+	// ascii Mode. Levels, Dither and Hysteresis only apply to luminance.
+	Mapper string
+
+	// Detail, when set to braille or quadrant, draws the busiest cells,
+	// whose pixels vary by a standard deviation of at least DetailThreshold
+	// gray levels, as braille dots or quadrant blocks, and the rest from
+	// the ramp by tone, keeping faces and text sharp where plain ramps blur
+	// them. It needs the luminance Mapper and the ascii Mode.
+	Detail          string
+	DetailThreshold float64
+
+	// Mode picks what each cell shows: ascii draws ramp characters, blocks
+	// draws only background-colored spaces and needs Color to be set,
+	// mosaic draws the one of Glyphs closest in color, and shade draws a
+	// shade character in a foreground over a background color, the pair and
+	// shade blending closest to the cell, and needs Color to be set.
+	Mode string
+
+	// Glyphs is the set mosaic mode picks from. When any glyph is double
+	// width, as emoji are, every cell covers two of the Width columns.
+	Glyphs []Glyph
+
+	// Color adds ANSI foreground colors: none, 16, 256 or truecolor.
+	Color string
+
+	// Tint, when set, colors cells from its gradient by the luminance of
+	// the image instead of by its colors, and needs Color to be set.
+	Tint *Tint
+
+	// Palette, when set, limits the colors of cells to its own, sent as
+	// they are in truecolor and as the closest of the 16 or 256 colors
+	// otherwise. Without it, PaletteSize picks that many colors from the
+	// image by median cut. Either needs Color to be set.
+	Palette     []color.RGBA
+	PaletteSize int
+
+	// Quantize picks how colors are matched to the 16 and 256 color
+	// palettes, or to Palette: nearest, ciede2000 or dither.
+	Quantize string
+
+	// Compact shortens colored output by not changing colors for spaces and
+	// dropping trailing spaces, so lines may be shorter than Width.
+	Compact bool
+
+	// Trim cuts the blank rows and columns around the subject once the
+	// effects and overlays are drawn, so the art may be smaller than Width
+	// by Height. Art that is blank all over is left as it is.
+	Trim bool
+
+	// Effects names registered Effects to restyle the grid with, in order.
+	// The built-in shadow, outline and scanlines draw a drop shadow, hollow
+	// out shapes and blank every second row.
+	Effects []string
+
+	// Overlays are stamped over the grid after mapping and effects.
+	Overlays []Overlay
+
+	// Hooks, when set, run functions of your own between the stages of the
+	// pipeline. Every stage runs again when Hooks points to other hooks,
+	// but not when the hooks it points to change. They are left out of
+	// the JSON of options, as functions have none.
+	Hooks *Hooks `json:"-"`
+}
+
+// aspect returns the width to height ratio of the part of the upright
+// source the art shows, as cells are about twice as tall as they are wide.
+func (o Options) aspect() float64 {
+	if o.Orient == 90 || o.Orient == 270 {
+		return float64(o.Height*2) / float64(o.Width)
+	}
+	return float64(o.Width) / float64(o.Height*2)
+}
+
+// ThresholdAuto is the Options.Threshold that picks the level by itself.
+const ThresholdAuto = -1
+
+// DefaultOptions returns the options used by the command line tool.
+func DefaultOptions() Options {
+	return Options{
+		Width:           64,
+		Height:          32,
+		Scaler:          "nearest",
+		Luma:            "rec601",
+		Alpha:           "black",
+		ToneMap:         "none",
+		DenoiseFilter:   "median",
+		ClipLow:         1,
+		ClipHigh:        1,
+		Contrast:        1,
+		Gamma:           1,
+		Charset:         Charsets["standard"],
+		Mode:            "ascii",
+		Mapper:          "luminance",
+		DetailThreshold: 32,
+		Color:           "none",
+		Quantize:        "nearest",
+	}
+}
+
+// Validate reports the first invalid option.
+func (o Options) Validate() error {
+	if o.Width < 1 || o.Height < 1 {
+		return fmt.Errorf("invalid size %dx%d", o.Width, o.Height)
+	}
+	if o.Samples < 0 {
+		return fmt.Errorf("invalid sample count %d", o.Samples)
+	}
+	switch o.Orient {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("invalid orientation %d: expected 90, 180 or 270", o.Orient)
+	}
+	if _, ok := lookupScaler(o.Scaler); !ok {
+		return fmt.Errorf("invalid scaler %q", o.Scaler)
+	}
+	for _, name := range o.Effects {
+		if _, ok := lookupEffect(name); !ok {
+			return fmt.Errorf("invalid effect %q", name)
+		}
+	}
+	if o.Resize != "" && o.Resize != "seam" {
+		return fmt.Errorf("invalid resize option %q", o.Resize)
+	}
+	switch o.Detail {
+	case "":
+	case "braille", "quadrant":
+		if o.Mapper != "" && o.Mapper != "luminance" {
+			return fmt.Errorf("detail cannot be combined with the %s mapper", o.Mapper)
+		}
+		if o.Mode != "ascii" {
+			return errors.New("detail needs ascii mode")
+		}
+		if o.DetailThreshold < 0 || o.DetailThreshold > 128 {
+			return fmt.Errorf("invalid detail threshold %g: expected 0 to 128", o.DetailThreshold)
+		}
+	default:
+		return fmt.Errorf("invalid detail option %q", o.Detail)
+	}
+	if o.Mapper != "" {
+		if _, ok := lookupMapper(o.Mapper); !ok {
+			return fmt.Errorf("invalid mapper %q", o.Mapper)
+		}
+		if blockMapper(o) != nil && o.Mode != "ascii" {
+			return fmt.Errorf("the %s mapper needs ascii mode", o.Mapper)
+		}
+	}
+	if o.Attrs && (o.Mode != "ascii" || blockMapper(o) != nil) {
+		return errors.New("attrs needs ascii mode and the luminance mapper without detail")
+	}
+	if o.Levels < 0 || o.Levels == 1 {
+		return fmt.Errorf("invalid level count %d: expected 0 or at least 2", o.Levels)
+	}
+	if err := validLevelBounds(o.LevelBounds); err != nil {
+		return fmt.Errorf("invalid level bounds: %v", err)
+	}
+	if o.Hysteresis < 0 {
+		return errors.New("hysteresis must not be negative")
+	}
+	if o.Threshold < ThresholdAuto || o.Threshold > 255 {
+		return fmt.Errorf("invalid threshold %d", o.Threshold)
+	}
+	if o.Denoise < 0 || o.Sharpen < 0 {
+		return errors.New("denoise and sharpen must not be negative")
+	}
+	if o.Denoise > 0 && o.DenoiseFilter != "median" && o.DenoiseFilter != "gaussian" {
+		return fmt.Errorf("invalid denoise filter %q", o.DenoiseFilter)
+	}
+	if o.Gamma <= 0 {
+		return errors.New("gamma must be greater than 0")
+	}
+	if o.ClipLow < 0 || o.ClipHigh < 0 || o.ClipLow+o.ClipHigh >= 100 {
+		return errors.New("clip percentiles must be positive and add up to less than 100")
+	}
+	switch o.Luma {
+	case "rec601", "rec709", "average", "lightness":
+	default:
+		return fmt.Errorf("invalid luma option %q", o.Luma)
+	}
+	switch o.Alpha {
+	case "black", "white", "checker", "skip":
+	default:
+		return fmt.Errorf("invalid alpha option %q", o.Alpha)
+	}
+	if utf8.RuneCountInString(o.Charset) < 2 {
+		return errors.New("charset needs at least two characters")
+	}
+	if o.Mask != nil && o.Mask.Bounds().Empty() {
+		return errors.New("mask is empty")
+	}
+	if o.MaskFill != 0 && SafeRune(o.MaskFill) != o.MaskFill {
+		return fmt.Errorf("mask fill %U is not a printable character", o.MaskFill)
+	}
+	// Every output takes printable characters, escaping what it must, but
+	// nothing can carry escapes, tabs or direction overrides safely
+	for _, r := range o.Charset {
+		if SafeRune(r) != r {
+			return fmt.Errorf("charset has %U, which is not a printable character", r)
+		}
+	}
+	for _, g := range o.Glyphs {
+		if SafeRune(g.Rune) != g.Rune {
+			return fmt.Errorf("glyphs have %U, which is not a printable character", g.Rune)
+		}
+	}
+	for _, ov := range o.Overlays {
+		for _, r := range ov.Text {
+			if SafeRune(r) != r {
+				return fmt.Errorf("text %q has %U, which is not a printable character", ov.Text, r)
+			}
+		}
+	}
+	switch o.Mode {
+	case "ascii":
+	case "blocks", "shade":
+		if o.Color == "none" {
+			return fmt.Errorf("%s mode needs a color option", o.Mode)
+		}
+	case "mosaic":
+		if len(o.Glyphs) == 0 {
+			return errors.New("mosaic mode needs glyphs")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q", o.Mode)
+	}
+	switch o.Color {
+	case "none", "16", "256", "truecolor":
+	default:
+		return fmt.Errorf("invalid color option %q", o.Color)
+	}
+	if o.PaletteSize < 0 {
+		return errors.New("palette size must not be negative")
+	}
+	if (o.Palette != nil || o.PaletteSize > 0) && o.Color == "none" {
+		return errors.New("palette needs a color option")
+	}
+	if o.Tint != nil && o.Color == "none" {
+		return errors.New("tint needs a color option")
+	}
+	switch o.Quantize {
+	case "nearest", "ciede2000", "dither":
+	default:
+		return fmt.Errorf("invalid quantize option %q", o.Quantize)
+	}
+	switch o.ToneMap {
+	case "none", "reinhard", "hable", "aces":
+	default:
+		return fmt.Errorf("invalid tone mapping option %q", o.ToneMap)
+	}
+	return nil
+}
+
+// Converter converts a single source image, caching the scaled, gray and
+// adjusted images between calls to Convert.
+type Converter struct {
+	src  image.Image
+	opts Options
+
+	region   image.Rectangle
+	scaled   image.Image
+	mask     *image.Alpha
+	cutout   *image.Alpha // the scaled Mask
+	flat     image.Image
+	colors   []Cell
+	gray     *image.Gray
+	adjusted *image.Gray
+	mapped   *Art
+	art      *Art
+	ascii    string
+
+	// prev holds the ramp levels of the previous animation frame, levels
+	// those of the last conversion
+	prev   []int
+	levels []int
+
+	progress Progress
+}
+
+// Progress is told how far a conversion has come, as done out of total
+// steps, after every step.
+type Progress func(done, total int)
+
+// convertSteps is the number of pipeline stages Convert reports progress
+// for: scaling, gray, colors, tone, mapping and finishing.
+const convertSteps = 6
+
+// OnProgress sets fn to be told about the stages of every later call to
+// Convert, including stages reused from the previous call. A nil fn stops
+// the reports.
+func (c *Converter) OnProgress(fn Progress) {
+	c.progress = fn
+}
+
+// report tells the progress function, if any, that step is done.
+func (c *Converter) report(step int) {
+	if c.progress != nil {
+		c.progress(step, convertSteps)
+	}
+}
+
+// NewConverter returns a Converter for src.
+func NewConverter(src image.Image) *Converter {
+	return &Converter{src: src}
+}
+
+// Convert renders the source image with opts. Stages whose inputs did not
+// change since the previous call are reused.
+func (c *Converter) Convert(opts Options) (string, error) {
+	return c.convert(context.Background(), opts)
+}
+
+// convert is Convert stopping with the error of ctx once it is done. The
+// context is checked between stages, and within the scaling stage by
+// scalers that are ContextScalers. The other stages take time in
+// proportion to the output, which is small.
+func (c *Converter) convert(ctx context.Context, opts Options) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	// A stage left behind by a cancelled call may not match c.opts, so
+	// the next call starts over
+	cancelled := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		c.scaled = nil
+		return true
+	}
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	// Each stage is dirty if its own options changed or any earlier stage
+	// was recomputed
+	prev := c.opts
+	dirty := c.scaled == nil ||
+		opts.Width != prev.Width || opts.Height != prev.Height ||
+		opts.Crop != prev.Crop || opts.Samples != prev.Samples || opts.Scaler != prev.Scaler ||
+		opts.Linear != prev.Linear || opts.Orient != prev.Orient ||
+		!sameFocus(opts.Focus, prev.Focus) || opts.SmartCrop != prev.SmartCrop || opts.Resize != prev.Resize ||
+		cellColumns(opts) != cellColumns(prev) || opts.Mapper != prev.Mapper || opts.Detail != prev.Detail ||
+		opts.Hooks != prev.Hooks || !sameImage(opts.Mask, prev.Mask)
+	if dirty {
+		source := c.src
+		if !opts.Crop.Empty() {
+			source = subImage(source, opts.Crop.Intersect(source.Bounds()))
+		}
+		switch {
+		case opts.SmartCrop && opts.Focus != nil:
+			source = subImage(source, SalientRectNear(source, opts.aspect(), *opts.Focus))
+		case opts.SmartCrop:
+			source = subImage(source, SalientRect(source, opts.aspect()))
+		case opts.Focus != nil:
+			source = cropAround(source, opts.aspect(), *opts.Focus)
+		}
+		c.region = source.Bounds()
+		if opts.Hooks != nil && opts.Hooks.BeforeScale != nil {
+			if source = opts.Hooks.BeforeScale(source); source == nil {
+				c.scaled = nil
+				return "", errors.New("BeforeScale hook must return an image")
+			}
+		}
+		// Mappers looking at several pixels per cell get them all
+		scaler, _ := lookupScaler(opts.Scaler)
+		bw, bh := blockSize(opts)
+		width, height := max(1, opts.Width/cellColumns(opts))*bw, opts.Height*bh
+		// Turned art is scaled from the upright source and turned after,
+		// which is cheaper than turning the source
+		if opts.Orient == 90 || opts.Orient == 270 {
+			width, height = height, width
+		}
+		var seams *seamCarving
+		if opts.Resize == "seam" {
+			if seams = findSeams(ctx, source, opts.aspect(), width, height); seams != nil {
+				source = seams.carve(ctx, source)
+			}
+		}
+		if opts.Linear {
+			source = linearLight(source)
+		}
+		if s, ok := scaler.(ContextScaler); ok {
+			c.scaled = s.ScaleContext(ctx, source, width, height, opts.Samples)
+		} else {
+			c.scaled = scaler.Scale(source, width, height, opts.Samples)
+		}
+		if opts.Linear {
+			c.scaled = encodeSRGB(c.scaled)
+		}
+		c.scaled = turn(c.scaled, opts.Orient)
+
+		c.cutout = nil
+		if opts.Mask != nil {
+			var mask image.Image = stretchedMask{mask: opts.Mask, src: c.src.Bounds(), bounds: c.region}
+			if seams != nil {
+				mask = seams.carve(ctx, mask)
+			}
+			c.cutout = maskAlpha(turn(scaler.Scale(mask, width, height, opts.Samples), opts.Orient))
+		}
+	}
+	c.report(1)
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	dirty = dirty || opts.Alpha != prev.Alpha ||
+		opts.Luma != prev.Luma || opts.ToneMap != prev.ToneMap
+	if dirty {
+		c.mask = nil
+		if opts.Alpha == "skip" {
+			c.mask = alphaMask(c.scaled)
+		}
+		c.mask = intersectMasks(c.mask, c.cutout)
+		c.flat = flattenAlpha(c.scaled, opts.Alpha)
+		if opts.ToneMap == "none" {
+			c.gray = convertToGray(c.flat, opts.Luma)
+		} else {
+			c.gray = toneMapToGray(c.flat, opts.ToneMap)
+		}
+		if opts.Hooks != nil && opts.Hooks.AfterGray != nil {
+			gray, err := grayHook("AfterGray", opts.Hooks.AfterGray, c.gray)
+			if err != nil {
+				c.scaled = nil
+				return "", err
+			}
+			c.gray = gray
+		}
+	}
+	c.report(2)
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	// Colors only depend on the flattened image, not on the tone stages
+	recolor := dirty || opts.Mode != prev.Mode || !slices.Equal(opts.Glyphs, prev.Glyphs) ||
+		opts.Color != prev.Color || opts.Quantize != prev.Quantize || !sameTint(opts.Tint, prev.Tint) ||
+		!slices.Equal(opts.Palette, prev.Palette) || opts.PaletteSize != prev.PaletteSize
+	if recolor {
+		var source image.Image = c.flat
+		if opts.Tint != nil {
+			source = opts.Tint.apply(c.gray)
+		}
+		bw, bh := blockSize(opts)
+		if opts.Linear && bw*bh > 1 {
+			source = encodeSRGB(shrinkBlocks(linearLight(source), bw, bh))
+		} else {
+			source = shrinkBlocks(source, bw, bh)
+		}
+		palette := opts.Palette
+		if palette == nil && opts.PaletteSize > 0 {
+			palette = MedianCut(source, opts.PaletteSize)
+		}
+		switch opts.Mode {
+		case "mosaic":
+			c.colors = mosaicCells(source, opts.Glyphs, opts.Quantize)
+		case "shade":
+			c.colors = shadeCells(source, opts.Color, opts.Quantize, palette)
+		default:
+			c.colors = cellColors(source, opts.Color, opts.Quantize, palette, opts.Mode == "blocks")
+		}
+	}
+	c.report(3)
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	dirty = dirty || opts.Denoise != prev.Denoise ||
+		opts.DenoiseFilter != prev.DenoiseFilter || opts.Sharpen != prev.Sharpen ||
+		opts.Reference != prev.Reference ||
+		opts.AutoContrast != prev.AutoContrast ||
+		opts.ClipLow != prev.ClipLow || opts.ClipHigh != prev.ClipHigh ||
+		opts.Brightness != prev.Brightness || opts.Contrast != prev.Contrast ||
+		opts.Gamma != prev.Gamma || opts.Threshold != prev.Threshold
+	if dirty {
+		c.adjusted = c.gray
+		if opts.Denoise > 0 {
+			c.adjusted = denoise(c.adjusted, opts.Denoise, opts.DenoiseFilter)
+		}
+		if opts.Sharpen > 0 {
+			c.adjusted = sharpen(c.adjusted, opts.Sharpen)
+		}
+		if opts.Reference != nil {
+			c.adjusted = matchHistogram(c.adjusted, opts.Reference)
+		}
+		if opts.AutoContrast {
+			c.adjusted = stretchContrast(c.adjusted, opts.ClipLow, opts.ClipHigh)
+		}
+		c.adjusted = adjustTone(c.adjusted, opts.Brightness, opts.Contrast, opts.Gamma)
+		switch {
+		case opts.Threshold == ThresholdAuto:
+			c.adjusted = threshold(c.adjusted, otsuThreshold(c.adjusted))
+		case opts.Threshold > 0:
+			c.adjusted = threshold(c.adjusted, opts.Threshold)
+		}
+		if opts.Hooks != nil && opts.Hooks.BeforeMap != nil {
+			adjusted, err := grayHook("BeforeMap", opts.Hooks.BeforeMap, c.adjusted)
+			if err != nil {
+				c.scaled = nil
+				return "", err
+			}
+			c.adjusted = adjusted
+		}
+	}
+	c.report(4)
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	dirty = dirty || recolor || opts.Charset != prev.Charset ||
+		opts.Dither != prev.Dither || opts.Invert != prev.Invert || opts.Attrs != prev.Attrs ||
+		opts.Levels != prev.Levels || !slices.Equal(opts.LevelBounds, prev.LevelBounds) ||
+		opts.Hysteresis != prev.Hysteresis || opts.MaskFill != prev.MaskFill ||
+		opts.DetailThreshold != prev.DetailThreshold
+	if dirty {
+		if m := blockMapper(opts); m != nil {
+			c.mapped, c.levels = mapBlocks(c.adjusted, c.flat, c.mask, c.colors, opts, m), nil
+		} else {
+			c.mapped, c.levels = mapToArt(c.adjusted, c.flat, c.mask, c.colors, opts, c.prev)
+		}
+		if c.cutout != nil && opts.MaskFill != 0 {
+			fill := opts.MaskFill
+			if cellColumns(opts) == 2 {
+				fill = widen(fill)
+			}
+			bw, bh := blockSize(opts)
+			fillCutout(c.mapped, c.cutout, bw, bh, fill)
+		}
+	}
+	c.report(5)
+	if cancelled() {
+		return "", ctx.Err()
+	}
+
+	dirty = dirty || opts.Compact != prev.Compact || opts.Trim != prev.Trim ||
+		!slices.Equal(opts.Effects, prev.Effects) || !slices.Equal(opts.Overlays, prev.Overlays)
+	if dirty {
+		c.art = finishArt(c.mapped, opts)
+		c.ascii = c.art.ANSI()
+	}
+	c.report(6)
+
+	c.opts = opts
+	return c.ascii, nil
+}
+
+// ConvertArt renders the source image like Convert, but returns the cell
+// grid for formats other than terminal text. The art is shared with later
+// calls and must not be modified.
+func (c *Converter) ConvertArt(opts Options) (*Art, error) {
+	if _, err := c.Convert(opts); err != nil {
+		return nil, err
+	}
+	return c.art, nil
+}
+
+// ConvertArtContext is ConvertArt stopping with the error of ctx once it
+// is cancelled, so a long conversion can be given up part way.
+func (c *Converter) ConvertArtContext(ctx context.Context, opts Options) (*Art, error) {
+	if _, err := c.convert(ctx, opts); err != nil {
+		return nil, err
+	}
+	return c.art, nil
+}
+
+// ConvertWithin converts like Convert but makes the output fit in maxBytes,
+// for art sent through channels with a size limit. It first switches to
+// Compact output, then steps the color down through 256 and 16 colors to
+// none, and finally shrinks the size keeping its aspect. It returns the art
+// with the options that produced it, or an error if even a single cell
+// doesn't fit.
+func (c *Converter) ConvertWithin(opts Options, maxBytes int) (string, Options, error) {
+	art, err := c.Convert(opts)
+	if err != nil || len(art) <= maxBytes {
+		return art, opts, err
+	}
+
+	steps := []func(*Options) bool{
+		func(o *Options) bool {
+			changed := !o.Compact
+			o.Compact = true
+			return changed
+		},
+		func(o *Options) bool {
+			// Blocks and shade modes have nothing to show without color,
+			// and a tint goes with the color
+			next := map[string]string{"truecolor": "256", "256": "16", "16": "none"}[o.Color]
+			if next == "" || next == "none" && (o.Mode == "blocks" || o.Mode == "shade") {
+				return false
+			}
+			o.Color = next
+			if next == "none" {
+				o.Tint = nil
+			}
+			return true
+		},
+	}
+	for _, step := range steps {
+		for step(&opts) {
+			if art, err = c.Convert(opts); err != nil || len(art) <= maxBytes {
+				return art, opts, err
+			}
+		}
+	}
+
+	// Shrinking by a tenth at a time keeps as much of the size as the
+	// budget allows
+	for w, h := opts.Width, opts.Height; w > 1 || h > 1; {
+		w, h = max(1, w*9/10), max(1, h*9/10)
+		opts.Width, opts.Height = w, h
+		if art, err = c.Convert(opts); err != nil || len(art) <= maxBytes {
+			return art, opts, err
+		}
+	}
+
+	return "", opts, fmt.Errorf("output does not fit in %d bytes", maxBytes)
+}
+
+// SourceRect returns the part of the source image used by the last call to
+// Convert, which is smaller than the full image when Focus or SmartCrop
+// crops it.
+func (c *Converter) SourceRect() image.Rectangle {
+	return c.region
+}
+
+// Convert is a shorthand for converting src once without keeping a Converter.
+func Convert(src image.Image, opts Options) (string, error) {
+	return NewConverter(src).Convert(opts)
+}
+
+// ConvertArt is a shorthand for converting src once to a cell grid.
+func ConvertArt(src image.Image, opts Options) (*Art, error) {
+	return NewConverter(src).ConvertArt(opts)
+}
+
+// An Option changes the options of ConvertContext, which start out as
+// DefaultOptions.
+type Option func(*Options)
+
+// WithOptions replaces every option with opts. Later options change it
+// further.
+func WithOptions(opts Options) Option {
+	return func(o *Options) { *o = opts }
+}
+
+// WithSize sets the size of the output in characters.
+func WithSize(width, height int) Option {
+	return func(o *Options) { o.Width, o.Height = width, height }
+}
+
+// WithCharset sets the character ramp from empty to dense.
+func WithCharset(charset string) Option {
+	return func(o *Options) { o.Charset = charset }
+}
+
+// WithColor sets the ANSI colors: none, 16, 256 or truecolor.
+func WithColor(color string) Option {
+	return func(o *Options) { o.Color = color }
+}
+
+// WithMode sets what each cell shows: ascii, blocks, mosaic or shade.
+func WithMode(mode string) Option {
+	return func(o *Options) { o.Mode = mode }
+}
+
+// WithHooks sets the functions run between the stages of the pipeline.
+func WithHooks(hooks *Hooks) Option {
+	return func(o *Options) { o.Hooks = hooks }
+}
+
+// ConvertContext converts src once to a cell grid like ConvertArt, but
+// stops with the error of ctx when it is cancelled or its deadline passes,
+// which servers need to drop work nobody waits for.
+func ConvertContext(ctx context.Context, src image.Image, opts ...Option) (*Art, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c := NewConverter(src)
+	if _, err := c.convert(ctx, o); err != nil {
+		return nil, err
+	}
+	return c.art, nil
+}
+
+// ConvertFrames converts every frame of an animation with opts. Unlike
+// converting the frames one by one, glyph choices carry over from frame to
+// frame as set by opts.Hysteresis.
+func ConvertFrames(frames []Frame, opts Options) ([]*Art, error) {
+	return ConvertFramesProgress(frames, opts, nil)
+}
+
+// ConvertFramesProgress is ConvertFrames telling progress, if not nil,
+// about every frame converted.
+func ConvertFramesProgress(frames []Frame, opts Options, progress Progress) ([]*Art, error) {
+	arts := make([]*Art, len(frames))
+	err := ConvertFramesEach(frames, opts, 0, func(i int, art *Art) error {
+		arts[i] = art
+		if progress != nil {
+			progress(i+1, len(frames))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return arts, nil
+}
+
+// ConvertFramesEach converts the frames of an animation on up to workers
+// goroutines, or GOMAXPROCS of them when workers is 0, and calls fn with
+// every art in frame order as soon as it and the frames before it are done.
+// Playback can then start before the last frame is converted. Workers stay
+// at most twice their number of frames ahead of fn, and an error from fn
+// stops the conversion. With opts.Hysteresis every frame depends on the one
+// before, so the frames are converted one at a time.
+func ConvertFramesEach(frames []Frame, opts Options, workers int, fn func(i int, art *Art) error) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if opts.Hysteresis > 0 || workers == 1 {
+		var levels []int
+		for i, frame := range frames {
+			c := NewConverter(frame.Image)
+			if opts.Hysteresis > 0 {
+				c.prev = levels
+			}
+			art, err := c.ConvertArt(opts)
+			if err != nil {
+				return err
+			}
+			levels = c.levels
+			if err := fn(i, art); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Every frame has its own buffered slot, so workers never wait on a
+	// slow fn, and ahead holds a token for every frame handed out but not
+	// yet taken by fn
+	type result struct {
+		art *Art
+		err error
+	}
+	slots := make([]chan result, len(frames))
+	for i := range slots {
+		slots[i] = make(chan result, 1)
+	}
+	ahead := make(chan struct{}, 2*workers)
+	jobs := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(jobs)
+		for i := range frames {
+			select {
+			case ahead <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for range workers {
+		go func() {
+			for i := range jobs {
+				art, err := ConvertArt(frames[i].Image, opts)
+				slots[i] <- result{art, err}
+			}
+		}()
+	}
+
+	for i := range frames {
+		r := <-slots[i]
+		<-ahead
+		if r.err != nil {
+			return r.err
+		}
+		if err := fn(i, r.art); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameFocus(a, b *image.Point) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameTint(a, b *Tint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,208 @@
+package imgascii
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// optionalFormats records which formats behind build tags were compiled in.
+var optionalFormats = map[string]bool{}
+
+// Features reports which of the parts of the package behind build tags
+// this build has: the heic and avif decoders and faces, face detection.
+func Features() map[string]bool {
+	return map[string]bool{
+		"heic":  optionalFormats["heic"],
+		"avif":  optionalFormats["avif"],
+		"faces": faceDetector != nil,
+	}
+}
+
+// DecodeOptions adjusts how images are decoded.
+type DecodeOptions struct {
+	// NoExifRotate keeps the stored pixel orientation instead of applying
+	// the EXIF orientation tag.
+	NoExifRotate bool
+
+	// IgnoreICC reads the pixels as sRGB even when the image carries an
+	// ICC profile for another color space, such as Display P3.
+	IgnoreICC bool
+
+	// Rotate turns the image clockwise by 90, 180 or 270 degrees after any
+	// EXIF rotation, and Flip then mirrors it: h left to right, v top to
+	// bottom.
+	Rotate int
+	Flip   string
+
+	// Crop keeps only this part of the image, in pixels of the turned
+	// image. Unlike Options.Crop it changes the decoded image itself, so its
+	// size and aspect are those of the cropped part. The zero rectangle keeps
+	// all of it.
+	Crop image.Rectangle
+}
+
+// Validate reports the first invalid setting in opts.
+func (opts DecodeOptions) Validate() error {
+	switch opts.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("invalid rotation %d: expected 90, 180 or 270", opts.Rotate)
+	}
+	switch opts.Flip {
+	case "", "h", "v":
+	default:
+		return fmt.Errorf("invalid flip %q: expected h or v", opts.Flip)
+	}
+	if opts.Crop != (image.Rectangle{}) && opts.Crop.Empty() {
+		return fmt.Errorf("invalid crop %v", opts.Crop)
+	}
+	return nil
+}
+
+// transform applies Rotate, Flip and Crop to an upright image.
+func (opts DecodeOptions) transform(img image.Image) (image.Image, error) {
+	img = turn(img, opts.Rotate)
+	img = orient(img, map[string]int{"h": 2, "v": 4}[opts.Flip])
+	if opts.Crop.Empty() {
+		return img, nil
+	}
+
+	rect, err := opts.cropRect(img.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	return subImage(img, rect), nil
+}
+
+// cropRect returns the part of an image of the given bounds Crop keeps.
+func (opts DecodeOptions) cropRect(bounds image.Rectangle) (image.Rectangle, error) {
+	rect := opts.Crop.Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return rect, fmt.Errorf("crop %d,%d,%d,%d is outside the %dx%d image",
+			opts.Crop.Min.X, opts.Crop.Min.Y, opts.Crop.Dx(), opts.Crop.Dy(), bounds.Dx(), bounds.Dy())
+	}
+	return rect, nil
+}
+
+// Decode reads an image from r with the default DecodeOptions. JPEG, PNG,
+// GIF, BMP, TIFF, WebP and Radiance HDR are registered by this package; for
+// animated GIFs, PNGs and WebPs only the first frame is used. AVIF and HEIC
+// are available when built with the avif and heic tags.
+func Decode(r io.Reader) (image.Image, error) {
+	return DecodeWith(r, DecodeOptions{})
+}
+
+// DecodeWith reads an image from r.
+func DecodeWith(r io.Reader, opts DecodeOptions) (image.Image, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// EXIF and ICC profiles live in the first segments of a JPEG, so a
+	// 64KB peek covers them
+	br := bufio.NewReaderSize(r, 64*1024)
+	if format := isoMediaFormat(br); format != "" && !optionalFormats[format] {
+		return nil, fmt.Errorf("failed to decode image: %s support requires building with -tags %s", format, format)
+	}
+	// x/image/webp only decodes still WebPs
+	if magic, _ := br.Peek(21); animatedWebP(magic) {
+		src, err := newWebPFrames(br, opts)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := src.Next()
+		return frame.Image, err
+	}
+
+	var header []byte
+	if !opts.NoExifRotate || !opts.IgnoreICC {
+		peeked, _ := br.Peek(64 * 1024)
+		header = bytes.Clone(peeked)
+	}
+	orientation := 1
+	if !opts.NoExifRotate {
+		orientation = exifOrientation(header)
+	}
+
+	img, _, err := image.Decode(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if !opts.IgnoreICC {
+		img = convertProfile(img, header)
+	}
+
+	return opts.transform(orient(img, orientation))
+}
+
+// DecodeBounds reads only the header of an image from r and returns the
+// bounds DecodeWith would give it, once turned upright, rotated and
+// cropped by opts, without decoding its pixels. It sizes work on many
+// images cheaply.
+func DecodeBounds(r io.Reader, opts DecodeOptions) (image.Rectangle, error) {
+	if err := opts.Validate(); err != nil {
+		return image.Rectangle{}, err
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	if format := isoMediaFormat(br); format != "" && !optionalFormats[format] {
+		return image.Rectangle{}, fmt.Errorf("failed to decode image: %s support requires building with -tags %s", format, format)
+	}
+	orientation := 1
+	if !opts.NoExifRotate {
+		header, _ := br.Peek(64 * 1024)
+		orientation = exifOrientation(header)
+	}
+
+	config, _, err := image.DecodeConfig(br)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	w, h := config.Width, config.Height
+	if orientation >= 5 && orientation <= 8 {
+		w, h = h, w
+	}
+	if opts.Rotate == 90 || opts.Rotate == 270 {
+		w, h = h, w
+	}
+	bounds := image.Rect(0, 0, w, h)
+	if opts.Crop.Empty() {
+		return bounds, nil
+	}
+	return opts.cropRect(bounds)
+}
+
+// isoMediaFormat sniffs the ftyp box of ISO base media files and reports
+// whether they hold AVIF or HEIC images. It returns "" for anything else.
+func isoMediaFormat(br *bufio.Reader) string {
+	header, _ := br.Peek(32)
+	if len(header) < 12 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return ""
+	}
+
+	// The major brand is followed by a version and the compatible brands
+	brands := header[8:12]
+	if len(header) > 16 {
+		brands = append(append([]byte{}, brands...), header[16:]...)
+	}
+	for i := 0; i+4 <= len(brands); i += 4 {
+		switch string(brands[i : i+4]) {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return "heic"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,11 @@
+//go:build avif
+
+package imgascii
+
+import (
+	_ "github.com/gen2brain/avif"
+)
+
+func init() {
+	optionalFormats["avif"] = true
+}
@@ -0,0 +1,11 @@
+//go:build heic
+
+package imgascii
+
+import (
+	_ "github.com/gen2brain/heic"
+)
+
+func init() {
+	optionalFormats["heic"] = true
+}
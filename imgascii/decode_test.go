@@ -0,0 +1,84 @@
+package imgascii
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// fixtureImage is a small image with a gradient across it, so encoders
+// can't store it as a single color.
+func fixtureImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestDecodeFormats(t *testing.T) {
+	encode := func(fn func(*bytes.Buffer) error) func(t *testing.T) []byte {
+		return func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			if err := fn(&buf); err != nil {
+				t.Fatal(err)
+			}
+			return buf.Bytes()
+		}
+	}
+	tests := []struct {
+		format string
+		data   func(t *testing.T) []byte
+		bounds image.Rectangle
+	}{
+		{"png", encode(func(b *bytes.Buffer) error { return png.Encode(b, fixtureImage(7, 5)) }), image.Rect(0, 0, 7, 5)},
+		{"gif", encode(func(b *bytes.Buffer) error { return gif.Encode(b, fixtureImage(9, 4), nil) }), image.Rect(0, 0, 9, 4)},
+		{"bmp", encode(func(b *bytes.Buffer) error { return bmp.Encode(b, fixtureImage(5, 3)) }), image.Rect(0, 0, 5, 3)},
+		{"tiff", encode(func(b *bytes.Buffer) error { return tiff.Encode(b, fixtureImage(6, 8), nil) }), image.Rect(0, 0, 6, 8)},
+		{"webp", func(t *testing.T) []byte {
+			data, err := os.ReadFile("testdata/gopher.webp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}, image.Rect(0, 0, 75, 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data := tt.data(t)
+
+			// The decoders are registered by this package's imports
+			_, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format {
+				t.Errorf("format %q, want %q", format, tt.format)
+			}
+
+			img, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != tt.bounds {
+				t.Errorf("Decode bounds %v, want %v", img.Bounds(), tt.bounds)
+			}
+			bounds, err := DecodeBounds(bytes.NewReader(data), DecodeOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bounds != tt.bounds {
+				t.Errorf("DecodeBounds %v, want %v", bounds, tt.bounds)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+	"sync"
+)
+
+// An Effect restyles the character grid after mapping, for text level looks
+// that would be awkward to get by filtering the image. Effects run in the
+// order Options.Effects lists them, before overlays are stamped on top, and
+// changing them only re-runs this last stage.
+type Effect interface {
+	// Apply changes the cells of art in place.
+	Apply(art *Art)
+}
+
+// EffectFunc adapts an ordinary function to the Effect interface.
+type EffectFunc func(art *Art)
+
+// Apply calls f.
+func (f EffectFunc) Apply(art *Art) {
+	f(art)
+}
+
+var (
+	effectsMu sync.RWMutex
+	effects   = map[string]Effect{
+		"shadow":    EffectFunc(dropShadow),
+		"outline":   EffectFunc(outline),
+		"scanlines": EffectFunc(scanlines),
+	}
+)
+
+// RegisterEffect makes an Effect available under name. It is meant to be
+// called from an init function and panics if name is empty, e is nil or the
+// name is already taken.
+func RegisterEffect(name string, e Effect) {
+	effectsMu.Lock()
+	defer effectsMu.Unlock()
+
+	if name == "" || e == nil {
+		panic("imgascii: RegisterEffect needs a name and an effect")
+	}
+	if _, dup := effects[name]; dup {
+		panic(fmt.Sprintf("imgascii: effect %q registered twice", name))
+	}
+	effects[name] = e
+}
+
+// Effects returns the sorted names of the registered effects.
+func Effects() []string {
+	effectsMu.RLock()
+	defer effectsMu.RUnlock()
+
+	names := make([]string, 0, len(effects))
+	for name := range effects {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupEffect(name string) (Effect, bool) {
+	effectsMu.RLock()
+	defer effectsMu.RUnlock()
+
+	e, ok := effects[name]
+	return e, ok
+}
+
+// finishArt applies the effects and overlays of opts to a copy of mapped.
+func finishArt(mapped *Art, opts Options) *Art {
+	art := &Art{Width: mapped.Width, Height: mapped.Height, Cells: slices.Clone(mapped.Cells), compact: opts.Compact}
+	for _, name := range opts.Effects {
+		e, _ := lookupEffect(name)
+		e.Apply(art)
+	}
+	applyOverlays(art.Cells, art.Width, art.Height, opts.Overlays)
+	if opts.Trim {
+		art = trimArt(art)
+	}
+	return art
+}
+
+// trimArt returns the part of art inside the blank rows and columns around
+// it, or art itself when there are none or nothing else.
+func trimArt(art *Art) *Art {
+	bounds := image.Rectangle{}
+	for y := 0; y < art.Height; y++ {
+		for x := 0; x < art.Width; x++ {
+			if !art.At(x, y).blank() {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if bounds.Empty() || bounds == image.Rect(0, 0, art.Width, art.Height) {
+		return art
+	}
+	trimmed := &Art{Width: bounds.Dx(), Height: bounds.Dy(), compact: art.compact}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		trimmed.Cells = append(trimmed.Cells, art.Cells[y*art.Width+bounds.Min.X:y*art.Width+bounds.Max.X]...)
+	}
+	return trimmed
+}
+
+// blank reports whether a cell shows nothing, being a space without a
+// background color or reverse video.
+func (c Cell) blank() bool {
+	return (c.Rune == ' ' || c.Rune == '\u3000') && c.Attr&(Background|Reverse) == 0 && c.Fill.A == 0
+}
+
+// clearCell blanks a cell, keeping the tone and color it was sampled with.
+func clearCell(c *Cell, r rune) {
+	c.Rune, c.Color, c.Index, c.Attr = r, color.RGBA{}, 0, c.Attr&Transparent
+	c.Fill, c.FillIndex = color.RGBA{}, 0
+}
+
+// dropShadow casts a shadow one cell down and to the right of everything
+// drawn, onto blank cells only.
+func dropShadow(art *Art) {
+	w, h := art.Width, art.Height
+	drawn := make([]bool, len(art.Cells))
+	for i, cell := range art.Cells {
+		drawn[i] = !cell.blank()
+	}
+	for y := h - 1; y > 0; y-- {
+		for x := w - 1; x > 0; x-- {
+			if i := y*w + x; art.Cells[i].blank() && drawn[i-w-1] {
+				clearCell(&art.Cells[i], '░')
+			}
+		}
+	}
+}
+
+// outline hollows out shapes, blanking every drawn cell whose four
+// neighbours are drawn too so only the edges remain.
+func outline(art *Art) {
+	w, h := art.Width, art.Height
+	drawn := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < w && y < h && !art.Cells[y*w+x].blank()
+	}
+	inner := make([]bool, len(art.Cells))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			inner[y*w+x] = drawn(x, y) && drawn(x-1, y) && drawn(x+1, y) && drawn(x, y-1) && drawn(x, y+1)
+		}
+	}
+	for i := range art.Cells {
+		if inner[i] {
+			clearCell(&art.Cells[i], ' ')
+		}
+	}
+}
+
+// scanlines blanks every second row, like the dark gaps between the lines
+// of a CRT.
+func scanlines(art *Art) {
+	for y := 1; y < art.Height; y += 2 {
+		for x := 0; x < art.Width; x++ {
+			clearCell(&art.Cells[y*art.Width+x], ' ')
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package imgascii
+
+import (
+	"errors"
+	"image"
+)
+
+// faceDetector finds faces when face detection is built in with the faces
+// build tag, and is nil otherwise.
+var faceDetector func(img image.Image) []image.Rectangle
+
+// DetectFaces returns the regions of img that hold faces, the most certain
+// first. Face detection is only built in with the faces build tag, as it
+// carries a detector and its trained cascade; without it DetectFaces
+// returns an error.
+func DetectFaces(img image.Image) ([]image.Rectangle, error) {
+	if faceDetector == nil {
+		return nil, errors.New("face detection requires building with -tags faces")
+	}
+	return faceDetector(img), nil
+}
@@ -0,0 +1,60 @@
+//go:build faces
+
+package imgascii
+
+import (
+	"context"
+	_ "embed"
+	"image"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// facefinder is the frontal face cascade that comes with pigo.
+//
+//go:embed cascade/facefinder
+var facefinder []byte
+
+func init() {
+	faceDetector = detectFaces
+}
+
+// detectFaces runs the pigo cascade over a copy of img no larger than 640
+// pixels a side, which finds faces of any useful size far faster than the
+// full image would.
+func detectFaces(img image.Image) []image.Rectangle {
+	classifier, err := pigo.NewPigo().Unpack(facefinder)
+	if err != nil {
+		return nil
+	}
+
+	bounds := img.Bounds()
+	scale := max(1, float64(max(bounds.Dx(), bounds.Dy()))/640)
+	w, h := max(1, int(float64(bounds.Dx())/scale)), max(1, int(float64(bounds.Dy())/scale))
+	gray := convertToGray(scaleImage(context.Background(), img, w, h, 1), "rec601")
+
+	params := pigo.CascadeParams{
+		MinSize:     max(20, min(w, h)/20),
+		MaxSize:     max(w, h),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{Pixels: gray.Pix, Rows: h, Cols: w, Dim: w},
+	}
+	detections := classifier.ClusterDetections(classifier.RunCascade(params, 0), 0.2)
+	sort.Slice(detections, func(i, j int) bool { return detections[i].Q > detections[j].Q })
+
+	// Scores below 5 are mostly false positives in pigo's own examples
+	var faces []image.Rectangle
+	for _, d := range detections {
+		if d.Q < 5 {
+			break
+		}
+		half := float64(d.Scale) / 2
+		faces = append(faces, image.Rect(
+			bounds.Min.X+int((float64(d.Col)-half)*scale), bounds.Min.Y+int((float64(d.Row)-half)*scale),
+			bounds.Min.X+int((float64(d.Col)+half)*scale), bounds.Min.Y+int((float64(d.Row)+half)*scale),
+		).Intersect(bounds))
+	}
+	return faces
+}
@@ -0,0 +1,130 @@
+//go:build !js
+
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The functions reading from the file system are left out of js builds,
+// where there is none; browsers pass the bytes of the image to Decode.
+
+// DecodeFile opens and decodes the image at path with the default options.
+func DecodeFile(path string) (image.Image, error) {
+	return DecodeFileWith(path, DecodeOptions{})
+}
+
+// DecodeFileWith opens and decodes the image at path.
+func DecodeFileWith(path string, opts DecodeOptions) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeWith(file, opts)
+}
+
+// DecodeFileBounds opens the image at path and returns its bounds as
+// DecodeBounds does.
+func DecodeFileBounds(path string, opts DecodeOptions) (image.Rectangle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeBounds(file, opts)
+}
+
+// DecodeFramesFile opens and decodes every frame of the image at path.
+func DecodeFramesFile(path string, opts DecodeOptions) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeFrames(file, opts)
+}
+
+// LoadSequence decodes every file matching pattern into frames shown at fps
+// frames per second. The pattern is a glob, a file name with a printf style
+// frame number such as frame%04d.png, which matches frame0001.png and on, or
+// a directory, whose files all are frames but for hidden ones. Files are
+// ordered naturally, so frame2.png comes before frame10.png.
+func LoadSequence(pattern string, fps float64, opts DecodeOptions) ([]Frame, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("invalid frame rate %g", fps)
+	}
+
+	paths, err := sequencePaths(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequence pattern: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %q", pattern)
+	}
+	sort.Slice(paths, func(i, j int) bool { return naturalLess(paths[i], paths[j]) })
+
+	delay := time.Duration(float64(time.Second) / fps)
+	frames := make([]Frame, 0, len(paths))
+	for _, path := range paths {
+		img, err := DecodeFileWith(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		frames = append(frames, Frame{Image: img, Delay: delay})
+	}
+
+	return frames, nil
+}
+
+// sequencePaths returns the files matching pattern. A printf style frame
+// number matches its digits, at least as many as it pads to, and the rest
+// of the file name and directories are taken literally, so frames that
+// ffmpeg or Blender wrote to folders with brackets in their names are found
+// too.
+func sequencePaths(pattern string) ([]string, error) {
+	var match func(name string) bool
+	dir, name := filepath.Split(pattern)
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		dir = pattern
+		match = func(name string) bool { return !strings.HasPrefix(name, ".") }
+	} else if loc := frameNumber.FindStringSubmatchIndex(name); loc != nil {
+		digits := `\d+`
+		if loc[2] >= 0 {
+			width, _ := strconv.Atoi(name[loc[2]:loc[3]])
+			digits = fmt.Sprintf(`\d{%d,}`, width)
+		}
+		number := regexp.MustCompile("^" + regexp.QuoteMeta(name[:loc[0]]) + digits + regexp.QuoteMeta(name[loc[1]:]) + "$")
+		match = number.MatchString
+	} else if frameNumber.MatchString(dir) {
+		return nil, fmt.Errorf("the frame number of %q is not in the file name", pattern)
+	} else {
+		return filepath.Glob(pattern)
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && match(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,89 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// denoise smooths noise out of img within radius cells: median takes the
+// median of every (2*radius+1)² window, which removes speckles and keeps
+// edges, and gaussian blurs with a Gaussian of that radius.
+func denoise(img *image.Gray, radius int, filter string) *image.Gray {
+	if filter == "gaussian" {
+		return gaussianBlur(img, radius)
+	}
+
+	bounds := img.Bounds()
+	smoothed := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var hist [256]int
+			count := 0
+			for wy := max(bounds.Min.Y, y-radius); wy < min(bounds.Max.Y, y+radius+1); wy++ {
+				for wx := max(bounds.Min.X, x-radius); wx < min(bounds.Max.X, x+radius+1); wx++ {
+					hist[img.GrayAt(wx, wy).Y]++
+					count++
+				}
+			}
+			level, seen := 0, hist[0]
+			for seen <= count/2 {
+				level++
+				seen += hist[level]
+			}
+			smoothed.SetGray(x, y, color.Gray{Y: uint8(level)})
+		}
+	}
+	return smoothed
+}
+
+// sharpen applies an unsharp mask: every cell moves away from the blur of
+// its neighbours by amount times the difference, so edges that downscaling
+// softened stand out again.
+func sharpen(img *image.Gray, amount float64) *image.Gray {
+	blurred := gaussianBlur(img, 1)
+	bounds := img.Bounds()
+	sharpened := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := float64(img.GrayAt(x, y).Y)
+			v += amount * (v - float64(blurred.GrayAt(x, y).Y))
+			sharpened.SetGray(x, y, color.Gray{Y: uint8(math.Round(math.Max(0, math.Min(255, v))))})
+		}
+	}
+	return sharpened
+}
+
+// gaussianBlur blurs img with a Gaussian of the given radius, as two passes
+// of a one dimensional kernel. Cells past the edge repeat the edge.
+func gaussianBlur(img *image.Gray, radius int) *image.Gray {
+	sigma := max(0.5, float64(radius)/2)
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	bounds := img.Bounds()
+	pass := func(src *image.Gray, dx, dy int) *image.Gray {
+		dst := image.NewGray(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				v := 0.0
+				for i, k := range kernel {
+					sx := min(max(x+(i-radius)*dx, bounds.Min.X), bounds.Max.X-1)
+					sy := min(max(y+(i-radius)*dy, bounds.Min.Y), bounds.Max.Y-1)
+					v += k * float64(src.GrayAt(sx, sy).Y)
+				}
+				dst.SetGray(x, y, color.Gray{Y: uint8(math.Round(v))})
+			}
+		}
+		return dst
+	}
+	return pass(pass(img, 1, 0), 0, 1)
+}
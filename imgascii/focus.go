@@ -0,0 +1,182 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ParseFocus turns a "x,y" pair of fractions into a point on the image. The
+// value "auto" picks the center of mass of the image's edge energy instead.
+func ParseFocus(value string, img image.Image) (image.Point, error) {
+	bounds := img.Bounds()
+	if value == "auto" {
+		return EdgeCentroid(img), nil
+	}
+
+	var fx, fy float64
+	if _, err := fmt.Sscanf(value, "%g,%g", &fx, &fy); err != nil {
+		return image.Point{}, fmt.Errorf("invalid focus %q: expected x,y or auto", value)
+	}
+	if fx < 0 || fx > 1 || fy < 0 || fy > 1 {
+		return image.Point{}, fmt.Errorf("invalid focus %q: coordinates must be between 0 and 1", value)
+	}
+
+	return image.Pt(
+		bounds.Min.X+int(fx*float64(bounds.Dx())),
+		bounds.Min.Y+int(fy*float64(bounds.Dy())),
+	), nil
+}
+
+// EdgeCentroid estimates where the subject is by weighting each pixel with
+// its local gradient, so busy detail pulls the point away from flat backdrops.
+func EdgeCentroid(img image.Image) image.Point {
+	bounds := img.Bounds()
+	edges, cols, rows, step := edgeGrid(img)
+
+	var sum, sumX, sumY float64
+	for gy := 0; gy < rows; gy++ {
+		for gx := 0; gx < cols; gx++ {
+			w := edges[gy*cols+gx]
+			sum += w
+			sumX += w * float64(bounds.Min.X+gx*step)
+			sumY += w * float64(bounds.Min.Y+gy*step)
+		}
+	}
+	if sum == 0 {
+		return image.Pt((bounds.Min.X+bounds.Max.X)/2, (bounds.Min.Y+bounds.Max.Y)/2)
+	}
+
+	return image.Pt(int(sumX/sum), int(sumY/sum))
+}
+
+// SalientRect finds the most detailed region of img with the given aspect
+// ratio, width over height, as large as the image allows. Detail is
+// measured as edge density, so a very wide banner cut from a tall photo
+// keeps the busy subject rather than the sky above it. Among equally
+// detailed regions the most central one wins.
+func SalientRect(img image.Image, aspect float64) image.Rectangle {
+	return salientRect(img, aspect, nil)
+}
+
+// SalientRectNear is SalientRect biased toward focus: the detail of every
+// region is weighed down by the distance of its center from focus, so a
+// region as far away as the image is across needs twice the detail to be
+// chosen over one centred on focus.
+func SalientRectNear(img image.Image, aspect float64, focus image.Point) image.Rectangle {
+	return salientRect(img, aspect, &focus)
+}
+
+func salientRect(img image.Image, aspect float64, focus *image.Point) image.Rectangle {
+	bounds := img.Bounds()
+	window := aroundRect(bounds, aspect, bounds.Min)
+	if window == bounds {
+		return bounds
+	}
+
+	// A summed area table gives the edges inside any window at once
+	edges, cols, rows, step := edgeGrid(img)
+	table := make([]float64, (cols+1)*(rows+1))
+	for gy := 0; gy < rows; gy++ {
+		for gx := 0; gx < cols; gx++ {
+			i := (gy+1)*(cols+1) + gx + 1
+			table[i] = edges[gy*cols+gx] + table[i-1] + table[i-cols-1] - table[i-cols-2]
+		}
+	}
+	ww, wh := min(cols, max(1, window.Dx()/step)), min(rows, max(1, window.Dy()/step))
+
+	// Distances are measured in half grid steps from the center of the
+	// image, or from focus
+	cx, cy := float64(cols), float64(rows)
+	if focus != nil {
+		cx, cy = 2*float64(focus.X-bounds.Min.X)/float64(step), 2*float64(focus.Y-bounds.Min.Y)/float64(step)
+	}
+	diagonal := math.Hypot(float64(2*cols), float64(2*rows))
+
+	best, bestX, bestY := -1.0, 0, 0
+	bestDistance := math.Inf(1)
+	for gy := 0; gy+wh <= rows; gy++ {
+		for gx := 0; gx+ww <= cols; gx++ {
+			sum := table[(gy+wh)*(cols+1)+gx+ww] - table[gy*(cols+1)+gx+ww] -
+				table[(gy+wh)*(cols+1)+gx] + table[gy*(cols+1)+gx]
+			distance := math.Hypot(float64(2*gx+ww)-cx, float64(2*gy+wh)-cy)
+			if focus != nil {
+				sum /= 1 + distance/diagonal
+			}
+			if sum > best || (sum == best && distance < bestDistance) {
+				best, bestX, bestY, bestDistance = sum, gx, gy, distance
+			}
+		}
+	}
+
+	x := min(bounds.Min.X+bestX*step, bounds.Max.X-window.Dx())
+	y := min(bounds.Min.Y+bestY*step, bounds.Max.Y-window.Dy())
+	return image.Rect(x, y, x+window.Dx(), y+window.Dy())
+}
+
+// edgeGrid samples the local gradient of img every step pixels, keeping
+// the sample count manageable for large images. The grid has cols by rows
+// points, starting at the top left corner of the image.
+func edgeGrid(img image.Image) ([]float64, int, int, int) {
+	bounds := img.Bounds()
+	step := max(1, max(bounds.Dx(), bounds.Dy())/256)
+	at := rgba64At(img)
+	luma := func(x, y int) float64 {
+		c := at(x, y)
+		return float64(luminance(uint32(c.R), uint32(c.G), uint32(c.B), "rec601"))
+	}
+
+	cols, rows := max(0, (bounds.Dx()-1)/step), max(0, (bounds.Dy()-1)/step)
+	edges := make([]float64, cols*rows)
+	for gy := 0; gy < rows; gy++ {
+		y := bounds.Min.Y + gy*step
+		for gx := 0; gx < cols; gx++ {
+			x := bounds.Min.X + gx*step
+			c := luma(x, y)
+			edges[gy*cols+gx] = math.Abs(luma(x+step, y)-c) + math.Abs(luma(x, y+step)-c)
+		}
+	}
+	return edges, cols, rows, step
+}
+
+// cropAround cuts the largest region with the given aspect ratio out of img,
+// centered as closely on focus as the image edges allow.
+func cropAround(img image.Image, aspect float64, focus image.Point) image.Image {
+	rect := aroundRect(img.Bounds(), aspect, focus)
+	if rect == img.Bounds() {
+		return img
+	}
+	return subImage(img, rect)
+}
+
+// aroundRect is the region cropAround cuts out of bounds.
+func aroundRect(bounds image.Rectangle, aspect float64, focus image.Point) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if float64(w)/float64(h) > aspect {
+		w = int(float64(h) * aspect)
+	} else {
+		h = int(float64(w) / aspect)
+	}
+	if w < 1 || h < 1 {
+		return bounds
+	}
+
+	x := max(bounds.Min.X, min(bounds.Max.X-w, focus.X-w/2))
+	y := max(bounds.Min.Y, min(bounds.Max.Y-h, focus.Y-h/2))
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// subImage returns the part of img inside rect, sharing pixels when the
+// image type allows it.
+func subImage(img image.Image, rect image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+
+	cropped := image.NewRGBA64(rect)
+	draw.Draw(cropped, rect, img, rect.Min, draw.Src)
+	return cropped
+}
@@ -0,0 +1,48 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// twoPatches returns a gray image 200 by 100 with a checkerboard in its
+// left and right quarters, the right one of contrast times the left's.
+func twoPatches(contrast uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			v := uint8(128)
+			if y >= 25 && y < 75 && (x/5+y/5)%2 == 0 {
+				switch {
+				case x >= 10 && x < 60:
+					v += 20
+				case x >= 140 && x < 190:
+					v += 20 * contrast
+				}
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestSalientRectNear(t *testing.T) {
+	left, right := image.Rect(10, 25, 60, 75), image.Rect(140, 25, 190, 75)
+	tests := []struct {
+		name     string
+		contrast uint8
+		focus    image.Point
+		patch    image.Rectangle
+	}{
+		{"focus on the left patch", 1, image.Pt(35, 50), left},
+		{"focus on the right patch", 1, image.Pt(165, 50), right},
+		{"much more detail away from focus", 5, image.Pt(35, 50), right},
+	}
+	for _, tt := range tests {
+		got := SalientRectNear(twoPatches(tt.contrast), 1, tt.focus)
+		if got.Dx() != 100 || got.Dy() != 100 || !tt.patch.In(got) {
+			t.Errorf("%s: SalientRectNear = %v, want a square around %v", tt.name, got, tt.patch)
+		}
+	}
+}
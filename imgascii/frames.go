@@ -0,0 +1,188 @@
+package imgascii
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// FrameSource hands out the frames of an image one at a time, each a whole
+// picture with any earlier frames it is drawn over composited in, and
+// turned by the DecodeOptions it was opened with.
+type FrameSource interface {
+	// Next returns the next frame, or io.EOF after the last one.
+	Next() (Frame, error)
+}
+
+// OpenFrames reads the frames of an image from r. Animated GIFs, APNGs and
+// animated WebPs give every frame of the animation, with their delays;
+// any other image gives a single frame.
+func OpenFrames(r io.Reader, opts DecodeOptions) (FrameSource, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(32)
+	switch {
+	case bytes.HasPrefix(magic, []byte("GIF8")):
+		return newGIFFrames(br, opts)
+	case bytes.HasPrefix(magic, pngSignature):
+		// Whether a PNG is animated is only known from its chunks
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		if src, err := newAPNGFrames(data, opts); src != nil || err != nil {
+			return src, err
+		}
+		return &stillFrame{r: bytes.NewReader(data), opts: opts}, nil
+	case animatedWebP(magic):
+		return newWebPFrames(br, opts)
+	}
+	return &stillFrame{r: br, opts: opts}, nil
+}
+
+// DecodeFrames reads every frame of an image from r, as OpenFrames hands
+// them out.
+func DecodeFrames(r io.Reader, opts DecodeOptions) ([]Frame, error) {
+	src, err := OpenFrames(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	var frames []Frame
+	for {
+		frame, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// stillFrame is the one frame of an image that isn't animated.
+type stillFrame struct {
+	r    io.Reader
+	opts DecodeOptions
+	done bool
+}
+
+func (s *stillFrame) Next() (Frame, error) {
+	if s.done {
+		return Frame{}, io.EOF
+	}
+	s.done = true
+	img, err := DecodeWith(s.r, s.opts)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Image: img}, nil
+}
+
+// How the area a frame covers is left for the next one: as it is, cleared
+// to transparent, or put back as it was before the frame.
+const (
+	disposeNone = iota
+	disposeBackground
+	disposePrevious
+)
+
+// frameCanvas composites the frames of an animation, each a patch drawn
+// over the picture the frames before it left.
+type frameCanvas struct {
+	canvas *image.RGBA
+	opts   DecodeOptions
+}
+
+func newFrameCanvas(bounds image.Rectangle, opts DecodeOptions) *frameCanvas {
+	return &frameCanvas{canvas: image.NewRGBA(bounds), opts: opts}
+}
+
+// draw draws patch over rect of the canvas, blending it with what is there
+// or replacing it, and returns the picture as a frame shown for delay.
+// dispose then sets what of rect the next frame is drawn over.
+func (c *frameCanvas) draw(patch image.Image, rect image.Rectangle, blend bool, dispose int, delay time.Duration) (Frame, error) {
+	bounds := c.canvas.Bounds()
+	var previous *image.RGBA
+	if dispose == disposePrevious {
+		previous = image.NewRGBA(bounds)
+		draw.Draw(previous, bounds, c.canvas, bounds.Min, draw.Src)
+	}
+
+	op := draw.Src
+	if blend {
+		op = draw.Over
+	}
+	draw.Draw(c.canvas, rect, patch, patch.Bounds().Min, op)
+	snapshot := image.NewRGBA(bounds)
+	draw.Draw(snapshot, bounds, c.canvas, bounds.Min, draw.Src)
+
+	switch dispose {
+	case disposeBackground:
+		draw.Draw(c.canvas, rect, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		c.canvas = previous
+	}
+
+	// Browsers treat a zero delay as 100ms, so do the same
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	turned, err := c.opts.transform(snapshot)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Image: turned, Delay: delay}, nil
+}
+
+// gifFrames are the frames of a GIF, composited honoring their disposal
+// methods.
+type gifFrames struct {
+	g      *gif.GIF
+	canvas *frameCanvas
+	next   int
+}
+
+func newGIFFrames(r io.Reader, opts DecodeOptions) (*gifFrames, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() && len(g.Image) > 0 {
+		bounds = g.Image[0].Bounds()
+	}
+	return &gifFrames{g: g, canvas: newFrameCanvas(bounds, opts)}, nil
+}
+
+func (s *gifFrames) Next() (Frame, error) {
+	i := s.next
+	if i >= len(s.g.Image) {
+		return Frame{}, io.EOF
+	}
+	s.next++
+
+	dispose := disposeNone
+	if i < len(s.g.Disposal) {
+		switch s.g.Disposal[i] {
+		case gif.DisposalBackground:
+			dispose = disposeBackground
+		case gif.DisposalPrevious:
+			dispose = disposePrevious
+		}
+	}
+	var delay time.Duration
+	if i < len(s.g.Delay) {
+		delay = time.Duration(s.g.Delay[i]) * 10 * time.Millisecond
+	}
+	paletted := s.g.Image[i]
+	return s.canvas.draw(paletted, paletted.Bounds(), true, dispose, delay)
+}
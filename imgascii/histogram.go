@@ -0,0 +1,59 @@
+package imgascii
+
+import (
+	"context"
+	"image"
+)
+
+// Histogram is the normalized cumulative luminance distribution of an
+// image, used to give other images the same tonal character.
+type Histogram [256]float64
+
+// HistogramOf computes the cumulative histogram of img using the given luma
+// formula. Large images are sampled on a grid to keep this cheap.
+func HistogramOf(img image.Image, luma string) *Histogram {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > 512 || h > 512 {
+		scale := float64(max(w, h)) / 512
+		w, h = max(1, int(float64(w)/scale)), max(1, int(float64(h)/scale))
+	}
+	gray := convertToGray(scaleImage(context.Background(), img, w, h, 1), luma)
+	return cumulative(gray)
+}
+
+func cumulative(img *image.Gray) *Histogram {
+	var counts [256]int
+	for _, v := range img.Pix {
+		counts[v]++
+	}
+
+	var hist Histogram
+	total, sum := float64(len(img.Pix)), 0
+	for i, n := range counts {
+		sum += n
+		hist[i] = float64(sum) / total
+	}
+	return &hist
+}
+
+// matchHistogram remaps the levels of img so its cumulative distribution
+// follows ref.
+func matchHistogram(img *image.Gray, ref *Histogram) *image.Gray {
+	src := cumulative(img)
+
+	var lut [256]uint8
+	j := 0
+	for i := range lut {
+		for j < 255 && ref[j] < src[i] {
+			j++
+		}
+		lut[i] = uint8(j)
+	}
+
+	matched := image.NewGray(img.Bounds())
+	for i, v := range img.Pix {
+		matched.Pix[i] = lut[v]
+	}
+	return matched
+}
@@ -0,0 +1,41 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+)
+
+// Hooks are functions of your own run between the stages of a conversion,
+// to look at or replace the image a stage hands on, as filters, masks or
+// segmentation the pipeline doesn't have. Any of them may be nil. When
+// ConvertFrames converts several frames at once, hooks are called from
+// several goroutines.
+type Hooks struct {
+	// BeforeScale is given the source image, once Crop, Focus and SmartCrop
+	// have cut it down, and returns the image to scale to the cells. It
+	// must not change the image it is given, which is the caller's, but
+	// may return one of any size.
+	BeforeScale func(img image.Image) image.Image
+
+	// AfterGray is given the scaled image reduced to gray levels, a pixel
+	// per cell or per dot of block mappers, before the tone adjustments,
+	// and returns the gray image to adjust. It may change the image it is
+	// given, but must keep its size.
+	AfterGray func(gray *image.Gray) *image.Gray
+
+	// BeforeMap is given the gray image after the tone adjustments, just
+	// before characters are picked for it, and returns the image to pick
+	// them for. It may change the image it is given, but must keep its
+	// size.
+	BeforeMap func(gray *image.Gray) *image.Gray
+}
+
+// grayHook runs hook, the hook called name, on gray and returns the image
+// it gives back, or an error when it is missing or of another size.
+func grayHook(name string, hook func(*image.Gray) *image.Gray, gray *image.Gray) (*image.Gray, error) {
+	bounds := gray.Bounds()
+	if gray = hook(gray); gray == nil || gray.Bounds() != bounds {
+		return nil, fmt.Errorf("%s hook must return a gray image of %v", name, bounds)
+	}
+	return gray, nil
+}
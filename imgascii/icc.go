@@ -0,0 +1,355 @@
+package imgascii
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Photos from recent phones and cameras are often tagged Display P3 or
+// Adobe RGB, whose primaries are further apart than those of sRGB. Read as
+// sRGB their tones and colors shift, so DecodeWith converts images with an
+// embedded ICC profile to sRGB. Only matrix and curve RGB profiles are
+// understood, which covers the common ones; others are left alone.
+
+// iccProfile returns the ICC profile embedded in the header of a JPEG, PNG
+// or WebP file, or nil when there is none.
+func iccProfile(header []byte) []byte {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8}):
+		return jpegICC(header)
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return pngICC(header)
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return webpICC(header)
+	}
+	return nil
+}
+
+// jpegICC joins the APP2 ICC_PROFILE segments a profile is split over.
+func jpegICC(header []byte) []byte {
+	var chunks [][]byte
+	for i := 2; i+4 <= len(header) && header[i] == 0xff; {
+		marker := header[i+1]
+		size := int(binary.BigEndian.Uint16(header[i+2:]))
+		if marker == 0xda || size < 2 {
+			break
+		}
+		body := header[i+4 : min(len(header), i+2+size)]
+		if marker == 0xe2 && bytes.HasPrefix(body, []byte("ICC_PROFILE\x00")) && len(body) > 14 {
+			// Each segment carries its number, from 1, and the count
+			seq, count := int(body[12]), int(body[13])
+			if chunks == nil {
+				chunks = make([][]byte, count)
+			}
+			if seq < 1 || seq > len(chunks) {
+				return nil
+			}
+			chunks[seq-1] = body[14:]
+		}
+		i += 2 + size
+	}
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil
+		}
+	}
+	return bytes.Join(chunks, nil)
+}
+
+// pngICC inflates the iCCP chunk, which comes before the image data.
+func pngICC(header []byte) []byte {
+	for i := 8; i+8 <= len(header); {
+		size := int(binary.BigEndian.Uint32(header[i:]))
+		kind := string(header[i+4 : i+8])
+		if kind == "IDAT" || i+12+size > len(header) {
+			break
+		}
+		if kind == "iCCP" {
+			// A profile name, a zero and the compression method come first
+			body := header[i+8 : i+8+size]
+			name := bytes.IndexByte(body, 0)
+			if name < 0 || name+2 > len(body) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := io.ReadAll(io.LimitReader(r, 4<<20))
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		i += 12 + size
+	}
+	return nil
+}
+
+// webpICC returns the ICCP chunk of an extended WebP file.
+func webpICC(header []byte) []byte {
+	for i := 12; i+8 <= len(header); {
+		size := int(binary.LittleEndian.Uint32(header[i+4:]))
+		if i+8+size > len(header) {
+			break
+		}
+		if string(header[i:i+4]) == "ICCP" {
+			return header[i+8 : i+8+size]
+		}
+		i += 8 + size + size&1
+	}
+	return nil
+}
+
+// iccTransform converts pixels of an RGB profile to sRGB: decoding each
+// channel through its tone curve to linear light, mixing the channels to
+// those of sRGB and encoding them as sRGB.
+type iccTransform struct {
+	// curves decode the 12 high bits of each channel to linear light
+	curves [3][]float32
+	matrix [3][3]float64
+}
+
+// srgbD50 holds the colorants of sRGB as ICC profiles store them, adapted
+// to the D50 white of the profile connection space, one column a channel.
+var srgbD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// parseICC reads the colorants and tone curves of an RGB matrix profile. It
+// returns nil for other profiles, broken ones and those close enough to
+// sRGB that converting would change nothing.
+func parseICC(profile []byte) *iccTransform {
+	if len(profile) < 132 || string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil
+	}
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for n := 0; n < count && 132+n*12+12 <= len(profile); n++ {
+		entry := profile[132+n*12:]
+		offset, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			return nil
+		}
+		tags[string(entry[:4])] = profile[offset : offset+size]
+	}
+
+	var t iccTransform
+	var colorants [3][3]float64
+	for c, name := range []string{"r", "g", "b"} {
+		xyz := tags[name+"XYZ"]
+		if len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil
+		}
+		for i := 0; i < 3; i++ {
+			colorants[i][c] = s15Fixed16(xyz[8+4*i:])
+		}
+		curve, ok := parseCurve(tags[name+"TRC"])
+		if !ok {
+			return nil
+		}
+		t.curves[c] = make([]float32, 1<<12)
+		for i := range t.curves[c] {
+			t.curves[c][i] = float32(curve(float64(i) / (1<<12 - 1)))
+		}
+	}
+
+	inverse, ok := invert3(srgbD50)
+	if !ok {
+		return nil
+	}
+	t.matrix = multiply3(inverse, colorants)
+	if t.nearSRGB() {
+		return nil
+	}
+	linearTables()
+	return &t
+}
+
+// nearSRGB reports whether t would hardly change a pixel.
+func (t *iccTransform) nearSRGB() bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(t.matrix[i][j]-want) > 0.01 {
+				return false
+			}
+		}
+	}
+	for _, curve := range t.curves {
+		for _, v := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+			if math.Abs(float64(curve[int(v*(1<<12-1))])-srgbToLinear(v)) > 0.005 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parseCurve reads a curv or para tone curve, mapping stored values from 0
+// to 1 to linear light.
+func parseCurve(tag []byte) (func(float64) float64, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+2*n {
+			return nil, false
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, true
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 0xffff
+		}
+		return func(x float64) float64 {
+			p := x * float64(n-1)
+			i := min(int(p), n-2)
+			return table[i] + (table[i+1]-table[i])*(p-float64(i))
+		}, true
+	case "para":
+		// Each function type adds parameters to the one before
+		kind := int(binary.BigEndian.Uint16(tag[8:]))
+		counts := []int{1, 3, 4, 5, 7}
+		if kind >= len(counts) || len(tag) < 12+4*counts[kind] {
+			return nil, false
+		}
+		p := make([]float64, 7)
+		for i := 0; i < counts[kind]; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		power := func(x float64) float64 { return math.Pow(math.Max(0, a*x+b), g) }
+		switch kind {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, true
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return power(x)
+				}
+				return 0
+			}, true
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return power(x) + c
+				}
+				return c
+			}, true
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return power(x)
+				}
+				return c * x
+			}, true
+		}
+		return func(x float64) float64 {
+			if x >= d {
+				return power(x) + e
+			}
+			return c*x + f
+		}, true
+	}
+	return nil, false
+}
+
+func multiply3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invert3(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return m, false
+	}
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// The cofactor of the transposed position, by cyclic indices
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv, true
+}
+
+// apply returns img converted to sRGB.
+func (t *iccTransform) apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	at := rgba64At(img)
+	converted := image.NewRGBA64(bounds)
+	parallelRows(bounds.Dy(), func(y0, y1 int) {
+		for y := bounds.Min.Y + y0; y < bounds.Min.Y+y1; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				converted.SetRGBA64(x, y, t.convert(at(x, y)))
+			}
+		}
+	})
+	return converted
+}
+
+// convert converts one premultiplied color.
+func (t *iccTransform) convert(c color.RGBA64) color.RGBA64 {
+	if c.A == 0 {
+		return c
+	}
+	a := uint32(c.A)
+	var in [3]float64
+	for i, v := range []uint16{c.R, c.G, c.B} {
+		in[i] = float64(t.curves[i][uint32(v)*0xffff/a>>4])
+	}
+	var out [3]uint16
+	for i := range out {
+		v := t.matrix[i][0]*in[0] + t.matrix[i][1]*in[1] + t.matrix[i][2]*in[2]
+		out[i] = uint16(uint32(toSRGB[uint16(math.Round(math.Max(0, math.Min(1, v))*0xffff))]) * a / 0xffff)
+	}
+	return color.RGBA64{out[0], out[1], out[2], c.A}
+}
+
+// convertProfile converts img to sRGB from the ICC profile, if any, found
+// in header.
+func convertProfile(img image.Image, header []byte) image.Image {
+	profile := iccProfile(header)
+	if profile == nil {
+		return img
+	}
+	t := parseICC(profile)
+	if t == nil {
+		return img
+	}
+	return t.apply(img)
+}
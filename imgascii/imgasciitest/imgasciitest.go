@@ -0,0 +1,115 @@
+// Package imgasciitest helps programs that embed imgascii notice when an
+// upgrade changes their rendered output.
+//
+// It ships a few small fixture images and golden file helpers. A test
+// converts a fixture with the options the program uses and compares the
+// result with a golden file committed next to the test:
+//
+//	func TestRender(t *testing.T) {
+//		opts := imgascii.DefaultOptions()
+//		opts.Color = "256"
+//		imgasciitest.ConvertGolden(t, imgasciitest.Fixture("smpte"), opts, "testdata/smpte.golden")
+//	}
+//
+// Running the tests with -imgasciitest.update writes the golden files
+// instead of comparing against them.
+package imgasciitest
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+//go:embed fixtures/*.png
+var fixtures embed.FS
+
+var update = flag.Bool("imgasciitest.update", false, "Write golden files instead of comparing against them")
+
+// Fixtures returns the names of the embedded fixture images: alpha, a
+// transparent disc over a color ramp, checkerboard, gradient, smpte and
+// zoneplate.
+func Fixtures() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Fixture decodes the named fixture image. It panics for unknown names, as
+// those are mistakes in the calling test.
+func Fixture(name string) image.Image {
+	data, err := fixtures.ReadFile("fixtures/" + name + ".png")
+	if err != nil {
+		panic(fmt.Sprintf("imgasciitest: unknown fixture %q", name))
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("imgasciitest: fixture %q: %v", name, err))
+	}
+	return img
+}
+
+// ConvertGolden converts img with opts and fails t if the art differs from
+// the golden file, reporting the first differing line.
+func ConvertGolden(t testing.TB, img image.Image, opts imgascii.Options, golden string) {
+	t.Helper()
+
+	art, err := imgascii.Convert(img, opts)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	Golden(t, art, golden)
+}
+
+// Golden compares art with the golden file, or writes the file when the
+// tests run with -imgasciitest.update.
+func Golden(t testing.TB, art, golden string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(art), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -imgasciitest.update to create it)", err)
+	}
+	if art == string(want) {
+		return
+	}
+
+	got, exp := strings.Split(art, "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < max(len(got), len(exp)); i++ {
+		var g, e string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(exp) {
+			e = exp[i]
+		}
+		if g != e {
+			t.Fatalf("output differs from %s at line %d:\n got: %q\nwant: %q", golden, i+1, g, e)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package imgasciitest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// TestFixtures renders every fixture against the golden files in
+// testdata, which -imgasciitest.update rewrites.
+func TestFixtures(t *testing.T) {
+	names := Fixtures()
+	if len(names) == 0 {
+		t.Fatal("no fixtures")
+	}
+	opts := imgascii.DefaultOptions()
+	opts.Width, opts.Height = 32, 12
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			ConvertGolden(t, Fixture(name), opts, filepath.Join("testdata", name+".golden"))
+		})
+	}
+}
+
+// recorder is a testing.TB that notes failures rather than stopping, so
+// the failure paths of Golden can be checked.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatal(args ...any) {
+	r.failures = append(r.failures, fmt.Sprint(args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestGolden(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "sub", "art.golden")
+	defer func(old bool) { *update = old }(*update)
+
+	*update = false
+	r := &recorder{TB: t}
+	Golden(r, "a\nb\n", golden)
+	if len(r.failures) == 0 || !strings.Contains(r.failures[0], "-imgasciitest.update") {
+		t.Errorf("missing golden file gave %q, want a hint to update", r.failures)
+	}
+
+	*update = true
+	r = &recorder{TB: t}
+	Golden(r, "a\nb\n", golden)
+	if len(r.failures) > 0 {
+		t.Fatalf("update failed: %q", r.failures)
+	}
+	if data, err := os.ReadFile(golden); err != nil || string(data) != "a\nb\n" {
+		t.Fatalf("update wrote %q, %v", data, err)
+	}
+
+	*update = false
+	r = &recorder{TB: t}
+	Golden(r, "a\nb\n", golden)
+	if len(r.failures) > 0 {
+		t.Errorf("same art failed: %q", r.failures)
+	}
+
+	r = &recorder{TB: t}
+	Golden(r, "a\nc\n", golden)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "line 2") {
+		t.Errorf("changed art gave %q, want a failure at line 2", r.failures)
+	}
+}
@@ -0,0 +1,116 @@
+package imgascii
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseLevelBounds parses gray levels written as "64,128,192", as used by
+// the command line, for Options.LevelBounds.
+func ParseLevelBounds(value string) ([]uint8, error) {
+	var bounds []uint8
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > 255 {
+			return nil, fmt.Errorf("invalid level bounds %q: expected gray levels from 1 to 255", value)
+		}
+		bounds = append(bounds, uint8(n))
+	}
+	if err := validLevelBounds(bounds); err != nil {
+		return nil, fmt.Errorf("invalid level bounds %q: %v", value, err)
+	}
+	return bounds, nil
+}
+
+func validLevelBounds(bounds []uint8) error {
+	for i, b := range bounds {
+		if b == 0 || i > 0 && b <= bounds[i-1] {
+			return errors.New("levels must start above 0 and rise")
+		}
+	}
+	return nil
+}
+
+// levelScale quantizes tones into the levels of Options.Levels or
+// Options.LevelBounds, and spreads those levels over the ramp.
+type levelScale struct {
+	// n is the number of levels, and bounds the tone each level after
+	// the first starts at, or nil for evenly spaced levels
+	n      int
+	bounds []uint8
+
+	// last is the index of the densest ramp character
+	last int
+}
+
+func newLevelScale(opts Options, ramp int) levelScale {
+	s := levelScale{n: ramp, last: ramp - 1}
+	switch {
+	case len(opts.LevelBounds) > 0:
+		s.n, s.bounds = len(opts.LevelBounds)+1, opts.LevelBounds
+	case opts.Levels > 0:
+		s.n = opts.Levels
+	}
+	return s
+}
+
+// position returns where tone v lies on the scale in levels, whose whole
+// part is its level, so hysteresis can measure how far a tone has moved
+// into a neighbouring level. Even levels split the 256 tones into bins of
+// the same width, and dithering measures its error from the tone of the
+// bin a cell falls in.
+func (s levelScale) position(v float64) float64 {
+	if s.bounds == nil {
+		return v * float64(s.n) / 256
+	}
+	level := 0
+	for level < len(s.bounds) && v >= float64(s.bounds[level]) {
+		level++
+	}
+	lo, hi := s.span(level)
+	return float64(level) + (v-lo)/(hi-lo)
+}
+
+// span returns the tones level covers, from lo up to but excluding hi.
+func (s levelScale) span(level int) (lo, hi float64) {
+	lo, hi = 0, 256
+	if level > 0 {
+		lo = float64(s.bounds[level-1])
+	}
+	if level < len(s.bounds) {
+		hi = float64(s.bounds[level])
+	}
+	return lo, hi
+}
+
+// level returns the level at position t.
+func (s levelScale) level(t float64) int {
+	return min(max(int(t), 0), s.n-1)
+}
+
+// tone returns the tone a level stands for, which dithering measures the
+// error from. The first and last levels stand for black and white.
+func (s levelScale) tone(level int) float64 {
+	switch {
+	case level == 0:
+		return 0
+	case level == s.n-1:
+		return 255
+	case s.bounds == nil:
+		return float64(level) * 255 / float64(s.n-1)
+	}
+	lo, hi := s.span(level)
+	return (lo + hi) / 2
+}
+
+// char returns the ramp index for level, spacing the levels evenly over
+// the ramp, so characters repeat when there are more levels than
+// characters and are skipped when there are fewer.
+func (s levelScale) char(level int) int {
+	if s.n == s.last+1 {
+		return level
+	}
+	return (level*s.last + (s.n-1)/2) / (s.n - 1)
+}
@@ -0,0 +1,88 @@
+package imgascii
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseLevelBounds(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []uint8
+		err   bool
+	}{
+		{"128", []uint8{128}, false},
+		{"64,128,192", []uint8{64, 128, 192}, false},
+		{" 1 , 255 ", []uint8{1, 255}, false},
+		{"255", []uint8{255}, false},
+		{"0", nil, true},
+		{"256", nil, true},
+		{"-1", nil, true},
+		{"128,64", nil, true},
+		{"64,64", nil, true},
+		{"64,,128", nil, true},
+		{"", nil, true},
+		{"dark", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevelBounds(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseLevelBounds(%q) error %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseLevelBounds(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLevelBoundsScale(t *testing.T) {
+	// Three levels over a ramp of five characters: below 64, from 64 and
+	// from 255, which holds only white
+	s := newLevelScale(Options{LevelBounds: []uint8{64, 255}}, 5)
+	tests := []struct {
+		tone  float64
+		level int
+		char  int
+	}{
+		{0, 0, 0},
+		{63, 0, 0},
+		{64, 1, 2},
+		{254, 1, 2},
+		{255, 2, 4},
+	}
+	for _, tt := range tests {
+		level := s.level(s.position(tt.tone))
+		if level != tt.level {
+			t.Errorf("tone %v is level %d, want %d", tt.tone, level, tt.level)
+		}
+		if char := s.char(level); char != tt.char {
+			t.Errorf("level %d is character %d, want %d", level, char, tt.char)
+		}
+	}
+
+	// The first and last levels stand for black and white, the others
+	// for the middle of their spans
+	for level, want := range []float64{0, 159.5, 255} {
+		if got := s.tone(level); got != want {
+			t.Errorf("level %d stands for tone %v, want %v", level, got, want)
+		}
+	}
+}
+
+func TestEvenLevels(t *testing.T) {
+	for _, n := range []int{2, 3, 4, 5, 10, 33} {
+		s := newLevelScale(Options{Levels: n}, 10)
+		counts := make([]int, n)
+		for v := 0; v < 256; v++ {
+			counts[s.level(s.position(float64(v)))]++
+		}
+		// Every level takes 256/n tones, give or take one where n doesn't
+		// divide 256
+		for level, count := range counts {
+			if count < 256/n || count > 256/n+1 {
+				t.Errorf("%d levels: level %d has %d tones, want %d", n, level, count, 256/n)
+			}
+		}
+	}
+}
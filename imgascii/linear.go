@@ -0,0 +1,91 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// Averaging gamma encoded values darkens the result, as a black and a white
+// pixel average to a gray that shows far darker than half their light. With
+// Options.Linear pixels are averaged in linear light instead, decoding sRGB
+// before the scaler and encoding the scaled image again after it.
+
+var (
+	linearOnce sync.Once
+	// toLinear and toSRGB map 16-bit values between sRGB and linear light
+	toLinear, toSRGB []uint16
+)
+
+func linearTables() {
+	linearOnce.Do(func() {
+		toLinear, toSRGB = make([]uint16, 1<<16), make([]uint16, 1<<16)
+		for i := range toLinear {
+			v := float64(i) / 0xffff
+			toLinear[i] = uint16(math.Round(srgbToLinear(v) * 0xffff))
+			toSRGB[i] = uint16(math.Round(linearToSRGB(v) * 0xffff))
+		}
+	})
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// mapRGBA64 applies table to the color channels of c. Colors are
+// premultiplied by alpha, so partly transparent ones are divided by it
+// first.
+func mapRGBA64(c color.RGBA64, table []uint16) color.RGBA64 {
+	switch c.A {
+	case 0:
+		return c
+	case 0xffff:
+		return color.RGBA64{table[c.R], table[c.G], table[c.B], c.A}
+	}
+	a := uint32(c.A)
+	channel := func(v uint16) uint16 {
+		return uint16(uint32(table[uint32(v)*0xffff/a]) * a / 0xffff)
+	}
+	return color.RGBA64{channel(c.R), channel(c.G), channel(c.B), c.A}
+}
+
+// linearImage shows an sRGB image in linear light.
+type linearImage struct {
+	image.Image
+	at func(x, y int) color.RGBA64
+}
+
+// linearLight returns img in linear light, converting pixels as they are
+// read so the whole source is not copied.
+func linearLight(img image.Image) image.Image {
+	linearTables()
+	return linearImage{img, rgba64At(img)}
+}
+
+func (l linearImage) ColorModel() color.Model { return color.RGBA64Model }
+
+func (l linearImage) At(x, y int) color.Color { return l.RGBA64At(x, y) }
+
+func (l linearImage) RGBA64At(x, y int) color.RGBA64 {
+	return mapRGBA64(l.at(x, y), toLinear)
+}
+
+// encodeSRGB returns img, which is in linear light, encoded as sRGB.
+func encodeSRGB(img image.Image) *image.RGBA64 {
+	linearTables()
+	bounds := img.Bounds()
+	at := rgba64At(img)
+	encoded := image.NewRGBA64(bounds)
+	parallelRows(bounds.Dy(), func(y0, y1 int) {
+		for y := bounds.Min.Y + y0; y < bounds.Min.Y+y1; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				encoded.SetRGBA64(x, y, mapRGBA64(at(x, y), toSRGB))
+			}
+		}
+	})
+	return encoded
+}
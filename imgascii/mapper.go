@@ -0,0 +1,400 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// A Mapper picks the character of every cell from the block of pixels the
+// cell covers, for mapping strategies other than a ramp by luminance, such
+// as braille dots or matching glyph shapes. Programs can add their own with
+// RegisterMapper and select it by name with Options.Mapper.
+type Mapper interface {
+	// Block returns how many pixels across and down each cell covers. The
+	// source is scaled to that many pixels per cell, and the tone stages
+	// run on those pixels.
+	Block() (width, height int)
+
+	// Map returns the cell for block. Returning block.Cell with only its
+	// Rune changed keeps the color the other options gave it. Map may be
+	// called from several goroutines at once.
+	Map(block Block) Cell
+}
+
+// Block is the part of the image one cell covers, as handed to a Mapper.
+type Block struct {
+	Width, Height int
+
+	// Gray holds the tone of every pixel row by row, after every tone
+	// adjustment, and Pixels their colors with any transparency
+	// flattened.
+	Gray   []uint8
+	Pixels []color.RGBA
+
+	// Ramp is Options.Charset, reversed when Options.Invert is set, and
+	// Invert is Options.Invert, for mappers that draw without the ramp.
+	Ramp   []rune
+	Invert bool
+
+	// Cell is the cell as the other options make it, with the color and
+	// the average tone and pixel of the block, but no rune yet.
+	Cell Cell
+}
+
+var (
+	mappersMu sync.RWMutex
+	// luminance picks ramp characters by tone, halfblock and braille draw
+	// the pixels above half tone as half blocks and dots, and structural
+	// picks the ramp character whose shape is closest to the block
+	mappers = map[string]Mapper{
+		"luminance":  luminanceMapper{},
+		"halfblock":  halfblockMapper{},
+		"braille":    brailleMapper{},
+		"structural": &structuralMapper{masks: map[string][][]float64{}},
+	}
+)
+
+// RegisterMapper makes a Mapper available under name. It is meant to be
+// called from an init function and panics if name is empty, m is nil or the
+// name is already taken.
+func RegisterMapper(name string, m Mapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+
+	if name == "" || m == nil {
+		panic("imgascii: RegisterMapper needs a name and a mapper")
+	}
+	if _, dup := mappers[name]; dup {
+		panic(fmt.Sprintf("imgascii: mapper %q registered twice", name))
+	}
+	mappers[name] = m
+}
+
+// Mappers returns the sorted names of the registered mappers.
+func Mappers() []string {
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+
+	names := make([]string, 0, len(mappers))
+	for name := range mappers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupMapper(name string) (Mapper, bool) {
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+
+	m, ok := mappers[name]
+	return m, ok
+}
+
+// blockMapper returns the Mapper opts select, or nil for the luminance
+// ramp, which the pipeline maps itself so Dither and Hysteresis can carry
+// state from cell to cell. Detail maps the ramp with finer glyphs.
+func blockMapper(opts Options) Mapper {
+	if opts.Detail != "" {
+		return detailMapper{fine: opts.Detail, threshold: opts.DetailThreshold}
+	}
+	if opts.Mapper == "" {
+		return nil
+	}
+	m, _ := lookupMapper(opts.Mapper)
+	if _, ok := m.(luminanceMapper); ok {
+		return nil
+	}
+	return m
+}
+
+// blockSize returns the pixels per cell of the Mapper opts select.
+func blockSize(opts Options) (int, int) {
+	if m := blockMapper(opts); m != nil {
+		w, h := m.Block()
+		return max(1, w), max(1, h)
+	}
+	return 1, 1
+}
+
+// luminanceMapper picks the ramp character for the tone of the cell.
+type luminanceMapper struct{}
+
+func (luminanceMapper) Block() (int, int) { return 1, 1 }
+
+func (luminanceMapper) Map(b Block) Cell {
+	// Every character takes an even share of the 256 tones
+	b.Cell.Rune = b.Ramp[int(b.Gray[0])*len(b.Ramp)/256]
+	return b.Cell
+}
+
+// inked reports which pixels of b are at least half tone, as bright pixels
+// get the dense end of the ramp, or below it when b is inverted.
+func inked(b Block) []bool {
+	ink := make([]bool, len(b.Gray))
+	for i, g := range b.Gray {
+		ink[i] = (g >= 0x80) != b.Invert
+	}
+	return ink
+}
+
+// halfblockMapper splits each cell into a top and a bottom half, doubling
+// the vertical resolution.
+type halfblockMapper struct{}
+
+func (halfblockMapper) Block() (int, int) { return 1, 2 }
+
+func (halfblockMapper) Map(b Block) Cell {
+	ink := inked(b)
+	b.Cell.Rune = []rune{' ', '▀', '▄', '█'}[boolBit(ink[0])|boolBit(ink[1])<<1]
+	return b.Cell
+}
+
+// brailleMapper draws each cell as a braille pattern of two by four dots,
+// the finest detail a cell can show.
+type brailleMapper struct{}
+
+func (brailleMapper) Block() (int, int) { return 2, 4 }
+
+// brailleDots are the bits of the braille dots for the pixels of a block,
+// row by row. The bottom row was added to the six dot patterns last, so
+// its bits come last.
+var brailleDots = []rune{0x01, 0x08, 0x02, 0x10, 0x04, 0x20, 0x40, 0x80}
+
+func (brailleMapper) Map(b Block) Cell {
+	var dots rune
+	for i, ink := range inked(b) {
+		if ink {
+			dots |= brailleDots[i]
+		}
+	}
+	// An empty pattern is a space, so effects see the cell as blank
+	b.Cell.Rune = ' '
+	if dots != 0 {
+		b.Cell.Rune = 0x2800 + dots
+	}
+	return b.Cell
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// structuralMapper picks the ramp character whose ink, as drawn in the
+// built-in 7x13 bitmap font, lies closest to the bright pixels of the block,
+// so edges come out as slashes, bars and underscores rather than as tones.
+// It works best with a ramp of many shapes, such as the detailed charset.
+type structuralMapper struct {
+	mu sync.Mutex
+	// masks holds the ink of every character of a ramp, scaled to the
+	// block, by ramp
+	masks map[string][][]float64
+}
+
+// structuralWidth and structuralHeight are the block size of
+// structuralMapper, about the aspect of the font's cells.
+const structuralWidth, structuralHeight = 4, 8
+
+func (*structuralMapper) Block() (int, int) { return structuralWidth, structuralHeight }
+
+func (m *structuralMapper) Map(b Block) Cell {
+	masks := m.rampMasks(b.Ramp)
+	best, bestDistance := 0, -1.0
+	for i, mask := range masks {
+		distance := 0.0
+		for j, g := range b.Gray {
+			d := float64(g)/255 - mask[j]
+			distance += d * d
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	b.Cell.Rune = b.Ramp[best]
+	return b.Cell
+}
+
+// rampMasks returns the masks of ramp, drawing them the first time.
+func (m *structuralMapper) rampMasks(ramp []rune) [][]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := string(ramp)
+	if masks, ok := m.masks[key]; ok {
+		return masks
+	}
+
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	advance, _ := face.GlyphAdvance('M')
+	cell := image.NewAlpha(image.Rect(0, 0, advance.Ceil(), metrics.Height.Ceil()))
+	d := &font.Drawer{Dst: cell, Src: image.Opaque, Face: face}
+	cw, ch := cell.Bounds().Dx(), cell.Bounds().Dy()
+
+	masks := make([][]float64, len(ramp))
+	for i, r := range ramp {
+		clear(cell.Pix)
+		d.Dot = fixed.P(0, metrics.Ascent.Ceil())
+		d.DrawString(string(r))
+
+		// Every block pixel averages the font pixels it covers
+		mask := make([]float64, structuralWidth*structuralHeight)
+		for y := 0; y < structuralHeight; y++ {
+			for x := 0; x < structuralWidth; x++ {
+				x0, x1 := x*cw/structuralWidth, max(x*cw/structuralWidth+1, (x+1)*cw/structuralWidth)
+				y0, y1 := y*ch/structuralHeight, max(y*ch/structuralHeight+1, (y+1)*ch/structuralHeight)
+				sum := 0
+				for fy := y0; fy < y1; fy++ {
+					for fx := x0; fx < x1; fx++ {
+						sum += int(cell.AlphaAt(fx, fy).A)
+					}
+				}
+				mask[y*structuralWidth+x] = float64(sum) / 255 / float64((x1-x0)*(y1-y0))
+			}
+		}
+		masks[i] = mask
+	}
+	m.masks[key] = masks
+	return masks
+}
+
+// detailMapper picks from the ramp by tone, like luminance, but draws
+// cells whose pixels vary by at least threshold as braille dots or, when
+// fine is quadrant, as quadrant blocks, inked where they are brighter than
+// the cell, so edges keep their shape.
+type detailMapper struct {
+	fine      string
+	threshold float64
+}
+
+// quadrants are the quadrant block characters for the inked quarters of a
+// cell, the top left the lowest bit and the bottom right the highest.
+var quadrants = []rune(" ▘▝▀▖▌▞▛▗▚▐▜▄▙▟█")
+
+func (m detailMapper) Block() (int, int) {
+	if m.fine == "quadrant" {
+		return 2, 2
+	}
+	return 2, 4
+}
+
+func (m detailMapper) Map(b Block) Cell {
+	var sum, squares float64
+	for _, g := range b.Gray {
+		sum += float64(g)
+		squares += float64(g) * float64(g)
+	}
+	n := float64(len(b.Gray))
+	mean := sum / n
+	if math.Sqrt(max(0, squares/n-mean*mean)) < m.threshold {
+		b.Cell.Rune = b.Ramp[min(int(mean), 255)*len(b.Ramp)/256]
+		return b.Cell
+	}
+
+	var bits rune
+	for i, g := range b.Gray {
+		if (float64(g) > mean) != b.Invert {
+			if m.fine == "quadrant" {
+				bits |= 1 << i
+			} else {
+				bits |= brailleDots[i]
+			}
+		}
+	}
+	switch {
+	case m.fine == "quadrant":
+		b.Cell.Rune = quadrants[bits]
+	case bits == 0:
+		b.Cell.Rune = ' '
+	default:
+		b.Cell.Rune = 0x2800 + bits
+	}
+	return b.Cell
+}
+
+// shrinkBlocks averages every bw by bh block of img into one pixel, giving
+// the one pixel per cell image the color stage works on.
+func shrinkBlocks(img image.Image, bw, bh int) image.Image {
+	if bw == 1 && bh == 1 {
+		return img
+	}
+	bounds := img.Bounds()
+	at := rgba64At(img)
+	w, h := bounds.Dx()/bw, bounds.Dy()/bh
+	small := image.NewRGBA64(image.Rect(0, 0, w, h))
+	n := uint32(bw * bh)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a uint32
+			for by := 0; by < bh; by++ {
+				for bx := 0; bx < bw; bx++ {
+					c := at(bounds.Min.X+x*bw+bx, bounds.Min.Y+y*bh+by)
+					r, g, b, a = r+uint32(c.R), g+uint32(c.G), b+uint32(c.B), a+uint32(c.A)
+				}
+			}
+			small.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return small
+}
+
+// mapBlocks maps every cell with m from its block of img, the adjusted
+// tones, and flat, the flattened colors. Cells that are mostly see-through
+// in mask are left blank.
+func mapBlocks(img *image.Gray, flat image.Image, mask *image.Alpha, colors []Cell, opts Options, m Mapper) *Art {
+	bw, bh := blockSize(opts)
+	bounds := img.Bounds()
+	w, h := bounds.Dx()/bw, bounds.Dy()/bh
+	ramp := []rune(opts.Charset)
+	if opts.Invert {
+		slices.Reverse(ramp)
+	}
+	var small *image.Alpha
+	if mask != nil {
+		small = alphaMask(shrinkBlocks(mask, bw, bh))
+	}
+
+	cells := make([]Cell, w*h)
+	parallelRows(h, func(y0, y1 int) {
+		block := Block{Width: bw, Height: bh, Gray: make([]uint8, bw*bh), Pixels: make([]color.RGBA, bw*bh), Ramp: ramp, Invert: opts.Invert}
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				var gray, r, g, b int
+				for by := 0; by < bh; by++ {
+					for bx := 0; bx < bw; bx++ {
+						px, py := bounds.Min.X+x*bw+bx, bounds.Min.Y+y*bh+by
+						j := by*bw + bx
+						block.Gray[j] = img.GrayAt(px, py).Y
+						block.Pixels[j] = color.RGBAModel.Convert(flat.At(px, py)).(color.RGBA)
+						gray += int(block.Gray[j])
+						r, g, b = r+int(block.Pixels[j].R), g+int(block.Pixels[j].G), b+int(block.Pixels[j].B)
+					}
+				}
+				n := bw * bh
+				i := y*w + x
+				block.Cell = Cell{}
+				if colors != nil {
+					block.Cell = colors[i]
+				}
+				block.Cell.Gray = uint8(gray / n)
+				block.Cell.Pixel = color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff}
+				if transparent(small, x, y) {
+					cells[i] = Cell{Rune: ' ', Attr: Transparent, Gray: block.Cell.Gray, Pixel: block.Cell.Pixel}
+					continue
+				}
+				cells[i] = m.Map(block)
+			}
+		}
+	})
+	return &Art{Width: w, Height: h, Cells: cells}
+}
@@ -0,0 +1,79 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+)
+
+// stretchedMask is a mask stretched over src, the bounds of the source
+// image, showing the part within bounds, so a mask of another size than the
+// source still covers it whole.
+type stretchedMask struct {
+	mask        image.Image
+	src, bounds image.Rectangle
+}
+
+func (m stretchedMask) ColorModel() color.Model { return m.mask.ColorModel() }
+
+func (m stretchedMask) Bounds() image.Rectangle { return m.bounds }
+
+func (m stretchedMask) At(x, y int) color.Color {
+	mb := m.mask.Bounds()
+	return m.mask.At(mb.Min.X+(x-m.src.Min.X)*mb.Dx()/m.src.Dx(), mb.Min.Y+(y-m.src.Min.Y)*mb.Dy()/m.src.Dy())
+}
+
+// maskAlpha returns how much of every pixel of a scaled mask is converted,
+// its luminance times its alpha, as an alpha mask.
+func maskAlpha(img image.Image) *image.Alpha {
+	bounds := img.Bounds()
+	alpha := image.NewAlpha(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Premultiplied, so transparent pixels are black
+			r, g, b, _ := img.At(x, y).RGBA()
+			alpha.SetAlpha(x, y, color.Alpha{luminance(r, g, b, "rec601")})
+		}
+	}
+	return alpha
+}
+
+// intersectMasks returns the alpha mask of pixels both a and b show, either
+// of which may be nil for all of them.
+func intersectMasks(a, b *image.Alpha) *image.Alpha {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	both := image.NewAlpha(a.Bounds())
+	for i := range both.Pix {
+		both.Pix[i] = min(a.Pix[i], b.Pix[i])
+	}
+	return both
+}
+
+// fillCutout sets the cells of art that cutout, the scaled mask, leaves
+// out to fill, using blocks of bw by bh pixels per cell.
+func fillCutout(art *Art, cutout *image.Alpha, bw, bh int, fill rune) {
+	if bw*bh > 1 {
+		cutout = alphaMask(shrinkBlocks(cutout, bw, bh))
+	}
+	origin := cutout.Bounds().Min
+	for i := range art.Cells {
+		if transparent(cutout, origin.X+i%art.Width, origin.Y+i/art.Width) {
+			art.Cells[i].Rune = fill
+			art.Cells[i].Attr &^= Transparent
+		}
+	}
+}
+
+// sameImage reports whether a and b are the same image, which images that
+// can't be compared never are.
+func sameImage(a, b image.Image) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return reflect.TypeOf(a).Comparable() && reflect.TypeOf(b).Comparable() && a == b
+}
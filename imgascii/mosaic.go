@@ -0,0 +1,100 @@
+package imgascii
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Glyph is a character that shows as a color of its own, such as a colored
+// emoji, for mosaic mode.
+type Glyph struct {
+	Rune  rune
+	Color color.RGBA
+}
+
+// GlyphSets are the built-in glyph sets for mosaic mode, colored as common
+// emoji fonts draw them.
+var GlyphSets = map[string][]Glyph{
+	"squares": {
+		{'⬛', color.RGBA{0x29, 0x2f, 0x33, 0xff}},
+		{'⬜', color.RGBA{0xe6, 0xe7, 0xe8, 0xff}},
+		{'🟥', color.RGBA{0xdd, 0x2e, 0x44, 0xff}},
+		{'🟧', color.RGBA{0xf4, 0x90, 0x0c, 0xff}},
+		{'🟨', color.RGBA{0xfd, 0xcb, 0x58, 0xff}},
+		{'🟩', color.RGBA{0x78, 0xb1, 0x59, 0xff}},
+		{'🟦', color.RGBA{0x55, 0xac, 0xee, 0xff}},
+		{'🟪', color.RGBA{0xaa, 0x8e, 0xd6, 0xff}},
+		{'🟫', color.RGBA{0xc1, 0x69, 0x4f, 0xff}},
+	},
+	"circles": {
+		{'⚫', color.RGBA{0x29, 0x2f, 0x33, 0xff}},
+		{'⚪', color.RGBA{0xe6, 0xe7, 0xe8, 0xff}},
+		{'🔴', color.RGBA{0xdd, 0x2e, 0x44, 0xff}},
+		{'🟠', color.RGBA{0xf4, 0x90, 0x0c, 0xff}},
+		{'🟡', color.RGBA{0xfd, 0xcb, 0x58, 0xff}},
+		{'🟢', color.RGBA{0x78, 0xb1, 0x59, 0xff}},
+		{'🔵', color.RGBA{0x55, 0xac, 0xee, 0xff}},
+		{'🟣', color.RGBA{0xaa, 0x8e, 0xd6, 0xff}},
+		{'🟤', color.RGBA{0xc1, 0x69, 0x4f, 0xff}},
+	},
+}
+
+// ParseGlyphs reads a glyph set with one glyph per line, each followed by
+// the color it shows as, as in "🟥 #dd2e44". Blank lines are skipped.
+func ParseGlyphs(r io.Reader) ([]Glyph, error) {
+	var glyphs []Glyph
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var g Glyph
+		if len(fields) != 2 || utf8.RuneCountInString(fields[0]) != 1 {
+			return nil, fmt.Errorf("line %d: expected a glyph and #rrggbb", line)
+		}
+		g.Rune, _ = utf8.DecodeRuneInString(fields[0])
+		if _, err := fmt.Sscanf(fields[1], "#%02x%02x%02x", &g.Color.R, &g.Color.G, &g.Color.B); err != nil {
+			return nil, fmt.Errorf("line %d: invalid color", line)
+		}
+		g.Color.A = 0xff
+		glyphs = append(glyphs, g)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(glyphs) == 0 {
+		return nil, fmt.Errorf("no glyphs")
+	}
+	return glyphs, nil
+}
+
+// mosaicCells picks the glyph closest in color to every cell of img, matched
+// with the given Quantize strategy. The glyphs bring their own color, so the
+// cells keep the default one.
+func mosaicCells(img image.Image, glyphs []Glyph, quantize string) []Cell {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	pixels := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*w+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+
+	palette := make([]color.RGBA, len(glyphs))
+	for i, g := range glyphs {
+		palette[i] = g.Color
+	}
+	cells := make([]Cell, w*h)
+	for i, idx := range quantizeColors(pixels, w, palette, quantize) {
+		cells[i] = Cell{Rune: glyphs[idx].Rune, Index: -1}
+	}
+	return cells
+}
@@ -0,0 +1,119 @@
+package imgascii
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// exifOrientation returns the EXIF orientation tag found in the header of a
+// JPEG or TIFF file, or 1 (upright) when there is none.
+func exifOrientation(header []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		tiff = header
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8}):
+		// Walk the JPEG segments looking for the APP1 Exif block
+		for i := 2; i+4 <= len(header) && header[i] == 0xff; {
+			marker := header[i+1]
+			size := int(binary.BigEndian.Uint16(header[i+2:]))
+			if marker == 0xda || size < 2 {
+				break
+			}
+			body := header[i+4 : min(len(header), i+2+size)]
+			if marker == 0xe1 && bytes.HasPrefix(body, []byte("Exif\x00\x00")) {
+				tiff = body[6:]
+				break
+			}
+			i += 2 + size
+		}
+	}
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if tiff[0] == 'M' {
+		order = binary.BigEndian
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+
+	return 1
+}
+
+// turn turns img clockwise by 90, 180 or 270 degrees, or returns it as it
+// is for 0.
+func turn(img image.Image, degrees int) image.Image {
+	return orient(img, map[int]int{90: 6, 180: 3, 270: 8}[degrees])
+}
+
+// TurnedBounds returns the bounds of an image of the given bounds turned
+// clockwise by degrees, as seen by art with that Options.Orient, for sizing
+// the art to the aspect of the image.
+func TurnedBounds(bounds image.Rectangle, degrees int) image.Rectangle {
+	if degrees == 90 || degrees == 270 {
+		return image.Rect(0, 0, bounds.Dy(), bounds.Dx())
+	}
+	return bounds
+}
+
+// orient applies one of the eight EXIF orientations to img so the result is
+// upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	at := rgba64At(img)
+	dst := image.NewRGBA64(image.Rect(0, 0, dw, dh))
+	parallelRows(dh, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < dw; x++ {
+				var sx, sy int
+				switch orientation {
+				case 2:
+					sx, sy = w-1-x, y
+				case 3:
+					sx, sy = w-1-x, h-1-y
+				case 4:
+					sx, sy = x, h-1-y
+				case 5:
+					sx, sy = y, x
+				case 6:
+					sx, sy = y, h-1-x
+				case 7:
+					sx, sy = w-1-y, h-1-x
+				case 8:
+					sx, sy = w-1-y, x
+				}
+				dst.SetRGBA64(x, y, at(bounds.Min.X+sx, bounds.Min.Y+sy))
+			}
+		}
+	})
+
+	return dst
+}
@@ -0,0 +1,95 @@
+package imgascii
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+)
+
+// Overlay is text stamped over the converted grid, replacing the characters
+// underneath it.
+type Overlay struct {
+	Text string
+
+	// X and Y are the column and row of the first character. Negative
+	// values count from the right and bottom edges, so X of -1 puts the
+	// last character in the last column.
+	X, Y int
+
+	// Center centers the text in its row, ignoring X.
+	Center bool
+
+	// Color is the text color. The zero value keeps the default color.
+	Color color.RGBA
+}
+
+// ParseOverlay parses "x,y[,#rrggbb]:text" as used by the command line. An
+// x of c centers the text.
+func ParseOverlay(value string) (Overlay, error) {
+	spec, text, ok := strings.Cut(value, ":")
+	if !ok || text == "" {
+		return Overlay{}, fmt.Errorf("invalid overlay %q: expected x,y[,#rrggbb]:text", value)
+	}
+
+	o := Overlay{Text: text}
+	parts := strings.Split(spec, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Overlay{}, fmt.Errorf("invalid overlay %q: expected x,y[,#rrggbb]:text", value)
+	}
+	if parts[0] == "c" {
+		o.Center, parts[0] = true, "0"
+	}
+	if _, err := fmt.Sscanf(parts[0]+" "+parts[1], "%d %d", &o.X, &o.Y); err != nil {
+		return Overlay{}, fmt.Errorf("invalid overlay position %q", spec)
+	}
+	if len(parts) == 3 {
+		if _, err := fmt.Sscanf(parts[2], "#%02x%02x%02x", &o.Color.R, &o.Color.G, &o.Color.B); err != nil {
+			return Overlay{}, fmt.Errorf("invalid overlay color %q", parts[2])
+		}
+		o.Color.A = 0xff
+	}
+
+	return o, nil
+}
+
+// applyOverlays writes each overlay into the cell grid. Text running past
+// the right edge is cut off rather than wrapped.
+func applyOverlays(cells []Cell, w, h int, overlays []Overlay) {
+	for _, o := range overlays {
+		x, y := o.X, o.Y
+		switch {
+		case o.Center:
+			x = (w - utf8.RuneCountInString(o.Text)) / 2
+		case x < 0:
+			x = w + x + 1 - utf8.RuneCountInString(o.Text)
+		}
+		if y < 0 {
+			y = h + y
+		}
+		if y < 0 || y >= h {
+			continue
+		}
+
+		for _, r := range o.Text {
+			if x >= 0 && x < w {
+				cell := &cells[y*w+x]
+				cell.Rune, cell.Color, cell.Index, cell.Attr = r, o.Color, -1, 0
+				cell.Fill, cell.FillIndex = color.RGBA{}, 0
+			}
+			x++
+		}
+	}
+}
+
+// String formats o the way ParseOverlay reads it.
+func (o Overlay) String() string {
+	x := fmt.Sprint(o.X)
+	if o.Center {
+		x = "c"
+	}
+	if o.Color.A == 0 {
+		return fmt.Sprintf("%s,%d:%s", x, o.Y, o.Text)
+	}
+	return fmt.Sprintf("%s,%d,#%02x%02x%02x:%s", x, o.Y, o.Color.R, o.Color.G, o.Color.B, o.Text)
+}
@@ -0,0 +1,180 @@
+package imgascii
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Palettes are the built-in fixed palettes for Options.Palette: the four
+// greens of the original Game Boy, the 16 colors of the PICO-8 fantasy
+// console and the 16 of the Commodore 64.
+var Palettes = map[string][]color.RGBA{
+	"gameboy": hexColors("0f380f 306230 8bac0f 9bbc0f"),
+	"pico8": hexColors("000000 1d2b53 7e2553 008751 ab5236 5f574f c2c3c7 fff1e8 " +
+		"ff004d ffa300 ffec27 00e436 29adff 83769c ff77a8 ffccaa"),
+	"c64": hexColors("000000 ffffff 68372b 70a4b2 6f3d86 588d43 352879 b8c76f " +
+		"6f4f25 433900 9a6759 444444 6c6c6c 9ad284 6c5eb5 959595"),
+}
+
+// hexColors parses the space separated colors of a built-in palette.
+func hexColors(list string) []color.RGBA {
+	palette, err := ParsePalette(strings.NewReader(list))
+	if err != nil {
+		panic(err)
+	}
+	return palette
+}
+
+// ParsePalette reads a palette as a GIMP .gpl file, with a "GIMP Palette"
+// line followed by lines of red, green and blue from 0 to 255, or as a list
+// of rrggbb colors, with or without a leading #, separated by commas,
+// spaces or lines. Lines starting with ; are comments in either.
+func ParsePalette(r io.Reader) ([]color.RGBA, error) {
+	var palette []color.RGBA
+	scanner := bufio.NewScanner(r)
+	gimp := false
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == 1 && text == "GIMP Palette":
+			gimp = true
+			continue
+		case text == "" || strings.HasPrefix(text, ";"):
+			continue
+		case gimp && (strings.HasPrefix(text, "#") || strings.HasPrefix(text, "Name:") || strings.HasPrefix(text, "Columns:")):
+			// Comments and the Name and Columns headers
+			continue
+		case gimp:
+			var c [3]int
+			if _, err := fmt.Sscan(text, &c[0], &c[1], &c[2]); err != nil || max(c[0], c[1], c[2]) > 255 || min(c[0], c[1], c[2]) < 0 {
+				return nil, fmt.Errorf("line %d: expected red, green and blue from 0 to 255", line)
+			}
+			palette = append(palette, color.RGBA{uint8(c[0]), uint8(c[1]), uint8(c[2]), 0xff})
+			continue
+		}
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			var c color.RGBA
+			hex := strings.TrimPrefix(field, "#")
+			if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(hex) != 6 {
+				return nil, fmt.Errorf("line %d: invalid color", line)
+			}
+			c.A = 0xff
+			palette = append(palette, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("no colors")
+	}
+	return palette, nil
+}
+
+// maxCutPixels bounds the pixels MedianCut looks at, taking every so many
+// of larger images.
+const maxCutPixels = 1 << 16
+
+// MedianCut picks up to n colors standing for the colors of img. The box
+// around its colors is split at the median of its widest channel, then the
+// widest of the boxes that gives, until there are n boxes or none can be
+// split, and each box gives the mean of its colors.
+func MedianCut(img image.Image, n int) []color.RGBA {
+	bounds := img.Bounds()
+	step := 1
+	for bounds.Dx()*bounds.Dy()/(step*step) > maxCutPixels {
+		step++
+	}
+	var pixels [][3]uint8
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+		}
+	}
+	if len(pixels) == 0 || n < 1 {
+		return nil
+	}
+
+	// widest returns the channel of box with the largest range and its
+	// range
+	widest := func(box [][3]uint8) (int, int) {
+		channel, spread := 0, -1
+		for k := 0; k < 3; k++ {
+			lo, hi := 255, 0
+			for _, p := range box {
+				lo, hi = min(lo, int(p[k])), max(hi, int(p[k]))
+			}
+			if hi-lo > spread {
+				channel, spread = k, hi-lo
+			}
+		}
+		return channel, spread
+	}
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < n {
+		split, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			if c, s := widest(box); s > spread {
+				split, channel, spread = i, c, s
+			}
+		}
+		if split < 0 {
+			break
+		}
+		box := boxes[split]
+		slices.SortStableFunc(box, func(a, b [3]uint8) int { return int(a[channel]) - int(b[channel]) })
+		boxes[split] = box[:len(box)/2]
+		boxes = append(boxes, box[len(box)/2:])
+	}
+
+	palette := make([]color.RGBA, len(boxes))
+	for i, box := range boxes {
+		var sum [3]int
+		for _, p := range box {
+			sum[0], sum[1], sum[2] = sum[0]+int(p[0]), sum[1]+int(p[1]), sum[2]+int(p[2])
+		}
+		palette[i] = color.RGBA{uint8(sum[0] / len(box)), uint8(sum[1] / len(box)), uint8(sum[2] / len(box)), 0xff}
+	}
+	return palette
+}
+
+// cellPalette returns the colors cells are matched to in the given color
+// mode and the ANSIPalette index each is sent as, -1 for true color. A
+// palette of the options' own is sent as it is in truecolor and snapped to
+// the closest of the 16 or 256 colors otherwise. Without one, the 16 and
+// 256 color palettes are matched to, and truecolor returns none, as every
+// color is sent as it is.
+func cellPalette(mode string, custom []color.RGBA) ([]color.RGBA, []int) {
+	// The 256 color palette leaves out the 16 themed colors, so its
+	// indexes start at 16 in ANSIPalette
+	palette, offset := xterm256, 16
+	if mode == "16" {
+		palette, offset = ansi16, 0
+	}
+	if custom == nil {
+		if mode == "truecolor" {
+			return nil, nil
+		}
+		indexes := make([]int, len(palette))
+		for i := range indexes {
+			indexes[i] = i + offset
+		}
+		return palette, indexes
+	}
+
+	colors, indexes := slices.Clone(custom), make([]int, len(custom))
+	for i, c := range custom {
+		indexes[i] = -1
+		if mode != "truecolor" {
+			j := nearestRGB(rgbOf(c), palette)
+			colors[i], indexes[i] = palette[j], j+offset
+		}
+	}
+	return colors, indexes
+}
@@ -0,0 +1,76 @@
+package imgascii
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+)
+
+// minRowsPerWorker keeps small images on a single goroutine, where starting
+// workers would cost more than it saves.
+const minRowsPerWorker = 16
+
+// parallelRows calls fn on bands of the rows 0 to h, one band per worker
+// with as many workers as GOMAXPROCS allows. Bands never overlap, so fn may
+// write its rows of a shared image without locking.
+func parallelRows(h int, fn func(y0, y1 int)) {
+	workers := min(runtime.GOMAXPROCS(0), h/minRowsPerWorker)
+	if workers <= 1 {
+		fn(0, h)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			fn(y0, y1)
+		}(i*h/workers, (i+1)*h/workers)
+	}
+	wg.Wait()
+}
+
+// parallelRowsContext is parallelRows for long loops that should stop once
+// ctx is done. The workers take bands of minRowsPerWorker rows in turn and
+// check ctx before each, leaving the remaining rows undone.
+func parallelRowsContext(ctx context.Context, h int, fn func(y0, y1 int)) {
+	var mu sync.Mutex
+	next := 0
+	band := func() (int, int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= h || ctx.Err() != nil {
+			return 0, 0, false
+		}
+		y0 := next
+		next = min(h, next+minRowsPerWorker)
+		return y0, next, true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, min(runtime.GOMAXPROCS(0), h/minRowsPerWorker)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y0, y1, ok := band(); ok; y0, y1, ok = band() {
+				fn(y0, y1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// rgba64At returns a pixel reader for img. Every standard image type reads
+// straight from its pixel buffer without boxing a color.Color per pixel.
+func rgba64At(img image.Image) func(x, y int) color.RGBA64 {
+	if fast, ok := img.(image.RGBA64Image); ok {
+		return fast.RGBA64At
+	}
+	return func(x, y int) color.RGBA64 {
+		r, g, b, a := img.At(x, y).RGBA()
+		return color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+	}
+}
@@ -0,0 +1,223 @@
+package imgascii
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+)
+
+// scaleImage resizes img to width by height cells. With samples above 1 each
+// cell averages a samples by samples grid at fixed offsets within the cell,
+// so the same source pixels feed the same cell in every frame of an
+// animation. It stops early, leaving rows blank, once ctx is done.
+func scaleImage(ctx context.Context, img image.Image, width, height, samples int) image.Image {
+	bounds := img.Bounds()
+	at := rgba64At(img)
+	// RGBA64 keeps the full precision of 16-bit sources for tone mapping
+	scaled := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	if samples <= 1 {
+		parallelRowsContext(ctx, height, func(y0, y1 int) {
+			for y := y0; y < y1; y++ {
+				srcY := bounds.Min.Y + y*bounds.Dy()/height
+				for x := 0; x < width; x++ {
+					srcX := bounds.Min.X + x*bounds.Dx()/width
+					scaled.SetRGBA64(x, y, at(srcX, srcY))
+				}
+			}
+		})
+		return scaled
+	}
+
+	n := uint32(samples * samples)
+	parallelRowsContext(ctx, height, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < width; x++ {
+				var r, g, b, a uint32
+				for sy := 0; sy < samples; sy++ {
+					for sx := 0; sx < samples; sx++ {
+						// Sample points sit at the centers of the subcells
+						srcX := bounds.Min.X + (x*2*samples+2*sx+1)*bounds.Dx()/(width*2*samples)
+						srcY := bounds.Min.Y + (y*2*samples+2*sy+1)*bounds.Dy()/(height*2*samples)
+						c := at(srcX, srcY)
+						r, g, b, a = r+uint32(c.R), g+uint32(c.G), b+uint32(c.B), a+uint32(c.A)
+					}
+				}
+				scaled.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+			}
+		}
+	})
+
+	return scaled
+}
+
+func convertToGray(img image.Image, luma string) *image.Gray {
+	bounds := img.Bounds()
+	at := rgba64At(img)
+	gray := image.NewGray(bounds)
+	parallelRows(bounds.Dy(), func(y0, y1 int) {
+		for y := bounds.Min.Y + y0; y < bounds.Min.Y+y1; y++ {
+			row := gray.Pix[gray.PixOffset(bounds.Min.X, y):]
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := at(x, y)
+				row[x-bounds.Min.X] = luminance(uint32(c.R), uint32(c.G), uint32(c.B), luma)
+			}
+		}
+	})
+
+	return gray
+}
+
+// luminance reduces 16-bit r, g, b to a single 8-bit value. The rec601
+// formula matches color.GrayModel. The lightness mode converts to linear
+// light and then to CIE L*, which spreads photographic tones more evenly
+// over the ramp.
+func luminance(r, g, b uint32, luma string) uint8 {
+	if luma == "rec601" {
+		return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+	}
+	rf, gf, bf := float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff
+
+	var v float64
+	switch luma {
+	case "rec709":
+		v = 0.2126*rf + 0.7152*gf + 0.0722*bf
+	case "average":
+		v = (rf + gf + bf) / 3
+	case "lightness":
+		y := 0.2126*srgbToLinear(rf) + 0.7152*srgbToLinear(gf) + 0.0722*srgbToLinear(bf)
+		if y > 216.0/24389 {
+			v = (116*math.Cbrt(y) - 16) / 100
+		} else {
+			v = y * 24389 / 27 / 100
+		}
+	}
+
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Charsets are the built-in character ramps, ordered from empty to dense.
+var Charsets = map[string]string{
+	"standard": " .:-=+*#%@",
+	"blocks":   " ░▒▓█",
+	"detailed": " .'`^\",:;Il!i><~+_-?][}{1)(|\\/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$",
+}
+
+// mapToArt picks a ramp character for every cell. It also returns the tone
+// level chosen for each cell, -1 for transparent ones, which a following
+// frame can pass back in as prev to hold glyphs steady with opts.Hysteresis.
+func mapToArt(img *image.Gray, flat image.Image, mask *image.Alpha, colors []Cell, opts Options, prev []int) (*Art, []int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	ramp := []rune(opts.Charset)
+	if len(prev) != w*h {
+		prev = nil
+	}
+
+	// Dithering carries each cell's rounding error over to its neighbours
+	// so gradients between two ramp levels don't band
+	var errs []float64
+	if opts.Dither {
+		errs = make([]float64, (w+2)*(h+1))
+	}
+
+	// Double width cells need double width blanks, and the fullwidth forms
+	// of any ASCII in the ramp, to keep rows aligned
+	blank := ' '
+	if cellColumns(opts) == 2 {
+		blank = widen(blank)
+		for i, r := range ramp {
+			ramp[i] = widen(r)
+		}
+	}
+	var attrs []Attr
+	if opts.Attrs {
+		ramp, attrs = attrRamp(ramp)
+	}
+	last := len(ramp) - 1
+	scale := newLevelScale(opts, len(ramp))
+
+	cells := make([]Cell, w*h)
+	levels := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			gray := img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y
+			pixel := color.RGBAModel.Convert(flat.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			if transparent(mask, bounds.Min.X+x, bounds.Min.Y+y) {
+				cells[i] = Cell{Rune: blank, Attr: Transparent, Gray: gray, Pixel: pixel}
+				levels[i] = -1
+				continue
+			}
+			if colors != nil {
+				cells[i] = colors[i]
+			}
+			cells[i].Gray, cells[i].Pixel = gray, pixel
+			v := float64(gray)
+			e := y*(w+2) + x + 1
+			if opts.Dither {
+				v = math.Max(0, math.Min(255, v+errs[e]))
+			}
+			t := scale.position(v)
+			level := scale.level(t)
+			// A cell only leaves its previous level once its tone moves
+			// Hysteresis levels past the edges of that level
+			if prev != nil && prev[i] >= 0 {
+				if p := float64(prev[i]); t >= p-opts.Hysteresis && t < p+1+opts.Hysteresis {
+					level = prev[i]
+				}
+			}
+			levels[i] = level
+			if opts.Dither {
+				diff := v - scale.tone(level)
+				errs[e+1] += diff * 7 / 16
+				errs[e+w+1] += diff * 3 / 16
+				errs[e+w+2] += diff * 5 / 16
+				errs[e+w+3] += diff * 1 / 16
+			}
+			char := scale.char(level)
+			if opts.Invert {
+				char = last - char
+			}
+			switch opts.Mode {
+			case "blocks":
+				cells[i].Rune = ' '
+			case "mosaic", "shade":
+				cells[i].Rune = colors[i].Rune
+			default:
+				cells[i].Rune = ramp[char]
+				if attrs != nil {
+					cells[i].Attr |= attrs[char]
+				}
+			}
+		}
+	}
+
+	return &Art{Width: w, Height: h, Cells: cells}, levels
+}
+
+// attrRamp spreads ramp over the attributes Options.Attrs adds, returning
+// the longer ramp with the attribute of each character. Each character
+// after the first is followed by its dim, plain and bold forms, and the
+// densest by the lighter half of the ramp in reverse video, lightest last,
+// whose inverse covers more of the cell the less the character does.
+func attrRamp(ramp []rune) ([]rune, []Attr) {
+	runes, attrs := []rune{ramp[0]}, []Attr{0}
+	for _, r := range ramp[1:] {
+		runes = append(runes, r, r, r)
+		attrs = append(attrs, Dim, 0, Bold)
+	}
+	for i := (len(ramp) - 1) / 2; i >= 0; i-- {
+		runes = append(runes, ramp[i])
+		attrs = append(attrs, Reverse)
+	}
+	return runes, attrs
+}
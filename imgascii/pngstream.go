@@ -0,0 +1,333 @@
+package imgascii
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// PNG color types
+const (
+	pngGray      = 0
+	pngTrueColor = 2
+	pngPaletted  = 3
+	pngGrayAlpha = 4
+	pngTrueAlpha = 6
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngRows decodes a non-interlaced PNG one row at a time, holding only the
+// current and previous rows rather than the whole image.
+type pngRows struct {
+	r      *bufio.Reader
+	width  int
+	height int
+	depth  int
+	kind   int
+
+	palette     color.Palette
+	transparent []byte // tRNS color key for gray and true color images
+
+	idat      *idatReader
+	pixels    io.Reader
+	bpp       int // bytes per complete pixel, at least 1, used by filters
+	cur, prev []byte
+	y         int
+}
+
+// streamablePNG reports whether br starts with a PNG that pngRows can read,
+// without consuming anything. Interlaced images spread every row over seven
+// passes and are left to the regular decoder.
+func streamablePNG(br *bufio.Reader) bool {
+	header, err := br.Peek(8 + 8 + 13)
+	if err != nil || !bytes.Equal(header[:8], pngSignature) || string(header[12:16]) != "IHDR" {
+		return false
+	}
+	ihdr := header[16:]
+	depth, kind, interlace := int(ihdr[8]), int(ihdr[9]), ihdr[12]
+	if interlace != 0 {
+		return false
+	}
+	switch kind {
+	case pngGray:
+		return depth == 1 || depth == 2 || depth == 4 || depth == 8 || depth == 16
+	case pngPaletted:
+		return depth == 1 || depth == 2 || depth == 4 || depth == 8
+	case pngTrueColor, pngGrayAlpha, pngTrueAlpha:
+		return depth == 8 || depth == 16
+	}
+	return false
+}
+
+// newPNGRows reads the chunks up to the first IDAT. br must hold a PNG that
+// streamablePNG accepted.
+func newPNGRows(br *bufio.Reader) (*pngRows, error) {
+	if _, err := br.Discard(len(pngSignature)); err != nil {
+		return nil, err
+	}
+
+	p := &pngRows{r: br}
+	for {
+		length, kind, err := p.chunkHeader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		if kind == "IDAT" {
+			p.idat = &idatReader{r: br, remaining: length}
+			break
+		}
+
+		if kind == "IEND" {
+			return nil, errors.New("failed to decode image: no image data")
+		}
+
+		// Only the header, palette and transparency matter, everything
+		// else is skipped along with the CRCs
+		var data []byte
+		if kind == "IHDR" || kind == "PLTE" || kind == "tRNS" {
+			data = make([]byte, length)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return nil, fmt.Errorf("failed to decode image: %w", err)
+			}
+		} else if _, err := br.Discard(length); err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		if _, err := br.Discard(4); err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+
+		switch kind {
+		case "IHDR":
+			if len(data) < 13 {
+				return nil, errors.New("failed to decode image: bad IHDR")
+			}
+			p.width = int(binary.BigEndian.Uint32(data[0:]))
+			p.height = int(binary.BigEndian.Uint32(data[4:]))
+			p.depth, p.kind = int(data[8]), int(data[9])
+		case "PLTE":
+			p.palette = make(color.Palette, len(data)/3)
+			for i := range p.palette {
+				p.palette[i] = color.RGBA{data[3*i], data[3*i+1], data[3*i+2], 0xff}
+			}
+		case "tRNS":
+			if p.kind == pngPaletted {
+				for i := 0; i < len(data) && i < len(p.palette); i++ {
+					r, g, b, _ := p.palette[i].RGBA()
+					p.palette[i] = color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), data[i]}
+				}
+			} else {
+				p.transparent = data
+			}
+		}
+	}
+	if p.width < 1 || p.height < 1 {
+		return nil, errors.New("failed to decode image: invalid size")
+	}
+
+	channels := map[int]int{pngGray: 1, pngTrueColor: 3, pngPaletted: 1, pngGrayAlpha: 2, pngTrueAlpha: 4}[p.kind]
+	bits := channels * p.depth
+	p.bpp = max(1, bits/8)
+	stride := (p.width*bits + 7) / 8
+	p.cur, p.prev = make([]byte, stride), make([]byte, stride)
+
+	pixels, err := zlib.NewReader(p.idat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	p.pixels = pixels
+	return p, nil
+}
+
+func (p *pngRows) chunkHeader() (int, string, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(p.r, header[:]); err != nil {
+		return 0, "", err
+	}
+	return int(binary.BigEndian.Uint32(header[:4])), string(header[4:]), nil
+}
+
+func (p *pngRows) Bounds() image.Rectangle {
+	return image.Rect(0, 0, p.width, p.height)
+}
+
+// next decodes the following row, which at is then able to read pixels from.
+func (p *pngRows) next() error {
+	if p.y >= p.height {
+		return io.EOF
+	}
+	p.cur, p.prev = p.prev, p.cur
+
+	var filter [1]byte
+	if _, err := io.ReadFull(p.pixels, filter[:]); err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if _, err := io.ReadFull(p.pixels, p.cur); err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	cur, prev, bpp := p.cur, p.prev, p.bpp
+	if p.y == 0 {
+		clear(prev)
+	}
+	switch filter[0] {
+	case 0:
+	case 1: // Sub
+		for i := bpp; i < len(cur); i++ {
+			cur[i] += cur[i-bpp]
+		}
+	case 2: // Up
+		for i := range cur {
+			cur[i] += prev[i]
+		}
+	case 3: // Average
+		for i := range cur {
+			left := 0
+			if i >= bpp {
+				left = int(cur[i-bpp])
+			}
+			cur[i] += uint8((left + int(prev[i])) / 2)
+		}
+	case 4: // Paeth
+		for i := range cur {
+			var a, c int
+			if i >= bpp {
+				a, c = int(cur[i-bpp]), int(prev[i-bpp])
+			}
+			cur[i] += paeth(a, int(prev[i]), c)
+		}
+	default:
+		return fmt.Errorf("failed to decode image: bad filter type %d", filter[0])
+	}
+
+	p.y++
+	return nil
+}
+
+func paeth(a, b, c int) uint8 {
+	pa, pb, pc := abs(b-c), abs(a-c), abs(a+b-2*c)
+	switch {
+	case pa <= pb && pa <= pc:
+		return uint8(a)
+	case pb <= pc:
+		return uint8(b)
+	}
+	return uint8(c)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// at returns pixel x of the current row with the same values image/png
+// would decode it to.
+func (p *pngRows) at(x int) color.Color {
+	row := p.cur
+	if p.depth < 8 {
+		// Samples are packed most significant bits first
+		shift := 8 - p.depth - x*p.depth%8
+		v := row[x*p.depth/8] >> shift & (1<<p.depth - 1)
+		if p.kind == pngPaletted {
+			return p.paletteColor(v)
+		}
+		key := -1
+		if len(p.transparent) >= 2 {
+			key = int(p.transparent[1])
+		}
+		gray := v * uint8(255/(1<<p.depth-1))
+		if int(v) == key {
+			return color.NRGBA{gray, gray, gray, 0}
+		}
+		return color.Gray{gray}
+	}
+
+	if p.depth == 16 {
+		i := x * p.bpp
+		sample := func(n int) uint16 { return binary.BigEndian.Uint16(row[i+2*n:]) }
+		switch p.kind {
+		case pngGray:
+			y := sample(0)
+			if len(p.transparent) >= 2 && binary.BigEndian.Uint16(p.transparent) == y {
+				return color.NRGBA64{y, y, y, 0}
+			}
+			return color.Gray16{y}
+		case pngTrueColor:
+			r, g, b := sample(0), sample(1), sample(2)
+			if t := p.transparent; len(t) >= 6 && binary.BigEndian.Uint16(t) == r &&
+				binary.BigEndian.Uint16(t[2:]) == g && binary.BigEndian.Uint16(t[4:]) == b {
+				return color.NRGBA64{r, g, b, 0}
+			}
+			return color.RGBA64{r, g, b, 0xffff}
+		case pngGrayAlpha:
+			return color.NRGBA64{sample(0), sample(0), sample(0), sample(1)}
+		default:
+			return color.NRGBA64{sample(0), sample(1), sample(2), sample(3)}
+		}
+	}
+
+	i := x * p.bpp
+	switch p.kind {
+	case pngGray:
+		y := row[i]
+		if len(p.transparent) >= 2 && p.transparent[1] == y {
+			return color.NRGBA{y, y, y, 0}
+		}
+		return color.Gray{y}
+	case pngTrueColor:
+		r, g, b := row[i], row[i+1], row[i+2]
+		if t := p.transparent; len(t) >= 6 && t[1] == r && t[3] == g && t[5] == b {
+			return color.NRGBA{r, g, b, 0}
+		}
+		return color.RGBA{r, g, b, 0xff}
+	case pngPaletted:
+		return p.paletteColor(row[i])
+	case pngGrayAlpha:
+		return color.NRGBA{row[i], row[i], row[i], row[i+1]}
+	default:
+		return color.NRGBA{row[i], row[i+1], row[i+2], row[i+3]}
+	}
+}
+
+func (p *pngRows) paletteColor(index uint8) color.Color {
+	if int(index) >= len(p.palette) {
+		return color.RGBA{0, 0, 0, 0xff}
+	}
+	return p.palette[index]
+}
+
+// idatReader joins the data of consecutive IDAT chunks into one stream.
+type idatReader struct {
+	r         *bufio.Reader
+	remaining int
+}
+
+func (d *idatReader) Read(b []byte) (int, error) {
+	for d.remaining == 0 {
+		// Skip the CRC and move on if the next chunk is more image data
+		if _, err := d.r.Discard(4); err != nil {
+			return 0, err
+		}
+		header, err := d.r.Peek(8)
+		if err != nil {
+			return 0, err
+		}
+		if string(header[4:]) != "IDAT" {
+			return 0, io.EOF
+		}
+		d.remaining = int(binary.BigEndian.Uint32(header[:4]))
+		d.r.Discard(8)
+	}
+
+	n, err := d.r.Read(b[:min(len(b), d.remaining)])
+	d.remaining -= n
+	return n, err
+}
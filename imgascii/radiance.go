@@ -0,0 +1,163 @@
+package imgascii
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// Radiance HDR files store each pixel as three 8-bit mantissas sharing an
+// exponent, so they reach far beyond the brightness of white. The decoder
+// registered here divides them by the brightest channel in the image and
+// keeps them in linear light in an *image.RGBA64, ready for Options.ToneMap.
+// Detail darker than 1/65535 of the brightest pixel is lost.
+
+func init() {
+	image.RegisterFormat("hdr", "#?", decodeRadiance, decodeRadianceConfig)
+}
+
+// radianceHeader reads the header of a Radiance file up to and including
+// the resolution line, returning the image size.
+func radianceHeader(r *bufio.Reader) (width, height int, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "#?") {
+		return 0, 0, errors.New("hdr: missing signature")
+	}
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return 0, 0, errors.New("hdr: truncated header")
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return 0, 0, fmt.Errorf("hdr: unsupported format %s", format)
+		}
+	}
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return 0, 0, errors.New("hdr: missing resolution")
+	}
+	// Only the standard top to bottom, left to right order is read
+	if _, err := fmt.Sscanf(line, "-Y %d +X %d", &height, &width); err != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("hdr: unsupported resolution %q", strings.TrimSpace(line))
+	}
+	return width, height, nil
+}
+
+func decodeRadianceConfig(r io.Reader) (image.Config, error) {
+	width, height, err := radianceHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: width, Height: height}, nil
+}
+
+func decodeRadiance(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	width, height, err := radianceHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pixels grow as they are read, so a header claiming a huge size
+	// fails at the end of the data rather than allocating it up front
+	var pixels []float32
+	brightest := float32(0)
+	scanline := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		if err := readRadianceScanline(br, scanline); err != nil {
+			return nil, fmt.Errorf("hdr: line %d: %w", y, err)
+		}
+		for x := 0; x < width; x++ {
+			rgbe := scanline[x*4 : x*4+4]
+			scale := float32(0)
+			if rgbe[3] != 0 {
+				scale = float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+			}
+			for _, m := range rgbe[:3] {
+				v := (float32(m) + 0.5) * scale
+				brightest = max(brightest, v)
+				pixels = append(pixels, v)
+			}
+		}
+	}
+
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	if brightest == 0 {
+		brightest = 1
+	}
+	channel := func(v float32) uint16 {
+		return uint16(math.Round(float64(v / brightest * 0xffff)))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := pixels[(y*width+x)*3:]
+			img.SetRGBA64(x, y, color.RGBA64{channel(p[0]), channel(p[1]), channel(p[2]), 0xffff})
+		}
+	}
+	return img, nil
+}
+
+// readRadianceScanline fills line with the RGBE bytes of one scanline,
+// which is stored flat or run length encoded one channel at a time.
+func readRadianceScanline(r *bufio.Reader, line []byte) error {
+	width := len(line) / 4
+	start, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		_, err := io.ReadFull(r, line)
+		return err
+	}
+	if int(start[2])<<8|int(start[3]) != width {
+		return errors.New("scanline width does not match the image")
+	}
+	r.Discard(4)
+
+	for c := 0; c < 4; c++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				// A run of one value
+				n := int(count) - 128
+				if x+n > width {
+					return errors.New("run past the end of the scanline")
+				}
+				v, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					line[x*4+c] = v
+					x++
+				}
+				continue
+			}
+			n := int(count)
+			if n == 0 || x+n > width {
+				return errors.New("run past the end of the scanline")
+			}
+			for ; n > 0; n-- {
+				v, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				line[x*4+c] = v
+				x++
+			}
+		}
+	}
+	return nil
+}
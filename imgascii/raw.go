@@ -0,0 +1,112 @@
+package imgascii
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// RawFormats are the pixel layouts ReadRaw understands: packed 8-bit RGB,
+// RGBA and gray, by their byte count per pixel. rgb, rgba and gray are
+// short for the same.
+var RawFormats = map[string]int{
+	"rgb24":  3,
+	"rgba32": 4,
+	"gray8":  1,
+	"rgb":    3,
+	"rgba":   4,
+	"gray":   1,
+}
+
+// MaxRawSide is the largest width and height of a raw frame, so a corrupt
+// size fails instead of allocating gigabytes.
+const MaxRawSide = 16384
+
+// ParseRawFormat parses a raw frame layout written as WxH:format, such as
+// 320x240:rgba, and checks the size and format.
+func ParseRawFormat(s string) (w, h int, format string, err error) {
+	size, format, found := strings.Cut(s, ":")
+	if _, err := fmt.Sscanf(size, "%dx%d", &w, &h); err != nil || !found {
+		return 0, 0, "", fmt.Errorf("invalid raw format %q: expected WxH:format", s)
+	}
+	if err := checkRaw(w, h, format); err != nil {
+		return 0, 0, "", err
+	}
+	return w, h, format, nil
+}
+
+func checkRaw(w, h int, format string) error {
+	if w < 1 || h < 1 || w > MaxRawSide || h > MaxRawSide {
+		return fmt.Errorf("invalid raw size %dx%d: expected 1 to %d on each side", w, h, MaxRawSide)
+	}
+	if _, ok := RawFormats[format]; !ok {
+		return fmt.Errorf("invalid raw format %q", format)
+	}
+	return nil
+}
+
+// ReadRaw reads one w by h frame of unencoded pixels in format from r, for
+// programs that already hold pixels in memory and would rather not encode
+// them. Rows are top to bottom without padding. At the end of a stream of
+// frames it returns io.EOF, and io.ErrUnexpectedEOF for a partial frame.
+func ReadRaw(r io.Reader, w, h int, format string) (image.Image, error) {
+	if err := checkRaw(w, h, format); err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, w, h)
+	switch RawFormats[format] {
+	case 1:
+		img := image.NewGray(rect)
+		if _, err := io.ReadFull(r, img.Pix); err != nil {
+			return nil, err
+		}
+		return img, nil
+	case 4:
+		img := image.NewNRGBA(rect)
+		if _, err := io.ReadFull(r, img.Pix); err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+
+	buf := make([]byte, w*h*3)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(rect)
+	for i := 0; i < w*h; i++ {
+		copy(img.Pix[i*4:], buf[i*3:i*3+3])
+		img.Pix[i*4+3] = 0xff
+	}
+	return img, nil
+}
+
+// ReadRawFrame reads one frame of unencoded pixels that starts with its own
+// layout, a line such as "320x240:rgba\n" as ParseRawFormat reads, so a
+// stream can change size between frames. At the end of a stream it returns
+// io.EOF, and io.ErrUnexpectedEOF for a partial frame.
+func ReadRawFrame(r *bufio.Reader) (image.Image, error) {
+	// A header is a few bytes, anything longer is pixels without one
+	line, err := r.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull || len(line) > 32:
+		return nil, errors.New("raw frame header too long")
+	case err == io.EOF && len(line) > 0:
+		return nil, io.ErrUnexpectedEOF
+	case err != nil:
+		return nil, err
+	}
+	w, h, format, err := ParseRawFormat(strings.TrimSpace(string(line)))
+	if err != nil {
+		return nil, err
+	}
+	img, err := ReadRaw(r, w, h, format)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return img, err
+}
@@ -0,0 +1,89 @@
+package imgascii
+
+import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"sync"
+)
+
+// A Renderer writes art in an output format, so programs can add formats
+// of their own, such as IRC color codes, with RegisterRenderer and pick
+// them by name.
+type Renderer interface {
+	// Render writes art to w. Render may be called from several
+	// goroutines at once.
+	Render(art *Art, w io.Writer) error
+}
+
+// RendererFunc adapts an ordinary function to the Renderer interface.
+type RendererFunc func(art *Art, w io.Writer) error
+
+// Render calls f.
+func (f RendererFunc) Render(art *Art, w io.Writer) error {
+	return f(art, w)
+}
+
+var (
+	renderersMu sync.RWMutex
+	// text is the plain characters, ansi adds the color escapes, html is
+	// a pre element and png a picture in the built-in bitmap font, dark on
+	// light
+	renderers = map[string]Renderer{
+		"text": RendererFunc(func(art *Art, w io.Writer) error {
+			_, err := io.WriteString(w, art.String())
+			return err
+		}),
+		"ansi": RendererFunc(func(art *Art, w io.Writer) error {
+			_, err := art.WriteTo(w)
+			return err
+		}),
+		"html": RendererFunc(func(art *Art, w io.Writer) error {
+			_, err := fmt.Fprintf(w, "<pre>%s</pre>\n", art.HTML())
+			return err
+		}),
+		"png": RendererFunc(func(art *Art, w io.Writer) error {
+			return png.Encode(w, art.Image(nil, color.Black, color.White))
+		}),
+	}
+)
+
+// RegisterRenderer makes a Renderer available under name. It is meant to be
+// called from an init function and panics if name is empty, r is nil or the
+// name is already taken.
+func RegisterRenderer(name string, r Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+
+	if name == "" || r == nil {
+		panic("imgascii: RegisterRenderer needs a name and a renderer")
+	}
+	if _, dup := renderers[name]; dup {
+		panic(fmt.Sprintf("imgascii: renderer %q registered twice", name))
+	}
+	renderers[name] = r
+}
+
+// Renderers returns the sorted names of the registered renderers.
+func Renderers() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LookupRenderer returns the Renderer registered under name.
+func LookupRenderer(name string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	r, ok := renderers[name]
+	return r, ok
+}
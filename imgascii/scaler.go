@@ -0,0 +1,92 @@
+package imgascii
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+)
+
+// A Scaler resamples the source image down to one pixel per output cell. It
+// is the most expensive stage for large images, so programs can swap in
+// their own, for example one running on the GPU, with RegisterScaler and
+// select it by name with Options.Scaler.
+type Scaler interface {
+	// Scale returns a width by height image of img. Samples is
+	// Options.Samples, how many points per cell side to average for
+	// steadier animations, which a Scaler may interpret as it sees fit.
+	// Scale may be called from several goroutines at once.
+	Scale(img image.Image, width, height, samples int) image.Image
+}
+
+// A ContextScaler is a Scaler that can stop early when ctx is done, in
+// which case the image it returns is thrown away. ConvertContext uses
+// ScaleContext for the scalers that have it.
+type ContextScaler interface {
+	Scaler
+	ScaleContext(ctx context.Context, img image.Image, width, height, samples int) image.Image
+}
+
+// ScalerFunc adapts an ordinary function to the Scaler interface.
+type ScalerFunc func(img image.Image, width, height, samples int) image.Image
+
+// Scale calls f.
+func (f ScalerFunc) Scale(img image.Image, width, height, samples int) image.Image {
+	return f(img, width, height, samples)
+}
+
+var (
+	scalersMu sync.RWMutex
+	// nearest picks the pixel under each cell, or averages a Samples by
+	// Samples grid of them
+	scalers = map[string]Scaler{"nearest": nearestScaler{}}
+)
+
+// nearestScaler is the built-in nearest scaler.
+type nearestScaler struct{}
+
+func (nearestScaler) Scale(img image.Image, width, height, samples int) image.Image {
+	return scaleImage(context.Background(), img, width, height, samples)
+}
+
+func (nearestScaler) ScaleContext(ctx context.Context, img image.Image, width, height, samples int) image.Image {
+	return scaleImage(ctx, img, width, height, samples)
+}
+
+// RegisterScaler makes a Scaler available under name. It is meant to be
+// called from an init function and panics if name is empty, s is nil or the
+// name is already taken.
+func RegisterScaler(name string, s Scaler) {
+	scalersMu.Lock()
+	defer scalersMu.Unlock()
+
+	if name == "" || s == nil {
+		panic("imgascii: RegisterScaler needs a name and a scaler")
+	}
+	if _, dup := scalers[name]; dup {
+		panic(fmt.Sprintf("imgascii: scaler %q registered twice", name))
+	}
+	scalers[name] = s
+}
+
+// Scalers returns the sorted names of the registered scalers.
+func Scalers() []string {
+	scalersMu.RLock()
+	defer scalersMu.RUnlock()
+
+	names := make([]string, 0, len(scalers))
+	for name := range scalers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupScaler(name string) (Scaler, bool) {
+	scalersMu.RLock()
+	defer scalersMu.RUnlock()
+
+	s, ok := scalers[name]
+	return s, ok
+}
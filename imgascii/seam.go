@@ -0,0 +1,152 @@
+package imgascii
+
+import (
+	"context"
+	"image"
+)
+
+const (
+	// seamMinRatio is how far the source and output aspects must be apart,
+	// as the ratio of the two, before seams are carved; closer ones are
+	// stretched as usual.
+	seamMinRatio = 1.2
+
+	// seamMaxShare is the largest share of its columns or rows carving
+	// removes from the source. Beyond it seams cut through the subject, so
+	// the rest of the difference is stretched.
+	seamMaxShare = 0.5
+)
+
+// seamCarving is the set of seams carved out of a source, which carves them
+// out of any image of the same region.
+type seamCarving struct {
+	// width and height are the size of the working copy the seams were
+	// found in, before they were removed
+	width, height int
+	// wide is set when columns were removed, and rows otherwise
+	wide bool
+	// keep holds the working copy pixels left, by their index, in lines
+	// along the seams: rows for columns removed and columns for rows
+	keep [][]int
+}
+
+// findSeams works out the seams to carve out of img, the region of the
+// source being converted, to bring it to aspect, width over height, before
+// it is scaled to width by height pixels. It works on a copy scaled to twice
+// the output size across the seams, where they cost little to find, and
+// repeatedly removes the seam of pixels from one edge to the other with
+// the least luminance gradient along it, the flattest background. It
+// returns nil when the aspects are close enough to be stretched.
+func findSeams(ctx context.Context, img image.Image, aspect float64, width, height int) *seamCarving {
+	bounds := img.Bounds()
+	ratio := float64(bounds.Dx()) / float64(bounds.Dy()) / aspect
+	if ratio < seamMinRatio && ratio > 1/seamMinRatio {
+		return nil
+	}
+
+	s := &seamCarving{wide: ratio > 1}
+	var remove int
+	if s.wide {
+		s.height = min(bounds.Dy(), 2*height)
+		s.width = max(1, bounds.Dx()*s.height/bounds.Dy())
+		target := max(1, int(aspect*float64(s.height)+0.5))
+		remove = min(s.width-target, int(float64(s.width)*seamMaxShare))
+	} else {
+		s.width = min(bounds.Dx(), 2*width)
+		s.height = max(1, bounds.Dy()*s.width/bounds.Dx())
+		target := max(1, int(float64(s.width)/aspect+0.5))
+		remove = min(s.height-target, int(float64(s.height)*seamMaxShare))
+	}
+	if remove < 1 {
+		return nil
+	}
+
+	// Rows are carved as the columns of the working copy turned on its
+	// side, so lines always run across the seams
+	work := scaleImage(ctx, img, s.width, s.height, 2).(*image.RGBA64)
+	lines, length := s.height, s.width
+	if !s.wide {
+		lines, length = length, lines
+	}
+	luma := make([][]int, lines)
+	s.keep = make([][]int, lines)
+	for i := range luma {
+		luma[i], s.keep[i] = make([]int, length), make([]int, length)
+		for j := range luma[i] {
+			x, y := j, i
+			if !s.wide {
+				x, y = y, x
+			}
+			c := work.RGBA64At(x, y)
+			luma[i][j] = int(luminance(uint32(c.R), uint32(c.G), uint32(c.B), "rec601"))
+			s.keep[i][j] = y*s.width + x
+		}
+	}
+
+	energy := make([][]int, lines)
+	for i := range energy {
+		energy[i] = make([]int, length)
+	}
+	seam := make([]int, lines)
+	for ; remove > 0 && ctx.Err() == nil; remove-- {
+		// The gradient of every pixel, summed along the cheapest path from
+		// the first line to it
+		for i := range luma {
+			for j := 0; j < length; j++ {
+				e := abs(luma[i][min(j+1, length-1)]-luma[i][max(j-1, 0)]) +
+					abs(luma[min(i+1, lines-1)][j]-luma[max(i-1, 0)][j])
+				if i > 0 {
+					e += min(energy[i-1][max(j-1, 0)], energy[i-1][j], energy[i-1][min(j+1, length-1)])
+				}
+				energy[i][j] = e
+			}
+		}
+
+		// The seam is traced back from the cheapest end on the last line
+		last := energy[lines-1][:length]
+		for j := range last {
+			if last[j] < last[seam[lines-1]] {
+				seam[lines-1] = j
+			}
+		}
+		for i := lines - 2; i >= 0; i-- {
+			j := seam[i+1]
+			best := j
+			for _, k := range []int{j - 1, j + 1} {
+				if k >= 0 && k < length && energy[i][k] < energy[i][best] {
+					best = k
+				}
+			}
+			seam[i] = best
+		}
+
+		for i, j := range seam {
+			luma[i] = append(luma[i][:j], luma[i][j+1:]...)
+			s.keep[i] = append(s.keep[i][:j], s.keep[i][j+1:]...)
+		}
+		length--
+		seam[lines-1] = 0
+	}
+	return s
+}
+
+// carve removes the seams from img, which covers the same region as the
+// image they were found in, returning the image left.
+func (s *seamCarving) carve(ctx context.Context, img image.Image) image.Image {
+	work := scaleImage(ctx, img, s.width, s.height, 2).(*image.RGBA64)
+	length := len(s.keep[0])
+	carved := image.NewRGBA64(image.Rect(0, 0, length, len(s.keep)))
+	if !s.wide {
+		carved = image.NewRGBA64(image.Rect(0, 0, len(s.keep), length))
+	}
+	for i, line := range s.keep {
+		for j, k := range line {
+			x, y := j, i
+			if !s.wide {
+				x, y = y, x
+			}
+			carved.SetRGBA64(x, y, work.RGBA64At(k%s.width, k/s.width))
+		}
+	}
+	return carved
+}
@@ -0,0 +1,65 @@
+package imgascii
+
+import (
+	"image"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Frame is a single image of an animation and how long it stays on screen.
+type Frame struct {
+	Image image.Image
+	Delay time.Duration
+}
+
+// frameNumber matches the frame number of a printf style sequence pattern,
+// as ffmpeg and Blender name the files they write: %d, or %04d for numbers
+// padded with zeros to four digits.
+var frameNumber = regexp.MustCompile(`%(0\d+)?d`)
+
+// IsSequencePattern reports whether path is a glob or a printf style
+// pattern, such as frames/%04d.png, matching several files rather than a
+// single image.
+func IsSequencePattern(path string) bool {
+	return strings.ContainsAny(path, "*?[") || frameNumber.MatchString(path)
+}
+
+// naturalLess compares strings treating runs of digits as numbers.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			// Compare by length first after trimming zeros, then by value
+			ta, tb := trimZeros(da), trimZeros(db)
+			if len(ta) != len(tb) {
+				return len(ta) < len(tb)
+			}
+			if ta != tb {
+				return ta < tb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
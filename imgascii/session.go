@@ -0,0 +1,96 @@
+package imgascii
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Change is a single recorded parameter change.
+type Change struct {
+	// Offset is the time since the session started.
+	Offset  time.Duration `json:"offset"`
+	Options Options       `json:"options"`
+}
+
+// Session records every set of options used while tuning a conversion, so
+// the tuning can be replayed later or its final state exported.
+type Session struct {
+	Start   time.Time `json:"start"`
+	Changes []Change  `json:"changes"`
+}
+
+// NewSession starts an empty recording.
+func NewSession() *Session {
+	return &Session{Start: time.Now()}
+}
+
+// Record appends opts to the session unless they equal the last change.
+func (s *Session) Record(opts Options) {
+	if n := len(s.Changes); n > 0 && sameOptions(s.Changes[n-1].Options, opts) {
+		return
+	}
+	s.Changes = append(s.Changes, Change{Offset: time.Since(s.Start), Options: opts})
+}
+
+// Final returns the last recorded options.
+func (s *Session) Final() (Options, bool) {
+	if len(s.Changes) == 0 {
+		return Options{}, false
+	}
+	return s.Changes[len(s.Changes)-1].Options, true
+}
+
+// ExportFinal writes the last recorded options as JSON, which can be kept
+// as a pipeline file to reproduce the tuned look.
+func (s *Session) ExportFinal(w io.Writer) error {
+	opts, ok := s.Final()
+	if !ok {
+		return fmt.Errorf("session has no recorded changes")
+	}
+	data, err := json.MarshalIndent(opts, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Replay calls fn with every recorded change, waiting between them as long
+// as the original session did divided by speed. A speed of 0 or less replays
+// without waiting.
+func (s *Session) Replay(speed float64, fn func(Options)) {
+	var last time.Duration
+	for _, change := range s.Changes {
+		if speed > 0 {
+			time.Sleep(time.Duration(float64(change.Offset-last) / speed))
+		}
+		last = change.Offset
+		fn(change.Options)
+	}
+}
+
+// WriteTo writes the session as JSON.
+func (s *Session) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// ReadSession reads a session written by WriteTo.
+func ReadSession(r io.Reader) (*Session, error) {
+	var s Session
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	return &s, nil
+}
+
+func sameOptions(a, b Options) bool {
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,159 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+)
+
+// shades are the characters of shade mode with the share of the cell their
+// ink covers, from the bare background to three quarters foreground.
+var shades = []struct {
+	Rune     rune
+	Coverage float64
+}{
+	{' ', 0}, {'░', 0.25}, {'▒', 0.5}, {'▓', 0.75},
+}
+
+// shadeCandidates is how many palette colors closest to a cell shade mode
+// pairs up, as colors further away rarely blend closer.
+const shadeCandidates = 8
+
+// shadeCells picks a shade character, a foreground and a background color
+// for every cell of img, the combination whose blend in linear light comes
+// closest to the cell color, matched with the given Quantize strategy, from
+// custom when it is not nil. As truecolor without a palette matches every
+// color exactly, its cells are spaces in their own background color, as
+// blocks mode draws them.
+func shadeCells(img image.Image, mode, quantize string, custom []color.RGBA) []Cell {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	pixels := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*w+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+
+	cells := make([]Cell, w*h)
+	palette, indexes := cellPalette(mode, custom)
+	if palette == nil {
+		for i, p := range pixels {
+			cells[i] = Cell{Rune: ' ', Fill: color.RGBA{uint8(p[0]), uint8(p[1]), uint8(p[2]), 0xff}, FillIndex: -1}
+		}
+		return cells
+	}
+
+	s := newShader(palette, indexes, quantize == "ciede2000")
+	if quantize != "dither" {
+		parallelRows(h, func(y0, y1 int) {
+			for i := y0 * w; i < y1*w; i++ {
+				cells[i], _ = s.shade(pixels[i])
+			}
+		})
+		return cells
+	}
+
+	// Dithering spreads what each cell misses by onto the cells after it,
+	// as quantizeColors does
+	spread := func(x, y int, e [3]float64, weight float64) {
+		if x < 0 || x >= w || y >= h {
+			return
+		}
+		for k := range e {
+			pixels[y*w+x][k] += e[k] * weight
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := pixels[y*w+x]
+			var blend [3]float64
+			cells[y*w+x], blend = s.shade(p)
+			e := [3]float64{p[0] - blend[0], p[1] - blend[1], p[2] - blend[2]}
+			spread(x+1, y, e, 7.0/16)
+			spread(x-1, y+1, e, 3.0/16)
+			spread(x, y+1, e, 5.0/16)
+			spread(x+1, y+1, e, 1.0/16)
+		}
+	}
+	return cells
+}
+
+// shader blends the colors of a palette for shade mode.
+type shader struct {
+	palette []color.RGBA
+	indexes []int // ANSIPalette index of every palette entry, or -1
+	lab     bool
+	// linear holds the palette in 16-bit linear light
+	linear [][3]float64
+}
+
+func newShader(palette []color.RGBA, indexes []int, lab bool) *shader {
+	linearTables()
+	s := &shader{palette: palette, indexes: indexes, lab: lab, linear: make([][3]float64, len(palette))}
+	for i, c := range palette {
+		s.linear[i] = [3]float64{float64(toLinear[int(c.R)*0x101]), float64(toLinear[int(c.G)*0x101]), float64(toLinear[int(c.B)*0x101])}
+	}
+	return s
+}
+
+// shade returns the cell whose shade of two palette colors blends closest
+// to p, and the color of that blend. The pairs are made of the palette
+// colors closest to p by RGB distance, and compared by CIEDE2000 when lab
+// is set.
+func (s *shader) shade(p [3]float64) (Cell, [3]float64) {
+	var near [shadeCandidates]int
+	var nearDistance [shadeCandidates]float64
+	n := 0
+	for i, c := range s.palette {
+		d := rgbDistance(p, rgbOf(c))
+		if n == len(near) && d >= nearDistance[n-1] {
+			continue
+		}
+		j := min(n, len(near)-1)
+		for ; j > 0 && nearDistance[j-1] > d; j-- {
+			near[j], nearDistance[j] = near[j-1], nearDistance[j-1]
+		}
+		near[j], nearDistance[j] = i, d
+		n = min(n+1, len(near))
+	}
+
+	distance := func(q [3]float64) float64 { return rgbDistance(p, q) }
+	if s.lab {
+		lab := rgbToLab(p[0], p[1], p[2])
+		distance = func(q [3]float64) float64 { return ciede2000(lab, rgbToLab(q[0], q[1], q[2])) }
+	}
+
+	// A space in the closest color is the blend to beat
+	best := Cell{Rune: ' ', Fill: s.palette[near[0]], FillIndex: s.indexes[near[0]]}
+	blend := rgbOf(s.palette[near[0]])
+	bestDistance := distance(blend)
+	for _, shade := range shades[1:] {
+		for _, f := range near[:n] {
+			for _, b := range near[:n] {
+				if f == b {
+					continue
+				}
+				var mix [3]float64
+				for k := range mix {
+					v := shade.Coverage*s.linear[f][k] + (1-shade.Coverage)*s.linear[b][k]
+					mix[k] = float64(toSRGB[int(v+0.5)]) / 0x101
+				}
+				if d := distance(mix); d < bestDistance {
+					best = Cell{Rune: shade.Rune, Color: s.palette[f], Index: s.indexes[f], Fill: s.palette[b], FillIndex: s.indexes[b]}
+					blend, bestDistance = mix, d
+				}
+			}
+		}
+	}
+	return best, blend
+}
+
+func rgbOf(c color.RGBA) [3]float64 {
+	return [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+}
+
+func rgbDistance(p, q [3]float64) float64 {
+	dr, dg, db := p[0]-q[0], p[1]-q[1], p[2]-q[2]
+	return dr*dr + dg*dg + db*db
+}
@@ -0,0 +1,150 @@
+package imgascii
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ConvertStream reads an image from r and writes its art to w without ever
+// holding the whole decoded image. Non-interlaced PNGs are decoded a row at a
+// time, sampled straight into the small scaled image, and reading stops
+// after the last row that feeds a cell. Other formats, and interlaced PNGs,
+// are decoded whole as by Decode, as are images for a registered Scaler.
+//
+// Options work as with Convert. Focus points are in source pixels as usual,
+// but a point from EdgeCentroid needs the decoded image, which is what this
+// function avoids. SmartCrop, seam carving, a Mask and a BeforeScale hook need it too, so
+// they decode the image whole.
+func ConvertStream(r io.Reader, w io.Writer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	// Only the built-in scaler knows how to sample rows as they arrive
+	beforeScale := opts.Hooks != nil && opts.Hooks.BeforeScale != nil
+	if opts.Scaler != "nearest" || opts.SmartCrop || opts.Resize != "" || opts.Mask != nil || beforeScale || !streamablePNG(br) {
+		img, err := Decode(br)
+		if err != nil {
+			return err
+		}
+		art, err := Convert(img, opts)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, art)
+		return err
+	}
+
+	// The pixels are converted from any ICC profile as they are sampled
+	header, _ := br.Peek(64 * 1024)
+	profile := parseICC(iccProfile(header))
+	rows, err := newPNGRows(br)
+	if err != nil {
+		return err
+	}
+
+	region := rows.Bounds()
+	if !opts.Crop.Empty() {
+		region = opts.Crop.Intersect(region)
+	}
+	if opts.Focus != nil {
+		region = aroundRect(region, opts.aspect(), *opts.Focus)
+	}
+	bw, bh := blockSize(opts)
+	width, height := max(1, opts.Width/cellColumns(opts))*bw, opts.Height*bh
+	if opts.Orient == 90 || opts.Orient == 270 {
+		width, height = height, width
+	}
+	scaled, err := scaleRows(rows, region, width, height, opts.Samples, opts.Linear, profile)
+	if err != nil {
+		return err
+	}
+	scaled = turn(scaled, opts.Orient)
+
+	// The converter starts from the scaled image, as if it had scaled it
+	c := &Converter{region: region, scaled: scaled, opts: Options{
+		Width: opts.Width, Height: opts.Height, Crop: opts.Crop, Focus: opts.Focus,
+		Samples: opts.Samples, Scaler: opts.Scaler, Linear: opts.Linear, Orient: opts.Orient, Mode: opts.Mode, Glyphs: opts.Glyphs, Mapper: opts.Mapper,
+		Hooks: opts.Hooks,
+	}}
+	art, err := c.Convert(opts)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, art)
+	return err
+}
+
+// scaleRows samples the rows of a streamed image into a width by height
+// image, picking exactly the pixels scaleImage picks from the region. The
+// pixels are converted to sRGB with profile, unless it is nil, and averaged
+// in linear light when linear is set.
+func scaleRows(rows *pngRows, region image.Rectangle, width, height, samples int, linear bool, profile *iccTransform) (image.Image, error) {
+	s := max(1, samples)
+	srcX := func(x, sx int) int {
+		if samples <= 1 {
+			return region.Min.X + x*region.Dx()/width
+		}
+		return region.Min.X + (x*2*s+2*sx+1)*region.Dx()/(width*2*s)
+	}
+	srcY := func(y, sy int) int {
+		if samples <= 1 {
+			return region.Min.Y + y*region.Dy()/height
+		}
+		return region.Min.Y + (y*2*s+2*sy+1)*region.Dy()/(height*2*s)
+	}
+
+	// Which output rows each source row feeds
+	needs := map[int][]int{}
+	last := 0
+	for y := 0; y < height; y++ {
+		for sy := 0; sy < s; sy++ {
+			row := srcY(y, sy)
+			needs[row] = append(needs[row], y)
+			last = max(last, row)
+		}
+	}
+
+	if linear {
+		linearTables()
+	}
+	sums := make([][4]uint32, width*height)
+	for row := 0; row <= last; row++ {
+		if err := rows.next(); err != nil {
+			return nil, err
+		}
+		for _, y := range needs[row] {
+			for x := 0; x < width; x++ {
+				for sx := 0; sx < s; sx++ {
+					r, g, b, a := rows.at(srcX(x, sx)).RGBA()
+					if profile != nil || linear {
+						c := color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+						if profile != nil {
+							c = profile.convert(c)
+						}
+						if linear {
+							c = mapRGBA64(c, toLinear)
+						}
+						r, g, b, a = uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+					}
+					sum := &sums[y*width+x]
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+r, sum[1]+g, sum[2]+b, sum[3]+a
+				}
+			}
+		}
+	}
+
+	n := uint32(s * s)
+	scaled := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for i, sum := range sums {
+		c := color.RGBA64{uint16(sum[0] / n), uint16(sum[1] / n), uint16(sum[2] / n), uint16(sum[3] / n)}
+		if linear {
+			c = mapRGBA64(c, toSRGB)
+		}
+		scaled.SetRGBA64(i%width, i/width, c)
+	}
+	return scaled, nil
+}
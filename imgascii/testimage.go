@@ -0,0 +1,96 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// TestPatterns are the synthetic images Generate can draw.
+var TestPatterns = []string{"gradient", "checkerboard", "zoneplate", "smpte"}
+
+// Generate draws a synthetic test image of w by h pixels. The gradient runs
+// black to white left to right and is good for checking the ramp, the
+// checkerboard has 8 pixel squares, the zone plate is a circular chirp that
+// shows aliasing, and smpte draws SMPTE color bars to check terminal colors.
+func Generate(pattern string, w, h int) (image.Image, error) {
+	if w < 1 || h < 1 {
+		return nil, fmt.Errorf("invalid size %dx%d", w, h)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	switch pattern {
+	case "gradient":
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / max(1, w-1))
+			for y := 0; y < h; y++ {
+				img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+			}
+		}
+	case "checkerboard":
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint8(0)
+				if (x/8+y/8)%2 == 0 {
+					v = 255
+				}
+				img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+			}
+		}
+	case "zoneplate":
+		// The phase grows with the squared radius, so the frequency rises
+		// steadily outwards and reaches Nyquist at the nearer edge
+		cx, cy := float64(w)/2, float64(h)/2
+		k := math.Pi / (2 * math.Min(cx, cy))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				dx, dy := float64(x)-cx, float64(y)-cy
+				v := uint8(math.Round(127.5 + 127.5*math.Cos(k*(dx*dx+dy*dy))))
+				img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+			}
+		}
+	case "smpte":
+		drawSMPTE(img)
+	default:
+		return nil, fmt.Errorf("invalid test pattern %q", pattern)
+	}
+
+	return img, nil
+}
+
+// drawSMPTE draws SMPTE color bars: seven 75% bars over a strip of reversed
+// blue bars and a bottom row of -I, white, +Q and black.
+func drawSMPTE(img *image.RGBA) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	bars := []color.RGBA{
+		{191, 191, 191, 255}, {191, 191, 0, 255}, {0, 191, 191, 255}, {0, 191, 0, 255},
+		{191, 0, 191, 255}, {191, 0, 0, 255}, {0, 0, 191, 255},
+	}
+	strip := []color.RGBA{
+		{0, 0, 191, 255}, {19, 19, 19, 255}, {191, 0, 191, 255}, {19, 19, 19, 255},
+		{0, 191, 191, 255}, {19, 19, 19, 255}, {191, 191, 191, 255},
+	}
+	bottom := []color.RGBA{
+		{0, 33, 76, 255}, {255, 255, 255, 255}, {50, 0, 106, 255}, {19, 19, 19, 255},
+	}
+
+	fill := func(x0, y0, x1, y1 int, c color.RGBA) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	top, middle := h*2/3, h*3/4
+	for i, c := range bars {
+		fill(i*w/7, 0, (i+1)*w/7, top, c)
+		fill(i*w/7, top, (i+1)*w/7, middle, strip[i])
+	}
+	// The bottom row splits the first five sevenths into four patches and
+	// leaves the rest black
+	for i, c := range bottom {
+		fill(i*w*5/28, middle, (i+1)*w*5/28, h, c)
+	}
+	fill(w*20/28, middle, w, h, color.RGBA{19, 19, 19, 255})
+}
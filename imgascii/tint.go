@@ -0,0 +1,67 @@
+package imgascii
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Tint is a two-tone gradient that colors cells by their luminance instead
+// of by the colors of the image, from Dark for black to Light for white.
+type Tint struct {
+	Dark  color.RGBA
+	Light color.RGBA
+}
+
+// Tints are the built-in gradients: green on black as in The Matrix, the
+// amber of old terminals, and sepia.
+var Tints = map[string]Tint{
+	"matrix": {Dark: color.RGBA{0x00, 0x0a, 0x00, 0xff}, Light: color.RGBA{0x00, 0xff, 0x41, 0xff}},
+	"amber":  {Dark: color.RGBA{0x0a, 0x05, 0x00, 0xff}, Light: color.RGBA{0xff, 0xb0, 0x00, 0xff}},
+	"sepia":  {Dark: color.RGBA{0x2b, 0x1a, 0x0e, 0xff}, Light: color.RGBA{0xf1, 0xe3, 0xc6, 0xff}},
+}
+
+// ParseTint parses the name of one of Tints or a custom duotone written as
+// "#rrggbb,#rrggbb", dark first, as used by the command line.
+func ParseTint(value string) (Tint, error) {
+	if t, ok := Tints[value]; ok {
+		return t, nil
+	}
+	dark, light, found := strings.Cut(value, ",")
+	var t Tint
+	_, err := fmt.Sscanf(dark, "#%02x%02x%02x", &t.Dark.R, &t.Dark.G, &t.Dark.B)
+	if err == nil && found {
+		_, err = fmt.Sscanf(light, "#%02x%02x%02x", &t.Light.R, &t.Light.G, &t.Light.B)
+	}
+	if err != nil || !found {
+		return Tint{}, fmt.Errorf("invalid tint %q: expected matrix, amber, sepia or #rrggbb,#rrggbb", value)
+	}
+	t.Dark.A, t.Light.A = 0xff, 0xff
+	return t, nil
+}
+
+// At returns the color of the gradient at gray level y.
+func (t Tint) At(y uint8) color.RGBA {
+	lerp := func(a, b uint8) uint8 {
+		return uint8((int(a)*(255-int(y)) + int(b)*int(y) + 127) / 255)
+	}
+	return color.RGBA{lerp(t.Dark.R, t.Light.R), lerp(t.Dark.G, t.Light.G), lerp(t.Dark.B, t.Light.B), 0xff}
+}
+
+// String formats the tint as ParseTint reads it.
+func (t Tint) String() string {
+	return fmt.Sprintf("#%02x%02x%02x,#%02x%02x%02x", t.Dark.R, t.Dark.G, t.Dark.B, t.Light.R, t.Light.G, t.Light.B)
+}
+
+// apply colors every pixel of gray with the gradient.
+func (t Tint) apply(gray *image.Gray) *image.RGBA {
+	bounds := gray.Bounds()
+	tinted := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			tinted.SetRGBA(x, y, t.At(gray.GrayAt(x, y).Y))
+		}
+	}
+	return tinted
+}
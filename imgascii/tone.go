@@ -0,0 +1,182 @@
+package imgascii
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// toneMapToGray compresses the luminance of a high dynamic range image into
+// the 8-bit range. The source is treated as linear light, which is how 16-bit
+// HDR captures are usually stored, and the result is gamma encoded for display.
+func toneMapToGray(img image.Image, operator string) *image.Gray {
+	bounds := img.Bounds()
+	lum := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	logSum := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			l := (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+			lum = append(lum, l)
+			logSum += math.Log(1e-4 + l)
+		}
+	}
+
+	// Scale the scene so its log-average luminance lands on middle gray
+	key := 0.18
+	if len(lum) > 0 {
+		key /= math.Exp(logSum / float64(len(lum)))
+	}
+
+	gray := image.NewGray(bounds)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			l := lum[i] * key
+			i++
+			switch operator {
+			case "reinhard":
+				l = l / (1 + l)
+			case "hable":
+				const whitePoint = 11.2
+				l = hable(l*2) / hable(whitePoint)
+			case "aces":
+				l = aces(l)
+			}
+			l = math.Pow(math.Max(0, math.Min(1, l)), 1/2.2)
+			gray.SetGray(x, y, color.Gray{Y: uint8(math.Round(l * 255))})
+		}
+	}
+
+	return gray
+}
+
+// hable is the filmic curve from Uncharted 2, as described by John Hable.
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// aces is Krzysztof Narkowicz's fit of the ACES filmic curve, which keeps
+// more contrast in the midtones than reinhard and rolls highlights off
+// gently instead of clipping them.
+func aces(x float64) float64 {
+	const a, b, c, d, e = 2.51, 0.03, 2.43, 0.59, 0.14
+	return x * (a*x + b) / (x*(c*x+d) + e)
+}
+
+// stretchContrast remaps the grayscale histogram so the given percentiles
+// land on black and white, letting low-contrast images use the whole ramp.
+func stretchContrast(img *image.Gray, clipLow, clipHigh float64) *image.Gray {
+	bounds := img.Bounds()
+	var hist [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			hist[img.GrayAt(x, y).Y]++
+		}
+	}
+
+	total := bounds.Dx() * bounds.Dy()
+	low, high := 0, 255
+	for count, limit := 0, int(float64(total)*clipLow/100); low < 255; low++ {
+		count += hist[low]
+		if count > limit {
+			break
+		}
+	}
+	for count, limit := 0, int(float64(total)*clipHigh/100); high > 0; high-- {
+		count += hist[high]
+		if count > limit {
+			break
+		}
+	}
+	if high <= low {
+		return img
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		v := (i - low) * 255 / (high - low)
+		lut[i] = uint8(max(0, min(255, v)))
+	}
+
+	stretched := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			stretched.SetGray(x, y, color.Gray{Y: lut[img.GrayAt(x, y).Y]})
+		}
+	}
+
+	return stretched
+}
+
+func adjustTone(img *image.Gray, brightness, contrast, gamma float64) *image.Gray {
+	// Build a lookup table once instead of doing the float math per pixel
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i) / 255
+		v = (v-0.5)*contrast + 0.5 + brightness
+		v = math.Max(0, math.Min(1, v))
+		v = math.Pow(v, 1/gamma)
+		lut[i] = uint8(math.Round(v * 255))
+	}
+
+	bounds := img.Bounds()
+	adjusted := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			adjusted.SetGray(x, y, color.Gray{Y: lut[img.GrayAt(x, y).Y]})
+		}
+	}
+
+	return adjusted
+}
+
+// otsuThreshold picks the gray level that best splits img into dark and
+// light, by Otsu's method of maximising the variance between the two.
+func otsuThreshold(img *image.Gray) int {
+	bounds := img.Bounds()
+	var hist [256]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			hist[img.GrayAt(x, y).Y]++
+		}
+	}
+
+	total, sum := float64(bounds.Dx()*bounds.Dy()), 0.0
+	for i, n := range hist {
+		sum += float64(i) * n
+	}
+
+	// Levels below t are dark; the best t maximises the between class
+	// variance w0*w1*(mean0-mean1)²
+	best, level := -1.0, 128
+	w0, sum0 := 0.0, 0.0
+	for t := 1; t < 256; t++ {
+		w0 += hist[t-1]
+		sum0 += float64(t-1) * hist[t-1]
+		w1 := total - w0
+		if w0 == 0 || w1 == 0 {
+			continue
+		}
+		diff := sum0/w0 - (sum-sum0)/w1
+		if v := w0 * w1 * diff * diff; v > best {
+			best, level = v, t
+		}
+	}
+	return level
+}
+
+// threshold turns img black and white, white from level up.
+func threshold(img *image.Gray, level int) *image.Gray {
+	bounds := img.Bounds()
+	binary := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if int(img.GrayAt(x, y).Y) >= level {
+				binary.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return binary
+}
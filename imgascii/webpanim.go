@@ -0,0 +1,152 @@
+package imgascii
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+var errWebPAnimation = errors.New("failed to decode image: invalid animated WebP")
+
+// animatedWebP reports whether header, the start of a file, is a WebP with
+// the animation flag of its VP8X chunk set.
+func animatedWebP(header []byte) bool {
+	return len(header) >= 21 && string(header[:4]) == "RIFF" && string(header[8:16]) == "WEBPVP8X" && header[20]&0x02 != 0
+}
+
+// webpFrames are the frames of an animated WebP. The ANMF chunk of every
+// frame holds the chunks of a still WebP, which x/image/webp decodes once
+// they are wrapped in a file of their own.
+type webpFrames struct {
+	chunks []riffChunk
+	canvas *frameCanvas
+}
+
+// riffChunk is a chunk of a RIFF file: its FourCC and data.
+type riffChunk struct {
+	kind string
+	data []byte
+}
+
+// readRIFFChunks splits data into chunks, which are padded to an even
+// length.
+func readRIFFChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	for len(data) >= 8 {
+		n := binary.LittleEndian.Uint32(data[4:])
+		if uint64(n) > uint64(len(data)-8) {
+			return nil, errWebPAnimation
+		}
+		chunks = append(chunks, riffChunk{string(data[:4]), data[8 : 8+n]})
+		data = data[min(len(data), 8+int(n)+int(n&1)):]
+	}
+	return chunks, nil
+}
+
+func newWebPFrames(r io.Reader, opts DecodeOptions) (*webpFrames, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if len(data) < 12 {
+		return nil, errWebPAnimation
+	}
+	chunks, err := readRIFFChunks(data[12:])
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].kind != "VP8X" || len(chunks[0].data) != 10 {
+		return nil, errWebPAnimation
+	}
+	vp8x := chunks[0].data
+	bounds := image.Rect(0, 0, int(uint24(vp8x[4:]))+1, int(uint24(vp8x[7:]))+1)
+
+	s := &webpFrames{canvas: newFrameCanvas(bounds, opts)}
+	for _, c := range chunks {
+		if c.kind == "ANMF" {
+			s.chunks = append(s.chunks, c)
+		}
+	}
+	if len(s.chunks) == 0 {
+		return nil, errWebPAnimation
+	}
+	return s, nil
+}
+
+// uint24 reads the little endian 24 bit number WebP headers use.
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func (s *webpFrames) Next() (Frame, error) {
+	if len(s.chunks) == 0 {
+		return Frame{}, io.EOF
+	}
+	anmf := s.chunks[0].data
+	s.chunks = s.chunks[1:]
+	if len(anmf) < 16 {
+		return Frame{}, errWebPAnimation
+	}
+
+	// The offset is stored halved, the size less one and the duration in
+	// milliseconds. Flag bit 1 is set for frames that replace what is
+	// under them rather than being blended over it, and bit 0 for frames
+	// cleared once shown.
+	x, y := 2*int(uint24(anmf)), 2*int(uint24(anmf[3:]))
+	w, h := int(uint24(anmf[6:]))+1, int(uint24(anmf[9:]))+1
+	delay := time.Duration(uint24(anmf[12:])) * time.Millisecond
+	flags := anmf[15]
+	dispose := disposeNone
+	if flags&0x01 != 0 {
+		dispose = disposeBackground
+	}
+
+	frame, err := readRIFFChunks(anmf[16:])
+	if err != nil {
+		return Frame{}, err
+	}
+	var still bytes.Buffer
+	for _, c := range frame {
+		switch c.kind {
+		case "ALPH":
+			// Lossy frames keep their alpha in a chunk of its own, which
+			// only a VP8X file may have
+			vp8x := make([]byte, 10)
+			vp8x[0] = 0x10
+			vp8x[4], vp8x[5], vp8x[6] = byte(w-1), byte((w-1)>>8), byte((w-1)>>16)
+			vp8x[7], vp8x[8], vp8x[9] = byte(h-1), byte((h-1)>>8), byte((h-1)>>16)
+			writeRIFFChunk(&still, riffChunk{"VP8X", vp8x})
+			writeRIFFChunk(&still, c)
+		case "VP8 ", "VP8L":
+			writeRIFFChunk(&still, c)
+		}
+	}
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(4+still.Len()))
+	file.WriteString("WEBP")
+	file.Write(still.Bytes())
+
+	patch, err := webp.Decode(&file)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode image: frame: %w", err)
+	}
+	rect := image.Rect(x, y, x+w, y+h).Intersect(s.canvas.canvas.Bounds())
+	return s.canvas.draw(patch, rect, flags&0x02 == 0, dispose, delay)
+}
+
+// writeRIFFChunk writes c to buf with its length and padding.
+func writeRIFFChunk(buf *bytes.Buffer, c riffChunk) {
+	buf.WriteString(c.kind)
+	binary.Write(buf, binary.LittleEndian, uint32(len(c.data)))
+	buf.Write(c.data)
+	if len(c.data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
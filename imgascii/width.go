@@ -0,0 +1,114 @@
+package imgascii
+
+import "unicode"
+
+// RuneWidth returns how many terminal columns r takes: 0 for control
+// characters and combining marks, 2 for East Asian wide and fullwidth
+// characters and emoji, and 1 for everything else.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0, r < 0x20, r >= 0x7f && r < 0xa0:
+		return 0
+	case r == 0x200b, unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	case wideRune(r):
+		return 2
+	}
+	return 1
+}
+
+// SafeRune returns r, or U+FFFD in place of a control or format character
+// such as an escape, a tab or a direction override, which would corrupt
+// every kind of text output. Options only accept characters that are
+// safe, so this only replaces what mappers, effects or scripts put in.
+func SafeRune(r rune) rune {
+	if !unicode.IsGraphic(r) {
+		return unicode.ReplacementChar
+	}
+	return r
+}
+
+// wideRune reports whether terminals draw r two columns wide: emoji and the
+// East Asian wide and fullwidth ranges.
+func wideRune(r rune) bool {
+	switch {
+	case r >= 0x1100 && r <= 0x115f,
+		r == 0x231a || r == 0x231b || r == 0x23f0 || r == 0x23f3,
+		r >= 0x25fd && r <= 0x25fe,
+		r >= 0x2614 && r <= 0x2615,
+		r >= 0x2648 && r <= 0x2653,
+		r == 0x26aa || r == 0x26ab || r == 0x26bd || r == 0x26be,
+		r == 0x26d4 || r == 0x26ea || r == 0x26f5 || r == 0x26fa || r == 0x26fd,
+		r == 0x2705 || r == 0x274c || r == 0x2b50 || r == 0x2b55,
+		r >= 0x2b1b && r <= 0x2b1c,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f680 && r <= 0x1f6ff,
+		r >= 0x1f7e0 && r <= 0x1f7eb,
+		r >= 0x1f900 && r <= 0x1faff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return true
+	}
+	return false
+}
+
+// widen returns the fullwidth form of a printable ASCII character, with the
+// ideographic space for a space, so narrow ramp characters fill a double
+// width cell. Other runes are returned as they are.
+func widen(r rune) rune {
+	switch {
+	case r == ' ':
+		return '　'
+	case r > ' ' && r < 0x7f:
+		return r + 0xfee0
+	}
+	return r
+}
+
+// cellColumns returns how many terminal columns each cell takes: two when
+// the glyphs of mosaic mode or the characters of the ramp include a double
+// width one, as emoji and CJK characters are, and one otherwise. Scaling
+// samples half as many columns for double width cells so the aspect holds.
+func cellColumns(opts Options) int {
+	var runes []rune
+	switch opts.Mode {
+	case "blocks", "shade":
+		return 1
+	case "mosaic":
+		for _, g := range opts.Glyphs {
+			runes = append(runes, g.Rune)
+		}
+	default:
+		runes = []rune(opts.Charset)
+	}
+	for _, r := range runes {
+		if wideRune(r) {
+			return 2
+		}
+	}
+	return 1
+}
+
+// Columns returns how many terminal columns each cell of the art takes: two
+// when any cell holds a double width character and one otherwise. Narrow
+// characters in double width art are padded with a space as they are
+// rendered, which keeps the columns lined up.
+func (a *Art) Columns() int {
+	for _, cell := range a.Cells {
+		if wideRune(cell.Rune) {
+			return 2
+		}
+	}
+	return 1
+}
+
+// padding returns how many spaces follow r to fill a cell columns wide.
+func padding(r rune, columns int) int {
+	return max(0, columns-RuneWidth(r))
+}
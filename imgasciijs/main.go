@@ -0,0 +1,77 @@
+//go:build js && wasm
+
+// Command imgasciijs runs the conversion engine of imgascii in browsers. Built
+// with GOOS=js GOARCH=wasm and started with the wasm_exec.js of the Go
+// distribution, it sets a global imgascii object whose convert function takes
+// the bytes of an image and an object of Options:
+//
+//	const art = imgascii.convert(bytes, {width: 80, charset: "detailed"});
+//	if (art.error) throw new Error(art.error);
+//	pre.innerHTML = art.html;
+//
+// Options keys are the field names of imgascii.Options in any case, as in
+// pipeline files, and options left out keep their defaults. The result holds
+// the art as plain text and as HTML with any colors, and its size in
+// characters, or only error when the image could not be converted.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+func main() {
+	js.Global().Set("imgascii", js.ValueOf(map[string]any{
+		"convert": js.FuncOf(convert),
+	}))
+
+	// The functions are only callable while the program runs
+	select {}
+}
+
+// convert is imgascii.convert(imageBytes, options).
+func convert(this js.Value, args []js.Value) any {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return failure("convert needs the bytes of an image")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	// Without a height the art keeps the aspect of the image
+	opts := imgascii.DefaultOptions()
+	opts.Height = 0
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		// JSON is the form Options already take in pipeline files
+		encoded := js.Global().Get("JSON").Call("stringify", args[1]).String()
+		if err := json.Unmarshal([]byte(encoded), &opts); err != nil {
+			return failure(err.Error())
+		}
+	}
+
+	img, err := imgascii.Decode(bytes.NewReader(data))
+	if err != nil {
+		return failure(err.Error())
+	}
+	// Characters are about twice as tall as they are wide
+	if opts.Height == 0 && opts.Width > 0 {
+		bounds := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+		opts.Height = max(1, opts.Width*bounds.Dy()/bounds.Dx()/2)
+	}
+	art, err := imgascii.ConvertArt(img, opts)
+	if err != nil {
+		return failure(err.Error())
+	}
+	return map[string]any{
+		"text":   art.String(),
+		"html":   art.HTML(),
+		"width":  art.Width,
+		"height": art.Height,
+	}
+}
+
+func failure(message string) any {
+	return map[string]any{"error": message}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// viewer is the state of the interactive mode. The decoded image is kept in
+// a Converter, so every key press only re-runs the stages it affects.
+type viewer struct {
+	converter *imgascii.Converter
+	bounds    image.Rectangle
+	opts      imgascii.Options
+
+	// zoom is how many times smaller than the whole image the view is,
+	// centered on cx, cy in source pixels.
+	zoom   float64
+	cx, cy float64
+
+	session     *imgascii.Session
+	sessionPath string
+	status      string
+}
+
+// interactiveKeys documents the key bindings on the status line.
+const interactiveKeys = "arrows pan  +/- zoom  c color  s charset  d dither  i invert  r record  q quit"
+
+func runInteractive(args []string) int {
+	fs := flag.NewFlagSet("interactive", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Path to the image file")
+	sessionPath := fs.String("record", "session.json", "Where the r key saves the recorded session")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii interactive -i image [options]")
+		fmt.Fprintln(os.Stderr, "Keys: "+interactiveKeys)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	// The view pans and zooms over the upright image
+	if opts.Orient != 0 {
+		fmt.Fprintln(os.Stderr, tr("-orient cannot be used in interactive mode"))
+		return exitUsage
+	}
+	img, err := imgascii.DecodeFileWith(*imagePath, optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, tr("Interactive mode needs a terminal. Quitting."))
+		return exitFailure
+	}
+
+	bounds := img.Bounds()
+	v := &viewer{
+		converter:   imgascii.NewConverter(img),
+		bounds:      bounds,
+		opts:        opts,
+		zoom:        1,
+		cx:          float64(bounds.Min.X+bounds.Max.X) / 2,
+		cy:          float64(bounds.Min.Y+bounds.Max.Y) / 2,
+		sessionPath: *sessionPath,
+	}
+	if err := v.run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func (v *viewer) run() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		out.Flush()
+		term.Restore(int(os.Stdin.Fd()), state)
+	}()
+	// Ctrl-C is a key in raw mode, but SIGTERM still ends the tool
+	defer onInterrupt(func() {
+		os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		term.Restore(int(os.Stdin.Fd()), state)
+	})()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		if err := v.draw(out); err != nil {
+			return err
+		}
+
+		key, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		if !v.handle(key) {
+			return v.stopRecording()
+		}
+	}
+}
+
+// readKey reads one key press, folding arrow escape sequences into names.
+func readKey(in *bufio.Reader) (string, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if b != 0x1b {
+		return string(b), nil
+	}
+	if in.Buffered() == 0 {
+		return "esc", nil
+	}
+	seq := make([]byte, 2)
+	if _, err := in.Read(seq); err != nil {
+		return "", err
+	}
+	switch string(seq) {
+	case "[A":
+		return "up", nil
+	case "[B":
+		return "down", nil
+	case "[C":
+		return "right", nil
+	case "[D":
+		return "left", nil
+	}
+	return "", nil
+}
+
+// handle applies a key press and reports whether the viewer should go on.
+func (v *viewer) handle(key string) bool {
+	step := 0.1 / v.zoom
+	v.status = ""
+	switch key {
+	case "q", "esc", "\x03":
+		return false
+	case "left", "h":
+		v.cx -= step * float64(v.bounds.Dx())
+	case "right", "l":
+		v.cx += step * float64(v.bounds.Dx())
+	case "up", "k":
+		v.cy -= step * float64(v.bounds.Dy())
+	case "down", "j":
+		v.cy += step * float64(v.bounds.Dy())
+	case "+", "=":
+		v.zoom = min(v.zoom*1.25, 64)
+	case "-", "_":
+		v.zoom = max(v.zoom/1.25, 1)
+	case "c":
+		// Blocks and shade modes draw nothing without a color, so they skip
+		// none
+		colors := []string{"none", "16", "256", "truecolor"}
+		if v.opts.Mode == "blocks" || v.opts.Mode == "shade" {
+			colors = colors[1:]
+		}
+		v.opts.Color = cycle(colors, v.opts.Color)
+	case "s":
+		names := []string{"standard", "blocks", "detailed"}
+		current := ""
+		for _, name := range names {
+			if imgascii.Charsets[name] == v.opts.Charset {
+				current = name
+			}
+		}
+		v.opts.Charset = imgascii.Charsets[cycle(names, current)]
+	case "d":
+		v.opts.Dither = !v.opts.Dither
+	case "i":
+		v.opts.Invert = !v.opts.Invert
+	case "r":
+		if v.session == nil {
+			v.session = imgascii.NewSession()
+			v.status = tr("recording")
+		} else if err := v.stopRecording(); err != nil {
+			v.status = err.Error()
+		} else {
+			v.status = fmt.Sprintf(tr("saved %s"), v.sessionPath)
+		}
+	}
+	return true
+}
+
+// stopRecording saves and ends the current recording, if there is one.
+func (v *viewer) stopRecording() error {
+	if v.session == nil {
+		return nil
+	}
+	session := v.session
+	v.session = nil
+
+	file, err := createAtomic(v.sessionPath)
+	if err != nil {
+		return err
+	}
+	if _, err := session.WriteTo(file); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// draw renders the current view to fill the terminal above a status line.
+func (v *viewer) draw(out *bufio.Writer) error {
+	cols, rows := terminalSize()
+	rows = max(1, rows-1)
+
+	// The view keeps the terminal's aspect, cells being twice as tall as
+	// they are wide, and stays inside the image
+	aspect := float64(cols) / float64(rows*2)
+	w, h := float64(v.bounds.Dx())/v.zoom, float64(v.bounds.Dy())/v.zoom
+	if w/h > aspect {
+		w = h * aspect
+	} else {
+		h = w / aspect
+	}
+	v.cx = max(float64(v.bounds.Min.X)+w/2, min(float64(v.bounds.Max.X)-w/2, v.cx))
+	v.cy = max(float64(v.bounds.Min.Y)+h/2, min(float64(v.bounds.Max.Y)-h/2, v.cy))
+
+	opts := v.opts
+	opts.Crop = image.Rect(int(v.cx-w/2), int(v.cy-h/2), int(v.cx+w/2), int(v.cy+h/2))
+	opts.Width = max(1, min(cols, int(w*float64(cols)/float64(v.bounds.Dx())*v.zoom)))
+	opts.Height = max(1, min(rows, int(float64(opts.Width)*h/w/2)))
+	art, err := v.converter.Convert(opts)
+	if err != nil {
+		return err
+	}
+	if v.session != nil {
+		v.session.Record(opts)
+	}
+
+	out.WriteString("\x1b[H\x1b[2J")
+	out.WriteString(strings.ReplaceAll(strings.TrimSuffix(art, "\n"), "\n", "\r\n"))
+	status := fmt.Sprintf("%.0f%%  %s", v.zoom*100, interactiveKeys)
+	if v.status != "" {
+		status = v.status + "  " + status
+	}
+	fmt.Fprintf(out, "\x1b[%d;1H\x1b[0m\x1b[7m%s\x1b[0m", rows+1, truncate(status, cols))
+	return out.Flush()
+}
+
+// cycle returns the entry after current in values, wrapping around.
+func cycle(values []string, current string) string {
+	return values[(slices.Index(values, current)+1)%len(values)]
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interruptSignals stop the tool: Ctrl-C, and the SIGTERM that kill,
+// service managers and container runtimes send.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// interrupted is cancelled by the first interrupt signal.
+var interrupted, interrupt = context.WithCancel(context.Background())
+
+var interruptState struct {
+	mu       sync.Mutex
+	watchers int
+	next     int
+	cleanups map[int]func()
+}
+
+// handleInterrupts traps the interrupt signals for the whole run. The first
+// one cancels interrupted, which the modes that watch it take to wind down
+// and return, restoring the terminal and discarding partial output on the
+// way. When no mode watches it, or on a second signal, the tool exits at
+// once with exitInterrupted after running the cleanups registered with
+// onInterrupt.
+func handleInterrupts() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, interruptSignals...)
+	go func() {
+		<-c
+		interrupt()
+		interruptState.mu.Lock()
+		watched := interruptState.watchers > 0
+		interruptState.mu.Unlock()
+		if watched {
+			<-c
+		}
+		interruptState.mu.Lock()
+		for id := interruptState.next - 1; id >= 0; id-- {
+			if fn, ok := interruptState.cleanups[id]; ok {
+				fn()
+			}
+		}
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// watchInterrupts tells handleInterrupts the caller stops by itself once
+// the returned context, interrupted, is done, until it calls done.
+func watchInterrupts() (context.Context, func()) {
+	interruptState.mu.Lock()
+	interruptState.watchers++
+	interruptState.mu.Unlock()
+	return interrupted, func() {
+		interruptState.mu.Lock()
+		interruptState.watchers--
+		interruptState.mu.Unlock()
+	}
+}
+
+// onInterrupt registers fn to run should the tool exit on an interrupt
+// before remove is called, latest first as deferred calls run. The
+// cleanups restore the terminal and remove temporary files, which exiting
+// would leave behind.
+func onInterrupt(fn func()) (remove func()) {
+	interruptState.mu.Lock()
+	defer interruptState.mu.Unlock()
+	if interruptState.cleanups == nil {
+		interruptState.cleanups = map[int]func(){}
+	}
+	id := interruptState.next
+	interruptState.next++
+	interruptState.cleanups[id] = fn
+	return func() {
+		interruptState.mu.Lock()
+		delete(interruptState.cleanups, id)
+		interruptState.mu.Unlock()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// jsonCell is one cell of the JSON output.
+type jsonCell struct {
+	Char      string   `json:"char"`
+	Luminance uint8    `json:"luminance"`
+	RGB       [3]uint8 `json:"rgb"`
+}
+
+// writeJSON writes the size of the art and its cells row by row, each with
+// its character, the luminance that picked it and its sampled color.
+func writeJSON(w io.Writer, art *imgascii.Art) error {
+	rows := make([][]jsonCell, art.Height)
+	for y := range rows {
+		rows[y] = make([]jsonCell, art.Width)
+		for x := range rows[y] {
+			cell := art.At(x, y)
+			rows[y][x] = jsonCell{
+				Char:      string(cell.Rune),
+				Luminance: cell.Gray,
+				RGB:       [3]uint8{cell.Pixel.R, cell.Pixel.G, cell.Pixel.B},
+			}
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		Width  int          `json:"width"`
+		Height int          `json:"height"`
+		Cells  [][]jsonCell `json:"cells"`
+	}{art.Width, art.Height, rows})
+}
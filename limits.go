@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// limits bounds the resources of the long running modes, so they can be left
+// running in small containers or started on demand and stop by themselves.
+type limits struct {
+	// idle stops the mode after this long without any work. Zero never
+	// stops.
+	idle time.Duration
+
+	// jobs is how many conversions may run at once. Further conversions
+	// wait in a queue.
+	jobs int
+}
+
+// byteSize is a flag value holding a number of bytes, written with an
+// optional K, M or G suffix in powers of 1024.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	s := strings.TrimSuffix(strings.ToUpper(value), "B")
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n << shift)
+	return nil
+}
+
+// limitMemory sets a soft limit on the heap. The garbage collector works
+// harder as the limit comes near instead of letting the process grow past it.
+func limitMemory(max byteSize) {
+	if max > 0 {
+		debug.SetMemoryLimit(int64(max))
+	}
+}
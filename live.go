@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// frameSource is a live input that frames can be grabbed from, such as a
+// camera or a raw pixel stream.
+type frameSource interface {
+	// Frame waits for and returns the next frame. io.EOF ends the stream.
+	Frame() (image.Image, error)
+	Close() error
+}
+
+// runLive streams art from src to the terminal until the stream ends or is
+// interrupted. With fit set every frame is sized to the terminal, otherwise
+// to size. A positive fps caps the frame rate, skipping frames the
+// conversion can't keep up with; otherwise frames are drawn as they arrive.
+// meter, if not nil, shows the frame rate below the frames.
+func runLive(src frameSource, opts imgascii.Options, size image.Point, fit bool, fps float64, meter *fpsMeter) error {
+	defer src.Close()
+
+	ctx, done := watchInterrupts()
+	defer done()
+
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?25l\x1b[2J")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[2J\x1b[H")
+		out.Flush()
+	}()
+	// A source stuck waiting for a frame exits on a second interrupt
+	defer onInterrupt(func() { os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[2J\x1b[H") })()
+
+	var prev *imgascii.Art
+	var tick <-chan time.Time
+	if fps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / fps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		img, err := src.Frame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		opts.Width, opts.Height = size.X, size.Y
+		if fit {
+			opts.Width, opts.Height = fitSize(imgascii.TurnedBounds(img.Bounds(), opts.Orient), reserveFor(meter != nil))
+		}
+		art, err := imgascii.ConvertArt(img, opts)
+		if err != nil {
+			return err
+		}
+		// Only changed cells are drawn once there is a frame to compare
+		// with. The last newline of a whole frame is left out so a frame
+		// filling the terminal doesn't scroll it, unless the meter needs
+		// the line below
+		text := art.Delta(prev)
+		prev = art
+		if meter == nil {
+			text = strings.TrimSuffix(text, "\n")
+		}
+		start := time.Now()
+		out.WriteString(text)
+		if meter != nil {
+			fmt.Fprintf(out, "\x1b[%d;1H", art.Height+1)
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		meter.frame(time.Since(start))
+
+		if tick == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		}
+	}
+}
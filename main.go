@@ -1,176 +1,1334 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
+	"image/color/palette"
 	"image/draw"
-	_ "image/jpeg"
-	"image/png"
+	"image/gif"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
 )
 
 func main() {
+	handleInterrupts()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "convert":
+			os.Exit(runConvert(os.Args[2:]))
+		case "play":
+			os.Exit(runPlay(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "batch":
+			os.Exit(runBatch(os.Args[2:]))
+		case "filter":
+			os.Exit(runFilter(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "interactive":
+			os.Exit(runInteractive(os.Args[2:]))
+		case "tune":
+			os.Exit(runTune(os.Args[2:]))
+		case "gen":
+			os.Exit(runGen(os.Args[2:]))
+		case "matrix":
+			os.Exit(runMatrix(os.Args[2:]))
+		case "screensaver":
+			os.Exit(runScreensaver(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "stats":
+			os.Exit(runStats(os.Args[2:]))
+		case "caps":
+			os.Exit(runCaps(os.Args[2:]))
+		case "cache":
+			os.Exit(runCache(os.Args[2:]))
+		case "strip":
+			os.Exit(runStrip(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "ansify":
+			os.Exit(runAnsify(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		}
+	}
+
+	// Without a command the arguments are those of convert, as they were
+	// before there were commands
+	os.Exit(runConvert(os.Args[1:]))
+}
+
+// ansiTerminal is false when stdout is a console that prints escape
+// sequences literally, as Windows consoles before Windows 10 do.
+var ansiTerminal = enableVirtualTerminal()
+
+// deterministic is set by -deterministic. It makes the output depend on
+// nothing but the input and the flags, for CI pipelines: terminals are
+// taken to be 80x24 without colors or a light background, the default
+// config file is not read and recordings carry no timestamp.
+var deterministic bool
+
+// Exit codes of every command, so scripts can tell what went wrong.
+// Diagnostics always go to stderr, keeping stdout for output.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2 // bad flags or arguments
+	exitDecode  = 3 // the input could not be read or decoded
+	exitWrite   = 4 // the output could not be written
+
+	// exitInterrupted follows SIGINT or SIGTERM, 128 plus the number of
+	// SIGINT as shells report a command stopped by Ctrl-C
+	exitInterrupted = 130
+)
+
+// commands lists the subcommands for the usage message.
+const commands = `Commands:
+  convert      convert an image to a file or stdout, the default
+  play         play an animation, camera or raw stream in the terminal
+  serve        convert images posted over HTTP or gRPC
+  batch        convert several images to files
+  filter       convert stdin to stdout for editors and scripts
+  interactive  view an image full screen and tune it by key
+  tune         tune an image by key and print the command line
+  gen          write a synthetic test image
+  matrix       compare settings on a contact sheet
+  screensaver  show random images full screen until a key is pressed
+  compare      show two images side by side or their differences
+  selftest     check this build renders the built-in test images as released
+  bench        time every stage of converting an image
+  stats        show the tones of an image and how they fill the ramp
+  caps         show what the terminal supports
+  cache        clear the conversions kept by -cache-dir
+  strip        remove the colors from art on stdin
+  ansify       color plain art on stdin from its JSON output
+  render       draw a text or ANSI art file as png, svg or pdf
+
+Run go-img-ascii <command> -help for the options of a command.
+`
+
+// runConvert is the convert command, which is also what runs without a
+// command.
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+
 	// Handle command line arguments
-	imagePath := flag.String("i", "", "Path to the image file")
-	output := flag.String("o", "stdout", "Output option: stdout or png or txt")
-	width := flag.Int("w", 64, "Width to scale the image to")
-	height := flag.Int("h", 32, "Height to scale the image to")
+	var inputs pathList
+	fs.Var(&inputs, "i", "Path to the image file, camera:N for a webcam, screen for a screenshot, raw:path[:WxH:format] for raw pixels or unix:path or a named pipe for a feed of images, may be repeated with -montage")
+	output := fs.String("o", "stdout", "Output option: stdout or clipboard or png or svg or pdf or txt or ansi-file or html or gif or cast or json or go or md")
+	outPath := fs.String("out", "", "Output file, whose extension picks the format unless -o is given")
+	widths := sizeList{64}
+	heights := sizeList{32}
+	fs.Var(&widths, "w", "Width to scale the image to, comma separated for several sizes")
+	fs.Var(&heights, "h", "Height to scale the image to, comma separated for several sizes")
+	var relative relativeSize
+	fs.Var(&relative.scale, "scale", "Size the output to a percentage of the image, as 25%, instead of -w and -h")
+	fs.IntVar(&relative.maxWidth, "max-width", 0, "Largest width, the height following the image aspect, instead of -w and -h")
+	fs.IntVar(&relative.maxHeight, "max-height", 0, "Largest height, the width following the image aspect, instead of -w and -h")
+	var preset presetName
+	fs.Var(&preset, "size", "Preset size and charset: thumbnail or small or medium or large, or full to fill the terminal, overridden by -w, -h and -charset")
+	fontPath := fs.String("font", "", "TrueType or OpenType font for png, svg and pdf output")
+	fontSize := localFloat(fs, "font-size", 14, "Font size in points for -font")
+	calibrate := fs.Bool("calibrate", false, "Respace the charset by the ink of each glyph in -font, or the built-in font")
+	themeName := fs.String("theme", "light", "Colors for png, svg and pdf output: light or dark or solarized or matrix")
+	linkMode := fs.String("html-links", "none", "Link html cells to the source image: none or fragment or query")
+	var goSrc goSource
+	fs.StringVar(&goSrc.pkg, "go-package", "main", "Package of the file written by -o go")
+	fs.StringVar(&goSrc.name, "go-name", "Art", "Name of the constant holding the art in -o go output")
+	clipboardANSI := fs.Bool("clipboard-ansi", false, "Keep the color escapes in text copied by -o clipboard")
+	mdTitle := fs.String("md-title", "", "Heading above the code block written by -o md")
+	txtSpaces := fs.String("txt-spaces", "keep", "Spaces in -o txt output: keep, or trim to drop trailing spaces, or tabs to also turn runs of spaces into tabs")
+	eol := fs.String("eol", "lf", "Line endings of -o txt and ansi-file output: lf or crlf")
+	encoding := fs.String("encoding", "utf8", "Character set of -o txt and ansi-file output: utf8 or cp437 or ascii, swapping characters it lacks for the closest it has")
+	annotate := fs.Bool("annotate", false, "Head txt, ansi-file and html exports with a comment naming the source file, size, charset and version of the tool")
+	noAnnotate := fs.Bool("no-annotate", false, "Never head exports with a comment, even when the config file sets -annotate")
+	linkBase := fs.String("link-base", "", "URL of the source image for -html-links (default the input path)")
+	watch := fs.Bool("watch", false, "Re-render whenever the input file changes")
+	fit := fs.Bool("fit", false, "Size the output to fit the terminal")
+	maxBytes := fs.Int("max-bytes", 0, "Shrink the output until it fits in this many bytes")
+	autoTuning := fs.Bool("auto-tune", false, "Pick the -contrast, -gamma and start of the charset whose art looks most like the image, printing them on stderr")
+	score := fs.Bool("score", false, "Print on stderr how much the art looks like the image, as SSIM from -1 to 1, to compare charsets and settings")
+	idleTimeout := fs.Duration("idle-timeout", 0, "Stop watching after this long without changes")
+	maxJobs := fs.Int("max-jobs", 1, "Conversions that may run at once in watch mode, the rest are queued")
+	var maxMemory byteSize
+	fs.Var(&maxMemory, "max-memory", "Soft memory limit such as 256M")
+	cacheDir := fs.String("cache-dir", "", "Directory keeping conversions of still images, reused when the same image is converted with the same options")
+	cacheMax := byteSize(256 << 20)
+	fs.Var(&cacheMax, "cache-max", "Size -cache-dir is kept under by removing the least recently used conversions, 0 for no limit")
+	region := fs.String("region", "", "Part of the screen to capture with -i screen: x,y,w,h")
+	rawFormat := fs.String("raw-format", "", "Size and pixel format of -i raw:path frames, as 320x240:rgba, instead of a header on every frame")
+	pan := fs.Bool("pan", false, "Slowly zoom and pan across the image in wallpaper mode")
+	fps := localFloat(fs, "fps", 12, "Frame rate for image sequences and camera input")
+	sequence := fs.Bool("sequence", false, "Read -i as the frames of an animation: a glob, a numbered pattern such as frames/%04d.png or a directory")
+	progress := fs.Bool("progress", false, "Show conversion progress, and the frame rate of playback, on stderr")
+	maxFPS := localFloat(fs, "max-fps", 0, "Highest frame rate to play animations at, dropping the frames in between")
+	var pb playback
+	fs.IntVar(&pb.loop, "loop", 1, "Times to play an animation on stdout, 0 to repeat it until q is pressed")
+	fs.BoolVar(&pb.reverse, "reverse", false, "Play an animation on stdout backwards")
+	fs.BoolVar(&pb.boomerang, "boomerang", false, "Play an animation on stdout forwards and then backwards")
+	var grid gridValue
+	fs.Var(&grid, "montage", "Lay several -i inputs, or the images of a directory, out on one sheet of colsxrows tiles sized -w by -h")
+	labels := fs.Bool("labels", false, "Put each file name above its tile in a montage")
+	separators := fs.Bool("separators", false, "Divide the tiles of a montage with lines")
+	var page pageValue
+	fs.Var(&page, "tile", "Split the art into pages of colsxlines, each headed by its row and column, written as numbered files or separated by form feeds")
+	var sheetGrid gridValue
+	fs.Var(&sheetGrid, "contact-sheet", "Lay colsxrows frames spread evenly over an animation out on one sheet of tiles sized -w by -h, each below its time")
+	slideshow := fs.Bool("slideshow", false, "Show several -i inputs, or the images of a directory, one after another in the terminal until a key is pressed")
+	delay := fs.Duration("delay", 5*time.Second, "How long each image of a slideshow is shown")
+	transition := fs.String("transition", "cut", "Transition between the images of a slideshow: cut or fade or dissolve or wipe")
+	pad := fs.Int("pad", 0, "Columns of margin around the art, with half as many lines above and below")
+	padChar := fs.String("pad-char", " ", "Character filling the -pad margin")
+	center := fs.Bool("center", false, "Centre the art in the width of the terminal")
+	border := fs.Bool("border", false, "Draw a box around the art")
+	title := fs.String("title", "", "Caption in the top edge of the -border box")
+	configPath := fs.String("config", "", "TOML file with defaults for these flags (default ~/.config/go-img-ascii/config.toml)")
+	fs.BoolVar(&deterministic, "deterministic", false, "Ignore the terminal, the default config file and the clock, so the same input and flags always give the same output")
+	version := fs.Bool("version", false, "Print the version, the commit built from and the optional features of this binary")
+	optionFlags := addOptionFlags(fs)
 
 	// Override the default usage function
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii [command] [options]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprint(os.Stderr, commands)
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options of convert:")
+		fmt.Fprintln(os.Stderr, "  -config string")
+		fmt.Fprintln(os.Stderr, "    	TOML file with defaults for these flags (default ~/.config/go-img-ascii/config.toml)")
+		fmt.Fprintln(os.Stderr, "  -deterministic")
+		fmt.Fprintln(os.Stderr, "    	Ignore the terminal, the default config file and the clock, so the same input and flags always give the same output")
+		fmt.Fprintln(os.Stderr, "  -version")
+		fmt.Fprintln(os.Stderr, "    	Print the version, the commit built from and the optional features of this binary")
 		fmt.Fprintln(os.Stderr, "  -i string")
-		fmt.Fprintln(os.Stderr, "    	Path to the image file")
+		fmt.Fprintln(os.Stderr, "    	Path to the image file, camera:N for a webcam, screen for a screenshot, raw:path[:WxH:format] for raw pixels or unix:path or a named pipe for a feed of images, may be repeated with -montage")
 		fmt.Fprintln(os.Stderr, "  -o string")
-		fmt.Fprintln(os.Stderr, "    	Output option: stdout or png or txt (default \"stdout\")")
-		fmt.Fprintln(os.Stderr, "  -w int")
-		fmt.Fprintln(os.Stderr, "    	Width to scale the image to (default 64)")
-		fmt.Fprintln(os.Stderr, "  -h int")
-		fmt.Fprintln(os.Stderr, "    	Height to scale the image to (default 32)")
+		fmt.Fprintln(os.Stderr, "    	Output option: stdout or clipboard or png or svg or pdf or txt or ansi-file or html or gif or cast or json or go or md (default \"stdout\")")
+		fmt.Fprintln(os.Stderr, "  -out string")
+		fmt.Fprintln(os.Stderr, "    	Output file, whose extension picks the format unless -o is given")
+		fmt.Fprintln(os.Stderr, "  -w int[,int...]")
+		fmt.Fprintln(os.Stderr, "    	Width to scale the image to, comma separated for several sizes (default 64)")
+		fmt.Fprintln(os.Stderr, "  -h int[,int...]")
+		fmt.Fprintln(os.Stderr, "    	Height to scale the image to, comma separated for several sizes (default 32)")
+		fmt.Fprintln(os.Stderr, "  -scale percent")
+		fmt.Fprintln(os.Stderr, "    	Size the output to a percentage of the image, as 25%, instead of -w and -h")
+		fmt.Fprintln(os.Stderr, "  -max-width int")
+		fmt.Fprintln(os.Stderr, "    	Largest width, the height following the image aspect, instead of -w and -h")
+		fmt.Fprintln(os.Stderr, "  -max-height int")
+		fmt.Fprintln(os.Stderr, "    	Largest height, the width following the image aspect, instead of -w and -h")
+		fmt.Fprintln(os.Stderr, "  -size string")
+		fmt.Fprintln(os.Stderr, "    	Preset size and charset: thumbnail or small or medium or large, or full to fill the terminal, overridden by -w, -h and -charset")
+		fmt.Fprintln(os.Stderr, "  -font string")
+		fmt.Fprintln(os.Stderr, "    	TrueType or OpenType font for png, svg and pdf output")
+		fmt.Fprintln(os.Stderr, "  -font-size float")
+		fmt.Fprintln(os.Stderr, "    	Font size in points for -font (default 14)")
+		fmt.Fprintln(os.Stderr, "  -calibrate")
+		fmt.Fprintln(os.Stderr, "    	Respace the charset by the ink of each glyph in -font, or the built-in font")
+		fmt.Fprintln(os.Stderr, "  -theme string")
+		fmt.Fprintln(os.Stderr, "    	Colors for png, svg and pdf output: light or dark or solarized or matrix (default \"light\")")
+		fmt.Fprintln(os.Stderr, "  -html-links string")
+		fmt.Fprintln(os.Stderr, "    	Link html cells to the source image: none or fragment or query (default \"none\")")
+		fmt.Fprintln(os.Stderr, "  -link-base string")
+		fmt.Fprintln(os.Stderr, "    	URL of the source image for -html-links (default the input path)")
+		fmt.Fprintln(os.Stderr, "  -clipboard-ansi")
+		fmt.Fprintln(os.Stderr, "    	Keep the color escapes in text copied by -o clipboard")
+		fmt.Fprintln(os.Stderr, "  -md-title string")
+		fmt.Fprintln(os.Stderr, "    	Heading above the code block written by -o md")
+		fmt.Fprintln(os.Stderr, "  -txt-spaces string")
+		fmt.Fprintln(os.Stderr, "    	Spaces in -o txt output: keep, or trim to drop trailing spaces, or tabs to also turn runs of spaces into tabs (default \"keep\")")
+		fmt.Fprintln(os.Stderr, "  -eol string")
+		fmt.Fprintln(os.Stderr, "    	Line endings of -o txt and ansi-file output: lf or crlf (default \"lf\")")
+		fmt.Fprintln(os.Stderr, "  -encoding string")
+		fmt.Fprintln(os.Stderr, "    	Character set of -o txt and ansi-file output: utf8 or cp437 or ascii, swapping characters it lacks for the closest it has (default \"utf8\")")
+		fmt.Fprintln(os.Stderr, "  -annotate")
+		fmt.Fprintln(os.Stderr, "    	Head txt, ansi-file and html exports with a comment naming the source file, size, charset and version of the tool")
+		fmt.Fprintln(os.Stderr, "  -no-annotate")
+		fmt.Fprintln(os.Stderr, "    	Never head exports with a comment, even when the config file sets -annotate")
+		fmt.Fprintln(os.Stderr, "  -go-package string")
+		fmt.Fprintln(os.Stderr, "    	Package of the file written by -o go (default \"main\")")
+		fmt.Fprintln(os.Stderr, "  -go-name string")
+		fmt.Fprintln(os.Stderr, "    	Name of the constant holding the art in -o go output (default \"Art\")")
+		fmt.Fprintln(os.Stderr, "  -watch")
+		fmt.Fprintln(os.Stderr, "    	Re-render whenever the input file changes")
+		fmt.Fprintln(os.Stderr, "  -fit")
+		fmt.Fprintln(os.Stderr, "    	Size the output to fit the terminal")
+		fmt.Fprintln(os.Stderr, "  -max-bytes int")
+		fmt.Fprintln(os.Stderr, "    	Shrink the output until it fits in this many bytes")
+		fmt.Fprintln(os.Stderr, "  -auto-tune")
+		fmt.Fprintln(os.Stderr, "    	Pick the -contrast, -gamma and start of the charset whose art looks most like the image, printing them on stderr")
+		fmt.Fprintln(os.Stderr, "  -score")
+		fmt.Fprintln(os.Stderr, "    	Print on stderr how much the art looks like the image, as SSIM from -1 to 1, to compare charsets and settings")
+		fmt.Fprintln(os.Stderr, "  -idle-timeout duration")
+		fmt.Fprintln(os.Stderr, "    	Stop watching after this long without changes")
+		fmt.Fprintln(os.Stderr, "  -max-jobs int")
+		fmt.Fprintln(os.Stderr, "    	Conversions that may run at once in watch mode, the rest are queued (default 1)")
+		fmt.Fprintln(os.Stderr, "  -max-memory size")
+		fmt.Fprintln(os.Stderr, "    	Soft memory limit such as 256M")
+		fmt.Fprintln(os.Stderr, "  -cache-dir string")
+		fmt.Fprintln(os.Stderr, "    	Directory keeping conversions of still images, reused when the same image is converted with the same options")
+		fmt.Fprintln(os.Stderr, "  -cache-max size")
+		fmt.Fprintln(os.Stderr, "    	Size -cache-dir is kept under by removing the least recently used conversions, 0 for no limit (default 256M)")
+		fmt.Fprintln(os.Stderr, "  -region string")
+		fmt.Fprintln(os.Stderr, "    	Part of the screen to capture with -i screen: x,y,w,h")
+		fmt.Fprintln(os.Stderr, "  -raw-format WxH:format")
+		fmt.Fprintln(os.Stderr, "    	Size and pixel format of -i raw:path frames, as 320x240:rgba, instead of a header on every frame")
+		fmt.Fprintln(os.Stderr, "  -pan")
+		fmt.Fprintln(os.Stderr, "    	Slowly zoom and pan across the image in wallpaper mode")
+		fmt.Fprintln(os.Stderr, "  -fps float")
+		fmt.Fprintln(os.Stderr, "    	Frame rate for image sequences and camera input (default 12)")
+		fmt.Fprintln(os.Stderr, "  -sequence")
+		fmt.Fprintln(os.Stderr, "    	Read -i as the frames of an animation: a glob, a numbered pattern such as frames/%04d.png or a directory")
+		fmt.Fprintln(os.Stderr, "  -progress")
+		fmt.Fprintln(os.Stderr, "    	Show conversion progress, and the frame rate of playback, on stderr")
+		fmt.Fprintln(os.Stderr, "  -max-fps float")
+		fmt.Fprintln(os.Stderr, "    	Highest frame rate to play animations at, dropping the frames in between (default no limit)")
+		fmt.Fprintln(os.Stderr, "  -loop int")
+		fmt.Fprintln(os.Stderr, "    	Times to play an animation on stdout, 0 to repeat it until q is pressed (default 1)")
+		fmt.Fprintln(os.Stderr, "  -reverse")
+		fmt.Fprintln(os.Stderr, "    	Play an animation on stdout backwards")
+		fmt.Fprintln(os.Stderr, "  -boomerang")
+		fmt.Fprintln(os.Stderr, "    	Play an animation on stdout forwards and then backwards")
+		fmt.Fprintln(os.Stderr, "  -montage colsxrows")
+		fmt.Fprintln(os.Stderr, "    	Lay several -i inputs, or the images of a directory, out on one sheet of colsxrows tiles sized -w by -h")
+		fmt.Fprintln(os.Stderr, "  -labels")
+		fmt.Fprintln(os.Stderr, "    	Put each file name above its tile in a montage")
+		fmt.Fprintln(os.Stderr, "  -separators")
+		fmt.Fprintln(os.Stderr, "    	Divide the tiles of a montage with lines")
+		fmt.Fprintln(os.Stderr, "  -tile colsxlines")
+		fmt.Fprintln(os.Stderr, "    	Split the art into pages of colsxlines, each headed by its row and column, written as numbered files or separated by form feeds")
+		fmt.Fprintln(os.Stderr, "  -contact-sheet colsxrows")
+		fmt.Fprintln(os.Stderr, "    	Lay colsxrows frames spread evenly over an animation out on one sheet of tiles sized -w by -h, each below its time")
+		fmt.Fprintln(os.Stderr, "  -slideshow")
+		fmt.Fprintln(os.Stderr, "    	Show several -i inputs, or the images of a directory, one after another in the terminal until a key is pressed")
+		fmt.Fprintln(os.Stderr, "  -delay duration")
+		fmt.Fprintln(os.Stderr, "    	How long each image of a slideshow is shown (default 5s)")
+		fmt.Fprintln(os.Stderr, "  -transition string")
+		fmt.Fprintln(os.Stderr, "    	Transition between the images of a slideshow: cut or fade or dissolve or wipe (default \"cut\")")
+		fmt.Fprintln(os.Stderr, "  -pad int")
+		fmt.Fprintln(os.Stderr, "    	Columns of margin around the art, with half as many lines above and below")
+		fmt.Fprintln(os.Stderr, "  -pad-char string")
+		fmt.Fprintln(os.Stderr, "    	Character filling the -pad margin (default \" \")")
+		fmt.Fprintln(os.Stderr, "  -center")
+		fmt.Fprintln(os.Stderr, "    	Centre the art in the width of the terminal")
+		fmt.Fprintln(os.Stderr, "  -border")
+		fmt.Fprintln(os.Stderr, "    	Draw a box around the art")
+		fmt.Fprintln(os.Stderr, "  -title string")
+		fmt.Fprintln(os.Stderr, "    	Caption in the top edge of the -border box")
+		fmt.Fprintln(os.Stderr, "  -brightness float")
+		fmt.Fprintln(os.Stderr, "    	Brightness offset from -1 to 1 (default 0)")
+		fmt.Fprintln(os.Stderr, "  -contrast float")
+		fmt.Fprintln(os.Stderr, "    	Contrast multiplier (default 1)")
+		fmt.Fprintln(os.Stderr, "  -gamma float")
+		fmt.Fprintln(os.Stderr, "    	Gamma correction (default 1)")
+		fmt.Fprintln(os.Stderr, "  -denoise int")
+		fmt.Fprintln(os.Stderr, "    	Smooth noise within this many cells before the tone adjustments")
+		fmt.Fprintln(os.Stderr, "  -denoise-filter string")
+		fmt.Fprintln(os.Stderr, "    	Filter for -denoise: median or gaussian (default \"median\")")
+		fmt.Fprintln(os.Stderr, "  -sharpen float")
+		fmt.Fprintln(os.Stderr, "    	Unsharp mask amount to recover edges lost to downscaling, 1 is strong (default 0)")
+		fmt.Fprintln(os.Stderr, "  -match string")
+		fmt.Fprintln(os.Stderr, "    	Match the tonal histogram of this reference image")
+		fmt.Fprintln(os.Stderr, "  -auto-contrast")
+		fmt.Fprintln(os.Stderr, "    	Stretch the grayscale histogram to use the full ramp")
+		fmt.Fprintln(os.Stderr, "  -clip-low float")
+		fmt.Fprintln(os.Stderr, "    	Percent of darkest pixels to clip with -auto-contrast (default 1)")
+		fmt.Fprintln(os.Stderr, "  -clip-high float")
+		fmt.Fprintln(os.Stderr, "    	Percent of brightest pixels to clip with -auto-contrast (default 1)")
+		fmt.Fprintln(os.Stderr, "  -charset string")
+		fmt.Fprintln(os.Stderr, "    	Character ramp from empty to dense: standard or blocks or detailed or the characters themselves (default \"standard\")")
+		fmt.Fprintln(os.Stderr, "  -threshold string")
+		fmt.Fprintln(os.Stderr, "    	Render in two tones, cells from this gray level up dense: 1 to 255 or auto")
+		fmt.Fprintln(os.Stderr, "  -dither")
+		fmt.Fprintln(os.Stderr, "    	Diffuse rounding error between cells to avoid banding")
+		fmt.Fprintln(os.Stderr, "  -levels int")
+		fmt.Fprintln(os.Stderr, "    	Tone steps to quantize to, repeating or skipping charset characters to fit (default one per character)")
+		fmt.Fprintln(os.Stderr, "  -level-bounds string")
+		fmt.Fprintln(os.Stderr, "    	Gray levels from 1 to 255 at which each tone step after the first starts, as 64,128,192, instead of even steps")
+		fmt.Fprintln(os.Stderr, "  -samples int")
+		fmt.Fprintln(os.Stderr, "    	Average an NxN grid of samples per cell for steadier animations (default 1)")
+		fmt.Fprintln(os.Stderr, "  -linear")
+		fmt.Fprintln(os.Stderr, "    	Average -samples and the pixels of block mappers in linear light, keeping fine light detail from darkening")
+		fmt.Fprintln(os.Stderr, "  -hysteresis float")
+		fmt.Fprintln(os.Stderr, "    	Tone levels a cell's tone must move before an animation frame changes its glyph")
+		fmt.Fprintln(os.Stderr, "  -compact")
+		fmt.Fprintln(os.Stderr, "    	Shorten colored output by skipping color changes on spaces and trailing spaces")
+		fmt.Fprintln(os.Stderr, "  -trim")
+		fmt.Fprintln(os.Stderr, "    	Cut the blank rows and columns around the subject")
+		fmt.Fprintln(os.Stderr, "  -effects string")
+		fmt.Fprintln(os.Stderr, "    	Text effects to apply in order, comma separated: shadow or outline or scanlines")
+		fmt.Fprintln(os.Stderr, "  -map-script string")
+		fmt.Fprintln(os.Stderr, "    	Lua script whose cell function returns the character and color of every cell")
+		fmt.Fprintln(os.Stderr, "  -invert")
+		fmt.Fprintln(os.Stderr, "    	Reverse the character ramp")
+		fmt.Fprintln(os.Stderr, "  -attrs")
+		fmt.Fprintln(os.Stderr, "    	Add dim, bold and reverse video characters to the ramp as extra tones for terminals with few colors")
+		fmt.Fprintln(os.Stderr, "  -bg string")
+		fmt.Fprintln(os.Stderr, "    	Terminal background: dark or light or auto (default \"dark\")")
+		fmt.Fprintln(os.Stderr, "  -focus string")
+		fmt.Fprintln(os.Stderr, "    	Crop to the output aspect around a point: x,y as fractions or auto")
+		fmt.Fprintln(os.Stderr, "  -smart-crop")
+		fmt.Fprintln(os.Stderr, "    	Crop to the output aspect around the most detailed part of the image")
+		fmt.Fprintln(os.Stderr, "  -crop-face")
+		fmt.Fprintln(os.Stderr, "    	Crop to the output aspect around the most certain face, needs the faces build tag")
+		fmt.Fprintln(os.Stderr, "  -resize string")
+		fmt.Fprintln(os.Stderr, "    	Fit a source of another aspect: stretch or seam to carve away its least detailed columns or rows (default \"stretch\")")
+		fmt.Fprintln(os.Stderr, "  -alpha string")
+		fmt.Fprintln(os.Stderr, "    	Background for transparent pixels: black or white or checker or skip (default \"black\")")
+		fmt.Fprintln(os.Stderr, "  -mask string")
+		fmt.Fprintln(os.Stderr, "    	Image whose light parts are converted and dark parts left blank, stretched over the input")
+		fmt.Fprintln(os.Stderr, "  -mask-fill string")
+		fmt.Fprintln(os.Stderr, "    	Character filling the parts -mask leaves blank (default \" \")")
+		fmt.Fprintln(os.Stderr, "  -luma string")
+		fmt.Fprintln(os.Stderr, "    	Luminance formula: rec601 or rec709 or average or lightness (default \"rec601\")")
+		fmt.Fprintln(os.Stderr, "  -tonemap string")
+		fmt.Fprintln(os.Stderr, "    	HDR tone mapping: none or reinhard or hable or aces (default \"none\")")
+		fmt.Fprintln(os.Stderr, "  -text value")
+		fmt.Fprintln(os.Stderr, "    	Stamp text over the art as x,y[,#rrggbb]:text, x may be c to center, may be repeated")
+		fmt.Fprintln(os.Stderr, "  -caption string")
+		fmt.Fprintln(os.Stderr, "    	Stamp a caption centered in the bottom line of the art")
+		fmt.Fprintln(os.Stderr, "  -watermark string")
+		fmt.Fprintln(os.Stderr, "    	Stamp text in the bottom right corner of the art")
+		fmt.Fprintln(os.Stderr, "  -no-exif-rotate")
+		fmt.Fprintln(os.Stderr, "    	Ignore the EXIF orientation of photos")
+		fmt.Fprintln(os.Stderr, "  -ignore-icc")
+		fmt.Fprintln(os.Stderr, "    	Read the pixels as sRGB even when the image carries an ICC profile for another color space")
+		fmt.Fprintln(os.Stderr, "  -rotate int")
+		fmt.Fprintln(os.Stderr, "    	Turn the image clockwise before converting: 90 or 180 or 270")
+		fmt.Fprintln(os.Stderr, "  -flip string")
+		fmt.Fprintln(os.Stderr, "    	Mirror the image after -rotate: h or v")
+		fmt.Fprintln(os.Stderr, "  -crop value")
+		fmt.Fprintln(os.Stderr, "    	Convert only this part of the turned image: x,y,w,h in pixels")
+		fmt.Fprintln(os.Stderr, "  -orient string")
+		fmt.Fprintln(os.Stderr, "    	Turn the art for vertical banners and displays on their side: horizontal or vertical, or 90 or 180 or 270 degrees clockwise (default \"horizontal\")")
+		fmt.Fprintln(os.Stderr, "  -mode string")
+		fmt.Fprintln(os.Stderr, "    	Cell rendering: ascii or blocks or mosaic or shade or wallpaper, or auto for blocks where the terminal shows them (default \"ascii\")")
+		fmt.Fprintln(os.Stderr, "  -mapper string")
+		fmt.Fprintln(os.Stderr, "    	Character selection for ascii mode: luminance or halfblock or braille or structural (default \"luminance\")")
+		fmt.Fprintln(os.Stderr, "  -detail-map string")
+		fmt.Fprintln(os.Stderr, "    	Draw busy cells with finer glyphs and the rest from the charset: none or braille or quadrant (default \"none\")")
+		fmt.Fprintln(os.Stderr, "  -detail-threshold float")
+		fmt.Fprintln(os.Stderr, "    	Standard deviation in gray levels, from 0 to 128, at which -detail-map draws a cell with finer glyphs (default 32)")
+		fmt.Fprintln(os.Stderr, "  -glyphs string")
+		fmt.Fprintln(os.Stderr, "    	Glyphs for mosaic mode: squares or circles or a file of glyph #rrggbb lines (default \"squares\")")
+		fmt.Fprintln(os.Stderr, "  -color string")
+		fmt.Fprintln(os.Stderr, "    	ANSI color output: none or 16 or 256 or truecolor, or auto or always or never to pick the depth the terminal supports (default \"none\")")
+		fmt.Fprintln(os.Stderr, "  -quantize string")
+		fmt.Fprintln(os.Stderr, "    	Palette matching for 16 and 256 colors: nearest or ciede2000 or dither (default \"nearest\")")
+		fmt.Fprintln(os.Stderr, "  -tint string")
+		fmt.Fprintln(os.Stderr, "    	Color cells by brightness along a gradient: matrix or amber or sepia or #rrggbb,#rrggbb")
+		fmt.Fprintln(os.Stderr, "  -palette string")
+		fmt.Fprintln(os.Stderr, "    	Limit colors to a fixed palette: gameboy or pico8 or c64, #rrggbb,#rrggbb,..., a .gpl or hex list file, or median-cut:N for N colors of the image")
 	}
 
-	flag.Parse()
-
-	if *imagePath == "" {
-		fmt.Println("No image provided. Quitting.")
-		os.Exit(1)
+	fs.Parse(args)
+	if *version {
+		printVersion(os.Stdout)
+		return exitOK
 	}
 
-	img, err := decodeImage(*imagePath)
+	// -out overrides -o from the config file, only one given as a flag
+	// overrides -out
+	// The same goes for -w and -h over relative sizes, but giving both
+	// kinds on the command line is a mistake
+	explicit, absolute, themed := false, false, false
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+		explicit = explicit || f.Name == "o"
+		themed = themed || f.Name == "theme"
+		absolute = absolute || f.Name == "w" || f.Name == "h"
+	})
+	if absolute && relative.given() {
+		fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height cannot be combined with -w or -h"))
+		return exitUsage
+	}
+	// The environment, like the config file, is not what -deterministic
+	// output may depend on
+	var err error
+	if !deterministic {
+		err = applyEnv(fs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if *configPath != "" {
+		err = applyConfig(fs, *configPath, true)
+	} else if path := defaultConfigPath(); path != "" && !deterministic {
+		err = applyConfig(fs, path, false)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	// A preset from the config file still gives way to sizes on the
+	// command line
+	if preset.apply(fs, given) {
+		absolute = true
+	}
+	limitMemory(maxMemory)
+	format, err := resolveOutput(*output, explicit, *outPath)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
+	*output = format
 
-	scaled := scaleImage(img, *width, *height)
-	gray := convertToGray(scaled)
-	ascii := mapToASCII(gray)
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	// A console without escapes gets plain characters rather than a screen
+	// full of escape codes
+	if *output == "stdout" && !ansiTerminal && opts.Color != "none" {
+		fmt.Fprintln(os.Stderr, tr("This console does not support colors, printing plain text."))
+		opts.Color, opts.Tint = "none", nil
+		if opts.Mode == "blocks" || opts.Mode == "shade" {
+			opts.Mode = "ascii"
+		}
+	}
 
-	switch *output {
-	case "stdout":
-		printToSTDOUT(ascii)
-	case "png":
-		exportToPNG(ascii, "output.png")
-	case "txt":
-		exportToTXT(ascii, "output.txt")
+	switch *linkMode {
+	case "none", "fragment", "query":
 	default:
-		fmt.Println("Invalid output option. Quitting.")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, tr("Invalid html links option. Quitting."))
+		return exitUsage
+	}
+	switch *txtSpaces {
+	case "keep", "trim", "tabs":
+	default:
+		fmt.Fprintln(os.Stderr, tr("Invalid txt spaces option. Quitting."))
+		return exitUsage
+	}
+	enc := textEncoding{eol: *eol, charset: *encoding}
+	if (enc.eol != "lf" && enc.eol != "crlf") || (enc.charset != "utf8" && enc.charset != "cp437" && enc.charset != "ascii") {
+		fmt.Fprintln(os.Stderr, tr("-eol must be lf or crlf and -encoding utf8 or cp437 or ascii. Quitting."))
+		return exitUsage
+	}
+	if err := pb.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
-}
 
-func decodeImage(imagePath string) (image.Image, error) {
-	file, err := os.Open(imagePath)
+	th, ok := themes[*themeName]
+	if !ok {
+		fmt.Fprintln(os.Stderr, tr("Invalid theme option. Quitting."))
+		return exitUsage
+	}
+	if err := goSrc.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !themed {
+		th = tintedTheme(th, opts.Tint)
+	}
+
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	if len(inputs) > 1 && grid.cols == 0 && !*slideshow {
+		fmt.Fprintln(os.Stderr, tr("Several inputs need -montage or -slideshow. Quitting."))
+		return exitUsage
+	}
+	imagePath := inputs[0]
+	isSequence := *sequence || imgascii.IsSequencePattern(imagePath)
+	if *sequence {
+		if err := checkSequence(imagePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	fill := []rune(*padChar)
+	if *pad < 0 || len(fill) != 1 {
+		fmt.Fprintln(os.Stderr, tr("-pad must not be negative and -pad-char must be a single character. Quitting."))
+		return exitUsage
+	}
+	if strings.ContainsFunc(*padChar+*title, func(r rune) bool { return imgascii.SafeRune(r) != r }) {
+		fmt.Fprintln(os.Stderr, tr("-pad-char and -title must be printable characters. Quitting."))
+		return exitUsage
+	}
+	if (*pad > 0 || *border) && *linkMode != "none" {
+		fmt.Fprintln(os.Stderr, tr("-pad and -border cannot be combined with -html-links. Quitting."))
+		return exitUsage
+	}
+	// Centring only means something in the terminal
+	fr := frame{pad: *pad, fill: fill[0], border: *border, title: *title, center: *center && *output == "stdout"}
+
+	face, err := loadFace(*fontPath, *fontSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open image: %w", err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	// Only a single image links back to its pixels, as set once it is
+	// converted
+	settings := outputSettings{face: face, th: th, links: htmlLinks{mode: "none"}, goSrc: goSrc, mdTitle: *mdTitle, txtSpaces: *txtSpaces, encoding: enc}
+	if *calibrate {
+		opts.Charset = calibratedCharset(opts.Charset, face, *fontPath, *fontSize)
+	}
+	if *output == "png" || *output == "gif" || *output == "pdf" {
+		warnMissingGlyphs(opts, face, os.Stderr)
+	}
+	if *annotate && !*noAnnotate {
+		names := make([]string, len(inputs))
+		for i, input := range inputs {
+			names[i] = filepath.Base(input)
+		}
+		settings.annotate = &annotation{source: strings.Join(names, ", "), charset: opts.Charset}
 	}
-	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	sizes, err := pairSizes(widths, heights)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if absolute {
+		relative = relativeSize{}
+	}
+	if relative.maxWidth < 0 || relative.maxHeight < 0 {
+		fmt.Fprintln(os.Stderr, tr("-max-width and -max-height must not be negative"))
+		return exitUsage
 	}
 
-	return img, nil
-}
+	// Tuning and scoring compare a single converted image with its art,
+	// which -trim would cut down
+	tuning := *autoTuning || *score
+	if tuning && (*slideshow || grid.cols > 0 || *watch || sheetGrid.cols > 0 || opts.Trim) {
+		fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+		return exitUsage
+	}
+	if page.cols > 0 && (*slideshow || grid.cols > 0 || *watch) {
+		fmt.Fprintln(os.Stderr, tr("-tile only splits still images. Quitting."))
+		return exitUsage
+	}
+	if sheetGrid.cols > 0 && (*slideshow || grid.cols > 0 || *watch) {
+		fmt.Fprintln(os.Stderr, tr("-contact-sheet needs an animation or image sequence. Quitting."))
+		return exitUsage
+	}
+	if *slideshow {
+		if grid.cols > 0 || *watch {
+			fmt.Fprintln(os.Stderr, tr("A slideshow cannot be combined with -montage or -watch. Quitting."))
+			return exitUsage
+		}
+		return runSlideshow(inputs, opts, optionFlags, *delay, *transition, *fps)
+	}
 
-func scaleImage(img image.Image, width, height int) image.Image {
-	bounds := img.Bounds()
-	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	if grid.cols > 0 {
+		if *watch || relative.given() {
+			fmt.Fprintln(os.Stderr, tr("A montage takes its tile size from -w and -h and cannot be watched. Quitting."))
+			return exitUsage
+		}
+		paths, listed, err := montageInputs(inputs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitDecode
+		}
+		sheet, code, err := montage(paths, listed, grid, sizes[0], opts, optionFlags, *labels, *separators)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return code
+		}
+		return writeSheet(fr.apply(sheet), *output, *outPath, settings, *clipboardANSI)
+	}
 
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			srcX := x * bounds.Dx() / width
-			srcY := y * bounds.Dy() / height
-			scaled.Set(x, y, img.At(srcX, srcY))
+	if *watch {
+		if *output != "stdout" || len(sizes) > 1 || isSequence {
+			fmt.Fprintln(os.Stderr, tr("Watch mode only supports a single image and size on stdout. Quitting."))
+			return exitUsage
 		}
+		lim := limits{idle: *idleTimeout, jobs: *maxJobs}
+		err := runWatch(imagePath, *fit, lim, func() (string, error) {
+			img, err := imgascii.DecodeFileWith(imagePath, optionFlags.decodeOptions())
+			if err != nil {
+				return "", err
+			}
+			o := opts
+			if err := optionFlags.applyFocus(&o, img); err != nil {
+				return "", err
+			}
+			o.Width, o.Height = sizes[0].X, sizes[0].Y
+			bounds := imgascii.TurnedBounds(img.Bounds(), o.Orient)
+			if *fit {
+				o.Width, o.Height = fitSize(bounds, 1)
+			} else if relative.given() {
+				size := relative.size(bounds)
+				o.Width, o.Height = size.X, size.Y
+			}
+			return imgascii.Convert(img, o)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
 	}
 
-	return scaled
-}
+	if index, ok := cameraIndex(imagePath); ok {
+		if page.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-tile only splits still images. Quitting."))
+			return exitUsage
+		}
+		if sheetGrid.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-contact-sheet needs an animation or image sequence. Quitting."))
+			return exitUsage
+		}
+		if tuning {
+			fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+			return exitUsage
+		}
+		if *output != "stdout" || len(sizes) > 1 {
+			fmt.Fprintln(os.Stderr, tr("Camera input only supports a single size on stdout. Quitting."))
+			return exitUsage
+		}
+		if relative.given() {
+			fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height need an image input"))
+			return exitUsage
+		}
+		cam, err := openCamera(index)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "camera:%d: %v\n", index, err)
+			return exitFailure
+		}
+		if err := runLive(cam, opts, sizes[0], *fit, *fps, newFPSMeter(*progress, os.Stderr)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	if raw, ok, err := openRaw(imagePath, *rawFormat); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitDecode
+		}
+		if page.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-tile only splits still images. Quitting."))
+			return exitUsage
+		}
+		if sheetGrid.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-contact-sheet needs an animation or image sequence. Quitting."))
+			return exitUsage
+		}
+		if tuning {
+			fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+			return exitUsage
+		}
+		if *output != "stdout" || len(sizes) > 1 {
+			fmt.Fprintln(os.Stderr, tr("Raw input only supports a single size on stdout. Quitting."))
+			return exitUsage
+		}
+		if relative.given() {
+			fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height need an image input"))
+			return exitUsage
+		}
+		// Raw frames are drawn as soon as they arrive, the writer sets the pace
+		if err := runLive(raw, opts, sizes[0], *fit, 0, newFPSMeter(*progress, os.Stderr)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	if feed, ok, err := openFeed(imagePath, optionFlags.decodeOptions()); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitDecode
+		}
+		if page.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-tile only splits still images. Quitting."))
+			return exitUsage
+		}
+		if sheetGrid.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-contact-sheet needs an animation or image sequence. Quitting."))
+			return exitUsage
+		}
+		if tuning {
+			fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+			return exitUsage
+		}
+		if *output != "stdout" || len(sizes) > 1 {
+			fmt.Fprintln(os.Stderr, tr("Feed input only supports a single size on stdout. Quitting."))
+			return exitUsage
+		}
+		if relative.given() {
+			fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height need an image input"))
+			return exitUsage
+		}
+		// Like raw frames, fed images are drawn as soon as they arrive
+		if err := runLive(feed, opts, sizes[0], *fit, 0, newFPSMeter(*progress, os.Stderr)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	// A glob is treated as the frames of an animation, as is an animated GIF,
+	// PNG or WebP
+	var frames []imgascii.Frame
+	failure := exitDecode
+	var cache *resultCache
+	var entry string
+	if display, ok := screenDisplay(imagePath); ok {
+		var img image.Image
+		img, err = captureScreen(display, *region)
+		frames = []imgascii.Frame{{Image: img}}
+		failure = exitFailure
+	} else if isSequence {
+		frames, err = imgascii.LoadSequence(imagePath, *fps, optionFlags.decodeOptions())
+	} else if *cacheDir != "" && *output != "clipboard" && *optionFlags.mode != "wallpaper" && !*score {
+		// The cache is looked up before decoding, which a hit skips along
+		// with the conversion. Animations are never added, so only still
+		// images are found. -score is not looked up as its score is only
+		// known by converting
+		var data []byte
+		data, err = os.ReadFile(imagePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to open image: %w", err))
+			return exitDecode
+		}
+		key := cacheOptions{
+			Build:     buildID(),
+			Decode:    optionFlags.decodeOptions(),
+			Options:   opts,
+			Script:    fileSum(*optionFlags.mapScript),
+			Mask:      fileSum(*optionFlags.mask),
+			Sizes:     sizes,
+			Scale:     float64(relative.scale),
+			MaxWidth:  relative.maxWidth,
+			MaxHeight: relative.maxHeight,
+			Fit:       *fit,
+			MaxBytes:  *maxBytes,
+			AutoTune:  *autoTuning,
+			Pad:       fr.pad,
+			Fill:      fr.fill,
+			Border:    fr.border,
+			Title:     fr.title,
+			Center:    fr.center,
+			Page:      image.Pt(page.cols, page.lines),
+			Output:    *output,
+			Theme:     *themeName,
+			Themed:    themed,
+			Font:      fileSum(*fontPath),
+			FontSize:  *fontSize,
+			Links:     *linkMode,
+			LinkBase:  *linkBase,
+			GoPackage: goSrc.pkg,
+			GoName:    goSrc.name,
+			MdTitle:   *mdTitle,
+			TxtSpaces: *txtSpaces,
+			EOL:       *eol,
+			Encoding:  *encoding,
+		}
+		if settings.annotate != nil {
+			key.Annotation = settings.annotate.source
+		}
+		if *fit || fr.center {
+			key.Terminal.X, key.Terminal.Y = terminalSize()
+		}
+		if key.Links != "none" && key.LinkBase == "" {
+			key.LinkBase = imagePath
+		}
+		cache = &resultCache{dir: *cacheDir, max: int64(cacheMax)}
+		entry = cache.name(data, key)
+		if outputs, ok := cache.get(entry); ok {
+			return writeCached(outputs, *output, *outPath)
+		}
+		frames, err = imgascii.DecodeFrames(bytes.NewReader(data), optionFlags.decodeOptions())
+	} else {
+		frames, err = imgascii.DecodeFramesFile(imagePath, optionFlags.decodeOptions())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return failure
+	}
+
+	if len(frames) > 1 {
+		if len(sizes) > 1 {
+			fmt.Fprintln(os.Stderr, tr("Several sizes are not supported for animations. Quitting."))
+			return exitUsage
+		}
+		if pb.given() && (*output != "stdout" || sheetGrid.cols > 0) {
+			fmt.Fprintln(os.Stderr, tr("-loop, -reverse and -boomerang only apply to playback on stdout. Quitting."))
+			return exitUsage
+		}
+		if page.cols > 0 {
+			fmt.Fprintln(os.Stderr, tr("-tile only splits still images. Quitting."))
+			return exitUsage
+		}
+		if tuning {
+			fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+			return exitUsage
+		}
+		if err := optionFlags.applyFocus(&opts, frames[0].Image); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		if sheetGrid.cols > 0 {
+			if *fit || relative.given() {
+				fmt.Fprintln(os.Stderr, tr("A contact sheet takes its tile size from -w and -h. Quitting."))
+				return exitUsage
+			}
+			sheet, err := contactSheet(frames, sheetGrid, sizes[0], opts, *separators, newProgressBar(*progress, os.Stderr, imagePath))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+			return writeSheet(fr.apply(sheet), *output, *outPath, settings, *clipboardANSI)
+		}
+		opts.Width, opts.Height = sizes[0].X, sizes[0].Y
+		bounds := imgascii.TurnedBounds(frames[0].Image.Bounds(), opts.Orient)
+		if *fit {
+			opts.Width, opts.Height = fitSize(bounds, reserveFor(*progress && *output == "stdout"))
+		} else if relative.given() {
+			size := relative.size(bounds)
+			opts.Width, opts.Height = size.X, size.Y
+		}
+		if *output == "stdout" {
+			if err := playFrames(os.Stdout, frames, opts, fr, pb, *maxFPS, newFPSMeter(*progress, os.Stderr)); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitWrite
+			}
+			return exitOK
+		}
+		arts, delays, err := convertFrames(frames, opts, newProgressBar(*progress, os.Stderr, imagePath))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		for i, art := range arts {
+			arts[i] = fr.apply(art)
+		}
+
+		// Formats holding a single art get a file per frame
+		switch *output {
+		case "clipboard":
+			fmt.Fprintln(os.Stderr, tr("Animations cannot be copied to the clipboard. Quitting."))
+			return exitUsage
+		case "gif":
+			exportToGIF(arts, delays, outputFile(*outPath, "gif", ""), face, th)
+		case "cast":
+			exportToCast(arts, delays, outputFile(*outPath, "cast", ""))
+		default:
+			r, ok := settings.renderer(*output)
+			if !ok {
+				fmt.Fprintln(os.Stderr, tr("Invalid output option. Quitting."))
+				return exitUsage
+			}
+			for i, art := range arts {
+				exportArt(art, r, *output, outputFile(*outPath, outputExtension(*output), fmt.Sprintf("-%04d", i+1)))
+			}
+		}
+		return exitOK
+	}
+
+	if sheetGrid.cols > 0 {
+		fmt.Fprintln(os.Stderr, tr("-contact-sheet needs an animation or image sequence. Quitting."))
+		return exitUsage
+	}
+	img := frames[0].Image
+	if *fit {
+		w, h := fitSize(imgascii.TurnedBounds(img.Bounds(), opts.Orient), 1)
+		sizes = []image.Point{image.Pt(w, h)}
+	} else if relative.given() {
+		sizes = []image.Point{relative.size(imgascii.TurnedBounds(img.Bounds(), opts.Orient))}
+	}
+
+	if *optionFlags.mode == "wallpaper" {
+		if tuning {
+			fmt.Fprintln(os.Stderr, tr("-auto-tune and -score only apply to still images. Quitting."))
+			return exitUsage
+		}
+		if err := runWallpaper(img, opts, *pan, *fps); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
 
-func convertToGray(img image.Image) *image.Gray {
-	bounds := img.Bounds()
-	gray := image.NewGray(bounds)
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			originalColor := img.At(x, y)
-			grayColor := color.GrayModel.Convert(originalColor).(color.Gray)
-			gray.SetGray(x, y, grayColor)
+	if err := optionFlags.applyFocus(&opts, img); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// The converter keeps the decoded image, so each size only re-runs the
+	// pipeline from scaling onwards. Every size is converted before anything
+	// is written, so a failure never leaves partial output behind
+	converter := imgascii.NewConverter(img)
+	arts := make([]*imgascii.Art, len(sizes))
+	// Art is scored as seen on the background -bg names, which reversed the
+	// ramp unless -invert reversed it back
+	drawn := glyphs{face: face, light: opts.Invert != *optionFlags.invert}
+	bar := newProgressBar(*progress, os.Stderr, imagePath)
+	for n, size := range sizes {
+		opts.Width, opts.Height = size.X, size.Y
+		if *maxBytes > 0 {
+			_, opts, err = converter.ConvertWithin(opts, *maxBytes)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+		}
+		// Tuning starts afresh from the options given for every size
+		tuned := opts
+		if *autoTuning {
+			var similarity float64
+			tuned, similarity, err = autoTune(converter, img, opts, drawn)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+			fmt.Fprintf(os.Stderr, tr("auto-tune %dx%d: -contrast %g -gamma %g -charset %s (score %.4f)\n"),
+				tuned.Width, tuned.Height, tuned.Contrast, tuned.Gamma, shellQuote(tuned.Charset), similarity)
 		}
+		// The bar spans every size, each taking its share
+		converter.OnProgress(func(done, total int) {
+			bar.update(n*total+done, len(sizes)*total)
+		})
+		arts[n], err = converter.ConvertArt(tuned)
+		converter.OnProgress(nil)
+		bar.clear()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		if *score {
+			fmt.Fprintf(os.Stderr, tr("score %dx%d: %.4f\n"), tuned.Width, tuned.Height, scoreArt(converter, img, arts[n], tuned, drawn))
+		}
+		arts[n] = fr.apply(arts[n])
 	}
 
-	return gray
+	// Several sizes get their dimensions appended to the file name, and
+	// pages their row and column
+	suffixes := make([]string, len(arts))
+	if len(sizes) > 1 {
+		for n, size := range sizes {
+			suffixes[n] = fmt.Sprintf("-%dx%d", size.X, size.Y)
+		}
+	}
+	separator := byte('\n')
+	if page.cols > 0 {
+		arts, suffixes = tileArts(arts, suffixes, page)
+		separator = '\f'
+	}
+
+	if *output == "stdout" {
+		r, _ := settings.renderer(*output)
+		var b strings.Builder
+		for n, art := range arts {
+			if n > 0 {
+				b.WriteByte(separator)
+			}
+			r.Render(art, &b)
+		}
+		if _, err := io.WriteString(os.Stdout, b.String()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+		cache.add(entry, []cachedOutput{{Data: []byte(b.String())}})
+		return exitOK
+	}
+	if *output == "clipboard" {
+		if err := copyToClipboard(clipboardText(arts, *clipboardANSI)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+		return exitOK
+	}
+
+	settings.links = htmlLinks{mode: *linkMode, base: *linkBase, region: converter.SourceRect(), orient: opts.Orient}
+	if settings.links.base == "" {
+		settings.links.base = imagePath
+	}
+	r, ok := settings.renderer(*output)
+	var outputs []cachedOutput
+	for n, art := range arts {
+		suffix := suffixes[n]
+		path := outputFile(*outPath, outputExtension(*output), suffix)
+		switch {
+		case *output == "gif":
+			exportToGIF([]*imgascii.Art{art}, []time.Duration{0}, path, face, th)
+		case *output == "cast":
+			exportToCast([]*imgascii.Art{art}, []time.Duration{0}, path)
+		case ok:
+			exportArt(art, r, *output, path)
+		default:
+			fmt.Fprintln(os.Stderr, tr("Invalid output option. Quitting."))
+			return exitUsage
+		}
+		// The cache keeps the files as written
+		if cache != nil {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				cache = nil
+				continue
+			}
+			outputs = append(outputs, cachedOutput{Suffix: suffix, Data: data})
+		}
+	}
+	cache.add(entry, outputs)
+	return exitOK
+}
+
+// fitSize returns the largest size that keeps the aspect ratio of an image
+// of the given bounds and fits the terminal, leaving reserve rows free below
+// it for the prompt.
+func fitSize(bounds image.Rectangle, reserve int) (int, int) {
+	cols, rows := terminalSize()
+	rows = max(1, rows-reserve)
+
+	// Cells are about twice as tall as they are wide
+	w := cols
+	h := max(1, w*bounds.Dy()/bounds.Dx()/2)
+	if h > rows {
+		h = rows
+		w = max(1, h*2*bounds.Dx()/bounds.Dy())
+	}
+	return w, h
 }
 
-func mapToASCII(img *image.Gray) string {
-	bounds := img.Bounds()
-	ascii := " .:-=+*#%@"
-	buf := make([]byte, 0, bounds.Dx()*bounds.Dy())
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			c := img.GrayAt(x, y)
-			i := int(float64(c.Y) * 9 / 255)
-			buf = append(buf, ascii[i])
+// sizeList is a flag value holding one or more comma separated dimensions.
+type sizeList []int
+
+func (s *sizeList) String() string {
+	parts := make([]string, len(*s))
+	for i, v := range *s {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *sizeList) Set(value string) error {
+	var list sizeList
+	for _, part := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 1 {
+			return fmt.Errorf("invalid size %q", part)
 		}
-		buf = append(buf, '\n')
+		list = append(list, v)
 	}
+	*s = list
+	return nil
+}
 
-	return string(buf)
+// pairSizes matches widths with heights. A single height is scaled along
+// with each width so every variant keeps the same aspect ratio.
+func pairSizes(widths, heights sizeList) ([]image.Point, error) {
+	sizes := make([]image.Point, len(widths))
+	switch {
+	case len(heights) == len(widths):
+		for i := range widths {
+			sizes[i] = image.Pt(widths[i], heights[i])
+		}
+	case len(heights) == 1:
+		for i := range widths {
+			sizes[i] = image.Pt(widths[i], max(1, heights[0]*widths[i]/widths[0]))
+		}
+	default:
+		return nil, fmt.Errorf("got %d widths but %d heights", len(widths), len(heights))
+	}
+
+	return sizes, nil
 }
 
-func printToSTDOUT(ascii string) {
-	for _, char := range ascii {
-		fmt.Print(string(char))
+// queryLightBackground asks the terminal for its background color with an
+// OSC 11 query. The second return value is false when the terminal did not
+// answer in time, in which case COLORFGBG is consulted as a fallback.
+func queryLightBackground() (bool, bool) {
+	if deterministic {
+		return false, false
 	}
+	query, ok := passthrough("\x1b]11;?\x07")
+	if ok && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+			defer term.Restore(int(os.Stdin.Fd()), state)
+			defer onInterrupt(func() { term.Restore(int(os.Stdin.Fd()), state) })()
+
+			fmt.Fprint(os.Stdout, query)
+			r, ok := readReply(200*time.Millisecond, 64, func(buf []byte) bool {
+				last := buf[len(buf)-1]
+				return last == '\a' || last == '\\' && len(buf) > 1 && buf[len(buf)-2] == 0x1b
+			})
+			if ok {
+				var red, green, blue uint32
+				if i := strings.Index(r, "rgb:"); i >= 0 {
+					if _, err := fmt.Sscanf(r[i:], "rgb:%x/%x/%x", &red, &green, &blue); err == nil {
+						// Components are 1 to 4 hex digits, only the ratio matters
+						digits := strings.Index(r[i+4:], "/")
+						full := float64(uint32(1)<<(4*digits) - 1)
+						l := (0.2126*float64(red) + 0.7152*float64(green) + 0.0722*float64(blue)) / full
+						return l > 0.5, true
+					}
+				}
+			}
+		}
+	}
+
+	// COLORFGBG is set by some terminals as "fg;bg" using ANSI color numbers
+	if v := os.Getenv("COLORFGBG"); v != "" {
+		parts := strings.Split(v, ";")
+		switch parts[len(parts)-1] {
+		case "7", "15":
+			return true, true
+		default:
+			return false, true
+		}
+	}
+
+	return false, false
 }
 
-func exportToTXT(ascii string, outputPath string) {
-	file, err := os.Create(outputPath)
-	if err != nil {
-		fmt.Println("Error: File could not be created")
-		os.Exit(1)
+// writeTXT writes the art as plain text. Select graphic rendition escapes
+// are stripped even from overlaid text, so the file shows the same in any
+// viewer. Spaces are kept, or compacted as compactSpaces does for trim and
+// tabs.
+func writeTXT(art *imgascii.Art, w io.Writer, spaces string) error {
+	text := sgrEscape.ReplaceAllString(art.String(), "")
+	if spaces != "keep" {
+		lines := strings.SplitAfter(text, "\n")
+		for i, line := range lines {
+			if content, ok := strings.CutSuffix(line, "\n"); ok {
+				lines[i] = compactSpaces(content, spaces) + "\n"
+			}
+		}
+		text = strings.Join(lines, "")
 	}
-	defer file.Close()
+	_, err := io.WriteString(w, text)
+	return err
+}
 
-	if _, err := file.WriteString(ascii); err != nil {
-		fmt.Println("Error: ASCII could not be written")
-		os.Exit(1)
+// compactSpaces shortens a line of plain text: trim drops its trailing
+// spaces, and tabs also turns each run of spaces reaching a tab stop, every
+// eight columns, into a tab, as unexpand does. Transparent logos leave wide
+// fields of spaces that this shrinks to a few bytes.
+func compactSpaces(line, spaces string) string {
+	line = strings.TrimRight(line, " ")
+	if spaces != "tabs" {
+		return line
 	}
+	var b strings.Builder
+	column, run := 0, 0
+	for _, r := range line {
+		if r == ' ' {
+			column++
+			run++
+			if column%8 == 0 {
+				// A tab only pays for itself over two or more spaces
+				if run > 1 {
+					b.WriteByte('\t')
+				} else {
+					b.WriteByte(' ')
+				}
+				run = 0
+			}
+			continue
+		}
+		b.WriteString(strings.Repeat(" ", run))
+		run = 0
+		b.WriteRune(r)
+		column += imgascii.RuneWidth(r)
+	}
+	return b.String()
 }
 
-func exportToPNG(ascii string, outputPath string) {
-	lines := strings.Split(ascii, "\n")
-	img := image.NewRGBA(image.Rect(0, 0, len(lines[0])*6, len(lines)*12))
-	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+// sgrEscape matches an escape sequence setting colors or text attributes.
+// Art pads the escape character, which takes no column, with a space.
+var sgrEscape = regexp.MustCompile(`\x1b ?\[[0-9;:]*m`)
 
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.Black,
-		Face: basicfont.Face7x13,
+// checkSequence returns an error unless -sequence can read path as frames:
+// a directory of them, or a glob or numbered pattern, which are read as
+// frames even without -sequence.
+func checkSequence(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	if !imgascii.IsSequencePattern(path) {
+		return errors.New(tr("-sequence needs a glob, a numbered pattern such as frames/%04d.png or a directory. Quitting."))
 	}
+	return nil
+}
 
-	for y, line := range lines {
-		d.Dot = fixed.P(0, (y+1)*12)
-		d.DrawString(line)
+// loadFace opens a TrueType or OpenType font at the given point size. An
+// empty path selects the built-in 7x13 bitmap font.
+func loadFace(path string, size float64) (font.Face, error) {
+	if path == "" {
+		return basicfont.Face7x13, nil
 	}
 
-	file, err := os.Create(outputPath)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
 	if err != nil {
-		fmt.Println("Error: File could not be created")
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to load font: %w", err)
 	}
-	defer file.Close()
 
-	if err := png.Encode(file, img); err != nil {
-		fmt.Println("Error: Image could not be encoded")
-		os.Exit(1)
+	return face, nil
+}
+
+// theme is the pair of colors used to render text into an image.
+type theme struct {
+	background color.Color
+	foreground color.Color
+}
+
+var themes = map[string]theme{
+	"light":     {color.White, color.Black},
+	"dark":      {color.Black, color.RGBA{0xd0, 0xd0, 0xd0, 0xff}},
+	"solarized": {color.RGBA{0x00, 0x2b, 0x36, 0xff}, color.RGBA{0x83, 0x94, 0x96, 0xff}},
+	"matrix":    {color.Black, color.RGBA{0x00, 0xff, 0x41, 0xff}},
+}
+
+// tintedTheme returns the ends of tint as the colors of image exports, so
+// they look like the tinted terminal output, or th without a tint.
+func tintedTheme(th theme, tint *imgascii.Tint) theme {
+	if tint == nil {
+		return th
+	}
+	return theme{tint.Dark, tint.Light}
+}
+
+// exportToGIF saves the frames as an animated GIF.
+func exportToGIF(arts []*imgascii.Art, delays []time.Duration, outputPath string, face font.Face, th theme) {
+	exportFile(outputPath, "Error: Image could not be encoded", func(w io.Writer) error {
+		return writeGIF(w, arts, delays, face, th)
+	})
+}
+
+// writeGIF renders every frame like the png output and encodes them as an
+// animated GIF that keeps the frame delays.
+func writeGIF(w io.Writer, arts []*imgascii.Art, delays []time.Duration, face font.Face, th theme) error {
+	anim := &gif.GIF{}
+	for i, art := range arts {
+		img := art.Image(face, th.foreground, th.background)
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, int(delays[i]/(10*time.Millisecond)))
 	}
+	return gif.EncodeAll(w, anim)
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// mapScript is an effect running the cell function of a Lua script over
+// every cell, for -map-script. The function is called as
+//
+//	cell(x, y, gray, r, g, b, char)
+//
+// with the position of the cell from 0, its tone and sampled color from 0
+// to 255 and the character picked for it, while the globals width and
+// height hold the size of the art. It returns the new character and a
+// #rrggbb color, where nil keeps the current one and a false color clears
+// it. Scripts get the base, string, table and math libraries but no access
+// to files or the system.
+type mapScript struct {
+	path  string
+	proto *lua.FunctionProto
+
+	// Lua states are not safe for concurrent use, and animations apply
+	// effects to several frames at once
+	states sync.Pool
+
+	failed sync.Once
+}
+
+var (
+	mapScriptsMu sync.Mutex
+	// mapScripts holds the effect name of every script loaded by path, as
+	// effects can only be registered once but options are built again on
+	// every change in the interactive modes
+	mapScripts = map[string]string{}
+)
+
+// loadMapScript compiles the script at path and registers it as an effect,
+// returning the effect name.
+func loadMapScript(path string) (string, error) {
+	mapScriptsMu.Lock()
+	defer mapScriptsMu.Unlock()
+	if name, ok := mapScripts[path]; ok {
+		return name, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("map script: %w", err)
+	}
+	defer file.Close()
+	chunk, err := parse.Parse(file, path)
+	if err != nil {
+		return "", fmt.Errorf("map script: %w", err)
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return "", fmt.Errorf("map script: %w", err)
+	}
+
+	s := &mapScript{path: path, proto: proto}
+	L, err := s.newState()
+	if err != nil {
+		return "", fmt.Errorf("map script: %w", err)
+	}
+	L.SetGlobal("width", lua.LNumber(1))
+	L.SetGlobal("height", lua.LNumber(1))
+	// A first call catches the mistakes that would otherwise only show in
+	// the middle of the art
+	if _, _, err := s.call(L, 0, 0, imgascii.Cell{Rune: ' '}); err != nil {
+		L.Close()
+		return "", fmt.Errorf("map script: %w", err)
+	}
+	s.states.Put(L)
+
+	name := "map-script:" + path
+	imgascii.RegisterEffect(name, s)
+	mapScripts[path] = name
+	return name, nil
+}
+
+// newState returns a sandboxed Lua state that has run the script.
+func (s *mapScript) newState() (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.StringLibName, lua.OpenString},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// The base library can still load code from files
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		return nil, luaError(err)
+	}
+	if L.GetGlobal("cell").Type() != lua.LTFunction {
+		L.Close()
+		return nil, errors.New(s.path + ": no cell function defined")
+	}
+	return L, nil
+}
+
+// call runs the cell function of L for the cell at x, y.
+func (s *mapScript) call(L *lua.LState, x, y int, c imgascii.Cell) (lua.LValue, lua.LValue, error) {
+	err := L.CallByParam(lua.P{Fn: L.GetGlobal("cell"), NRet: 2, Protect: true},
+		lua.LNumber(x), lua.LNumber(y), lua.LNumber(c.Gray),
+		lua.LNumber(c.Pixel.R), lua.LNumber(c.Pixel.G), lua.LNumber(c.Pixel.B),
+		lua.LString(string(c.Rune)))
+	if err != nil {
+		return nil, nil, luaError(err)
+	}
+	char, col := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	if char.Type() != lua.LTNil && char.Type() != lua.LTString {
+		return nil, nil, fmt.Errorf("%s: cell returned a %s for the character", s.path, char.Type())
+	}
+	if col.Type() != lua.LTNil && col != lua.LFalse && col.Type() != lua.LTString {
+		return nil, nil, fmt.Errorf("%s: cell returned a %s for the color", s.path, col.Type())
+	}
+	return char, col, nil
+}
+
+func (s *mapScript) Apply(art *imgascii.Art) {
+	L, _ := s.states.Get().(*lua.LState)
+	if L == nil {
+		var err error
+		if L, err = s.newState(); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+	defer s.states.Put(L)
+
+	L.SetGlobal("width", lua.LNumber(art.Width))
+	L.SetGlobal("height", lua.LNumber(art.Height))
+	for i := range art.Cells {
+		c := &art.Cells[i]
+		char, col, err := s.call(L, i%art.Width, i/art.Width, *c)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		if char.Type() == lua.LTString {
+			c.Rune = ' '
+			if r, _ := utf8.DecodeRuneInString(char.String()); r != utf8.RuneError {
+				c.Rune = r
+			}
+		}
+		switch {
+		case col == lua.LFalse:
+			c.Color, c.Index = color.RGBA{}, 0
+		case col.Type() == lua.LTString:
+			var rgb color.RGBA
+			if _, err := fmt.Sscanf(col.String(), "#%02x%02x%02x", &rgb.R, &rgb.G, &rgb.B); err != nil {
+				s.fail(fmt.Errorf("%s: invalid color %q", s.path, col.String()))
+				return
+			}
+			rgb.A = 0xff
+			c.Color, c.Index = rgb, -1
+		}
+	}
+}
+
+// luaError drops the stack traceback from errors raised in Lua, which
+// points into the interpreter rather than the script.
+func luaError(err error) error {
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) && apiErr.Object != nil {
+		return errors.New(apiErr.Object.String())
+	}
+	return err
+}
+
+// fail reports the first error of the script while applying it, as effects
+// have no way to return one, and leaves the rest of the art unchanged.
+func (s *mapScript) fail(err error) {
+	s.failed.Do(func() {
+		fmt.Fprintf(os.Stderr, tr("map script: %v\n"), err)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// writeMarkdown writes the art as plain text in a fenced code block, under
+// a heading when a title is given. The info string names the size of the
+// art after the language, which renderers ignore. The fence is made longer
+// than any run of backticks in the art so the art cannot close it early.
+func writeMarkdown(w io.Writer, art *imgascii.Art, title string) error {
+	text := sgrEscape.ReplaceAllString(art.String(), "")
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+
+	b := bufio.NewWriter(w)
+	if title != "" {
+		fmt.Fprintf(b, "### %s\n\n", title)
+	}
+	fmt.Fprintf(b, "%stext width=%d height=%d\n%s%s\n", fence, art.Width*art.Columns(), art.Height, text, fence)
+	return b.Flush()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// axis is one dimension of a comparison matrix: a conversion flag and the
+// values it takes along that dimension.
+type axis struct {
+	flag   string
+	values []string
+}
+
+// label names the value at index i, as in dither=true.
+func (a axis) label(i int) string {
+	if a.flag == "" {
+		return ""
+	}
+	return a.flag + "=" + a.values[i]
+}
+
+// axisValue parses the "flag=v1,v2,..." syntax of -rows and -cols.
+type axisValue axis
+
+func (a *axisValue) String() string {
+	if a.flag == "" {
+		return ""
+	}
+	return a.flag + "=" + strings.Join(a.values, ",")
+}
+
+func (a *axisValue) Set(value string) error {
+	name, list, ok := strings.Cut(value, "=")
+	if !ok || name == "" || list == "" {
+		return fmt.Errorf("invalid axis %q: expected flag=value,value", value)
+	}
+	a.flag, a.values = strings.TrimPrefix(name, "-"), strings.Split(list, ",")
+	return nil
+}
+
+// runMatrix renders one image across every combination of the values of
+// -rows and -cols into a labelled contact sheet, to pick settings from.
+func runMatrix(args []string) int {
+	fs := flag.NewFlagSet("matrix", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Path to the image file")
+	width := fs.Int("w", 48, "Width of every conversion, the height follows the image aspect")
+	var rows, cols axisValue
+	fs.Var(&rows, "rows", "Conversion flag and the values to compare down the sheet, as charset=standard,detailed")
+	fs.Var(&cols, "cols", "Conversion flag and the values to compare across the sheet")
+	output := fs.String("o", "matrix.html", "Output file, html or png")
+	themeName := fs.String("theme", "light", "Colors for the sheet: light or dark or solarized or matrix")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii matrix -i image -rows flag=a,b -cols flag=c,d [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	if *width < 1 {
+		fmt.Fprintln(os.Stderr, tr("matrix: width must be positive"))
+		return exitUsage
+	}
+
+	// Only the conversion flags can vary, and with a single axis the other
+	// has one unnamed value
+	conversion := flag.NewFlagSet("", flag.ContinueOnError)
+	addOptionFlags(conversion)
+	for _, a := range []*axisValue{&rows, &cols} {
+		switch {
+		case a.flag == "":
+			a.values = []string{""}
+		case conversion.Lookup(a.flag) == nil:
+			fmt.Fprintf(os.Stderr, tr("matrix: -%s is not a conversion flag\n"), a.flag)
+			return exitUsage
+		}
+	}
+	if rows.flag == "" && cols.flag == "" {
+		fmt.Fprintln(os.Stderr, tr("matrix: give -rows, -cols or both"))
+		return exitUsage
+	}
+
+	format := outputExtensions[strings.ToLower(filepath.Ext(*output))]
+	if format != "html" && format != "png" {
+		fmt.Fprintln(os.Stderr, tr("matrix: the sheet is written as .html or .png"))
+		return exitUsage
+	}
+	th, ok := themes[*themeName]
+	if !ok {
+		fmt.Fprintln(os.Stderr, tr("Invalid theme option. Quitting."))
+		return exitUsage
+	}
+
+	img, err := imgascii.DecodeFileWith(*imagePath, optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	// Setting the axis flags on the parsed set changes the values the
+	// option flags point at, so each combination builds its own options.
+	// One converter reuses whatever stages the varied flag leaves alone
+	converter := imgascii.NewConverter(img)
+	sheet := make([][]*imgascii.Art, len(rows.values))
+	for y, rowValue := range rows.values {
+		sheet[y] = make([]*imgascii.Art, len(cols.values))
+		for x, colValue := range cols.values {
+			for _, set := range []struct{ flag, value string }{{rows.flag, rowValue}, {cols.flag, colValue}} {
+				if set.flag == "" {
+					continue
+				}
+				if err := fs.Set(set.flag, set.value); err != nil {
+					fmt.Fprintf(os.Stderr, "matrix: -%s %s: %v\n", set.flag, set.value, err)
+					return exitUsage
+				}
+			}
+			opts, err := optionFlags.options()
+			if err == nil {
+				// -orient may be an axis, so the height follows the turned image
+				bounds := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+				opts.Width, opts.Height = *width, max(1, *width*bounds.Dy()/bounds.Dx()/2)
+				sheet[y][x], err = converter.ConvertArt(opts)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "matrix: %s: %v\n", strings.TrimSpace(axis(rows).label(y)+" "+axis(cols).label(x)), err)
+				return exitUsage
+			}
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writeMatrixHTML(w, sheet, axis(rows), axis(cols), th)
+	}
+	failure := "Error: HTML could not be written"
+	if format == "png" {
+		write = func(w io.Writer) error {
+			return png.Encode(w, renderMatrix(sheet, axis(rows), axis(cols), th))
+		}
+		failure = "Error: Image could not be encoded"
+	}
+	exportFile(*output, failure, write)
+	return exitOK
+}
+
+// writeMatrixHTML writes the sheet as a page with a table of conversions,
+// the column values heading the columns and the row values the rows.
+func writeMatrixHTML(w io.Writer, sheet [][]*imgascii.Art, rows, cols axis, th theme) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>go-img-ascii matrix</title>\n")
+	fmt.Fprintf(b, "<style>body{--bg:%s;--fg:%s;background:var(--bg);color:var(--fg);font-family:monospace}pre{line-height:1;margin:0}td,th{padding:8px;vertical-align:top;text-align:left}%s</style>\n",
+		cssColor(th.background), cssColor(th.foreground), imgascii.AttrCSS)
+	b.WriteString("</head>\n<body>\n<table>\n<tr><th></th>")
+	for x := range cols.values {
+		fmt.Fprintf(b, "<th>%s</th>", html.EscapeString(cols.label(x)))
+	}
+	b.WriteString("</tr>\n")
+	for y, row := range sheet {
+		fmt.Fprintf(b, "<tr><th>%s</th>", html.EscapeString(rows.label(y)))
+		for _, art := range row {
+			fmt.Fprintf(b, "<td><pre>%s</pre></td>", art.HTML())
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+
+	return b.Flush()
+}
+
+// renderMatrix draws the sheet as one image, each conversion rendered as
+// for png output, with the column labels along the top and the row labels
+// down the left.
+func renderMatrix(sheet [][]*imgascii.Art, rows, cols axis, th theme) *image.RGBA {
+	const pad = 8
+	face := basicfont.Face7x13
+	labelHeight := face.Metrics().Height.Ceil() + pad
+
+	labelWidth := 0
+	for y := range rows.values {
+		labelWidth = max(labelWidth, font.MeasureString(face, rows.label(y)).Ceil())
+	}
+	if labelWidth > 0 {
+		labelWidth += pad
+	}
+
+	images := make([][]*image.RGBA, len(sheet))
+	cellW, cellH := 0, 0
+	for y, row := range sheet {
+		images[y] = make([]*image.RGBA, len(row))
+		for x, art := range row {
+			images[y][x] = art.Image(face, th.foreground, th.background)
+			cellW = max(cellW, images[y][x].Bounds().Dx())
+			cellH = max(cellH, images[y][x].Bounds().Dy())
+		}
+	}
+	for x := range cols.values {
+		cellW = max(cellW, font.MeasureString(face, cols.label(x)).Ceil())
+	}
+
+	sheetW := pad + labelWidth + len(cols.values)*(cellW+pad)
+	sheetH := pad + labelHeight + len(rows.values)*(cellH+pad)
+	img := image.NewRGBA(image.Rect(0, 0, sheetW, sheetH))
+	draw.Draw(img, img.Bounds(), image.NewUniform(th.background), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(th.foreground), Face: face}
+	label := func(text string, x, y int) {
+		d.Dot = fixed.P(x, y+face.Metrics().Ascent.Ceil())
+		d.DrawString(text)
+	}
+	for x := range cols.values {
+		label(cols.label(x), pad+labelWidth+x*(cellW+pad), pad)
+	}
+	for y, row := range images {
+		top := pad + labelHeight + y*(cellH+pad)
+		label(rows.label(y), pad, top)
+		for x, cell := range row {
+			left := pad + labelWidth + x*(cellW+pad)
+			draw.Draw(img, cell.Bounds().Add(image.Pt(left, top)), cell, image.Point{}, draw.Src)
+		}
+	}
+
+	return img
+}
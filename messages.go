@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// messages holds a catalog per language, mapping every English message the
+// tool prints to its translation. Messages missing from a catalog, and every
+// message in languages without one, are printed in English.
+var messages = map[string]map[string]string{
+	"de": {
+		"No image provided. Quitting.":                                                   "Kein Bild angegeben. Abbruch.",
+		"-tile only splits still images. Quitting.":                                      "-tile teilt nur Standbilder auf. Abbruch.",
+		"row %d of %d, column %d of %d":                                                  "Zeile %d von %d, Spalte %d von %d",
+		"Invalid txt spaces option. Quitting.":                                           "Ungültige Option für Leerzeichen in txt. Abbruch.",
+		"Invalid html links option. Quitting.":                                           "Ungültige Option für HTML-Links. Abbruch.",
+		"Invalid theme option. Quitting.":                                                "Ungültiges Farbschema. Abbruch.",
+		"Invalid output option. Quitting.":                                               "Ungültige Ausgabeoption. Abbruch.",
+		"Watch mode only supports a single image and size on stdout. Quitting.":          "Der Beobachtungsmodus unterstützt nur ein Bild und eine Größe auf stdout. Abbruch.",
+		"Several sizes are not supported for animations. Quitting.":                      "Mehrere Größen werden für Animationen nicht unterstützt. Abbruch.",
+		"Interactive mode needs a terminal. Quitting.":                                   "Der interaktive Modus benötigt ein Terminal. Abbruch.",
+		"Tune mode needs a terminal. Quitting.":                                          "Der Abstimmungsmodus benötigt ein Terminal. Abbruch.",
+		"Camera input only supports a single size on stdout. Quitting.":                  "Kameraeingabe unterstützt nur eine Größe auf stdout. Abbruch.",
+		"Feed input only supports a single size on stdout. Quitting.":                    "Eingabe aus einem Datenstrom unterstützt nur eine Größe auf stdout. Abbruch.",
+		"Raw input only supports a single size on stdout. Quitting.":                     "Roheingabe unterstützt nur eine Größe auf stdout. Abbruch.",
+		"Error: File could not be created":                                               "Fehler: Datei konnte nicht erstellt werden",
+		"Error: File could not be saved":                                                 "Fehler: Datei konnte nicht gespeichert werden",
+		"Error: ASCII could not be written":                                              "Fehler: ASCII konnte nicht geschrieben werden",
+		"Error: HTML could not be written":                                               "Fehler: HTML konnte nicht geschrieben werden",
+		"Error: JSON could not be written":                                               "Fehler: JSON konnte nicht geschrieben werden",
+		"Error: Cast could not be written":                                               "Fehler: Aufnahme konnte nicht geschrieben werden",
+		"Error: Image could not be encoded":                                              "Fehler: Bild konnte nicht kodiert werden",
+		"filter: unexpected argument %q\n":                                               "filter: unerwartetes Argument %q\n",
+		"filter: -trim and -compact change the width and can't be used":                  "filter: -trim und -compact ändern die Breite und können nicht verwendet werden",
+		"filter: width must be positive and height must not be negative":                 "filter: Breite muss positiv und Höhe darf nicht negativ sein",
+		"-o %s cannot be combined with -out":                                             "-o %s kann nicht mit -out kombiniert werden",
+		"-out %s has no extension, add one or pick a format with -o":                     "-out %s hat keine Endung, ergänzen Sie eine oder wählen Sie ein Format mit -o",
+		"-out %s: %s files are not supported, pick a format with -o":                     "-out %s: %s-Dateien werden nicht unterstützt, wählen Sie ein Format mit -o",
+		"config: %s: unknown setting %q":                                                 "config: %s: unbekannte Einstellung %q",
+		"matrix: width must be positive":                                                 "matrix: Breite muss positiv sein",
+		"matrix: -%s is not a conversion flag\n":                                         "matrix: -%s ist keine Konvertierungsoption\n",
+		"matrix: give -rows, -cols or both":                                              "matrix: -rows, -cols oder beide angeben",
+		"matrix: the sheet is written as .html or .png":                                  "matrix: die Übersicht wird als .html oder .png geschrieben",
+		"batch: width must be positive and height must not be negative":                  "batch: Breite muss positiv und Höhe darf nicht negativ sein",
+		"-idle-timeout and -max-jobs must not be negative":                               "-idle-timeout und -max-jobs dürfen nicht negativ sein",
+		"-cache and -rate must not be negative, -burst and -max-upload must be positive": "-cache und -rate dürfen nicht negativ sein, -burst und -max-upload müssen positiv sein",
+		"serving gRPC on %s\n":                                                           "gRPC-Server läuft auf %s\n",
+		"serving on http://%s\n":                                                         "Server läuft auf http://%s\n",
+		"batch: %s and %s would both be written to %s\n":                                 "batch: %s und %s würden beide nach %s geschrieben\n",
+		"batch: give either images or -list, not both":                                   "batch: entweder Bilder oder -list angeben, nicht beides",
+		"batch: %s: width and height must not be negative\n":                             "batch: %s: Breite und Höhe dürfen nicht negativ sein\n",
+		"batch: %s: %s files are not supported\n":                                        "batch: %s: %s-Dateien werden nicht unterstützt\n",
+		"%s: failed: %v":  "%s: fehlgeschlagen: %v",
+		"%s: skipped: %s": "%s: übersprungen: %s",
+		"batch: %d converted, %d skipped, %d failed\n":                                          "batch: %d konvertiert, %d übersprungen, %d fehlgeschlagen\n",
+		"screensaver: invalid transition %q\n":                                                  "screensaver: ungültiger Übergang %q\n",
+		"screensaver: -interval and -fps must be positive and the other durations not negative": "screensaver: -interval und -fps müssen positiv und die anderen Dauern nicht negativ sein",
+		"Screensaver mode needs a terminal. Quitting.":                                          "Der Bildschirmschoner benötigt ein Terminal. Abbruch.",
+		"screensaver: no images to show in %s":                                                  "screensaver: keine Bilder zum Anzeigen in %s",
+		"This console does not support colors, printing plain text.":                            "Diese Konsole unterstützt keine Farben, Ausgabe als reiner Text.",
+		"FAIL %s: no golden output built in\n":                                                  "FEHLER %s: keine Referenzausgabe eingebaut\n",
+		"FAIL %s: output differs at line %d\n":                                                  "FEHLER %s: Ausgabe weicht in Zeile %d ab\n",
+		"%d of %d self tests failed\n":                                                          "%d von %d Selbsttests fehlgeschlagen\n",
+		"all %d self tests passed\n":                                                            "alle %d Selbsttests bestanden\n",
+		"bench: -n and -w must be positive and -h must not be negative":                         "bench: -n und -w müssen positiv sein und -h darf nicht negativ sein",
+		"compare: give both -i and -i2":                                                         "compare: -i und -i2 angeben",
+		"compare: invalid view %q\n":                                                            "compare: ungültige Ansicht %q\n",
+		"compare: width must be positive and height and gap must not be negative":               "compare: Breite muss positiv und Höhe und Abstand dürfen nicht negativ sein",
+		"compare: %d of %d cells differ\n":                                                      "compare: %d von %d Zellen unterscheiden sich\n",
+		"Several inputs need -montage or -slideshow. Quitting.":                                 "Mehrere Eingaben benötigen -montage oder -slideshow. Abbruch.",
+		"A slideshow cannot be combined with -montage or -watch. Quitting.":                     "Eine Diashow kann nicht mit -montage oder -watch kombiniert werden. Abbruch.",
+		"slideshow: invalid transition %q\n":                                                    "slideshow: ungültiger Übergang %q\n",
+		"slideshow: -delay must be positive":                                                    "slideshow: -delay muss positiv sein",
+		"Slideshow mode needs a terminal. Quitting.":                                            "Die Diashow benötigt ein Terminal. Abbruch.",
+		"A montage takes its tile size from -w and -h and cannot be watched. Quitting.":         "Eine Montage nimmt ihre Kachelgröße aus -w und -h und kann nicht beobachtet werden. Abbruch.",
+		"montage: no images among the inputs":                                                   "montage: keine Bilder unter den Eingaben",
+		"montage: %d images do not fit in %dx%d":                                                "montage: %d Bilder passen nicht in %dx%d",
+		"-crop-face cannot be combined with -focus or -smart-crop":                              "-crop-face kann nicht mit -focus oder -smart-crop kombiniert werden",
+		"-pad must not be negative and -pad-char must be a single character. Quitting.":         "-pad darf nicht negativ und -pad-char muss ein einzelnes Zeichen sein. Abbruch.",
+		"-pad and -border cannot be combined with -html-links. Quitting.":                       "-pad und -border können nicht mit -html-links kombiniert werden. Abbruch.",
+		"-go-package %q and -go-name %q must be Go identifiers":                                 "-go-package %q und -go-name %q müssen Go-Bezeichner sein",
+		"Error: Go source could not be written":                                                 "Fehler: Go-Quelltext konnte nicht geschrieben werden",
+		"map script: %v\n":                                                                      "Zuordnungsskript: %v\n",
+		"Error: Output could not be written":                                                    "Fehler: Ausgabe konnte nicht geschrieben werden",
+		"Error: Markdown could not be written":                                                  "Fehler: Markdown konnte nicht geschrieben werden",
+		"Animations cannot be copied to the clipboard. Quitting.":                               "Animationen können nicht in die Zwischenablage kopiert werden. Abbruch.",
+		"no clipboard program found, install wl-copy, xclip or xsel":                            "kein Programm für die Zwischenablage gefunden, installiere wl-copy, xclip oder xsel",
+		"recording":                 "Aufnahme läuft",
+		"saved %s":                  "%s gespeichert",
+		"invalid background option": "ungültige Hintergrundoption",
+		"-orient cannot be used in interactive mode":                                 "-orient kann im interaktiven Modus nicht verwendet werden",
+		"invalid orientation %q: expected horizontal, vertical, 90, 180 or 270":      "ungültige Ausrichtung %q: erwartet horizontal, vertical, 90, 180 oder 270",
+		"invalid threshold %q: expected 1 to 255 or auto":                            "ungültiger Schwellwert %q: erwartet 1 bis 255 oder auto",
+		"invalid size %q: expected small, medium, large, full or thumbnail":          "ungültige Größe %q: erwartet small, medium, large, full oder thumbnail",
+		"-contact-sheet needs an animation or image sequence. Quitting.":             "-contact-sheet braucht eine Animation oder eine Bildfolge. Abbruch.",
+		"A contact sheet takes its tile size from -w and -h. Quitting.":              "Ein Kontaktabzug nimmt die Kachelgröße von -w und -h. Abbruch.",
+		"-loop must not be negative":                                                 "-loop darf nicht negativ sein",
+		"-loop, -reverse and -boomerang only apply to playback on stdout. Quitting.": "-loop, -reverse und -boomerang gelten nur für die Wiedergabe auf stdout. Abbruch.",
+		"not an image":                                                                  "kein Bild",
+		"batch: -jobs must not be negative":                                             "batch: -jobs darf nicht negativ sein",
+		"cache: %v\n":                                                                   "Cache: %v\n",
+		"cache: removed %d entries, %d bytes\n":                                         "Cache: %d Einträge entfernt, %d Bytes\n",
+		"strip: unexpected argument %q\n":                                               "strip: unerwartetes Argument %q\n",
+		"ansify: unexpected argument %q\n":                                              "ansify: unerwartetes Argument %q\n",
+		"ansify: -colors is required":                                                   "ansify: -colors ist erforderlich",
+		"No art provided. Quitting.":                                                    "Keine ASCII-Grafik angegeben. Abbruch.",
+		"render: -o must be png or svg or pdf":                                          "render: -o muss png, svg oder pdf sein",
+		"-auto-tune and -score only apply to still images. Quitting.":                   "-auto-tune und -score gelten nur für Standbilder. Abbruch.",
+		"auto-tune %dx%d: -contrast %g -gamma %g -charset %s (score %.4f)\n":            "auto-tune %dx%d: -contrast %g -gamma %g -charset %s (Wert %.4f)\n",
+		"score %dx%d: %.4f\n":                                                           "Wert %dx%d: %.4f\n",
+		"-pad-char and -title must be printable characters. Quitting.":                  "-pad-char und -title müssen druckbare Zeichen sein. Abbruch.",
+		"Warning: the font has no glyphs for %q, which are drawn as blanks or boxes.\n": "Warnung: Die Schrift hat keine Glyphen für %q, die als Lücken oder Kästchen gezeichnet werden.\n",
+		"-eol must be lf or crlf and -encoding utf8 or cp437 or ascii. Quitting.":       "-eol muss lf oder crlf und -encoding utf8, cp437 oder ascii sein. Abbruch.",
+		"-sequence needs a glob, a numbered pattern such as frames/%04d.png or a directory. Quitting.": "-sequence braucht ein Glob-Muster, ein nummeriertes Muster wie frames/%04d.png oder ein Verzeichnis. Abbruch.",
+		"-mask-fill must be a single character":                                                        "-mask-fill muss ein einzelnes Zeichen sein",
+		"stats: sizes must be positive":                                                                "stats: Größen müssen positiv sein",
+		", replacing the existing file":                                                                ", ersetzt die vorhandene Datei",
+		"batch: dry run: %d would be converted, %d skipped, %d failed\n":                               "batch: Probelauf: %d würden konvertiert, %d übersprungen, %d fehlgeschlagen\n",
+		"batch: interrupted, %d of %d not converted\n":                                                 "batch: abgebrochen, %d von %d nicht konvertiert\n",
+		"invalid percentage":                                                                           "ungültiger Prozentwert",
+		"-scale, -max-width and -max-height cannot be combined with -w or -h":                          "-scale, -max-width und -max-height können nicht mit -w oder -h kombiniert werden",
+		"-max-width and -max-height must not be negative":                                              "-max-width und -max-height dürfen nicht negativ sein",
+		"-scale, -max-width and -max-height need an image input":                                       "-scale, -max-width und -max-height benötigen ein Bild als Eingabe",
+		"invalid number": "ungültige Zahl",
+	},
+}
+
+// language is the two letter language code of the user's locale.
+var language = localeLanguage()
+
+// tr returns msg translated to the user's language.
+func tr(msg string) string {
+	if translated, ok := messages[language][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// localeLanguage reads the language from the locale variables in the order
+// of precedence POSIX gives them, so "de_DE.UTF-8" yields "de".
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			lang, _, _ := strings.Cut(value, "_")
+			lang, _, _ = strings.Cut(lang, ".")
+			return strings.ToLower(lang)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// pathList is a repeatable flag collecting input paths.
+type pathList []string
+
+func (l *pathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *pathList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// gridValue is a flag value holding a layout of columns by rows, written as
+// 3x2 or 3×2. Without rows, as in 3, there are as many rows as the tiles
+// need.
+type gridValue struct {
+	cols, rows int
+}
+
+func (g *gridValue) String() string {
+	switch {
+	case g.cols == 0:
+		return ""
+	case g.rows == 0:
+		return fmt.Sprint(g.cols)
+	}
+	return fmt.Sprintf("%dx%d", g.cols, g.rows)
+}
+
+func (g *gridValue) Set(value string) error {
+	cols, rows, found := strings.Cut(strings.ReplaceAll(value, "×", "x"), "x")
+	var grid gridValue
+	_, err := fmt.Sscan(cols, &grid.cols)
+	if err == nil && found {
+		_, err = fmt.Sscan(rows, &grid.rows)
+	}
+	if err != nil || grid.cols < 1 || (found && grid.rows < 1) {
+		return fmt.Errorf("invalid layout %q: expected colsxrows", value)
+	}
+	*g = grid
+	return nil
+}
+
+// montageInputs expands directories among paths to the files in them. The
+// second return value marks the paths that came from a directory, which
+// are skipped when they turn out not to be images.
+func montageInputs(paths []string) ([]string, map[string]bool, error) {
+	var inputs []string
+	listed := map[string]bool{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			inputs = append(inputs, path)
+			continue
+		}
+		names, err := dirImages(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range names {
+			listed[name] = true
+		}
+		inputs = append(inputs, names...)
+	}
+	return inputs, listed, nil
+}
+
+// montage converts every input to fit a tile of size cells, keeping its
+// aspect, and lays the tiles out in grid order, left to right and then top
+// to bottom. Tiles are a blank column and row apart, or divided by box
+// lines with separators, and labels puts each file name above its tile.
+func montage(inputs []string, listed map[string]bool, grid gridValue, size image.Point, opts imgascii.Options, optionFlags *optionFlags, labels, separators bool) (*imgascii.Art, int, error) {
+	var tiles []*imgascii.Art
+	var names []string
+	for _, path := range inputs {
+		img, err := imgascii.DecodeFileWith(path, optionFlags.decodeOptions())
+		if err != nil {
+			if listed[path] {
+				continue
+			}
+			return nil, exitDecode, err
+		}
+		o := opts
+		if err := optionFlags.applyFocus(&o, img); err != nil {
+			return nil, exitUsage, err
+		}
+
+		fitted := fitTile(imgascii.TurnedBounds(img.Bounds(), o.Orient), size)
+		o.Width, o.Height = fitted.X, fitted.Y
+		tile, err := imgascii.ConvertArt(img, o)
+		if err != nil {
+			return nil, exitFailure, err
+		}
+		tiles = append(tiles, tile)
+		names = append(names, filepath.Base(path))
+	}
+	if len(tiles) == 0 {
+		return nil, exitDecode, fmt.Errorf(tr("montage: no images among the inputs"))
+	}
+
+	cols, rows := grid.cols, grid.rows
+	if rows == 0 {
+		rows = (len(tiles) + cols - 1) / cols
+	}
+	if len(tiles) > cols*rows {
+		return nil, exitUsage, fmt.Errorf(tr("montage: %d images do not fit in %dx%d"), len(tiles), cols, rows)
+	}
+	return layoutSheet(tiles, names, cols, rows, size, labels, separators), exitOK, nil
+}
+
+// fitTile returns the largest size within a tile of size cells that keeps
+// the aspect of bounds.
+func fitTile(bounds image.Rectangle, size image.Point) image.Point {
+	// Cells are about twice as tall as they are wide
+	fitted := image.Pt(size.X, max(1, size.X*bounds.Dy()/bounds.Dx()/2))
+	if fitted.Y > size.Y {
+		fitted = image.Pt(max(1, size.Y*2*bounds.Dx()/bounds.Dy()), size.Y)
+	}
+	return fitted
+}
+
+// layoutSheet lays tiles of up to size cells out on a sheet of cols by rows,
+// left to right and then top to bottom. Tiles are a blank column and row
+// apart, or divided by box lines with separators, and labels puts each name
+// above its tile.
+func layoutSheet(tiles []*imgascii.Art, names []string, cols, rows int, size image.Point, labels, separators bool) *imgascii.Art {
+	tileHeight := size.Y
+	if labels {
+		tileHeight++
+	}
+	sheet := &imgascii.Art{Width: cols*size.X + cols - 1, Height: rows*tileHeight + rows - 1}
+	sheet.Cells = make([]imgascii.Cell, sheet.Width*sheet.Height)
+	for i := range sheet.Cells {
+		sheet.Cells[i] = imgascii.Cell{Rune: ' ', Index: -1}
+	}
+	set := func(x, y int, r rune) {
+		sheet.Cells[y*sheet.Width+x].Rune = r
+	}
+
+	if separators {
+		for y := 0; y < sheet.Height; y++ {
+			for x := 0; x < sheet.Width; x++ {
+				vertical := x%(size.X+1) == size.X
+				horizontal := y%(tileHeight+1) == tileHeight
+				switch {
+				case vertical && horizontal:
+					set(x, y, '┼')
+				case vertical:
+					set(x, y, '│')
+				case horizontal:
+					set(x, y, '─')
+				}
+			}
+		}
+	}
+
+	for i, tile := range tiles {
+		left, top := i%cols*(size.X+1), i/cols*(tileHeight+1)
+		if labels {
+			name := []rune(names[i])
+			if len(name) > size.X {
+				name = append(name[:size.X-1], '…')
+			}
+			for x, r := range name {
+				set(left+(size.X-len(name))/2+x, top, r)
+			}
+			top++
+		}
+
+		// Tiles narrower or shorter than their cell are centred in it
+		left += (size.X - tile.Width) / 2
+		top += (size.Y - tile.Height) / 2
+		for y := 0; y < tile.Height; y++ {
+			copy(sheet.Cells[(top+y)*sheet.Width+left:], tile.Cells[y*tile.Width:(y+1)*tile.Width])
+		}
+	}
+	return sheet
+}
+
+// writeSheet writes a single art, such as a montage, in the output format.
+func writeSheet(art *imgascii.Art, output, outPath string, settings outputSettings, clipboardANSI bool) int {
+	switch output {
+	case "stdout":
+		r, _ := settings.renderer(output)
+		if err := r.Render(art, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+	case "clipboard":
+		if err := copyToClipboard(clipboardText([]*imgascii.Art{art}, clipboardANSI)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitWrite
+		}
+	case "gif":
+		exportToGIF([]*imgascii.Art{art}, []time.Duration{0}, outputFile(outPath, "gif", ""), settings.face, settings.th)
+	case "cast":
+		exportToCast([]*imgascii.Art{art}, []time.Duration{0}, outputFile(outPath, "cast", ""))
+	default:
+		r, ok := settings.renderer(output)
+		if !ok {
+			fmt.Fprintln(os.Stderr, tr("Invalid output option. Quitting."))
+			return exitUsage
+		}
+		exportArt(art, r, output, outputFile(outPath, outputExtension(output), ""))
+	}
+	return exitOK
+}
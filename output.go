@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// outputExtensions maps the file extensions -out understands to the output
+// format that writes them.
+var outputExtensions = map[string]string{
+	".txt":  "txt",
+	".ans":  "ansi-file",
+	".ansi": "ansi-file",
+	".png":  "png",
+	".svg":  "svg",
+	".pdf":  "pdf",
+	".html": "html",
+	".htm":  "html",
+	".gif":  "gif",
+	".cast": "cast",
+	".json": "json",
+	".go":   "go",
+	".md":   "md",
+}
+
+// resolveOutput picks the output format for the -o and -out flags. Without
+// a path the format is used as given. With one, the format comes from the
+// path's extension unless explicit says -o was given to override it.
+func resolveOutput(format string, explicit bool, path string) (string, error) {
+	if path == "" {
+		return format, nil
+	}
+	if explicit {
+		if format == "stdout" || format == "clipboard" {
+			return "", fmt.Errorf(tr("-o %s cannot be combined with -out"), format)
+		}
+		return format, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if inferred, ok := outputExtensions[ext]; ok {
+		return inferred, nil
+	}
+	if ext == "" {
+		return "", fmt.Errorf(tr("-out %s has no extension, add one or pick a format with -o"), path)
+	}
+	return "", fmt.Errorf(tr("-out %s: %s files are not supported, pick a format with -o"), path, ext)
+}
+
+// outputFile names an output file. Without -out files are called output
+// with the format as extension. A suffix such as a frame number or size goes
+// before the extension.
+func outputFile(path, format, suffix string) string {
+	if path == "" {
+		return "output" + suffix + "." + format
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + suffix + ext
+}
+
+// outputSettings holds what the formats of -o that write a single art need
+// besides the art.
+type outputSettings struct {
+	face      font.Face
+	th        theme
+	links     htmlLinks
+	goSrc     goSource
+	mdTitle   string
+	txtSpaces string
+	encoding  textEncoding
+	annotate  *annotation // nil unless -annotate
+}
+
+// renderer returns the Renderer for format, set up with s, or false when
+// format doesn't write a single art. Formats the tool doesn't have are
+// looked up among those registered with imgascii.RegisterRenderer, so
+// programs embedding the tool can add their own.
+func (s outputSettings) renderer(format string) (imgascii.Renderer, bool) {
+	var render imgascii.RendererFunc
+	switch format {
+	case "stdout", "ansi-file":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			_, err := art.WriteTo(w)
+			return err
+		}
+	case "txt":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeTXT(art, w, s.txtSpaces)
+		}
+	case "png":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return png.Encode(w, art.Image(s.face, s.th.foreground, s.th.background))
+		}
+	case "svg":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeSVG(w, art, s.face, s.th)
+		}
+	case "pdf":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writePDF(w, art.Image(s.face, s.th.foreground, s.th.background))
+		}
+	case "html":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeHTML(w, art, s.th, s.links)
+		}
+	case "json":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeJSON(w, art)
+		}
+	case "go":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeGo(w, art, s.goSrc)
+		}
+	case "md":
+		render = func(art *imgascii.Art, w io.Writer) error {
+			return writeMarkdown(w, art, s.mdTitle)
+		}
+	case "gif", "cast", "clipboard":
+		return nil, false
+	default:
+		return imgascii.LookupRenderer(format)
+	}
+	if s.annotate != nil && (format == "txt" || format == "ansi-file" || format == "html") {
+		body := render
+		render = func(art *imgascii.Art, w io.Writer) error {
+			if _, err := io.WriteString(w, s.annotate.header(art, format)); err != nil {
+				return err
+			}
+			return body(art, w)
+		}
+	}
+	if !s.encoding.plain() && (format == "txt" || format == "ansi-file") {
+		text := render
+		render = func(art *imgascii.Art, w io.Writer) error {
+			var buf bytes.Buffer
+			if err := text(art, &buf); err != nil {
+				return err
+			}
+			_, err := w.Write(s.encoding.encode(buf.String()))
+			return err
+		}
+	}
+	return render, true
+}
+
+// outputExtension is the file extension of format, without the dot.
+func outputExtension(format string) string {
+	if format == "ansi-file" {
+		return "ans"
+	}
+	return format
+}
+
+// renderFailures are the errors reported when writing a format fails.
+var renderFailures = map[string]string{
+	"txt":       "Error: ASCII could not be written",
+	"ansi-file": "Error: ASCII could not be written",
+	"png":       "Error: Image could not be encoded",
+	"svg":       "Error: Image could not be encoded",
+	"pdf":       "Error: Image could not be encoded",
+	"html":      "Error: HTML could not be written",
+	"json":      "Error: JSON could not be written",
+	"go":        "Error: Go source could not be written",
+	"md":        "Error: Markdown could not be written",
+}
+
+// exportArt saves art to outputPath with r, the renderer of format.
+func exportArt(art *imgascii.Art, r imgascii.Renderer, format, outputPath string) {
+	failure, ok := renderFailures[format]
+	if !ok {
+		failure = "Error: Output could not be written"
+	}
+	exportFile(outputPath, failure, func(w io.Writer) error {
+		return r.Render(art, w)
+	})
+}
+
+// clipboardText joins the arts, a blank line apart, as plain text or with
+// their color escapes.
+func clipboardText(arts []*imgascii.Art, ansi bool) string {
+	texts := make([]string, len(arts))
+	for i, art := range arts {
+		if ansi {
+			texts[i] = art.ANSI()
+		} else {
+			texts[i] = sgrEscape.ReplaceAllString(art.String(), "")
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// playback is the order an animation is played in.
+type playback struct {
+	loop      int // times to play the animation, 0 for ever
+	reverse   bool
+	boomerang bool
+}
+
+// playKeys documents the keys that control playback.
+const playKeys = "space pause  left/right step  q quit"
+
+// given reports whether playback differs from playing once forward.
+func (pb playback) given() bool {
+	return pb.loop != 1 || pb.reverse || pb.boomerang
+}
+
+func (pb playback) validate() error {
+	if pb.loop < 0 {
+		return errors.New(tr("-loop must not be negative"))
+	}
+	return nil
+}
+
+// sequence returns the frames of one loop of n frames in the order they are
+// shown, and how many frames the whole playback shows, -1 for ever. A
+// boomerang loop plays the frames forward and back again without repeating
+// the frames it turns on, so the next loop follows on, and the last loop
+// ends on the frame the first one started with.
+func (pb playback) sequence(n int) ([]int, int) {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+		if pb.reverse {
+			order[i] = n - 1 - i
+		}
+	}
+	if pb.boomerang {
+		for i := n - 2; i > 0; i-- {
+			order = append(order, order[i])
+		}
+	}
+	if pb.loop == 0 {
+		return order, -1
+	}
+	total := pb.loop * len(order)
+	if pb.boomerang && n > 1 {
+		total++
+	}
+	return order, total
+}
+
+// frameArts collects the arts of an animation as they are converted in the
+// background, so playback can start with the first and later loops, or
+// steps back, reuse them.
+type frameArts struct {
+	mu      sync.Mutex
+	ready   *sync.Cond
+	arts    []*imgascii.Art
+	err     error
+	done    bool
+	stopped bool
+}
+
+var errPlaybackStopped = errors.New("playback stopped")
+
+// convertInBackground starts converting frames with opts on every core.
+func convertInBackground(frames []imgascii.Frame, opts imgascii.Options) *frameArts {
+	c := &frameArts{}
+	c.ready = sync.NewCond(&c.mu)
+	go func() {
+		err := imgascii.ConvertFramesEach(frames, opts, 0, func(i int, art *imgascii.Art) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.stopped {
+				return errPlaybackStopped
+			}
+			c.arts = append(c.arts, art)
+			c.ready.Broadcast()
+			return nil
+		})
+		c.mu.Lock()
+		c.err, c.done = err, true
+		c.ready.Broadcast()
+		c.mu.Unlock()
+	}()
+	return c
+}
+
+// get waits for the art of frame i.
+func (c *frameArts) get(i int) (*imgascii.Art, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i >= len(c.arts) && !c.done {
+		c.ready.Wait()
+	}
+	if i < len(c.arts) {
+		return c.arts[i], nil
+	}
+	return nil, c.err
+}
+
+// stop ends the conversion of the frames not yet done.
+func (c *frameArts) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+}
+
+// readPlayKeys puts the terminal in raw mode and sends the keys pressed
+// until stdin closes. It returns a nil channel, which never delivers a key,
+// when stdin or w is not a terminal. restore puts the terminal back.
+func readPlayKeys(w io.Writer) (keys <-chan string, restore func(), err error) {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, func() {}, nil
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan string, 16)
+	go func() {
+		in := bufio.NewReader(os.Stdin)
+		for {
+			key, err := readKey(in)
+			if err != nil {
+				return
+			}
+			ch <- key
+		}
+	}()
+	return ch, func() { term.Restore(int(os.Stdin.Fd()), state) }, nil
+}
+
+// playFrames converts the frames with opts on every core and draws each,
+// framed by fr, over the previous one as soon as it is ready, so playback
+// starts without waiting for the whole animation. Only the cells that
+// changed since the previous frame are written, which saves most of the
+// bytes over slow connections. It keeps to the frame delays against the
+// wall clock: a frame that is not ready, or not written, before the next
+// one is due is dropped, so slow terminals and conversions skip frames
+// rather than drift. A positive maxFPS drops frames that would follow the
+// last one drawn sooner than it allows. pb sets the order and how often
+// the frames are played. meter, if not nil, shows the frame rate below the
+// frames.
+//
+// In a terminal the keys in playKeys pause playback and step through the
+// frames, which are never dropped while paused.
+func playFrames(w io.Writer, frames []imgascii.Frame, opts imgascii.Options, fr frame, pb playback, maxFPS float64, meter *fpsMeter) error {
+	arts := convertInBackground(frames, opts)
+	defer arts.stop()
+	keys, restore, err := readPlayKeys(w)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	out := bufio.NewWriter(w)
+	out.WriteString("\x1b[?25l\x1b[2J")
+	defer func() {
+		out.WriteString("\x1b[?25h")
+		out.Flush()
+	}()
+	// Playback stops at the next frame on an interrupt, or at once on a
+	// second one while a frame is still being converted
+	ctx, done := watchInterrupts()
+	defer done()
+	defer onInterrupt(func() {
+		io.WriteString(w, "\x1b[?25h")
+		restore()
+	})()
+
+	var interval time.Duration
+	if maxFPS > 0 {
+		interval = time.Duration(float64(time.Second) / maxFPS)
+	}
+
+	order, total := pb.sequence(len(frames))
+	var prev *imgascii.Art
+	shownPos := -1
+	draw := func(pos int) error {
+		art, err := arts.get(order[pos%len(order)])
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		art = fr.apply(art)
+		delta := art.Delta(prev)
+		// Raw mode leaves line feeds without a carriage return
+		if keys != nil {
+			delta = strings.ReplaceAll(delta, "\n", "\r\n")
+		}
+		out.WriteString(delta)
+		prev, shownPos = art, pos
+		fmt.Fprintf(out, "\x1b[%d;1H", art.Height+1)
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		meter.frame(time.Since(start))
+		return nil
+	}
+
+	// step applies a key to the frame last shown, reporting whether it
+	// pauses playback and whether it quits
+	step := func(key string, pos int) (int, bool, bool) {
+		from := max(shownPos, 0)
+		switch key {
+		case "q", "esc", "\x03":
+			return pos, true, true
+		case " ":
+			return from, true, false
+		case "left":
+			return max(from-1, 0), true, false
+		case "right":
+			if total < 0 || from < total-1 {
+				from++
+			}
+			return from, true, false
+		}
+		return pos, false, false
+	}
+
+	// The last frame is always drawn so playback ends on it
+	next := time.Now()
+	var shown time.Time
+	paused := false
+	for pos := 0; total < 0 || pos < total; {
+		if paused {
+			if pos != shownPos {
+				if err := draw(pos); err != nil {
+					return err
+				}
+			}
+			var key string
+			select {
+			case key = <-keys:
+			case <-ctx.Done():
+				return nil
+			}
+			if key == " " {
+				paused, next = false, time.Now()
+				pos++
+				continue
+			}
+			var quit bool
+			if pos, _, quit = step(key, pos); quit {
+				return nil
+			}
+			continue
+		}
+
+		i := order[pos%len(order)]
+		if _, err := arts.get(i); err != nil {
+			return err
+		}
+		due := next
+		next = due.Add(frames[i].Delay)
+		last := pos == total-1
+		if !last && (time.Now().After(next) || prev != nil && due.Sub(shown) < interval) {
+			meter.drop()
+			pos++
+			continue
+		}
+		select {
+		case key := <-keys:
+			var quit bool
+			if pos, paused, quit = step(key, pos); quit {
+				return nil
+			}
+			next = due
+			continue
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(due)):
+		}
+
+		if err := draw(pos); err != nil {
+			return err
+		}
+		shown = due
+		pos++
+		if last {
+			select {
+			case <-keys:
+			case <-ctx.Done():
+			case <-time.After(time.Until(next)):
+			}
+		}
+	}
+	return nil
+}
+
+// convertFrames converts every frame with opts and collects their delays,
+// showing the frames done on bar.
+func convertFrames(frames []imgascii.Frame, opts imgascii.Options, bar *progressBar) ([]*imgascii.Art, []time.Duration, error) {
+	arts, err := imgascii.ConvertFramesProgress(frames, opts, bar.update)
+	bar.clear()
+	if err != nil {
+		return nil, nil, err
+	}
+	delays := make([]time.Duration, len(frames))
+	for i, frame := range frames {
+		delays[i] = frame.Delay
+	}
+
+	return arts, delays, nil
+}
+
+// runPlay plays an animation, image sequence, camera or raw pixel stream in
+// the terminal, with only the flags that make sense for playback.
+func runPlay(args []string) int {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Animated GIF, PNG or WebP, quoted glob or numbered pattern of frames, camera:N, raw:path[:WxH:format], unix:path or a named pipe")
+	width := fs.Int("w", 64, "Width to scale the frames to")
+	height := fs.Int("h", 0, "Height to scale the frames to (default keeps the aspect)")
+	fit := fs.Bool("fit", false, "Size the frames to fit the terminal")
+	fps := localFloat(fs, "fps", 12, "Frame rate for image sequences and camera input")
+	sequence := fs.Bool("sequence", false, "Read -i as the frames of an animation: a glob, a numbered pattern such as frames/%04d.png or a directory")
+	rawFormat := fs.String("raw-format", "", "Size and pixel format of -i raw:path frames, as 320x240:rgba, instead of a header on every frame")
+	progress := fs.Bool("progress", false, "Show the playback frame rate on stderr")
+	maxFPS := localFloat(fs, "max-fps", 0, "Highest frame rate to play animations at, dropping the frames in between (default no limit)")
+	var pb playback
+	fs.IntVar(&pb.loop, "loop", 1, "Times to play an animation, 0 to repeat it until q is pressed")
+	fs.BoolVar(&pb.reverse, "reverse", false, "Play an animation backwards")
+	fs.BoolVar(&pb.boomerang, "boomerang", false, "Play an animation forwards and then backwards")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii play -i input [options]")
+		fmt.Fprintln(os.Stderr, "Keys: "+playKeys)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	if *sequence {
+		if err := checkSequence(*imagePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	opts, err := optionFlags.options()
+	if err == nil {
+		err = pb.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	size := image.Pt(*width, *height)
+
+	// Live sources need a fixed height, as there is no image to take the
+	// aspect from before the first frame
+	var live frameSource
+	if index, ok := cameraIndex(*imagePath); ok {
+		live, err = openCamera(index)
+	} else if raw, ok, rawErr := openRaw(*imagePath, *rawFormat); ok {
+		live, err = raw, rawErr
+	} else if feed, ok, feedErr := openFeed(*imagePath, optionFlags.decodeOptions()); ok {
+		live, err = feed, feedErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if live != nil {
+		if size.Y == 0 {
+			size.Y = max(1, size.X/2)
+		}
+		if err := runLive(live, opts, size, *fit, *fps, newFPSMeter(*progress, os.Stderr)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	var frames []imgascii.Frame
+	if *sequence || imgascii.IsSequencePattern(*imagePath) {
+		frames, err = imgascii.LoadSequence(*imagePath, *fps, optionFlags.decodeOptions())
+	} else {
+		frames, err = imgascii.DecodeFramesFile(*imagePath, optionFlags.decodeOptions())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+
+	first := frames[0].Image
+	if err := optionFlags.applyFocus(&opts, first); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	opts.Width, opts.Height = size.X, size.Y
+	bounds := imgascii.TurnedBounds(first.Bounds(), opts.Orient)
+	if opts.Height == 0 {
+		opts.Height = max(1, opts.Width*bounds.Dy()/bounds.Dx()/2)
+	}
+	if *fit {
+		opts.Width, opts.Height = fitSize(bounds, reserveFor(*progress))
+	}
+
+	if err := playFrames(os.Stdout, frames, opts, frame{}, pb, *maxFPS, newFPSMeter(*progress, os.Stderr)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitWrite
+	}
+	return exitOK
+}
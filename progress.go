@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// progressBar draws a bar on one line of w, redrawn in place as work is
+// done. A nil bar draws nothing, so callers need not check for -progress.
+type progressBar struct {
+	w     io.Writer
+	label string
+	shown bool
+}
+
+// newProgressBar returns a bar labelled label on w, or nil when disabled.
+func newProgressBar(enabled bool, w io.Writer, label string) *progressBar {
+	if !enabled {
+		return nil
+	}
+	return &progressBar{w: w, label: label}
+}
+
+// update redraws the bar for done out of total.
+func (p *progressBar) update(done, total int) {
+	if p == nil || total <= 0 {
+		return
+	}
+	const width = 30
+	filled := width * done / total
+	fmt.Fprintf(p.w, "\r\x1b[2K%s [%s%s] %3d%% %d/%d", p.label,
+		strings.Repeat("#", filled), strings.Repeat(" ", width-filled), 100*done/total, done, total)
+	p.shown = true
+}
+
+// clear erases the bar so another line can be written in its place. The
+// next update draws it again.
+func (p *progressBar) clear() {
+	if p == nil || !p.shown {
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[2K")
+	p.shown = false
+}
+
+// reserveFor returns the terminal rows to keep free below fitted frames for
+// a frame rate meter.
+func reserveFor(meter bool) int {
+	if meter {
+		return 1
+	}
+	return 0
+}
+
+// fpsMeter shows the frame rate of playback on the line below the frames,
+// updated once a second, with the frames dropped to keep up and how long
+// writing a frame takes. A nil meter shows nothing.
+type fpsMeter struct {
+	w       io.Writer
+	start   time.Time
+	frames  int
+	rate    float64
+	dropped int
+	latency time.Duration
+}
+
+// newFPSMeter returns a meter writing to w, or nil when disabled.
+func newFPSMeter(enabled bool, w io.Writer) *fpsMeter {
+	if !enabled {
+		return nil
+	}
+	return &fpsMeter{w: w, start: time.Now()}
+}
+
+// frame counts a drawn frame, which took latency to write, and shows the
+// rate measured over the last second, once there is one. The cursor is
+// expected at the start of the line below the frame.
+func (m *fpsMeter) frame(latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.frames++
+	m.latency = latency
+	if elapsed := time.Since(m.start); elapsed >= time.Second {
+		m.rate = float64(m.frames) / elapsed.Seconds()
+		m.frames, m.start = 0, time.Now()
+	}
+	if m.rate == 0 {
+		return
+	}
+	fmt.Fprintf(m.w, "\r\x1b[2K%.1f fps, %.1f ms writes", m.rate, float64(m.latency)/float64(time.Millisecond))
+	if m.dropped > 0 {
+		fmt.Fprintf(m.w, ", %d dropped", m.dropped)
+	}
+}
+
+// drop counts a frame skipped to keep up.
+func (m *fpsMeter) drop() {
+	if m != nil {
+		m.dropped++
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// rawSource reads frames of unencoded pixels one after another from a file
+// or stdin.
+type rawSource struct {
+	r             *bufio.Reader
+	c             io.Closer
+	width, height int
+	format        string // empty when every frame starts with a header
+}
+
+// openRaw opens a raw input named like raw:-:320x240:rgb24, where - reads
+// stdin and anything else is a file path. Without the size and format, as
+// raw:-, they are taken from layout, the -raw-format flag, and when that is
+// empty too every frame starts with a header giving its own. It reports
+// false when path is not a raw input at all.
+func openRaw(path, layout string) (*rawSource, bool, error) {
+	spec, ok := strings.CutPrefix(path, "raw:")
+	if !ok {
+		return nil, false, nil
+	}
+
+	// The file name may itself contain colons, so the size and format are
+	// taken from the end
+	name := spec
+	src := &rawSource{}
+	parts := strings.Split(spec, ":")
+	if n := len(parts); n >= 3 && strings.Contains(parts[n-2], "x") {
+		name, layout = strings.Join(parts[:n-2], ":"), parts[n-2]+":"+parts[n-1]
+	}
+	if name == "" {
+		return nil, true, fmt.Errorf("invalid raw input %q: expected raw:path or raw:path:WxH:format", path)
+	}
+	if layout != "" {
+		var err error
+		if src.width, src.height, src.format, err = imgascii.ParseRawFormat(layout); err != nil {
+			return nil, true, err
+		}
+	}
+
+	if name == "-" {
+		src.r, src.c = bufio.NewReader(os.Stdin), io.NopCloser(nil)
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, true, err
+		}
+		src.r, src.c = bufio.NewReader(f), f
+	}
+	return src, true, nil
+}
+
+func (s *rawSource) Frame() (image.Image, error) {
+	if s.format == "" {
+		return imgascii.ReadRawFrame(s.r)
+	}
+	return imgascii.ReadRaw(s.r, s.width, s.height, s.format)
+}
+
+func (s *rawSource) Close() error {
+	return s.c.Close()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runRender implements the render command, which draws art kept as text,
+// as -o txt and -o ansi-file write it, with the png, svg and pdf exports of
+// convert, without needing the image it was made from.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	input := fs.String("i", "", "Text or ANSI art file to draw, - for stdin")
+	output := fs.String("o", "png", "Output format: png or svg or pdf")
+	outPath := fs.String("out", "", "Output file, whose extension picks the format unless -o is given")
+	fontPath := fs.String("font", "", "TrueType or OpenType font to draw with")
+	fontSize := localFloat(fs, "font-size", 14, "Font size in points for -font")
+	themeName := fs.String("theme", "light", "Colors of characters without their own: light or dark or solarized or matrix")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii render -i art.txt [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "o"
+	})
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, tr("No art provided. Quitting."))
+		return exitUsage
+	}
+	format, err := resolveOutput(*output, explicit, *outPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	switch format {
+	case "png", "svg", "pdf":
+	default:
+		fmt.Fprintln(os.Stderr, tr("render: -o must be png or svg or pdf"))
+		return exitUsage
+	}
+	th, ok := themes[*themeName]
+	if !ok {
+		fmt.Fprintln(os.Stderr, tr("Invalid theme option. Quitting."))
+		return exitUsage
+	}
+	face, err := loadFace(*fontPath, *fontSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	var data []byte
+	if *input == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*input)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	// The header of -annotate is not part of the art
+	text := string(data)
+	if strings.HasPrefix(text, annotationPrefix) {
+		_, text, _ = strings.Cut(text, "\n")
+	}
+	art, err := readArt(text, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+
+	settings := outputSettings{face: face, th: th}
+	r, _ := settings.renderer(format)
+	exportArt(art, r, format, outputFile(*outPath, format, ""))
+	return exitOK
+}
+
+// readArt reads art printed as text, as -o txt, -o ansi-file and stdout
+// write it. The colors of escape sequences go to the cells, tabs from
+// -txt-spaces tabs become spaces again, and the carriage returns of -eol
+// crlf and the padding after every cell of art with wide characters are
+// dropped. Lines are filled with spaces up to width cells, or the longest
+// line when width is 0, and a longer line is an error.
+func readArt(text string, width int) (*imgascii.Art, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	columns := 1
+	for _, r := range sgrEscape.ReplaceAllString(text, "") {
+		columns = max(columns, imgascii.RuneWidth(r))
+	}
+
+	var sgr sgrState
+	rows := make([][]imgascii.Cell, len(lines))
+	for y, line := range lines {
+		line = expandTabs(strings.TrimSuffix(line, "\r"))
+		escapes := append(sgrEscape.FindAllStringIndex(line, -1), []int{len(line), len(line)})
+		start, padding := 0, 0
+		for _, loc := range escapes {
+			for _, r := range line[start:loc[0]] {
+				if padding > 0 {
+					padding--
+					if r == ' ' {
+						continue
+					}
+				}
+				rows[y] = append(rows[y], sgr.cell(r))
+				padding = columns - imgascii.RuneWidth(r)
+			}
+			sgr.apply(line[loc[0]:loc[1]])
+			start = loc[1]
+		}
+		if width > 0 && len(rows[y]) > width {
+			return nil, fmt.Errorf("line %d of the art is longer than %d cells", y+1, width)
+		}
+	}
+
+	if width == 0 {
+		for _, row := range rows {
+			width = max(width, len(row))
+		}
+	}
+	art := &imgascii.Art{Width: width, Height: len(rows), Cells: make([]imgascii.Cell, 0, width*len(rows))}
+	for _, row := range rows {
+		art.Cells = append(art.Cells, row...)
+		for range width - len(row) {
+			art.Cells = append(art.Cells, imgascii.Cell{Rune: ' '})
+		}
+	}
+	return art, nil
+}
+
+// sgrState is the foreground and background color set by the escapes read
+// so far, a zero alpha standing for the default, and the bold, dim and
+// reverse attributes.
+type sgrState struct {
+	fg, bg imgascii.Cell
+	attr   imgascii.Attr
+}
+
+// cell returns a cell of r in the current colors. A background alone is
+// the cell color, as blocks mode sets it, and behind a foreground it is the
+// fill, as shade mode sets it.
+func (s *sgrState) cell(r rune) imgascii.Cell {
+	switch {
+	case s.fg.Color.A != 0:
+		return imgascii.Cell{Rune: r, Color: s.fg.Color, Index: s.fg.Index, Fill: s.bg.Color, FillIndex: s.bg.Index, Attr: s.attr}
+	case s.bg.Color.A != 0:
+		return imgascii.Cell{Rune: r, Color: s.bg.Color, Index: s.bg.Index, Attr: imgascii.Background | s.attr}
+	}
+	return imgascii.Cell{Rune: r, Attr: s.attr}
+}
+
+// apply sets the colors and the bold, dim and reverse attributes of the
+// escape sequence seq, ignoring the other attributes it may set.
+func (s *sgrState) apply(seq string) {
+	if seq == "" {
+		return
+	}
+	fields := strings.FieldsFunc(seq[strings.IndexByte(seq, '[')+1:len(seq)-1], func(r rune) bool {
+		return r == ';' || r == ':'
+	})
+	if len(fields) == 0 {
+		*s = sgrState{}
+		return
+	}
+	codes := make([]int, len(fields))
+	for i, f := range fields {
+		codes[i], _ = strconv.Atoi(f)
+	}
+	palette := func(i int) imgascii.Cell {
+		i = min(max(i, 0), len(imgascii.ANSIPalette)-1)
+		return imgascii.Cell{Color: imgascii.ANSIPalette[i], Index: i}
+	}
+	for i := 0; i < len(codes); i++ {
+		switch c := codes[i]; {
+		case c == 0:
+			*s = sgrState{}
+		case c >= 30 && c <= 37:
+			s.fg = palette(c - 30)
+		case c >= 90 && c <= 97:
+			s.fg = palette(c - 90 + 8)
+		case c >= 40 && c <= 47:
+			s.bg = palette(c - 40)
+		case c >= 100 && c <= 107:
+			s.bg = palette(c - 100 + 8)
+		case c == 1:
+			s.attr |= imgascii.Bold
+		case c == 2:
+			s.attr |= imgascii.Dim
+		case c == 7:
+			s.attr |= imgascii.Reverse
+		case c == 22:
+			s.attr &^= imgascii.Bold | imgascii.Dim
+		case c == 27:
+			s.attr &^= imgascii.Reverse
+		case c == 39:
+			s.fg = imgascii.Cell{}
+		case c == 49:
+			s.bg = imgascii.Cell{}
+		case (c == 38 || c == 48) && i+2 < len(codes) && codes[i+1] == 5:
+			set := palette(codes[i+2])
+			i += 2
+			if c == 38 {
+				s.fg = set
+			} else {
+				s.bg = set
+			}
+		case (c == 38 || c == 48) && i+4 < len(codes) && codes[i+1] == 2:
+			set := imgascii.Cell{Color: color.RGBA{uint8(codes[i+2]), uint8(codes[i+3]), uint8(codes[i+4]), 0xff}, Index: -1}
+			i += 4
+			if c == 38 {
+				s.fg = set
+			} else {
+				s.bg = set
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package main
+
+import "time"
+
+// readReply reports no reply where stdin can't be read with a timeout.
+func readReply(timeout time.Duration, limit int, end func([]byte) bool) (string, bool) {
+	return "", false
+}
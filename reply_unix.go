@@ -0,0 +1,63 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readReply reads the reply of the terminal on stdin to a query, which must
+// be in raw mode, a byte at a time until end reports it complete or limit
+// bytes are read. It waits at most timeout, polling stdin rather than
+// blocking on it, so nothing is left reading once it returns and keystrokes
+// typed afterwards reach whoever reads next. Whatever of a reply arrived
+// too late is drained, so it doesn't show up at the prompt. The second
+// return value is false when the reply didn't come in time.
+func readReply(timeout time.Duration, limit int, end func([]byte) bool) (string, bool) {
+	fd := int(os.Stdin.Fd())
+	deadline := time.Now().Add(timeout)
+	var buf []byte
+	for len(buf) < limit {
+		wait := time.Until(deadline)
+		if wait <= 0 || !pollReadable(fd, wait) {
+			drainReply(fd)
+			return string(buf), false
+		}
+		b := make([]byte, 1)
+		if n, err := unix.Read(fd, b); n != 1 || err != nil {
+			return string(buf), false
+		}
+		buf = append(buf, b[0])
+		if end(buf) {
+			return string(buf), true
+		}
+	}
+	return string(buf), true
+}
+
+// pollReadable waits up to wait for fd to have input.
+func pollReadable(fd int, wait time.Duration) bool {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, int(max(1, wait.Milliseconds())))
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		return err == nil && n > 0 && fds[0].Revents&unix.POLLIN != 0
+	}
+}
+
+// drainReply discards the rest of a late reply, which terminals send in
+// one go, giving it a moment to arrive.
+func drainReply(fd int) {
+	b := make([]byte, 256)
+	for pollReadable(fd, 20*time.Millisecond) {
+		if n, err := unix.Read(fd, b); n <= 0 || err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Console input functions of kernel32, which clipboard_windows.go loads.
+var (
+	peekConsoleInput = kernel32.NewProc("PeekConsoleInputW")
+	readConsoleInput = kernel32.NewProc("ReadConsoleInputW")
+)
+
+// keyEvent is the EventType of console input records for keys, which is
+// how replies to queries arrive with virtual terminal input on.
+const keyEvent = 0x0001
+
+// inputRecord is the INPUT_RECORD of the console API. Only key events are
+// read, whose KEY_EVENT_RECORD starts the Event union with bKeyDown and
+// holds the character at offset 10.
+type inputRecord struct {
+	EventType uint16
+	_         uint16
+	Event     [16]byte
+}
+
+// keyChar reports whether r is a key being pressed that types a character.
+func (r *inputRecord) keyChar() bool {
+	down := *(*int32)(unsafe.Pointer(&r.Event[0]))
+	char := *(*uint16)(unsafe.Pointer(&r.Event[10]))
+	return r.EventType == keyEvent && down != 0 && char != 0
+}
+
+// readReply reads the reply of the terminal on stdin to a query, which must
+// be in raw mode, a byte at a time until end reports it complete or limit
+// bytes are read. It waits at most timeout for the console input to be
+// signalled, and as the console also signals mouse, focus, resize and key
+// release events, which reading stdin would block on, it discards those
+// and only reads once a typed character is waiting, so nothing is left
+// reading once it returns. The second return value is false when the reply
+// didn't come in time.
+func readReply(timeout time.Duration, limit int, end func([]byte) bool) (string, bool) {
+	handle := windows.Handle(os.Stdin.Fd())
+	deadline := time.Now().Add(timeout)
+	var buf []byte
+	for len(buf) < limit {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return string(buf), false
+		}
+		if event, err := windows.WaitForSingleObject(handle, uint32(max(1, wait.Milliseconds()))); err != nil || event != windows.WAIT_OBJECT_0 {
+			return string(buf), false
+		}
+		var record inputRecord
+		var n uint32
+		if r, _, _ := peekConsoleInput.Call(uintptr(handle), uintptr(unsafe.Pointer(&record)), 1, uintptr(unsafe.Pointer(&n))); r == 0 {
+			return string(buf), false
+		}
+		if n == 0 {
+			continue
+		}
+		if !record.keyChar() {
+			if r, _, _ := readConsoleInput.Call(uintptr(handle), uintptr(unsafe.Pointer(&record)), 1, uintptr(unsafe.Pointer(&n))); r == 0 {
+				return string(buf), false
+			}
+			continue
+		}
+		b := make([]byte, 1)
+		if n, err := os.Stdin.Read(b); n != 1 || err != nil {
+			return string(buf), false
+		}
+		buf = append(buf, b[0])
+		if end(buf) {
+			return string(buf), true
+		}
+	}
+	return string(buf), true
+}
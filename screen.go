@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/kbinani/screenshot"
+)
+
+// screenDisplay reports whether path names a screen rather than a file, and
+// which display: screen is the first one and screen:N any other.
+func screenDisplay(path string) (int, bool) {
+	if path == "screen" {
+		return 0, true
+	}
+	index, ok := strings.CutPrefix(path, "screen:")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// captureScreen grabs a screenshot of display. A region of x,y,w,h limits it
+// to that rectangle, measured from the display's top left corner.
+func captureScreen(display int, region string) (image.Image, error) {
+	if n := screenshot.NumActiveDisplays(); display >= n {
+		return nil, fmt.Errorf("display %d not found, %d active", display, n)
+	}
+	bounds := screenshot.GetDisplayBounds(display)
+
+	rect := bounds
+	if region != "" {
+		var x, y, w, h int
+		if _, err := fmt.Sscanf(region, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil || w < 1 || h < 1 {
+			return nil, fmt.Errorf("invalid region %q: expected x,y,w,h", region)
+		}
+		rect = image.Rect(x, y, x+w, y+h).Add(bounds.Min).Intersect(bounds)
+		if rect.Empty() {
+			return nil, fmt.Errorf("region %q is outside the display", region)
+		}
+	}
+
+	img, err := screenshot.CaptureRect(rect)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screen: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runScreensaver shows random images full screen, one after another with a
+// transition between them, until a key is pressed.
+func runScreensaver(args []string) int {
+	fs := flag.NewFlagSet("screensaver", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "Directory to pick images from")
+	feed := fs.String("feed", "", "URL of a list of image URLs, one per line, to use instead of -dir")
+	interval := fs.Duration("interval", 10*time.Second, "How long each image is shown")
+	transition := fs.String("transition", "dissolve", "Transition between images: none or dissolve or wipe or fade")
+	transitionTime := fs.Duration("transition-time", time.Second, "How long a transition takes")
+	idle := fs.Duration("idle", 0, "Wait this long without a key press before starting")
+	fps := localFloat(fs, "fps", 12, "Frame rate of the transitions")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii screensaver [-dir directory | -feed url] [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	switch *transition {
+	case "none", "dissolve", "wipe", "fade":
+	default:
+		fmt.Fprintf(os.Stderr, tr("screensaver: invalid transition %q\n"), *transition)
+		return exitUsage
+	}
+	if *interval <= 0 || *transitionTime < 0 || *idle < 0 || *fps <= 0 {
+		fmt.Fprintln(os.Stderr, tr("screensaver: -interval and -fps must be positive and the other durations not negative"))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, tr("Screensaver mode needs a terminal. Quitting."))
+		return exitFailure
+	}
+
+	s := &screensaver{
+		source:         *dir,
+		opts:           opts,
+		interval:       *interval,
+		transition:     *transition,
+		transitionTime: *transitionTime,
+		fps:            *fps,
+	}
+	s.names = func() ([]string, error) { return dirImages(*dir) }
+	s.load = func(name string) (image.Image, error) {
+		return imgascii.DecodeFileWith(name, optionFlags.decodeOptions())
+	}
+	if *feed != "" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		s.source = *feed
+		s.names = func() ([]string, error) { return feedImages(client, *feed) }
+		s.load = func(url string) (image.Image, error) {
+			resp, err := client.Get(url)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("%s: %s", url, resp.Status)
+			}
+			return imgascii.DecodeWith(resp.Body, optionFlags.decodeOptions())
+		}
+	}
+
+	if err := s.run(*idle); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runSlideshow shows inputs, with any directories among them expanded to
+// their images, in order and over again until a key is pressed. Cut is
+// the screensaver's none transition, and transitions take a second or a
+// quarter of the delay, whichever is shorter.
+func runSlideshow(inputs []string, opts imgascii.Options, optionFlags *optionFlags, delay time.Duration, transition string, fps float64) int {
+	switch transition {
+	case "cut":
+		transition = "none"
+	case "fade", "dissolve", "wipe":
+	default:
+		fmt.Fprintf(os.Stderr, tr("slideshow: invalid transition %q\n"), transition)
+		return exitUsage
+	}
+	if delay <= 0 {
+		fmt.Fprintln(os.Stderr, tr("slideshow: -delay must be positive"))
+		return exitUsage
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, tr("Slideshow mode needs a terminal. Quitting."))
+		return exitFailure
+	}
+
+	s := &screensaver{
+		source:         strings.Join(inputs, ", "),
+		ordered:        true,
+		opts:           opts,
+		interval:       delay,
+		transition:     transition,
+		transitionTime: min(time.Second, delay/4),
+		fps:            fps,
+	}
+	// Directories are read again every round, so new images join in
+	s.names = func() ([]string, error) {
+		names, _, err := montageInputs(inputs)
+		return names, err
+	}
+	s.load = func(name string) (image.Image, error) {
+		return imgascii.DecodeFileWith(name, optionFlags.decodeOptions())
+	}
+	if err := s.run(0); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// screensaver cycles through the images named by names in random order, or
+// in the order given when ordered is set.
+type screensaver struct {
+	source  string
+	names   func() ([]string, error)
+	load    func(name string) (image.Image, error)
+	ordered bool
+
+	opts           imgascii.Options
+	interval       time.Duration
+	transition     string
+	transitionTime time.Duration
+	fps            float64
+
+	// queue holds the names still to show before names is read again
+	queue []string
+}
+
+// slide is the next image to show, loaded while the current one is up.
+type slide struct {
+	img image.Image
+	err error
+}
+
+// run waits for idle without a key press, then shows images until the next
+// key press.
+func (s *screensaver) run(idle time.Duration) error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	defer onInterrupt(func() { term.Restore(int(os.Stdin.Fd()), state) })()
+
+	// Any key, or stdin closing, ends the show
+	keys := make(chan struct{}, 1)
+	go func() {
+		in := bufio.NewReader(os.Stdin)
+		for {
+			_, err := in.ReadByte()
+			select {
+			case keys <- struct{}{}:
+			default:
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if idle > 0 {
+		timer := time.NewTimer(idle)
+		for waiting := true; waiting; {
+			select {
+			case <-keys:
+				timer.Reset(idle)
+			case <-timer.C:
+				waiting = false
+			}
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+	defer onInterrupt(func() { os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l") })()
+
+	next := make(chan slide, 1)
+	fetch := func() {
+		img, err := s.next()
+		next <- slide{img, err}
+	}
+	go fetch()
+
+	var shown *imgascii.Art
+	for {
+		var sl slide
+		select {
+		case <-keys:
+			return nil
+		case sl = <-next:
+		}
+		if sl.err != nil {
+			return sl.err
+		}
+		go fetch()
+
+		cols, rows := terminalSize()
+		art, err := s.fill(sl.img, cols, rows)
+		if err != nil {
+			return err
+		}
+
+		// A transition needs both images at the same size, so a resized
+		// terminal just cuts to the next one
+		if shown != nil && s.transition != "none" && shown.Width == art.Width && shown.Height == art.Height {
+			steps := int(s.transitionTime.Seconds() * s.fps)
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / s.fps))
+			for i := 1; i <= steps; i++ {
+				frame, err := s.blend(shown, art, float64(i)/float64(steps+1))
+				if err == nil {
+					err = drawArt(out, frame)
+				}
+				if err != nil {
+					ticker.Stop()
+					return err
+				}
+				select {
+				case <-keys:
+					ticker.Stop()
+					return nil
+				case <-ticker.C:
+				}
+			}
+			ticker.Stop()
+		}
+		if err := drawArt(out, art); err != nil {
+			return err
+		}
+		shown = art
+
+		select {
+		case <-keys:
+			return nil
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// next loads the next image in the shuffled queue, skipping any that fail
+// to load. Once the queue is empty the names are read again, so images
+// added in the meantime join the show.
+func (s *screensaver) next() (image.Image, error) {
+	failed := 0
+	for {
+		if len(s.queue) == 0 {
+			names, err := s.names()
+			if err != nil {
+				return nil, err
+			}
+			if len(names) == 0 || failed >= len(names) {
+				return nil, fmt.Errorf(tr("screensaver: no images to show in %s"), s.source)
+			}
+			if !s.ordered {
+				rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+			}
+			s.queue = names
+		}
+
+		name := s.queue[0]
+		s.queue = s.queue[1:]
+		img, err := s.load(name)
+		if err == nil {
+			return img, nil
+		}
+		failed++
+	}
+}
+
+// fill converts img to the largest size that fits cols by rows, centred on
+// blank cells that fill the rest of the terminal. Double width art fills it
+// with half as many cells.
+func (s *screensaver) fill(img image.Image, cols, rows int) (*imgascii.Art, error) {
+	opts := s.opts
+	opts.Width, opts.Height = fitSize(imgascii.TurnedBounds(img.Bounds(), opts.Orient), 0)
+	art, err := imgascii.ConvertArt(img, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cols /= art.Columns()
+	full := &imgascii.Art{Width: cols, Height: rows, Cells: make([]imgascii.Cell, cols*rows)}
+	for i := range full.Cells {
+		full.Cells[i] = imgascii.Cell{Rune: ' ', Index: -1}
+	}
+	left, top := (cols-art.Width)/2, (rows-art.Height)/2
+	for y := 0; y < art.Height && top+y < rows; y++ {
+		copy(full.Cells[(top+y)*cols+left:(top+y+1)*cols], art.Cells[y*art.Width:(y+1)*art.Width])
+	}
+	return full, nil
+}
+
+// blend returns a frame of the transition from a to b. A fade converts the
+// sampled cell colors of both mixed together, so the tones cross over
+// rather than the cells.
+func (s *screensaver) blend(a, b *imgascii.Art, progress float64) (*imgascii.Art, error) {
+	if s.transition != "fade" {
+		return blendArt(a, b, s.transition, progress), nil
+	}
+
+	// The images are already scaled, so the mix has one pixel per cell
+	mix := image.NewRGBA(image.Rect(0, 0, a.Width, a.Height))
+	for i := range a.Cells {
+		p, q := a.Cells[i].Pixel, b.Cells[i].Pixel
+		lerp := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*progress) }
+		mix.Pix[i*4], mix.Pix[i*4+1], mix.Pix[i*4+2], mix.Pix[i*4+3] = lerp(p.R, q.R), lerp(p.G, q.G), lerp(p.B, q.B), lerp(p.A, q.A)
+	}
+	opts := s.opts
+	opts.Width, opts.Height = a.Width*a.Columns(), a.Height
+	return imgascii.ConvertArt(mix, opts)
+}
+
+// blendArt returns a frame of the transition from a to b that is progress,
+// between 0 and 1, of the way through. Dissolve swaps cells over in a fixed
+// scattered order, wipe sweeps across from the left.
+func blendArt(a, b *imgascii.Art, transition string, progress float64) *imgascii.Art {
+	frame := &imgascii.Art{Width: a.Width, Height: a.Height, Cells: make([]imgascii.Cell, len(a.Cells))}
+	for i := range frame.Cells {
+		var switched bool
+		if transition == "wipe" {
+			switched = float64(i%a.Width) < progress*float64(a.Width)
+		} else {
+			// Multiplicative hashing scatters the cells evenly
+			switched = float64(uint32(i)*2654435761%1000)/1000 < progress
+		}
+		frame.Cells[i] = a.Cells[i]
+		if switched {
+			frame.Cells[i] = b.Cells[i]
+		}
+	}
+	return frame
+}
+
+// drawArt draws art from the top left corner of the terminal. The final
+// newline is left out so the terminal doesn't scroll.
+func drawArt(out *bufio.Writer, art *imgascii.Art) error {
+	text := art.ANSI()
+	out.WriteString("\x1b[H")
+	out.WriteString(text[:len(text)-1])
+	return out.Flush()
+}
+
+// dirImages lists the files in dir, leaving out hidden ones. Anything that
+// isn't an image fails to load and is skipped by the show.
+func dirImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// feedImages reads a list of image URLs, one per line. Blank lines and
+// lines starting with # are ignored.
+func feedImages(client *http.Client, url string) ([]string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			names = append(names, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return names, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+	"github.com/m-spangenberg/go-img-ascii/imgascii/imgasciitest"
+)
+
+// selfTests are the conversions selftest checks, each of a fixture image of
+// imgasciitest with fixed options, covering the tone, color and mapping
+// stages.
+var selfTests = []struct {
+	name, fixture string
+	options       func(*imgascii.Options)
+}{
+	{"gradient", "gradient", func(o *imgascii.Options) {}},
+	{"gradient-dither", "gradient", func(o *imgascii.Options) {
+		o.Charset = imgascii.Charsets["detailed"]
+		o.Dither = true
+	}},
+	{"smpte-256", "smpte", func(o *imgascii.Options) { o.Color = "256" }},
+	{"smpte-16-ciede2000", "smpte", func(o *imgascii.Options) {
+		o.Color = "16"
+		o.Quantize = "ciede2000"
+	}},
+	{"alpha-blocks", "alpha", func(o *imgascii.Options) {
+		o.Mode = "blocks"
+		o.Color = "truecolor"
+	}},
+	{"zoneplate-contrast", "zoneplate", func(o *imgascii.Options) {
+		o.AutoContrast = true
+		o.Gamma = 1.8
+		o.Sharpen = 0.5
+	}},
+	{"checkerboard-braille", "checkerboard", func(o *imgascii.Options) { o.Mapper = "braille" }},
+	{"zoneplate-structural", "zoneplate", func(o *imgascii.Options) {
+		o.Charset = imgascii.Charsets["detailed"]
+		o.Mapper = "structural"
+	}},
+}
+
+// goldens holds the expected output of every self test, as written by
+// selftest -update.
+//
+//go:embed selftest/*.golden
+var goldens embed.FS
+
+// runSelftest converts the fixture images with the options of selfTests and
+// compares the art against the goldens built into the binary, so a build
+// for a new platform or compiler can be checked to render exactly like the
+// release it came from.
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	update := fs.String("update", "", "Write the golden files to this directory, the selftest directory of the source, instead of comparing")
+	verbose := fs.Bool("v", false, "List every test, not only the failures")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii selftest [options]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	failed := 0
+	for _, test := range selfTests {
+		opts := imgascii.DefaultOptions()
+		opts.Width, opts.Height = 40, 20
+		test.options(&opts)
+		art, err := imgascii.ConvertArt(imgasciitest.Fixture(test.fixture), opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", test.name, err)
+			return exitFailure
+		}
+		got := art.ANSI()
+
+		file := test.name + ".golden"
+		if *update != "" {
+			if err := os.WriteFile(filepath.Join(*update, file), []byte(got), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitWrite
+			}
+			continue
+		}
+
+		want, err := goldens.ReadFile("selftest/" + file)
+		if err != nil {
+			fmt.Printf(tr("FAIL %s: no golden output built in\n"), test.name)
+			failed++
+			continue
+		}
+		if line := firstDifference(got, string(want)); line > 0 {
+			fmt.Printf(tr("FAIL %s: output differs at line %d\n"), test.name, line)
+			failed++
+			continue
+		}
+		if *verbose {
+			fmt.Printf("ok   %s\n", test.name)
+		}
+	}
+
+	if *update != "" {
+		return exitOK
+	}
+	if failed > 0 {
+		fmt.Printf(tr("%d of %d self tests failed\n"), failed, len(selfTests))
+		return exitFailure
+	}
+	fmt.Printf(tr("all %d self tests passed\n"), len(selfTests))
+	return exitOK
+}
+
+// firstDifference returns the first line, counted from 1, at which got and
+// want differ, or 0 when they are the same.
+func firstDifference(got, want string) int {
+	if got == want {
+		return 0
+	}
+	g, w := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < max(len(g), len(w)); i++ {
+		if i >= len(g) || i >= len(w) || g[i] != w[i] {
+			return i + 1
+		}
+	}
+	return 0
+}
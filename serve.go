@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// runServe converts images posted over HTTP. POST /convert takes the image
+// as the request body and conversion flags as query parameters, such as
+// /convert?w=80&color=256, and answers with the art in the format named by
+// the format parameter: text, json or html. GET /stream does the same for
+// animations and cameras over a WebSocket, a frame at a time, and / serves
+// a page that does all of it in the browser. With -grpc it serves the
+// Converter service of imgasciipb instead.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	grpcMode := fs.Bool("grpc", false, "Serve the gRPC Converter service instead of HTTP")
+	cacheSize := fs.Int("cache", 128, "Conversions to keep for repeated requests (0 keeps none)")
+	rate := localFloat(fs, "rate", 0, "Requests a second allowed from each client address (default no limit)")
+	burst := fs.Int("burst", 10, "Requests a client may make at once before -rate applies")
+	maxUpload := byteSize(32 << 20)
+	fs.Var(&maxUpload, "max-upload", "Largest image accepted, such as 8M")
+	idleTimeout := fs.Duration("idle-timeout", 0, "Stop serving after this long without requests")
+	maxJobs := fs.Int("max-jobs", 0, "Conversions that may run at once, the rest are queued (default one per processor)")
+	var maxMemory byteSize
+	fs.Var(&maxMemory, "max-memory", "Soft memory limit such as 256M")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii serve [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *cacheSize < 0 || *rate < 0 || *burst < 1 || maxUpload < 1 {
+		fmt.Fprintln(os.Stderr, tr("-cache and -rate must not be negative, -burst and -max-upload must be positive"))
+		return exitUsage
+	}
+	if *idleTimeout < 0 || *maxJobs < 0 {
+		fmt.Fprintln(os.Stderr, tr("-idle-timeout and -max-jobs must not be negative"))
+		return exitUsage
+	}
+	limitMemory(maxMemory)
+	// A bad default in the environment would fail every request
+	if _, err := parseServeRequest(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	srv := newServer(limits{idle: *idleTimeout, jobs: *maxJobs})
+	srv.cache = newArtCache(*cacheSize)
+	srv.limiter = newRateLimiter(*rate, *burst)
+	srv.maxUpload = int64(maxUpload)
+
+	if *grpcMode {
+		lis, err := net.Listen("tcp", *addr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(os.Stderr, tr("serving gRPC on %s\n"), lis.Addr())
+		gs := newGRPCServer(srv)
+		go func() {
+			<-srv.idle()
+			gs.GracefulStop()
+		}()
+		if err := gs.Serve(lis); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /convert", srv.handleConvert)
+	mux.HandleFunc("GET /stream", srv.handleStream)
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webUI)
+	})
+	hs := &http.Server{Addr: *addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer srv.busy()()
+		mux.ServeHTTP(w, r)
+	})}
+	go func() {
+		<-srv.idle()
+		hs.Shutdown(context.Background())
+	}()
+	fmt.Fprintf(os.Stderr, tr("serving on http://%s\n"), *addr)
+	if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// webUI is the page served at /, which converts dropped images through
+// POST /convert as its controls change.
+//
+//go:embed web/index.html
+var webUI []byte
+
+// server holds what the handlers of serve share: the cache of recent
+// conversions, the rate limit of each client, the size of the largest
+// image accepted and the limits of the whole server.
+type server struct {
+	cache     *artCache
+	limiter   *rateLimiter
+	maxUpload int64
+
+	lim  limits
+	jobs chan struct{}
+
+	// active counts the requests being handled, and last is when the
+	// last of them ended
+	mu     sync.Mutex
+	active int
+	last   time.Time
+}
+
+// newServer returns a server within lim. Without a number of jobs as many
+// conversions run at once as there are processors.
+func newServer(lim limits) *server {
+	if lim.jobs == 0 {
+		lim.jobs = runtime.NumCPU()
+	}
+	return &server{lim: lim, jobs: make(chan struct{}, lim.jobs), last: time.Now()}
+}
+
+// acquire waits for one of the jobs of the server to be free and takes it
+// until release is called, or returns the error of ctx should it end first.
+func (s *server) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case s.jobs <- struct{}{}:
+		return func() { <-s.jobs }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// busy marks a request as being handled until done is called.
+func (s *server) busy() (done func()) {
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.active--
+		s.last = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// idle returns a channel closed once the server has handled no request for
+// lim.idle, or never without an idle timeout.
+func (s *server) idle() <-chan struct{} {
+	c := make(chan struct{})
+	if s.lim.idle <= 0 {
+		return c
+	}
+	go func() {
+		ticker := time.NewTicker(min(s.lim.idle, time.Second))
+		defer ticker.Stop()
+		for range ticker.C {
+			s.mu.Lock()
+			idle := s.active == 0 && time.Since(s.last) >= s.lim.idle
+			s.mu.Unlock()
+			if idle {
+				close(c)
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Limits of a single request, which keep one client from taking the memory
+// and processors of the whole server.
+const (
+	// serveMaxCells is the most cells of art, as 1024 by 1024
+	serveMaxCells = 1 << 20
+	// serveMaxSamples is the largest -samples, whose square multiplies the
+	// pixels the image is scaled to
+	serveMaxSamples = 4
+	// serveMaxPixels is the largest image decoded, as 8192 by 8192
+	serveMaxPixels = 1 << 26
+)
+
+// serveRequest is a conversion asked for over HTTP or gRPC.
+type serveRequest struct {
+	flags         *optionFlags
+	width, height int
+	format        string
+
+	// key names the options of the request for the cache, with its
+	// parameters in a fixed order.
+	key string
+}
+
+// parseServeRequest reads the size, format and conversion flags of a
+// request from params, keyed as the query parameters of /convert are.
+// Those it leaves out are taken from the environment variables of the
+// flags of the same names, as applyEnv does, so a deployment can pick its
+// own defaults.
+func parseServeRequest(params map[string][]string) (serveRequest, error) {
+	// Every request gets its own flag set, so parameters are parsed
+	// exactly like the flags of the other commands
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	req := serveRequest{flags: addOptionFlags(fs), width: 64, format: "text", key: url.Values(params).Encode()}
+	names := map[string]string{}
+	for _, key := range []string{"w", "h", "format"} {
+		if value, ok := os.LookupEnv(envName(key)); ok && params[key] == nil {
+			params = maps.Clone(params)
+			if params == nil {
+				params = map[string][]string{}
+			}
+			params[key], names[key] = []string{value}, envName(key)
+		}
+	}
+	for key, values := range params {
+		var err error
+		switch key {
+		case "w":
+			req.width, err = strconv.Atoi(values[0])
+		case "h":
+			req.height, err = strconv.Atoi(values[0])
+		case "format":
+			req.format = values[0]
+		case "map-script", "mask", "match":
+			// Scripts and images are read from the disk of the server
+			err = errors.New("not available over serve")
+		case "glyphs", "palette":
+			// Only the built-in sets and palettes, and palettes given as
+			// colors, since anything else is a file of the server
+			for _, value := range values {
+				if err == nil && (key == "glyphs" && imgascii.GlyphSets[value] == nil || key == "palette" && paletteFile(value)) {
+					err = errors.New("files are not available over serve")
+				}
+				if err == nil {
+					err = fs.Set(key, value)
+				}
+			}
+		default:
+			for _, value := range values {
+				if err == nil {
+					err = fs.Set(key, value)
+				}
+			}
+		}
+		if err != nil {
+			if name, ok := names[key]; ok {
+				key = name
+			}
+			return req, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if err := applyEnv(fs); err != nil {
+		return req, err
+	}
+	// Settings that ask the terminal would query the one the server was
+	// started from, if any, on every request
+	for _, auto := range []struct{ key, value string }{
+		{"bg", *req.flags.background},
+		{"color", *req.flags.color},
+		{"mode", *req.flags.mode},
+	} {
+		if auto.value == "auto" || auto.key == "color" && auto.value == "always" {
+			return req, fmt.Errorf("%s: %s needs a terminal and is not available over serve", auto.key, auto.value)
+		}
+	}
+	if req.width < 1 || req.height < 0 {
+		return req, errors.New("width must be positive and height must not be negative")
+	}
+	if req.width > serveMaxCells || req.height > serveMaxCells/req.width {
+		return req, fmt.Errorf("art is larger than %d cells", serveMaxCells)
+	}
+	if *req.flags.samples > serveMaxSamples {
+		return req, fmt.Errorf("samples: at most %d over serve", serveMaxSamples)
+	}
+	if req.format != "text" && req.format != "json" && req.format != "html" {
+		return req, fmt.Errorf("invalid format %q", req.format)
+	}
+	return req, nil
+}
+
+// options returns the conversion options of the request for img, the
+// image or first frame being converted.
+func (req serveRequest) options(img image.Image) (imgascii.Options, error) {
+	opts, err := req.flags.options()
+	if err != nil {
+		return opts, err
+	}
+	if err := req.flags.applyFocus(&opts, img); err != nil {
+		return opts, err
+	}
+
+	// Characters are about twice as tall as they are wide
+	opts.Width, opts.Height = req.width, req.height
+	if opts.Height == 0 {
+		bounds := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+		opts.Height = max(1, req.width*bounds.Dy()/bounds.Dx()/2)
+	}
+	if opts.Width*opts.Height > serveMaxCells {
+		return opts, fmt.Errorf("art is larger than %d cells", serveMaxCells)
+	}
+	return opts, nil
+}
+
+// checkPixels reads the size of the image in data from its header and
+// refuses images larger than serveMaxPixels before they are decoded.
+func checkPixels(data []byte) error {
+	bounds, err := imgascii.DecodeBounds(bytes.NewReader(data), imgascii.DecodeOptions{})
+	if err != nil {
+		return err
+	}
+	if int64(bounds.Dx())*int64(bounds.Dy()) > serveMaxPixels {
+		return fmt.Errorf("image of %dx%d pixels is larger than %d pixels", bounds.Dx(), bounds.Dy(), serveMaxPixels)
+	}
+	return nil
+}
+
+// write writes art in the format of the request.
+func (req serveRequest) write(w io.Writer, art *imgascii.Art) error {
+	switch req.format {
+	case "json":
+		return writeJSON(w, art)
+	case "html":
+		return writeHTML(w, art, themes["light"], htmlLinks{mode: "none"})
+	}
+	_, err := art.WriteTo(w)
+	return err
+}
+
+// contentTypes are the HTTP content types of the formats of serve.
+var contentTypes = map[string]string{
+	"text": "text/plain; charset=utf-8",
+	"json": "application/json",
+	"html": "text/html; charset=utf-8",
+}
+
+// handleConvert converts the posted image with the options of the query,
+// or answers from the cache when it has converted the same before.
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r) {
+		return
+	}
+	req, err := parseServeRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxUpload))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("image is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := cacheKey(data, req)
+	cached, ok := s.cache.get(key)
+	if !ok {
+		release, err := s.acquire(r.Context())
+		if err != nil {
+			return
+		}
+		defer release()
+		if err := checkPixels(data); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		img, err := imgascii.DecodeWith(bytes.NewReader(data), req.flags.decodeOptions())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		opts, err := req.options(img)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		art, err := imgascii.ConvertContext(r.Context(), img, imgascii.WithOptions(opts))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var b strings.Builder
+		req.write(&b, art)
+		cached = cachedArt{text: b.String(), width: art.Width, height: art.Height}
+		s.cache.add(key, cached)
+	}
+
+	w.Header().Set("Content-Type", contentTypes[req.format])
+	io.WriteString(w, cached.text)
+}
+
+// allow answers with 429 Too Many Requests and reports false when the
+// client of r has used up its rate.
+func (s *server) allow(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := s.limiter.allow(r.RemoteAddr)
+	if !ok {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}
+	return ok
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+	"github.com/m-spangenberg/go-img-ascii/imgasciipb"
+)
+
+// grpcConverter implements the Converter service of imgasciipb with the
+// same options, formats, cache and limits as POST /convert.
+type grpcConverter struct {
+	imgasciipb.UnimplementedConverterServer
+	srv *server
+}
+
+// newGRPCServer returns a gRPC server for srv. Requests may be a little
+// larger than the largest image to leave room for their other fields.
+func newGRPCServer(srv *server) *grpc.Server {
+	s := grpc.NewServer(grpc.MaxRecvMsgSize(int(srv.maxUpload) + 64<<10))
+	imgasciipb.RegisterConverterServer(s, grpcConverter{srv: srv})
+	return s
+}
+
+// allow returns a ResourceExhausted error when the client of ctx has used
+// up its rate, and checks the image size, which MaxRecvMsgSize only bounds
+// with the rest of the request.
+func (g grpcConverter) allow(ctx context.Context, in *imgasciipb.ConvertRequest) error {
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	if ok, wait := g.srv.limiter.allow(addr); !ok {
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s seconds", retryAfter(wait))
+	}
+	if int64(len(in.Image)) > g.srv.maxUpload {
+		return status.Errorf(codes.ResourceExhausted, "image is larger than %d bytes", g.srv.maxUpload)
+	}
+	return nil
+}
+
+// parseGRPCRequest turns the fields of in into the parameters of a
+// /convert query, so both servers read their options alike.
+func parseGRPCRequest(in *imgasciipb.ConvertRequest) (serveRequest, error) {
+	params := make(map[string][]string, len(in.Options)+3)
+	for key, value := range in.Options {
+		params[key] = []string{value}
+	}
+	if in.Width != 0 {
+		params["w"] = []string{strconv.Itoa(int(in.Width))}
+	}
+	if in.Height != 0 {
+		params["h"] = []string{strconv.Itoa(int(in.Height))}
+	}
+	if in.Format != "" {
+		params["format"] = []string{in.Format}
+	}
+	req, err := parseServeRequest(params)
+	if err != nil {
+		return req, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return req, nil
+}
+
+func (g grpcConverter) Convert(ctx context.Context, in *imgasciipb.ConvertRequest) (*imgasciipb.ConvertResponse, error) {
+	defer g.srv.busy()()
+	if err := g.allow(ctx, in); err != nil {
+		return nil, err
+	}
+	req, err := parseGRPCRequest(in)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(in.Image, req)
+	cached, ok := g.srv.cache.get(key)
+	if !ok {
+		release, err := g.srv.acquire(ctx)
+		if err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		defer release()
+		if err := checkPixels(in.Image); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		img, err := imgascii.DecodeWith(bytes.NewReader(in.Image), req.flags.decodeOptions())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		opts, err := req.options(img)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		art, err := imgascii.ConvertContext(ctx, img, imgascii.WithOptions(opts))
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		var b strings.Builder
+		if err := req.write(&b, art); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		cached = cachedArt{text: b.String(), width: art.Width, height: art.Height}
+		g.srv.cache.add(key, cached)
+	}
+	return &imgasciipb.ConvertResponse{Art: cached.text, Width: int32(cached.width), Height: int32(cached.height)}, nil
+}
+
+// ConvertFrames sends every frame as soon as it is converted, so clients
+// can start playing long animations before the last frame is done. A
+// client that goes away stops the conversion.
+func (g grpcConverter) ConvertFrames(in *imgasciipb.ConvertRequest, stream grpc.ServerStreamingServer[imgasciipb.Frame]) error {
+	defer g.srv.busy()()
+	if err := g.allow(stream.Context(), in); err != nil {
+		return err
+	}
+	req, err := parseGRPCRequest(in)
+	if err != nil {
+		return err
+	}
+	release, err := g.srv.acquire(stream.Context())
+	if err != nil {
+		return status.FromContextError(err).Err()
+	}
+	defer release()
+	if err := checkPixels(in.Image); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	frames, err := imgascii.DecodeFrames(bytes.NewReader(in.Image), req.flags.decodeOptions())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts, err := req.options(frames[0].Image)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = imgascii.ConvertFramesEach(frames, opts, 0, func(i int, art *imgascii.Art) error {
+		var b strings.Builder
+		if err := req.write(&b, art); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return stream.Send(&imgasciipb.Frame{Index: int32(i), Art: b.String(), DelayMs: frames[i].Delay.Milliseconds()})
+	})
+	if _, ok := status.FromError(err); !ok {
+		err = status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cachedArt is a conversion kept for repeated requests, already written in
+// the requested format.
+type cachedArt struct {
+	text          string
+	width, height int
+}
+
+// artCache keeps the most recently used conversions, so a server asked for
+// the same image with the same options again and again converts it once.
+// A nil cache keeps nothing.
+type artCache struct {
+	size    int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key string
+	art cachedArt
+}
+
+// newArtCache returns a cache of size entries, or nil when size is 0.
+func newArtCache(size int) *artCache {
+	if size <= 0 {
+		return nil
+	}
+	return &artCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// cacheKey identifies the conversion of the image in data by the options
+// of req.
+func cacheKey(data []byte, req serveRequest) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + "?" + req.key
+}
+
+func (c *artCache) get(key string) (cachedArt, bool) {
+	if c == nil {
+		return cachedArt{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return cachedArt{}, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).art, true
+}
+
+// add keeps art under key, forgetting the least recently used conversion
+// once the cache is full.
+func (c *artCache) add(key string, art cachedArt) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, art})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// rateLimiter allows every client address rate requests a second, with
+// bursts of up to burst requests, using a token bucket per address. A nil
+// limiter allows everything.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	clients map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+// sweepClients is how many addresses the limiter tracks before it forgets
+// those whose buckets have filled up again.
+const sweepClients = 4096
+
+// newRateLimiter returns a limiter, or nil when rate is 0.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: float64(max(1, burst)), clients: make(map[string]*bucket)}
+}
+
+// allow reports whether the client at addr, a host and port, may make a
+// request now, and if not, how long until it may.
+func (l *rateLimiter) allow(addr string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.clients) >= sweepClients {
+		for client, b := range l.clients {
+			if b.tokens+now.Sub(b.seen).Seconds()*l.rate >= l.burst {
+				delete(l.clients, client)
+			}
+		}
+	}
+
+	b, ok := l.clients[host]
+	if !ok {
+		b = &bucket{tokens: l.burst, seen: now}
+		l.clients[host] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.seen).Seconds()*l.rate)
+	b.seen = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// retryAfter formats wait as the whole seconds of a Retry-After header.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
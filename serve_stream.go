@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// upgrader accepts WebSockets from pages served by the same host only, so
+// other sites cannot drive a camera through a visitor's browser.
+var upgrader = websocket.Upgrader{}
+
+// handleStream converts an animation or a camera over a WebSocket, with
+// the options of the query as for /convert. With source=camera:N it
+// streams that camera until the client goes away; otherwise it waits for
+// the image as the first message and sends its frames at their delays.
+// Uploads are images as DecodeFrames reads them, animated GIFs, PNGs and
+// WebPs among them; video files are refused with a close reason saying so.
+// Every frame is a message in the requested format. Errors after the
+// upgrade close the socket with the error as the reason.
+func (s *server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r) {
+		return
+	}
+	params := r.URL.Query()
+	source := params.Get("source")
+	delete(params, "source")
+	req, err := parseServeRequest(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	index, camera := cameraIndex(source)
+	if source != "" && !camera {
+		http.Error(w, "source must be camera:N", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request already
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(s.maxUpload)
+
+	if camera {
+		err = s.streamCamera(conn, req, index)
+	} else {
+		err = s.streamUpload(conn, req)
+	}
+
+	code, reason := websocket.CloseNormalClosure, ""
+	if err != nil {
+		code, reason = websocket.CloseUnsupportedData, err.Error()
+	}
+	// A close reason must fit in a control frame
+	if len(reason) > 120 {
+		reason = reason[:120]
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// watchClose reads from conn, discarding what the client sends, and returns
+// a context that is cancelled once the client has closed it.
+func watchClose(conn *websocket.Conn) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+// sendArt writes art to conn as a message in the format of req.
+func sendArt(conn *websocket.Conn, req serveRequest, art *imgascii.Art) error {
+	mw, err := conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	if err := req.write(mw, art); err != nil {
+		mw.Close()
+		return err
+	}
+	return mw.Close()
+}
+
+// streamUpload reads an image from the first message and sends its frames
+// as they are converted, each no sooner than its delay after the one
+// before, so clients can show them as they arrive. The upload holds one of
+// the jobs of the server until its last frame is sent.
+func (s *server) streamUpload(conn *websocket.Conn, req serveRequest) error {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if format := videoFormat(data); format != "" {
+		return fmt.Errorf("%s video is not supported, send an animated GIF, PNG or WebP", format)
+	}
+	ctx := watchClose(conn)
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := checkPixels(data); err != nil {
+		return err
+	}
+	frames, err := imgascii.DecodeFrames(bytes.NewReader(data), req.flags.decodeOptions())
+	if err != nil {
+		return err
+	}
+	opts, err := req.options(frames[0].Image)
+	if err != nil {
+		return err
+	}
+
+	next := time.Now()
+	return imgascii.ConvertFramesEach(frames, opts, 0, func(i int, art *imgascii.Art) error {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-time.After(time.Until(next)):
+		}
+		next = next.Add(frames[i].Delay)
+		return sendArt(conn, req, art)
+	})
+}
+
+// videoFormat names the video container data starts with, or returns
+// nothing for anything else. ISO media files are video unless one of
+// their brands is HEIF or AVIF, which are images.
+func videoFormat(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		for i := 8; i+4 <= min(len(data), 32); i += 4 {
+			switch string(data[i : i+4]) {
+			case "avif", "avis", "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+				return ""
+			}
+		}
+		return "MP4"
+	case bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "WebM"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "AVI ":
+		return "AVI"
+	case bytes.HasPrefix(data, []byte("FLV")):
+		return "FLV"
+	case bytes.HasPrefix(data, []byte{0, 0, 1, 0xba}):
+		return "MPEG"
+	case len(data) > 188 && data[0] == 0x47 && data[188] == 0x47:
+		return "MPEG-TS"
+	}
+	return ""
+}
+
+// streamCamera sends frames from a camera as fast as they are captured and
+// converted, until the client goes away. The size of the art follows the
+// first frame, and every frame takes one of the jobs of the server while
+// it is converted.
+func (s *server) streamCamera(conn *websocket.Conn, req serveRequest, index int) error {
+	cam, err := openCamera(index)
+	if err != nil {
+		return err
+	}
+	defer cam.Close()
+
+	ctx := watchClose(conn)
+	var opts imgascii.Options
+	for first := true; ctx.Err() == nil; first = false {
+		img, err := cam.Frame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			if opts, err = req.options(img); err != nil {
+				return err
+			}
+		}
+		release, err := s.acquire(ctx)
+		if err != nil {
+			return nil
+		}
+		art, err := imgascii.ConvertContext(ctx, img, imgascii.WithOptions(opts))
+		release()
+		if err != nil {
+			return err
+		}
+		if err := sendArt(conn, req, art); err != nil {
+			return err
+		}
+	}
+	return nil
+}
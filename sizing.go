@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// percent is a flag value holding a percentage, written as 25% or just 25.
+// Like other numbers it accepts a decimal comma.
+type percent float64
+
+func (p *percent) String() string {
+	if *p == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*p), 'g', -1, 64) + "%"
+}
+
+func (p *percent) Set(value string) error {
+	v, err := strconv.ParseFloat(strings.Replace(strings.TrimSuffix(strings.TrimSpace(value), "%"), ",", ".", 1), 64)
+	if err != nil || v <= 0 {
+		return errors.New(tr("invalid percentage"))
+	}
+	*p = percent(v)
+	return nil
+}
+
+// relativeSize sizes the output from the size of the source instead of
+// absolute -w and -h values.
+type relativeSize struct {
+	scale               percent
+	maxWidth, maxHeight int
+}
+
+// given reports whether any relative sizing was asked for.
+func (r relativeSize) given() bool {
+	return r.scale > 0 || r.maxWidth > 0 || r.maxHeight > 0
+}
+
+// size returns the output size for a source of the given bounds. At 100%
+// every pixel column becomes a cell and every two pixel rows a row, as
+// characters are about twice as tall as they are wide. The result is then
+// shrunk, keeping its aspect, until it fits the maximums.
+func (r relativeSize) size(bounds image.Rectangle) image.Point {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())/2
+	if r.scale > 0 {
+		w, h = w*float64(r.scale)/100, h*float64(r.scale)/100
+	}
+	if r.maxWidth > 0 && w > float64(r.maxWidth) {
+		w, h = float64(r.maxWidth), h*float64(r.maxWidth)/w
+	}
+	if r.maxHeight > 0 && h > float64(r.maxHeight) {
+		w, h = w*float64(r.maxHeight)/h, float64(r.maxHeight)
+	}
+	return image.Pt(max(1, int(w+0.5)), max(1, int(h+0.5)))
+}
+
+// sizePreset is a named size for casual use, picking a charset that suits
+// it. The full preset fills the terminal like -fit.
+type sizePreset struct {
+	width, height int
+	fit           bool
+	charset       string
+}
+
+var sizePresets = map[string]sizePreset{
+	"thumbnail": {width: 24, height: 12, charset: "blocks"},
+	"small":     {width: 40, height: 20, charset: "standard"},
+	"medium":    {width: 80, height: 40, charset: "standard"},
+	"large":     {width: 160, height: 80, charset: "detailed"},
+	"full":      {fit: true, charset: "detailed"},
+}
+
+// presetName is a flag value holding the name of a size preset.
+type presetName string
+
+func (p *presetName) String() string {
+	return string(*p)
+}
+
+func (p *presetName) Set(value string) error {
+	if _, ok := sizePresets[value]; !ok {
+		return fmt.Errorf(tr("invalid size %q: expected small, medium, large, full or thumbnail"), value)
+	}
+	*p = presetName(value)
+	return nil
+}
+
+// apply sets the flags of the preset on fs, leaving alone those in given,
+// which were set on the command line and override it. It reports whether
+// the preset sized the output.
+func (p presetName) apply(fs *flag.FlagSet, given map[string]bool) bool {
+	preset, ok := sizePresets[string(p)]
+	if !ok {
+		return false
+	}
+	if !given["charset"] {
+		fs.Set("charset", preset.charset)
+	}
+	if given["w"] || given["h"] || given["fit"] || given["scale"] || given["max-width"] || given["max-height"] {
+		return false
+	}
+	if preset.fit {
+		fs.Set("fit", "true")
+		return true
+	}
+	fs.Set("w", strconv.Itoa(preset.width))
+	fs.Set("h", strconv.Itoa(preset.height))
+	return true
+}
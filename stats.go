@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// statsBins is how many bars the histogram of the stats command has, each
+// covering as many gray levels.
+const statsBins = 16
+
+// statsBarWidth is the length of the longest bar stats prints.
+const statsBarWidth = 40
+
+// runStats prints what decides how an image converts, before converting
+// it: the size of the art, the luminance histogram of the image, the
+// contrast, brightness and gamma that would spread its tones over the ramp
+// and how many characters of the ramp the art uses, with the flags given
+// and with those suggested.
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Path to the image file")
+	width := fs.Int("w", 64, "Width to scale the image to")
+	height := fs.Int("h", 32, "Height to scale the image to")
+	var relative relativeSize
+	fs.Var(&relative.scale, "scale", "Size the output to a percentage of the image, as 25%, instead of -w and -h")
+	fs.IntVar(&relative.maxWidth, "max-width", 0, "Largest width, the height following the image aspect, instead of -w and -h")
+	fs.IntVar(&relative.maxHeight, "max-height", 0, "Largest height, the width following the image aspect, instead of -w and -h")
+	fit := fs.Bool("fit", false, "Size the output to fit the terminal")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii stats -i image [options]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+	absolute := false
+	fs.Visit(func(f *flag.Flag) {
+		absolute = absolute || f.Name == "w" || f.Name == "h"
+	})
+	if absolute && relative.given() {
+		fmt.Fprintln(os.Stderr, tr("-scale, -max-width and -max-height cannot be combined with -w or -h"))
+		return exitUsage
+	}
+	if *width < 1 || *height < 1 || relative.maxWidth < 0 || relative.maxHeight < 0 {
+		fmt.Fprintln(os.Stderr, tr("stats: sizes must be positive"))
+		return exitUsage
+	}
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	img, err := imgascii.DecodeFileWith(*imagePath, optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	if err := optionFlags.applyFocus(&opts, img); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	opts.Width, opts.Height = *width, *height
+	turned := imgascii.TurnedBounds(img.Bounds(), opts.Orient)
+	if *fit {
+		opts.Width, opts.Height = fitSize(turned, 1)
+	} else if relative.given() {
+		size := relative.size(turned)
+		opts.Width, opts.Height = size.X, size.Y
+	}
+
+	converter := imgascii.NewConverter(img)
+	art, err := converter.ConvertArt(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	// The histogram covers the part of the image converted, when it can
+	// be cut out
+	region := converter.SourceRect()
+	source := img
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		source = sub.SubImage(region)
+	}
+	hist := imgascii.HistogramOf(source, opts.Luma)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	bounds := img.Bounds()
+	fmt.Fprintf(tw, "image\t%dx%d pixels\n", bounds.Dx(), bounds.Dy())
+	if region != bounds {
+		fmt.Fprintf(tw, "converted\t%dx%d pixels at %d,%d\n", region.Dx(), region.Dy(), region.Min.X, region.Min.Y)
+	}
+	fmt.Fprintf(tw, "output\t%dx%d cells\n", opts.Width, opts.Height)
+	fmt.Fprintf(tw, "luminance\tmin %d, median %d, mean %.0f, max %d\n",
+		percentile(hist, 0), percentile(hist, 0.5), meanLevel(hist), percentile(hist, 1))
+	fmt.Fprintf(tw, "spread\t%d to %d between the darkest and lightest 1%%\n", percentile(hist, 0.01), percentile(hist, 0.99))
+
+	suggested, tuned := suggestTone(hist)
+	if tuned {
+		fmt.Fprintf(tw, "suggested\t-contrast %.2f -brightness %.2f -gamma %.2f\n", suggested.contrast, suggested.brightness, suggested.gamma)
+	} else {
+		fmt.Fprintln(tw, "suggested\tnothing, the tones already fill the range")
+	}
+
+	ramp := []rune(opts.Charset)
+	if opts.Mode == "ascii" && (opts.Mapper == "" || opts.Mapper == "luminance") {
+		counts := rampCounts(art, ramp)
+		line := fmt.Sprintf("%d of %d characters used", usedCount(counts), len(ramp))
+		if tuned {
+			o := opts
+			o.AutoContrast = false
+			o.Contrast, o.Brightness, o.Gamma = suggested.contrast, suggested.brightness, suggested.gamma
+			if tunedArt, err := converter.ConvertArt(o); err == nil {
+				line += fmt.Sprintf(", %d with the suggested settings", usedCount(rampCounts(tunedArt, ramp)))
+			}
+		}
+		fmt.Fprintf(tw, "ramp\t%s\n", line)
+		tw.Flush()
+		fmt.Println()
+		printRampUse(os.Stdout, ramp, counts, len(art.Cells))
+	} else {
+		if opts.Mode != "ascii" {
+			fmt.Fprintf(tw, "ramp\tnot used in %s mode\n", opts.Mode)
+		} else {
+			fmt.Fprintf(tw, "ramp\tnot used by the %s mapper\n", opts.Mapper)
+		}
+		tw.Flush()
+	}
+
+	fmt.Println()
+	printHistogram(os.Stdout, hist)
+	return exitOK
+}
+
+// percentile returns the lowest gray level at or below which share p of
+// the pixels of hist are.
+func percentile(hist *imgascii.Histogram, p float64) int {
+	if p == 0 {
+		// The darkest level any pixel has
+		for i, v := range hist {
+			if v > 0 {
+				return i
+			}
+		}
+	}
+	for i, v := range hist {
+		if v >= p-1e-9 {
+			return i
+		}
+	}
+	return 255
+}
+
+// meanLevel returns the mean gray level of hist.
+func meanLevel(hist *imgascii.Histogram) float64 {
+	var mean, below float64
+	for i, v := range hist {
+		mean += float64(i) * (v - below)
+		below = v
+	}
+	return mean
+}
+
+// toneSettings are the values of -contrast, -brightness and -gamma.
+type toneSettings struct {
+	contrast, brightness, gamma float64
+}
+
+// suggestTone returns the tone settings that stretch the levels between
+// the darkest and lightest 1% of hist over the full range, centred, and
+// then bend the gamma to bring the mean to middle gray, as Options apply
+// them. The mean rather than the median, as a plain background can take
+// half of the image, and the gamma stays between 0.5 and 2, as past that
+// it flattens the other end of the ramp. It reports false when they are all close to doing nothing.
+func suggestTone(hist *imgascii.Histogram) (toneSettings, bool) {
+	lo, hi := float64(percentile(hist, 0.01)), float64(percentile(hist, 0.99))
+	hi = max(hi, lo+1)
+	s := toneSettings{contrast: 255 / (hi - lo), gamma: 1}
+	s.brightness = math.Max(-1, math.Min(1, -((lo+hi)/510-0.5)*s.contrast))
+	mean := (meanLevel(hist)/255-0.5)*s.contrast + 0.5 + s.brightness
+	if mean > 0 && mean < 1 {
+		s.gamma = math.Max(0.5, math.Min(2, math.Log(mean)/math.Log(0.5)))
+	}
+	s.contrast = math.Round(s.contrast*100) / 100
+	s.brightness = math.Round(s.brightness*100) / 100
+	s.gamma = math.Round(s.gamma*100) / 100
+	tuned := math.Abs(s.contrast-1) >= 0.1 || math.Abs(s.brightness) >= 0.05 || math.Abs(s.gamma-1) >= 0.1
+	return s, tuned
+}
+
+// rampCounts returns how many cells of art show each character of ramp.
+func rampCounts(art *imgascii.Art, ramp []rune) []int {
+	counts := make([]int, len(ramp))
+	for _, cell := range art.Cells {
+		for i, r := range ramp {
+			if cell.Rune == r {
+				counts[i]++
+				break
+			}
+		}
+	}
+	return counts
+}
+
+func usedCount(counts []int) int {
+	used := 0
+	for _, n := range counts {
+		if n > 0 {
+			used++
+		}
+	}
+	return used
+}
+
+// printRampUse prints the share of the cells each character of ramp takes
+// as a bar.
+func printRampUse(w io.Writer, ramp []rune, counts []int, cells int) {
+	most := max(1, counts[0])
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	for i, r := range ramp {
+		share := float64(counts[i]) / float64(max(1, cells))
+		fmt.Fprintf(w, "  %q %6.1f%%  %s\n", r, share*100, strings.Repeat("#", counts[i]*statsBarWidth/most))
+	}
+}
+
+// printHistogram prints hist as bars of statsBins ranges of gray levels,
+// the longest statsBarWidth long.
+func printHistogram(w io.Writer, hist *imgascii.Histogram) {
+	var shares [statsBins]float64
+	below, most := 0.0, 0.0
+	for i, v := range hist {
+		shares[i*statsBins/256] += v - below
+		below = v
+	}
+	for _, s := range shares {
+		most = math.Max(most, s)
+	}
+	for bin, s := range shares {
+		lo, hi := bin*256/statsBins, (bin+1)*256/statsBins-1
+		fmt.Fprintf(w, "  %3d-%-3d %6.1f%%  %s\n", lo, hi, s*100, strings.Repeat("#", int(s/most*statsBarWidth+0.5)))
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+var (
+	htmlPre = regexp.MustCompile(`(?s)<pre>(.*)</pre>`)
+	htmlTag = regexp.MustCompile(`<[^>]*>`)
+)
+
+// annotationPrefix starts the header -annotate writes on text exports.
+const annotationPrefix = "# go-img-ascii "
+
+// runStrip implements the strip command, which reads colored art from
+// stdin and writes it to stdout as plain text. ANSI art loses its color
+// escapes, and an HTML page written by -o html is cut down to the text of
+// its pre element, so the output matches -o txt.
+func runStrip(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("strip", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-img-ascii strip < art")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, tr("strip: unexpected argument %q\n"), fs.Arg(0))
+		return exitUsage
+	}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "strip: %v\n", err)
+		return exitDecode
+	}
+	text := string(data)
+	if m := htmlPre.FindStringSubmatch(text); m != nil {
+		text = html.UnescapeString(htmlTag.ReplaceAllString(m[1], ""))
+	} else {
+		text = sgrEscape.ReplaceAllString(text, "")
+	}
+	if _, err := io.WriteString(stdout, text); err != nil {
+		fmt.Fprintf(stderr, "strip: %v\n", err)
+		return exitWrite
+	}
+	return exitOK
+}
+
+// colorMap is the part of -o json output ansify reads: the size of the art
+// and the sampled color of every cell.
+type colorMap struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Cells  [][]struct {
+		RGB [3]uint8 `json:"rgb"`
+	} `json:"cells"`
+}
+
+// image returns the colors of the map as an image with a pixel per cell.
+func (m colorMap) image() (image.Image, error) {
+	if m.Width < 1 || m.Height < 1 || len(m.Cells) != m.Height {
+		return nil, fmt.Errorf("invalid color map of %dx%d cells", m.Width, m.Height)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+	for y, row := range m.Cells {
+		if len(row) != m.Width {
+			return nil, fmt.Errorf("row %d of the color map has %d cells, not %d", y+1, len(row), m.Width)
+		}
+		for x, cell := range row {
+			img.SetRGBA(x, y, color.RGBA{cell.RGB[0], cell.RGB[1], cell.RGB[2], 0xff})
+		}
+	}
+	return img, nil
+}
+
+// runAnsify implements the ansify command, the reverse of strip: it reads
+// plain art from stdin and colors every character with the cell at its
+// place in the -o json output of the same conversion, writing ANSI art to
+// stdout. The text may have been edited, as long as it still fits the map.
+func runAnsify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ansify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	colors := fs.String("colors", "", "JSON file written by -o json for the same art, whose colors are used")
+	depth := fs.String("color", "truecolor", "ANSI color output: 16 or 256 or truecolor, or auto or always or never to pick the depth the terminal supports")
+	quantize := fs.String("quantize", "nearest", "Palette matching for 16 and 256 colors: nearest or ciede2000 or dither")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-img-ascii ansify -colors art.json [options] < art.txt")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, tr("ansify: unexpected argument %q\n"), fs.Arg(0))
+		return exitUsage
+	}
+	if *colors == "" {
+		fmt.Fprintln(stderr, tr("ansify: -colors is required"))
+		return exitUsage
+	}
+
+	data, err := os.ReadFile(*colors)
+	if err != nil {
+		fmt.Fprintf(stderr, "ansify: %v\n", err)
+		return exitDecode
+	}
+	var m colorMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		fmt.Fprintf(stderr, "ansify: %s: %v\n", *colors, err)
+		return exitDecode
+	}
+	img, err := m.image()
+	if err != nil {
+		fmt.Fprintf(stderr, "ansify: %s: %v\n", *colors, err)
+		return exitDecode
+	}
+
+	text, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "ansify: %v\n", err)
+		return exitDecode
+	}
+	// The header of -annotate has no cell in the map and is kept as it is
+	var header []byte
+	if bytes.HasPrefix(text, []byte(annotationPrefix)) {
+		end := bytes.IndexByte(text, '\n') + 1
+		header, text = text[:end], text[end:]
+	}
+	art, err := readArt(string(text), m.Width)
+	if err == nil && art.Height != m.Height {
+		err = fmt.Errorf("the art has %d lines and the color map %d", art.Height, m.Height)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "ansify: %v\n", err)
+		return exitDecode
+	}
+	if err := art.Paint(img, colorDepth(*depth), *quantize); err != nil {
+		fmt.Fprintf(stderr, "ansify: %v\n", err)
+		return exitUsage
+	}
+
+	if _, err := stdout.Write(append(header, art.ANSI()...)); err != nil {
+		fmt.Fprintf(stderr, "ansify: %v\n", err)
+		return exitWrite
+	}
+	return exitOK
+}
+
+// expandTabs undoes -txt-spaces tabs, turning every tab back into the spaces
+// up to the next tab stop, every eight columns.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := 8 - column%8
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		b.WriteRune(r)
+		column += imgascii.RuneWidth(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// writeSVG writes the art as an SVG image laid out on the cells of the png
+// export with face. Every character is placed in its own cell, so the
+// monospaced font the viewer picks lines up however wide it is. Cells
+// without a color of their own take the colors of th.
+func writeSVG(w io.Writer, art *imgascii.Art, face font.Face, th theme) error {
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+	metrics := face.Metrics()
+	advance, ok := face.GlyphAdvance('M')
+	if !ok {
+		advance = font.MeasureString(face, "M")
+	}
+	cellWidth := advance.Ceil() * art.Columns()
+	lineHeight := metrics.Height.Ceil()
+	width, height := art.Width*cellWidth, art.Height*lineHeight
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	fmt.Fprintf(b, "<rect width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", width, height, cssColor(th.background))
+	for y := 0; y < art.Height; y++ {
+		for x := 0; x < art.Width; x++ {
+			cell := art.At(x, y)
+			fill := cell.Fill
+			if cell.Color.A != 0 && cell.Attr&imgascii.Background != 0 {
+				fill = cell.Color
+			}
+			if fill.A != 0 {
+				fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n",
+					x*cellWidth, y*lineHeight, cellWidth, lineHeight, cssColor(fill))
+			}
+		}
+	}
+
+	fmt.Fprintf(b, "<g font-family=\"monospace\" font-size=\"%d\" fill=\"%s\">\n", (metrics.Ascent + metrics.Descent).Ceil(), cssColor(th.foreground))
+	for y := 0; y < art.Height; y++ {
+		// Runs of one color share a tspan, listing the place of each of
+		// their characters. Spaces draw nothing and are left out
+		var line, xs, text string
+		fill := ""
+		flush := func() {
+			if text == "" {
+				return
+			}
+			if fill != "" {
+				line += fmt.Sprintf("<tspan x=\"%s\" fill=\"%s\">%s</tspan>", xs, fill, text)
+			} else {
+				line += fmt.Sprintf("<tspan x=\"%s\">%s</tspan>", xs, text)
+			}
+			xs, text = "", ""
+		}
+		for x := 0; x < art.Width; x++ {
+			cell := art.At(x, y)
+			if cell.Rune == ' ' || cell.Rune == '\u3000' {
+				continue
+			}
+			color := ""
+			if cell.Color.A != 0 && cell.Attr&imgascii.Background == 0 {
+				color = cssColor(cell.Color)
+			}
+			if color != fill {
+				flush()
+				fill = color
+			}
+			if xs != "" {
+				xs += " "
+			}
+			xs += fmt.Sprint(x * cellWidth)
+			text += html.EscapeString(string(imgascii.SafeRune(cell.Rune)))
+		}
+		flush()
+		if line != "" {
+			fmt.Fprintf(b, "<text y=\"%d\">%s</text>\n", y*lineHeight+metrics.Ascent.Ceil(), line)
+		}
+	}
+	b.WriteString("</g>\n</svg>\n")
+	return b.Flush()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// termCaps is what the terminal on stdout can show, as found by
+// terminalCaps.
+type termCaps struct {
+	tty      bool   // stdout is a terminal
+	answered bool   // the terminal answered the queries
+	color    string // truecolor or 256 or 16
+	unicode  bool
+	sixel    bool
+	kitty    bool
+	cell     image.Point // size of a character cell in pixels, zero when unknown
+}
+
+// capsQueries asks for kitty graphics support, the cell size in pixels, the
+// current foreground color after setting a 24-bit one, and finally the
+// primary device attributes. Every terminal answers the last, so its reply
+// ends the wait without the timeout on terminals ignoring the others.
+const capsQueries = "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\" +
+	"\x1b[16t" +
+	"\x1b[38;2;1;2;3m\x1bP$qm\x1b\\\x1b[0m" +
+	"\x1b[c"
+
+// passthrough returns query as it is sent to the terminal, or false when it
+// can't reach the terminal and is better not sent. Terminal multiplexers
+// would answer some queries themselves and drop the rest, so the query is
+// wrapped in a DCS envelope they pass on to the terminal they run in.
+// Inside tmux every escape of the query is doubled, and tmux 3.3 and later
+// pass it on only with their allow-passthrough option on. GNU screen
+// passes on the query as it is, but ends the envelope at the first string
+// terminator, so queries holding one can't be sent through it.
+func passthrough(query string) (string, bool) {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return "\x1bPtmux;" + strings.ReplaceAll(query, "\x1b", "\x1b\x1b") + "\x1b\\", true
+	case os.Getenv("STY") != "":
+		if strings.Contains(query, "\x1b\\") {
+			return "", false
+		}
+		return "\x1bP" + query + "\x1b\\", true
+	}
+	return query, true
+}
+
+var (
+	deviceAttributes = regexp.MustCompile(`\x1b\[\?([0-9;]*)c`)
+	cellPixels       = regexp.MustCompile(`\x1b\[6;(\d+);(\d+)t`)
+	directColor      = regexp.MustCompile(`\x1bP1\$r[0-9;:]*38[:;]2[:;]+1[:;]2[:;]3`)
+)
+
+var (
+	capsOnce sync.Once
+	caps     termCaps
+)
+
+// terminalCaps returns the capabilities of the terminal, probed once. The
+// color depth and Unicode support come from the environment, and when
+// stdin and stdout are a terminal it is queried for the rest, waiting at
+// most 200ms for an answer. A terminal that turns out to keep 24-bit colors
+// counts as truecolor even if it doesn't announce it. With -deterministic
+// nothing is probed: the terminal has 16 colors and no Unicode.
+func terminalCaps() termCaps {
+	capsOnce.Do(func() {
+		caps = termCaps{color: "16"}
+		if deterministic {
+			return
+		}
+		caps.tty = term.IsTerminal(int(os.Stdout.Fd()))
+		caps.color = announcedDepth()
+		caps.unicode = unicodeLocale()
+		if caps.tty && term.IsTerminal(int(os.Stdin.Fd())) {
+			caps.query()
+		}
+	})
+	return caps
+}
+
+// announcedDepth returns the color depth the terminal announces in the
+// environment, 16 when it announces none.
+func announcedDepth() string {
+	switch {
+	case os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit" || os.Getenv("WT_SESSION") != "":
+		return "truecolor"
+	case strings.Contains(os.Getenv("TERM"), "256color"):
+		return "256"
+	}
+	return "16"
+}
+
+// unicodeLocale reports whether the locale, or Windows Terminal, expects
+// UTF-8 output.
+func unicodeLocale() bool {
+	if os.Getenv("WT_SESSION") != "" {
+		return true
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return false
+}
+
+// query sends capsQueries and reads what the replies tell.
+func (c *termCaps) query() {
+	queries, ok := passthrough(capsQueries)
+	if !ok {
+		return
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	fmt.Fprint(os.Stdout, queries)
+	r, ok := readReply(200*time.Millisecond, 1024, func(buf []byte) bool {
+		return buf[len(buf)-1] == 'c' && deviceAttributes.Match(buf)
+	})
+	if !ok {
+		return
+	}
+	c.answered = true
+	if m := deviceAttributes.FindStringSubmatch(r); m != nil {
+		for _, attr := range strings.Split(m[1], ";") {
+			c.sixel = c.sixel || attr == "4"
+		}
+	}
+	c.kitty = strings.Contains(r, "\x1b_Gi=31;OK")
+	if m := cellPixels.FindStringSubmatch(r); m != nil {
+		var height, width int
+		fmt.Sscan(m[1], &height)
+		fmt.Sscan(m[2], &width)
+		c.cell = image.Pt(width, height)
+	}
+	if directColor.MatchString(r) {
+		c.color = "truecolor"
+	}
+}
+
+// runCaps prints what terminalCaps finds out about the terminal, to see
+// what -color auto and -mode auto will pick.
+func runCaps(args []string) int {
+	fs := flag.NewFlagSet("caps", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii caps")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+
+	c := terminalCaps()
+	yes := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	cell := "unknown"
+	if c.cell.X > 0 && c.cell.Y > 0 {
+		cell = fmt.Sprintf("%dx%d", c.cell.X, c.cell.Y)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "terminal\t%s\n", yes(c.tty))
+	fmt.Fprintf(tw, "answered queries\t%s\n", yes(c.answered))
+	fmt.Fprintf(tw, "colors\t%s\n", c.color)
+	fmt.Fprintf(tw, "unicode\t%s\n", yes(c.unicode))
+	fmt.Fprintf(tw, "sixel\t%s\n", yes(c.sixel))
+	fmt.Fprintf(tw, "kitty graphics\t%s\n", yes(c.kitty))
+	fmt.Fprintf(tw, "cell pixels\t%s\n", cell)
+	fmt.Fprintf(tw, "-color auto\t%s\n", colorDepth("auto"))
+	fmt.Fprintf(tw, "-mode auto\t%s\n", autoMode())
+	tw.Flush()
+	return exitOK
+}
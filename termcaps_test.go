@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestPassthrough(t *testing.T) {
+	tests := []struct {
+		tmux, sty string
+		query     string
+		want      string
+		ok        bool
+	}{
+		{"", "", "\x1b]11;?\x07", "\x1b]11;?\x07", true},
+		{"/tmp/tmux-1000/default,1234,0", "", "\x1b]11;?\x07", "\x1bPtmux;\x1b\x1b]11;?\x07\x1b\\", true},
+		{"/tmp/tmux-1000/default,1234,0", "", "\x1bP$qm\x1b\\\x1b[c", "\x1bPtmux;\x1b\x1bP$qm\x1b\x1b\\\x1b\x1b[c\x1b\\", true},
+		{"", "1234.pts-0.host", "\x1b]11;?\x07", "\x1bP\x1b]11;?\x07\x1b\\", true},
+		{"", "1234.pts-0.host", "\x1b[c", "\x1bP\x1b[c\x1b\\", true},
+		{"", "1234.pts-0.host", "\x1bP$qm\x1b\\\x1b[c", "", false},
+		{"/tmp/tmux-1000/default,1234,0", "1234.pts-0.host", "\x1b[c", "\x1bPtmux;\x1b\x1b[c\x1b\\", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TMUX", tt.tmux)
+		t.Setenv("STY", tt.sty)
+		got, ok := passthrough(tt.query)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("TMUX=%q STY=%q: passthrough(%q) = %q, %v, want %q, %v", tt.tmux, tt.sty, tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// enableVirtualTerminal does nothing where terminals always interpret
+// escape sequences.
+func enableVirtualTerminal() bool {
+	return true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// pageValue is a flag value holding the size of a printed page in columns
+// by lines, written as 80x66 or 80×66.
+type pageValue struct {
+	cols, lines int
+}
+
+func (p *pageValue) String() string {
+	if p.cols == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", p.cols, p.lines)
+}
+
+func (p *pageValue) Set(value string) error {
+	cols, lines, found := strings.Cut(strings.ReplaceAll(value, "×", "x"), "x")
+	var page pageValue
+	_, err := fmt.Sscan(cols, &page.cols)
+	if err == nil && found {
+		_, err = fmt.Sscan(lines, &page.lines)
+	}
+	// A page holds its header line and at least one line of art
+	if err != nil || !found || page.cols < 1 || page.lines < 2 {
+		return fmt.Errorf("invalid page size %q: expected colsxlines with at least 2 lines", value)
+	}
+	*p = page
+	return nil
+}
+
+// tileArts splits every art into pages of page.cols columns by page.lines
+// lines, each headed by a line naming its row and column so a printed
+// poster can be laid out again. The pages replace the art they came from,
+// row by row, and their file name suffixes add the row and column to its
+// suffix.
+func tileArts(arts []*imgascii.Art, suffixes []string, page pageValue) ([]*imgascii.Art, []string) {
+	var tiles []*imgascii.Art
+	var tileSuffixes []string
+	for n, art := range arts {
+		// Double width art fits half as many cells on a page
+		width, height := max(1, page.cols/art.Columns()), page.lines-1
+		cols, rows := (art.Width+width-1)/width, (art.Height+height-1)/height
+		digits := func(n int) int { return len(fmt.Sprint(n)) }
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				header := fmt.Sprintf(tr("row %d of %d, column %d of %d"), row+1, rows, col+1, cols)
+				// Pages too narrow for the header would otherwise all
+				// read the same once it is cut short
+				if len([]rune(header)) > min(width, art.Width-col*width) {
+					header = fmt.Sprintf("r%dc%d", row+1, col+1)
+				}
+				tiles = append(tiles, tileOf(art, col*width, row*height, width, height, header))
+				tileSuffixes = append(tileSuffixes, fmt.Sprintf("%s-%0*d-%0*d", suffixes[n], digits(rows), row+1, digits(cols), col+1))
+			}
+		}
+	}
+	return tiles, tileSuffixes
+}
+
+// tileOf copies the part of art at x,y that fits width by height cells
+// below a header line, cutting the header short if the part is narrower.
+func tileOf(art *imgascii.Art, x, y, width, height int, header string) *imgascii.Art {
+	width, height = min(width, art.Width-x), min(height, art.Height-y)
+	tile := &imgascii.Art{Width: width, Height: height + 1, Cells: make([]imgascii.Cell, width*(height+1))}
+	for i := range tile.Cells[:width] {
+		tile.Cells[i].Rune = ' '
+	}
+	for i, r := range []rune(header) {
+		if i < width {
+			tile.Cells[i].Rune = r
+		}
+	}
+	for row := 0; row < height; row++ {
+		copy(tile.Cells[(row+1)*width:], art.Cells[(y+row)*art.Width+x:][:width])
+	}
+	return tile
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// tuneKeys documents the key bindings on the status line. Lower case keys
+// decrease a value and upper case keys increase it.
+const tuneKeys = "b/B brightness  c/C contrast  g/G gamma  w/W width  s charset  q done"
+
+// tunedFlags are the flags the tune keys change, which are printed from the
+// tuned values rather than passed through.
+var tunedFlags = map[string]bool{
+	"i": true, "w": true, "brightness": true, "contrast": true, "gamma": true, "charset": true,
+}
+
+// tuner is the state of the tune mode.
+type tuner struct {
+	converter *imgascii.Converter
+	bounds    image.Rectangle
+	opts      imgascii.Options
+	charset   string
+}
+
+func runTune(args []string) int {
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	imagePath := fs.String("i", "", "Path to the image file")
+	width := fs.Int("w", 64, "Starting width, the height follows the image aspect")
+	optionFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-img-ascii tune -i image [options]")
+		fmt.Fprintln(os.Stderr, "Keys: "+tuneKeys)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if *imagePath == "" {
+		fmt.Fprintln(os.Stderr, tr("No image provided. Quitting."))
+		return exitUsage
+	}
+
+	opts, err := optionFlags.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	img, err := imgascii.DecodeFileWith(*imagePath, optionFlags.decodeOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDecode
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, tr("Tune mode needs a terminal. Quitting."))
+		return exitFailure
+	}
+
+	t := &tuner{
+		converter: imgascii.NewConverter(img),
+		bounds:    imgascii.TurnedBounds(img.Bounds(), opts.Orient),
+		opts:      opts,
+		charset:   fs.Lookup("charset").Value.String(),
+	}
+	t.resize(*width)
+	if err := t.run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	// The flags that reproduce the result go to stdout on their own line so
+	// they can be copied into a script
+	fmt.Println(t.command(*imagePath, fs, optionFlags))
+	return exitOK
+}
+
+func (t *tuner) run() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		out.Flush()
+		term.Restore(int(os.Stdin.Fd()), state)
+	}()
+	// Ctrl-C is a key in raw mode, but SIGTERM still ends the tool
+	defer onInterrupt(func() {
+		os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		term.Restore(int(os.Stdin.Fd()), state)
+	})()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		if err := t.draw(out); err != nil {
+			return err
+		}
+
+		key, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		if !t.handle(key) {
+			return nil
+		}
+	}
+}
+
+// handle applies a key press and reports whether tuning should go on.
+func (t *tuner) handle(key string) bool {
+	switch key {
+	case "q", "esc", "\x03", "\r":
+		return false
+	case "b":
+		t.opts.Brightness = max(t.opts.Brightness-0.05, -1)
+	case "B":
+		t.opts.Brightness = min(t.opts.Brightness+0.05, 1)
+	case "c":
+		t.opts.Contrast = max(t.opts.Contrast-0.1, 0)
+	case "C":
+		t.opts.Contrast += 0.1
+	case "g":
+		t.opts.Gamma = max(t.opts.Gamma-0.1, 0.1)
+	case "G":
+		t.opts.Gamma += 0.1
+	case "w":
+		t.resize(t.opts.Width - 4)
+	case "W":
+		t.resize(t.opts.Width + 4)
+	case "s":
+		t.charset = cycle([]string{"standard", "blocks", "detailed"}, t.charset)
+		t.opts.Charset = imgascii.Charsets[t.charset]
+	}
+	return true
+}
+
+// resize sets the width, keeping the height to the image aspect with cells
+// twice as tall as they are wide.
+func (t *tuner) resize(width int) {
+	t.opts.Width = max(4, width)
+	t.opts.Height = max(1, t.opts.Width*t.bounds.Dy()/t.bounds.Dx()/2)
+}
+
+func (t *tuner) draw(out *bufio.Writer) error {
+	art, err := t.converter.Convert(t.opts)
+	if err != nil {
+		return err
+	}
+
+	cols, rows := terminalSize()
+	out.WriteString("\x1b[H\x1b[2J")
+	out.WriteString(strings.ReplaceAll(strings.TrimSuffix(art, "\n"), "\n", "\r\n"))
+	status := fmt.Sprintf("%dx%d  brightness %.2f  contrast %.1f  gamma %.1f  %s  %s",
+		t.opts.Width, t.opts.Height, t.opts.Brightness, t.opts.Contrast, t.opts.Gamma, t.charset, tuneKeys)
+	fmt.Fprintf(out, "\x1b[%d;1H\x1b[0m\x1b[7m%s\x1b[0m", rows, truncate(status, cols))
+	return out.Flush()
+}
+
+// command returns the command line that reproduces the tuned conversion:
+// the tuned values followed by every other flag that was given.
+func (t *tuner) command(imagePath string, fs *flag.FlagSet, optionFlags *optionFlags) string {
+	args := []string{"go-img-ascii", "-i", shellQuote(imagePath),
+		"-w", strconv.Itoa(t.opts.Width), "-h", strconv.Itoa(t.opts.Height)}
+	if t.opts.Brightness != 0 {
+		args = append(args, "-brightness", strconv.FormatFloat(t.opts.Brightness, 'f', 2, 64))
+	}
+	if t.opts.Contrast != 1 {
+		args = append(args, "-contrast", strconv.FormatFloat(t.opts.Contrast, 'f', 1, 64))
+	}
+	if t.opts.Gamma != 1 {
+		args = append(args, "-gamma", strconv.FormatFloat(t.opts.Gamma, 'f', 1, 64))
+	}
+	if t.charset != "standard" {
+		args = append(args, "-charset", shellQuote(t.charset))
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case tunedFlags[f.Name]:
+		case f.Name == "text":
+			for _, o := range optionFlags.overlays {
+				args = append(args, "-text", shellQuote(o.String()))
+			}
+		default:
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				if f.Value.String() == "true" {
+					args = append(args, "-"+f.Name)
+				} else {
+					args = append(args, "-"+f.Name+"=false")
+				}
+			} else {
+				args = append(args, "-"+f.Name, shellQuote(f.Value.String()))
+			}
+		}
+	})
+
+	return strings.Join(args, " ")
+}
+
+// shellQuote single quotes s unless it is safe to pass to a shell as is.
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, r := range s {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./,:=#+", r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// umask returns no mask where there is no umask.
+func umask() fs.FileMode {
+	return 0
+}
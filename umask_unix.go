@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// umask returns the file mode creation mask of the process. Reading it
+// means setting it, so it is read once and put back at once.
+var umask = sync.OnceValue(func() fs.FileMode {
+	mask := unix.Umask(0o022)
+	unix.Umask(mask)
+	return fs.FileMode(mask)
+})
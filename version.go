@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// printVersion writes what -version reports: the version of the tool, the
+// commit it was built from and the Go release and platform it was built
+// with, then every optional feature and whether this binary has it, a name
+// and a value per line, for bug reports and for scripts to check.
+func printVersion(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "version\t%s\n", toolVersion())
+	commit, built, modified := "unknown", "unknown", false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.time":
+				built = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+	}
+	if modified {
+		commit += " (modified)"
+	}
+	fmt.Fprintf(tw, "commit\t%s\n", commit)
+	fmt.Fprintf(tw, "commit time\t%s\n", built)
+	fmt.Fprintf(tw, "go\t%s\n", runtime.Version())
+	fmt.Fprintf(tw, "platform\t%s/%s\n", runtime.GOOS, runtime.GOARCH)
+
+	// WebP is always decoded, but scripts shouldn't have to know that
+	features := imgascii.Features()
+	fmt.Fprintln(tw, "webp\tyes")
+	for _, tag := range []string{"heic", "avif", "faces"} {
+		if features[tag] {
+			fmt.Fprintf(tw, "%s\tyes\n", tag)
+		} else {
+			fmt.Fprintf(tw, "%s\tno, build with -tags %s\n", tag, tag)
+		}
+	}
+	if cameraSupported {
+		fmt.Fprintln(tw, "camera\tyes")
+	} else {
+		fmt.Fprintln(tw, "camera\tno, Linux only")
+	}
+	tw.Flush()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"image"
+	"math"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/m-spangenberg/go-img-ascii/imgascii"
+)
+
+// terminalSize returns the size of the terminal on stdout, or 80x24 when
+// stdout is not a terminal or the output is deterministic.
+func terminalSize() (int, int) {
+	if deterministic {
+		return 80, 24
+	}
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		return w, h
+	}
+	return 80, 24
+}
+
+// runWallpaper fills the terminal with colored blocks from img. With pan set
+// it keeps slowly zooming and panning across the image, Ken Burns style,
+// until interrupted.
+func runWallpaper(img image.Image, opts imgascii.Options, pan bool, fps float64) error {
+	cols, rows := terminalSize()
+	opts.Width, opts.Height = cols, rows
+
+	out := bufio.NewWriter(os.Stdout)
+	if !pan {
+		art, err := imgascii.Convert(img, opts)
+		if err != nil {
+			return err
+		}
+		out.WriteString(art)
+		return out.Flush()
+	}
+
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return runWallpaper(img, opts, false, fps)
+	}
+
+	ctx, done := watchInterrupts()
+	defer done()
+
+	out.WriteString("\x1b[?25l\x1b[2J")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[2J\x1b[H")
+		out.Flush()
+	}()
+
+	// The largest window with the terminal's aspect, cells being twice as
+	// tall as they are wide
+	bounds := img.Bounds()
+	aspect := float64(cols) / float64(rows*2)
+	baseW, baseH := float64(bounds.Dx()), float64(bounds.Dy())
+	if baseW/baseH > aspect {
+		baseW = baseH * aspect
+	} else {
+		baseH = baseW / aspect
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / fps))
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		// Zoom between 100% and 75% while drifting on slow, unrelated cycles
+		t := time.Since(start).Seconds()
+		zoom := 0.875 + 0.125*math.Cos(2*math.Pi*t/40)
+		w, h := baseW*zoom, baseH*zoom
+		cx := float64(bounds.Min.X) + w/2 + (float64(bounds.Dx())-w)*(0.5+0.5*math.Sin(2*math.Pi*t/60))
+		cy := float64(bounds.Min.Y) + h/2 + (float64(bounds.Dy())-h)*(0.5+0.5*math.Sin(2*math.Pi*t/47))
+		window := image.Rect(int(cx-w/2), int(cy-h/2), int(cx+w/2), int(cy+h/2)).Intersect(bounds)
+
+		art, err := imgascii.Convert(sub.SubImage(window), opts)
+		if err != nil {
+			return err
+		}
+		out.WriteString("\x1b[H")
+		out.WriteString(art[:len(art)-1])
+		if err := out.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
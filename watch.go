@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// rendered is the result of one render started by runWatch.
+type rendered struct {
+	seq int
+	art string
+	err error
+}
+
+// runWatch renders once and then again whenever the file at path changes,
+// redrawing the terminal each time. When resize is set it also redraws when
+// the terminal is resized. Failed renders, such as an editor's half-written
+// save, are reported on stderr and watching continues.
+//
+// Renders run beside the event loop, at most lim.jobs at a time with the rest
+// queued, and a render finishing after a newer one is dropped. With lim.idle
+// set watching stops once nothing has changed for that long.
+func runWatch(path string, resize bool, lim limits, render func() (string, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Editors often save by renaming a new file over the old one, so the
+	// directory is watched and events are filtered by name
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+	name := filepath.Clean(path)
+
+	winch := make(chan os.Signal, 1)
+	if resize {
+		notifyResize(winch)
+	}
+	ctx, done := watchInterrupts()
+	defer done()
+
+	jobs := make(chan struct{}, max(1, lim.jobs))
+	results := make(chan rendered)
+	started, shown := 0, 0
+	draw := func() {
+		started++
+		seq := started
+		go func() {
+			jobs <- struct{}{}
+			art, err := render()
+			<-jobs
+			results <- rendered{seq, art, err}
+		}()
+	}
+	draw()
+
+	var idle <-chan time.Time
+	resetIdle := func() {
+		if lim.idle > 0 {
+			idle = time.After(lim.idle)
+		}
+	}
+	resetIdle()
+
+	// Saves usually arrive as bursts of events, redraw once they settle
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == name && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(100 * time.Millisecond)
+				resetIdle()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, err)
+		case r := <-results:
+			switch {
+			case r.seq < shown:
+			case r.err != nil:
+				fmt.Fprintln(os.Stderr, r.err)
+			default:
+				shown = r.seq
+				fmt.Print("\x1b[H\x1b[2J" + r.art)
+			}
+		case <-debounce:
+			draw()
+		case <-winch:
+			draw()
+			resetIdle()
+		case <-idle:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}